@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/backup"
+	"github.com/iyhunko/go-htmx-mongo/internal/db"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// backupServiceFor builds the backup service on a connected database
+func backupServiceFor(mongodb *db.MongoDB, cfg *config.Config) *service.BackupService {
+	return service.NewBackupService(
+		repository.NewMongoBackupRepository(mongodb.DB, mongodb.Transactions),
+		mongodb.DB.Name(),
+		validation.LimitsFromConfig(cfg),
+	)
+}
+
+// runBackup writes a backup archive of the configured database to a file or stdout and prints its manifest as JSON
+func runBackup(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", `output file, or "-" for stdout (default a file named after the backup time)`)
+	_ = flags.Parse(args)
+
+	mongodb, cfg, cleanup, err := dial(ctx, db.Open)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	path := *out
+	if path == "" {
+		path = backup.FileName(time.Now())
+	}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	manifest, err := backupServiceFor(mongodb, cfg).Backup(ctx, w)
+	if err != nil {
+		if path != "-" {
+			os.Remove(path)
+		}
+		return err
+	}
+
+	slog.Info("Backup written", "path", path)
+	if path == "-" {
+		return nil
+	}
+	return printJSON(manifest)
+}
+
+// runVerify checks a backup archive without a database and prints its manifest as JSON
+func runVerify(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin verify file\n\nChecks the archive's checksums and that every document is valid under the configured limits.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.Load()
+	manifest, err := verifyArchive(flags.Arg(0), service.NewBackupService(nil, "", validation.LimitsFromConfig(cfg)))
+	if err != nil {
+		return err
+	}
+	return printJSON(manifest)
+}
+
+// runRestore restores a backup archive into the configured database, or another one, and prints its manifest as JSON
+func runRestore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	database := flags.String("database", "", "restore into this database instead of the configured one")
+	drop := flags.Bool("drop", false, "drop the backed up collections of the target database first; without it, they must be empty")
+	batchSize := flags.Int("batch-size", service.DefaultRestoreBatchSize, "number of documents per insert")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin restore [flags] file\n\nThe archive is verified before anything is written, and the target database is migrated afterwards.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+
+	mongodb, cfg, cleanup, err := dial(ctx, func(ctx context.Context, uri, dbName string) (*db.MongoDB, error) {
+		if *database != "" {
+			dbName = *database
+		}
+		return db.Open(ctx, uri, dbName)
+	})
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	backupService := backupServiceFor(mongodb, cfg)
+	// Verifying first keeps a damaged archive or an invalid document from leaving a partial restore behind
+	if _, err := verifyArchive(path, backupService); err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	manifest, err := backupService.Restore(ctx, file, service.RestoreOptions{Drop: *drop, BatchSize: *batchSize})
+	if err != nil {
+		return err
+	}
+	if err := db.Migrate(ctx, mongodb.DB); err != nil {
+		return fmt.Errorf("failed to migrate the restored database: %w", err)
+	}
+
+	slog.Info("Backup restored", "database", mongodb.DB.Name(), "from", manifest.Database, "createdAt", manifest.CreatedAt)
+	return printJSON(manifest)
+}
+
+// verifyArchive checks the archive at path with backupService
+func verifyArchive(path string, backupService *service.BackupService) (*backup.Manifest, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer file.Close()
+
+	manifest, err := backupService.Verify(file)
+	if err != nil {
+		return nil, fmt.Errorf("backup %s is not valid: %w", path, err)
+	}
+	return manifest, nil
+}
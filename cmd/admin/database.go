@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/db"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// runMigrate creates the collections and indexes the application needs, as the server does on startup
+func runMigrate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	mongodb, _, cleanup, err := dial(ctx, db.Open)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	return db.Migrate(ctx, mongodb.DB)
+}
+
+// runIndexes drops and creates again every index of the application's collections
+func runIndexes(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("indexes", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin indexes\n\nSearches fail and queries slow down until the indexes are rebuilt.")
+	}
+	_ = flags.Parse(args)
+
+	mongodb, _, cleanup, err := dial(ctx, db.Open)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := db.RebuildIndexes(ctx, mongodb.DB); err != nil {
+		return err
+	}
+	slog.Info("Indexes rebuilt")
+	return nil
+}
+
+// runReindex sets the search languages of posts stored with missing or outdated ones, e.g. by other tools,
+// and rebuilds the text index
+func runReindex(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	mongodb, cfg, cleanup, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	updated, err := postServiceFor(mongodb, cfg).ReindexSearch(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Search languages refreshed", "updated", updated)
+
+	if err := db.RebuildTextIndex(ctx, mongodb.DB); err != nil {
+		return err
+	}
+	slog.Info("Text index rebuilt")
+	return nil
+}
+
+// runPing connects to the configured database without migrating it and prints the server's details
+func runPing(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("ping", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	mongodb, cfg, cleanup, err := dial(ctx, db.Open)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	start := time.Now()
+	if err := mongodb.HealthCheck(ctx); err != nil {
+		return err
+	}
+	latency := time.Since(start)
+
+	var buildInfo struct {
+		Version string `bson:"version"`
+	}
+	if err := mongodb.Client.Database("admin").RunCommand(ctx, bson.D{{Key: "buildInfo", Value: 1}}).Decode(&buildInfo); err != nil {
+		return fmt.Errorf("failed to read server version: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Host\t%s:%s\n", cfg.MongoDBHost, cfg.MongoDBPort)
+	fmt.Fprintf(w, "Database\t%s\n", cfg.MongoDBDatabase)
+	fmt.Fprintf(w, "Version\t%s\n", buildInfo.Version)
+	fmt.Fprintf(w, "Transactions\t%t\n", mongodb.Transactions)
+	fmt.Fprintf(w, "Latency\t%s\n", latency.Round(time.Microsecond))
+	return w.Flush()
+}
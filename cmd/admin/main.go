@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/db"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"github.com/iyhunko/go-htmx-mongo/internal/transfer"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+const usage = `Usage: admin <command> [flags]
+
+Commands:
+  posts     List, show, create and delete posts
+  export    Export posts as JSON Lines or CSV
+  import    Import posts from a JSON Lines or CSV file
+  audit     Export the audit log as JSON Lines
+  users     List and create users, change their roles and passwords
+  seed      Generate fake posts or load a fixture set
+  backup    Write a backup archive of posts, the audit log, webhooks and users
+  verify    Check a backup archive
+  restore   Restore a backup archive, optionally into another database
+  migrate   Create missing collections and indexes
+  indexes   Drop and rebuild the indexes of every collection
+  reindex   Refresh the search languages of posts and rebuild the text index
+  ping      Check the connection to MongoDB
+
+Run "admin <command> -h" for command flags.
+Commands work on the tenant named by TENANT, or the default tenant.
+`
+
+func main() {
+	initLogger()
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Changes made by the CLI are attributed to it in the audit log. Whoever can run it
+	// can reach the database, so it may do everything.
+	ctx = service.WithActor(ctx, service.Actor{ID: CLIActor, Role: model.RoleAdmin})
+
+	ctx, err := withTenant(ctx, config.Load())
+	if err != nil {
+		slog.Error("Failed to select tenant", "error", err)
+		os.Exit(1)
+	}
+
+	switch os.Args[1] {
+	case "posts":
+		err = runPosts(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "audit":
+		err = runAudit(ctx, os.Args[2:])
+	case "users":
+		err = runUsers(ctx, os.Args[2:])
+	case "seed":
+		err = runSeed(ctx, os.Args[2:])
+	case "backup":
+		err = runBackup(ctx, os.Args[2:])
+	case "verify":
+		err = runVerify(ctx, os.Args[2:])
+	case "restore":
+		err = runRestore(ctx, os.Args[2:])
+	case "migrate":
+		err = runMigrate(ctx, os.Args[2:])
+	case "indexes":
+		err = runIndexes(ctx, os.Args[2:])
+	case "reindex":
+		err = runReindex(ctx, os.Args[2:])
+	case "ping":
+		err = runPing(ctx, os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		slog.Error("Command failed", "command", os.Args[1], "error", err)
+		os.Exit(1)
+	}
+}
+
+// initLogger initializes the structured logger.
+// Logs go to stderr so that stdout can carry exported data.
+func initLogger() {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+}
+
+// withTenant returns ctx carrying the configured tenant, which commands read and change the posts of
+func withTenant(ctx context.Context, cfg *config.Config) (context.Context, error) {
+	registry, err := tenant.LoadFile(cfg.TenantsFile)
+	if err != nil {
+		return nil, err
+	}
+	selected, err := registry.Lookup(cfg.Tenant)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.WithTenant(ctx, selected), nil
+}
+
+// CLIActor is the actor changes made by this command are recorded as in the audit log
+const CLIActor = "cli"
+
+// connect connects to the configured database, migrating it, and returns it with the configuration and a cleanup function
+func connect(ctx context.Context) (*db.MongoDB, *config.Config, func(), error) {
+	return dial(ctx, db.Connect)
+}
+
+// dial connects to the configured database with open and returns it with the configuration and a cleanup function
+func dial(ctx context.Context, open func(ctx context.Context, uri, dbName string) (*db.MongoDB, error)) (*db.MongoDB, *config.Config, func(), error) {
+	cfg := config.Load()
+
+	connectCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	mongodb, err := open(connectCtx, cfg.GetMongoURI(), cfg.MongoDBDatabase)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	cleanup := func() {
+		if err := mongodb.Disconnect(context.Background()); err != nil {
+			slog.Error("Error disconnecting from MongoDB", "error", err)
+		}
+	}
+	return mongodb, cfg, cleanup, nil
+}
+
+// newPostService connects to the configured database and builds the post service
+func newPostService(ctx context.Context) (*service.PostService, func(), error) {
+	mongodb, cfg, cleanup, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return postServiceFor(mongodb, cfg), cleanup, nil
+}
+
+// postServiceFor builds the post service on a connected database
+func postServiceFor(mongodb *db.MongoDB, cfg *config.Config) *service.PostService {
+	postRepo := repository.NewMongoPostRepository(mongodb.DB)
+	auditRepo := repository.NewMongoAuditRepository(mongodb.DB)
+	// Events are only written to the outbox here; the server's relay passes them on
+	var transactor repository.Transactor
+	if mongodb.Transactions {
+		transactor = repository.NewMongoTransactor(mongodb.Client)
+	}
+	return service.NewPostService(postRepo,
+		service.WithValidator(validation.FromConfig(cfg)),
+		service.WithAuditLog(auditRepo),
+		service.WithOutbox(repository.NewMongoOutboxRepository(mongodb.DB), transactor),
+	)
+}
+
+// runExport writes posts to a file or stdout
+func runExport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := flags.String("format", "jsonl", "output format: jsonl or csv")
+	search := flags.String("search", "", "export only posts matching this search query")
+	out := flags.String("out", "", "output file (default stdout)")
+	_ = flags.Parse(args)
+
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	count, err := postService.ExportPosts(ctx, w, format, *search)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Posts exported", "count", count, "format", format)
+	return nil
+}
+
+// runImport reads posts from a file or stdin and prints the import report as JSON
+func runImport(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	formatName := flags.String("format", "jsonl", "input format: jsonl or csv")
+	dryRun := flags.Bool("dry-run", false, "validate records without writing them")
+	batchSize := flags.Int("batch-size", service.DefaultImportBatchSize, "number of posts per bulk write")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin import [flags] [file]\n\nReads from stdin when no file is given.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	format, err := transfer.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer file.Close()
+		r = file
+	}
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	report, err := postService.ImportPosts(ctx, r, format, service.ImportOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+	if report != nil {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if encodeErr := encoder.Encode(report); encodeErr != nil {
+			return encodeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d records were rejected", len(report.Errors), report.Processed)
+	}
+
+	return nil
+}
+
+// runAudit writes the audit log, or the entries matching the filter flags, to a file or stdout as JSON Lines
+func runAudit(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("audit", flag.ExitOnError)
+	action := flags.String("action", "", "export only entries of this action: create, update, delete or import")
+	postID := flags.String("post", "", "export only entries of the post with this ID")
+	actor := flags.String("actor", "", "export only entries of this actor")
+	since := flags.String("since", "", "export only entries recorded on or after this date (YYYY-MM-DD)")
+	until := flags.String("until", "", "export only entries recorded before this date (YYYY-MM-DD)")
+	out := flags.String("out", "", "output file (default stdout)")
+	_ = flags.Parse(args)
+
+	query := service.AuditQuery{Action: *action, PostID: *postID, Actor: *actor}
+	for _, date := range []struct {
+		value  string
+		target *time.Time
+	}{{*since, &query.From}, {*until, &query.To}} {
+		if date.value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", date.value)
+		if err != nil {
+			return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", date.value)
+		}
+		*date.target = parsed
+	}
+	if err := query.Validate(); err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	mongodb, _, cleanup, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	auditService := service.NewAuditService(repository.NewMongoAuditRepository(mongodb.DB))
+	count, err := auditService.ExportEntries(ctx, w, query)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Audit log exported", "count", count)
+	return nil
+}
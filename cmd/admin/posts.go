@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+const postsUsage = `Usage: admin posts <command> [flags]
+
+Commands:
+  list      List posts, newest first
+  show      Print a post as JSON
+  create    Create a post
+  delete    Delete a post
+
+Run "admin posts <command> -h" for command flags.
+`
+
+// runPosts runs a posts subcommand
+func runPosts(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, postsUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		return runPostsList(ctx, args[1:])
+	case "show":
+		return runPostsShow(ctx, args[1:])
+	case "create":
+		return runPostsCreate(ctx, args[1:])
+	case "delete":
+		return runPostsDelete(ctx, args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, postsUsage)
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "unknown posts command %q\n\n%s", args[0], postsUsage)
+		os.Exit(2)
+		return nil
+	}
+}
+
+// runPostsList prints a page of posts as a table, or as JSON Lines with -json
+func runPostsList(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts list", flag.ExitOnError)
+	search := flags.String("search", "", "list only posts matching this search query")
+	status := flags.String("status", "", "list only posts with this status: draft, published or archived")
+	tags := flags.String("tags", "", "list only posts with one of these comma separated tags")
+	page := flags.Int("page", 1, "page number")
+	limit := flags.Int("limit", 20, "posts per page, up to 100")
+	asJSON := flags.Bool("json", false, "print posts as JSON Lines")
+	_ = flags.Parse(args)
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	query := service.ListQuery{
+		Search:     *search,
+		Status:     model.PostStatus(*status),
+		Sort:       repository.SortByCreated,
+		Descending: true,
+		Page:       *page,
+		PageSize:   *limit,
+	}
+	if *tags != "" {
+		query.Tags = strings.Split(*tags, ",")
+	}
+	posts, pagination, err := postService.ListPosts(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		for _, post := range posts {
+			if err := encoder.Encode(post); err != nil {
+				return err
+			}
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tCREATED\tTITLE")
+		for _, post := range posts {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", post.ID.Hex(), post.EffectiveStatus(), post.CreatedAt.Format("2006-01-02 15:04"), post.Title)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Posts listed", "page", pagination.Page, "pages", pagination.TotalPages, "total", pagination.TotalItems)
+	return nil
+}
+
+// runPostsShow prints the post with the given ID as JSON
+func runPostsShow(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts show", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin posts show <id>")
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	post, err := postService.GetPost(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printJSON(post)
+}
+
+// runPostsCreate creates a post, validated like posts created in the UI, and prints it as JSON
+func runPostsCreate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts create", flag.ExitOnError)
+	title := flags.String("title", "", "post title")
+	content := flags.String("content", "", "post content; - reads it from stdin")
+	tags := flags.String("tags", "", "comma separated tags")
+	language := flags.String("language", "", "language of the title and content (default en)")
+	_ = flags.Parse(args)
+
+	input := service.PostInput{Title: *title, Content: *content, Language: *language}
+	if *tags != "" {
+		input.Tags = strings.Split(*tags, ",")
+	}
+	if *content == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+		input.Content = string(data)
+	}
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	post, err := postService.CreatePost(ctx, input)
+	if err != nil {
+		return err
+	}
+	slog.Info("Post created", "id", post.ID.Hex())
+	return printJSON(post)
+}
+
+// runPostsDelete deletes the posts with the given IDs
+func runPostsDelete(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("posts delete", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin posts delete <id>...")
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	postService, cleanup, err := newPostService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	for _, id := range flags.Args() {
+		if err := postService.DeletePost(ctx, id); err != nil {
+			return fmt.Errorf("failed to delete post %s: %w", id, err)
+		}
+		slog.Info("Post deleted", "id", id)
+	}
+	return nil
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
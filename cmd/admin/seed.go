@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/seed"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
+)
+
+// runSeed generates fake posts, or loads a fixture set, and prints the import report as JSON
+func runSeed(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	count := flags.Int("count", 100, "number of posts to generate")
+	seedValue := flags.Int64("seed", 1, "seed of the generator; the same seed generates the same posts on the same day")
+	days := flags.Int("days", 365, "number of days before today the creation times are spread over")
+	fixture := flags.String("fixture", "", "load this fixture set instead of generating posts: "+strings.Join(seed.FixtureNames(), ", "))
+	dryRun := flags.Bool("dry-run", false, "validate posts without writing them")
+	batchSize := flags.Int("batch-size", service.DefaultImportBatchSize, "number of posts per bulk write")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin seed [flags]\n\nPosts are written with IDs, so seeding again with the same flags updates them instead of adding duplicates.")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	mongodb, cfg, cleanup, err := connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	var posts []*model.Post
+	if *fixture != "" {
+		if posts, err = seed.Fixture(*fixture); err != nil {
+			return err
+		}
+	} else {
+		posts = seed.Generate(seed.Options{
+			Count:  *count,
+			Seed:   *seedValue,
+			Limits: validation.LimitsFromConfig(cfg),
+			Span:   time.Duration(max(*days, 1)) * 24 * time.Hour,
+		})
+	}
+
+	postService := postServiceFor(mongodb, cfg)
+	report, err := postService.LoadPosts(ctx, posts, service.ImportOptions{
+		DryRun:    *dryRun,
+		BatchSize: *batchSize,
+	})
+	if report != nil {
+		if encodeErr := printJSON(report); encodeErr != nil {
+			return encodeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d posts were rejected", len(report.Errors), report.Processed)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+const usersUsage = `Usage: admin users <command> [flags]
+
+Commands:
+  list      List users and their roles
+  create    Create a user, reading the password from stdin
+  role      Give a user another role
+  passwd    Set a user's password, reading it from stdin, and sign them out
+
+Run "admin users <command> -h" for command flags.
+Roles: reader, author, editor and admin.
+`
+
+// runUsers runs a users subcommand
+func runUsers(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usersUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "list":
+		return runUsersList(ctx, args[1:])
+	case "create":
+		return runUsersCreate(ctx, args[1:])
+	case "role":
+		return runUsersRole(ctx, args[1:])
+	case "passwd":
+		return runUsersPasswd(ctx, args[1:])
+	case "-h", "--help", "help":
+		fmt.Fprint(os.Stdout, usersUsage)
+		return nil
+	default:
+		fmt.Fprintf(os.Stderr, "unknown users command %q\n\n%s", args[0], usersUsage)
+		os.Exit(2)
+		return nil
+	}
+}
+
+// runUsersList prints the users as a table
+func runUsersList(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("users list", flag.ExitOnError)
+	_ = flags.Parse(args)
+
+	userService, cleanup, err := newUserService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	users, err := userService.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tROLE\tCREATED\tUSERNAME")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", user.ID.Hex(), user.Role, user.CreatedAt.Format("2006-01-02 15:04"), user.Username)
+	}
+	return w.Flush()
+}
+
+// runUsersCreate creates a user with the password on the first line of stdin, e.g. to add the first admin
+func runUsersCreate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("users create", flag.ExitOnError)
+	username := flags.String("username", "", "user name: 3 to 32 lowercase letters, digits, dots, hyphens or underscores")
+	role := flags.String("role", string(model.RoleReader), "role: reader, author, editor or admin")
+	_ = flags.Parse(args)
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	userService, cleanup, err := newUserService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	user, err := userService.CreateUser(ctx, service.UserInput{Username: *username, Password: password, Role: model.Role(*role)})
+	if err != nil {
+		return err
+	}
+	slog.Info("User created", "id", user.ID.Hex(), "username", user.Username, "role", user.Role)
+	return nil
+}
+
+// runUsersRole gives the user with the name another role
+func runUsersRole(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("users role", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin users role <username> <role>")
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	userService, cleanup, err := newUserService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	user, err := findUser(ctx, userService, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if _, err := userService.SetRole(ctx, user.ID.Hex(), model.Role(flags.Arg(1))); err != nil {
+		return err
+	}
+	slog.Info("User role changed", "username", user.Username, "role", flags.Arg(1))
+	return nil
+}
+
+// runUsersPasswd sets the password of the user with the name to the first line of stdin
+func runUsersPasswd(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("users passwd", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: admin users passwd <username> < password.txt")
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	userService, cleanup, err := newUserService(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if err := userService.SetPassword(ctx, flags.Arg(0), password); err != nil {
+		return err
+	}
+	slog.Info("Password changed, the user was signed out", "username", flags.Arg(0))
+	return nil
+}
+
+// newUserService connects to the configured database and returns the user service with a cleanup function
+func newUserService(ctx context.Context) (*service.UserService, func(), error) {
+	mongodb, _, cleanup, err := connect(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	userService := service.NewUserService(
+		repository.NewMongoUserRepository(mongodb.DB),
+		repository.NewMongoSessionRepository(mongodb.DB),
+		service.UserOptions{},
+	)
+	return userService, cleanup, nil
+}
+
+// findUser returns the user with the name
+func findUser(ctx context.Context, userService *service.UserService, username string) (*model.User, error) {
+	users, err := userService.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	username = model.NormalizeUsername(username)
+	for _, user := range users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return nil, service.ErrUserNotFound
+}
+
+// readPassword reads a password from the first line of stdin, so that it stays out of the shell history
+func readPassword() (string, error) {
+	if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password: ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -2,21 +2,31 @@ package main
 
 import (
 	"context"
-	"html/template"
+	"crypto/rand"
+	"io/fs"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/cache"
 	"github.com/iyhunko/go-htmx-mongo/internal/controller"
 	"github.com/iyhunko/go-htmx-mongo/internal/db"
 	httproutes "github.com/iyhunko/go-htmx-mongo/internal/http"
 	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc"
+	"github.com/iyhunko/go-htmx-mongo/internal/ratelimit"
 	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/seed"
 	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
 	"github.com/iyhunko/go-htmx-mongo/pkg/config"
 	"github.com/iyhunko/go-htmx-mongo/web"
 )
@@ -28,15 +38,38 @@ func main() {
 	cfg := config.Load()
 	slog.Info("Configuration loaded", "serverPort", cfg.HttpServerPort, "database", cfg.MongoDBDatabase)
 
+	registry := loadTenants(cfg)
 	mongodb := connectDatabase(cfg)
 	defer disconnectDatabase(mongodb)
 
-	postController := initializeController(mongodb, cfg)
-	router := setupRouter(postController)
-	server := createServer(cfg, router)
+	webFiles := web.Files(cfg.WebDir)
+	templates := loadTemplates(webFiles, cfg.WebDir != "")
+	webhookService := newWebhookService(mongodb, cfg)
+	relay := service.NewOutboxRelay(repository.NewMongoOutboxRepository(mongodb.DB), []service.EventSink{webhookService}, service.RelayOptions{})
+	postService, postController, auditController, webhookController := initializeControllers(mongodb, templates, webhookService, relay, cfg)
+	backupService := newBackupService(mongodb, cfg)
+	userService := newUserService(mongodb, cfg)
+	tokenService := service.NewTokenService(repository.NewMongoTokenRepository(mongodb.DB), repository.NewMongoUserRepository(mongodb.DB))
+	ssoService := newSSOService(cfg, userService)
+	router := setupRouter(cfg, postController, auditController, webhookController, controller.NewBackupController(backupService), userService, tokenService, ssoService, templates, web.Static(webFiles), routeMiddleware(cfg, mongodb))
+	server := createServer(cfg, tenant.Handler(registry, router))
+
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	workerDone := startWebhookWorker(workerCtx, webhookService, cfg)
+	relayDone := startOutboxRelay(workerCtx, relay, cfg)
+	watcherDone := startChangeWatcher(workerCtx, mongodb, postService, registry, cfg)
+	schedulerDone := startBackupScheduler(workerCtx, backupService, cfg)
+	seedDatabase(postService, cfg)
 
 	startServer(server, cfg)
 	waitForShutdown(server)
+
+	// Let attempts in progress finish before the database is disconnected
+	stopWorker()
+	<-workerDone
+	<-relayDone
+	<-watcherDone
+	<-schedulerDone
 }
 
 // initLogger initializes the structured logger
@@ -47,6 +80,22 @@ func initLogger() {
 	slog.SetDefault(logger)
 }
 
+// loadTenants loads the configured tenants, exiting if they are invalid
+func loadTenants(cfg *config.Config) *tenant.Registry {
+	registry, err := tenant.LoadFile(cfg.TenantsFile)
+	if err != nil {
+		slog.Error("Failed to load tenants", "error", err)
+		os.Exit(1)
+	}
+	if registry.Len() > 1 && cfg.EstimatedCount {
+		// The estimate counts the posts of every tenant, which would reveal the size of every newsroom to each
+		slog.Error("ESTIMATED_COUNT can't be used when serving several tenants", "tenants", registry.Len())
+		os.Exit(1)
+	}
+	slog.Info("Tenants loaded", "count", registry.Len())
+	return registry
+}
+
 // connectDatabase establishes a connection to MongoDB
 func connectDatabase(cfg *config.Config) *db.MongoDB {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -67,33 +116,394 @@ func disconnectDatabase(mongodb *db.MongoDB) {
 	}
 }
 
-// initializeController initializes all application layers
-func initializeController(mongodb *db.MongoDB, cfg *config.Config) *controller.PostController {
+// newWebhookService creates the service that sends post events to webhooks
+func newWebhookService(mongodb *db.MongoDB, cfg *config.Config) *service.WebhookService {
+	return service.NewWebhookService(
+		repository.NewMongoWebhookRepository(mongodb.DB),
+		repository.NewMongoDeliveryRepository(mongodb.DB),
+		service.WebhookOptions{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			Backoff:     time.Duration(cfg.WebhookBackoffSeconds) * time.Second,
+			MaxBackoff:  time.Duration(cfg.WebhookMaxBackoffSeconds) * time.Second,
+			Timeout:     time.Duration(cfg.WebhookTimeoutSeconds) * time.Second,
+		},
+	)
+}
+
+// startWebhookWorker sends due webhook deliveries in the background until ctx is canceled.
+// The returned channel is closed once the worker has stopped.
+func startWebhookWorker(ctx context.Context, webhookService *service.WebhookService, cfg *config.Config) <-chan struct{} {
+	done := make(chan struct{})
+	if !cfg.WebhookWorker {
+		slog.Info("Webhook worker disabled")
+		close(done)
+		return done
+	}
+
+	interval := time.Duration(max(cfg.WebhookPollSeconds, 1)) * time.Second
+	go func() {
+		defer close(done)
+		webhookService.Run(ctx, interval)
+	}()
+	slog.Info("Webhook worker started", "interval", interval.String(), "maxAttempts", cfg.WebhookMaxAttempts)
+	return done
+}
+
+// startOutboxRelay passes outbox events to their sinks in the background until ctx is canceled.
+// The returned channel is closed once the relay has stopped.
+func startOutboxRelay(ctx context.Context, relay *service.OutboxRelay, cfg *config.Config) <-chan struct{} {
+	done := make(chan struct{})
+	if !cfg.OutboxRelay {
+		slog.Info("Outbox relay disabled")
+		close(done)
+		return done
+	}
+
+	interval := time.Duration(max(cfg.OutboxPollSeconds, 1)) * time.Second
+	go func() {
+		defer close(done)
+		relay.Run(ctx, interval)
+	}()
+	slog.Info("Outbox relay started", "interval", interval.String())
+	return done
+}
+
+// startChangeWatcher applies changes of posts written by other tools in the background until ctx is canceled.
+// The returned channel is closed once the watcher has stopped.
+func startChangeWatcher(ctx context.Context, mongodb *db.MongoDB, postService *service.PostService, registry *tenant.Registry, cfg *config.Config) <-chan struct{} {
+	done := make(chan struct{})
+	if !cfg.ChangeStreamWatcher {
+		close(done)
+		return done
+	}
+	// Change streams need the same deployments as transactions
+	if !mongodb.Transactions {
+		slog.Warn("MongoDB doesn't support change streams; changes written by other tools are not picked up. Run a replica set to enable them")
+		close(done)
+		return done
+	}
+
+	watcher := service.NewChangeWatcher(
+		repository.NewMongoPostWatcher(mongodb.DB),
+		repository.NewMongoResumeTokenRepository(mongodb.DB),
+		postService,
+	)
+	if registry.Len() == 1 {
+		// Deleted posts can't tell their tenant; with a single tenant, it is the default one
+		ctx = tenant.WithTenant(ctx, registry.Default())
+	}
+	go func() {
+		defer close(done)
+		watcher.Run(ctx)
+	}()
+	slog.Info("Change stream watcher started")
+	return done
+}
+
+// newBackupService creates the service taking and restoring backups of the configured database
+func newBackupService(mongodb *db.MongoDB, cfg *config.Config) *service.BackupService {
+	return service.NewBackupService(
+		repository.NewMongoBackupRepository(mongodb.DB, mongodb.Transactions),
+		cfg.MongoDBDatabase,
+		validation.LimitsFromConfig(cfg),
+	)
+}
+
+// newUserService creates the service signing users in and managing their roles
+func newUserService(mongodb *db.MongoDB, cfg *config.Config) *service.UserService {
+	return service.NewUserService(
+		repository.NewMongoUserRepository(mongodb.DB),
+		repository.NewMongoSessionRepository(mongodb.DB),
+		service.UserOptions{SessionTTL: time.Duration(cfg.SessionTTLHours) * time.Hour},
+	)
+}
+
+// newSSOService creates the single sign-on service of the configured OpenID Connect provider, exiting if the
+// configuration is incomplete, or returns nil when single sign-on is disabled
+func newSSOService(cfg *config.Config, userService *service.UserService) *service.SSOService {
+	if cfg.OIDCIssuer == "" {
+		return nil
+	}
+	if cfg.OIDCClientID == "" {
+		slog.Error("OIDC_CLIENT_ID is required for single sign-on", "issuer", cfg.OIDCIssuer)
+		os.Exit(1)
+	}
+	groups, err := service.ParseRoleMap(cfg.OIDCRoleMap)
+	if err != nil {
+		slog.Error("Invalid OIDC_ROLE_MAP", "error", err)
+		os.Exit(1)
+	}
+	defaultRole := model.Role(cfg.OIDCDefaultRole)
+	if defaultRole != "" && !defaultRole.Valid() {
+		slog.Error("Invalid OIDC_DEFAULT_ROLE", "role", cfg.OIDCDefaultRole)
+		os.Exit(1)
+	}
+
+	provider := oidc.NewProvider(oidc.Config{
+		Issuer:       cfg.OIDCIssuer,
+		ClientID:     cfg.OIDCClientID,
+		ClientSecret: cfg.OIDCClientSecret,
+		Scopes:       cfg.OIDCScopes,
+	})
+	slog.Info("Single sign-on enabled", "issuer", cfg.OIDCIssuer, "groups", len(groups), "defaultRole", defaultRole)
+	return service.NewSSOService(provider, userService, service.SSOOptions{
+		UsernameClaim: cfg.OIDCUsernameClaim,
+		Roles:         service.RoleMapping{Claim: cfg.OIDCRoleClaim, Groups: groups, Default: defaultRole},
+	})
+}
+
+// anonymousRole returns the configured role of visitors who aren't signed in, exiting if it is unknown
+func anonymousRole(cfg *config.Config) model.Role {
+	role := model.Role(cfg.AnonymousRole)
+	if !role.Valid() {
+		slog.Error("Invalid anonymous role", "role", cfg.AnonymousRole)
+		os.Exit(1)
+	}
+	if role.Can(model.PermManage) {
+		slog.Warn("Visitors who aren't signed in may manage users, webhooks and backups", "role", role)
+	}
+	return role
+}
+
+// startBackupScheduler writes backups into the backup directory in the background until ctx is canceled.
+// The returned channel is closed once the scheduler has stopped.
+func startBackupScheduler(ctx context.Context, backupService *service.BackupService, cfg *config.Config) <-chan struct{} {
+	done := make(chan struct{})
+	if cfg.BackupIntervalHours <= 0 {
+		close(done)
+		return done
+	}
+
+	interval := time.Duration(cfg.BackupIntervalHours) * time.Hour
+	go func() {
+		defer close(done)
+		backupService.RunSchedule(ctx, cfg.BackupDir, interval, cfg.BackupRetention)
+	}()
+	slog.Info("Backup scheduler started", "dir", cfg.BackupDir, "interval", interval.String(), "retention", cfg.BackupRetention)
+	return done
+}
+
+// seedDatabase loads the configured fixture set when there are no posts yet, so that development and demo
+// servers start with content. Failures are logged, since the server works without the fixtures.
+func seedDatabase(postService *service.PostService, cfg *config.Config) {
+	if cfg.SeedFixture == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	ctx = service.WithActor(ctx, service.Actor{ID: "seed", Role: model.RoleAdmin})
+
+	version, err := postService.Version(ctx)
+	if err != nil {
+		slog.Error("Failed to count posts before seeding", "error", err)
+		return
+	}
+	if version.Count > 0 {
+		slog.Info("Posts exist, skipping fixture set", "fixture", cfg.SeedFixture, "posts", version.Count)
+		return
+	}
+
+	posts, err := seed.Fixture(cfg.SeedFixture)
+	if err != nil {
+		slog.Error("Failed to load fixture set", "fixture", cfg.SeedFixture, "error", err)
+		return
+	}
+	report, err := postService.LoadPosts(ctx, posts, service.ImportOptions{})
+	if err != nil {
+		slog.Error("Failed to seed posts", "fixture", cfg.SeedFixture, "error", err)
+		return
+	}
+	if len(report.Errors) > 0 {
+		slog.Warn("Some fixture posts were rejected", "fixture", cfg.SeedFixture, "errors", report.Errors)
+	}
+	slog.Info("Posts seeded", "fixture", cfg.SeedFixture, "inserted", report.Inserted)
+}
+
+// newTransactor returns the transactor writing changes together with their outbox events,
+// or nil when the server doesn't support transactions
+func newTransactor(mongodb *db.MongoDB) repository.Transactor {
+	if !mongodb.Transactions {
+		slog.Warn("MongoDB doesn't support transactions; events of changes are lost if the process stops right after a change. Run a replica set to avoid it")
+		return nil
+	}
+	return repository.NewMongoTransactor(mongodb.Client)
+}
+
+// initializeControllers initializes all application layers; the post service is also returned for background workers
+func initializeControllers(mongodb *db.MongoDB, templates *web.Templates, webhookService *service.WebhookService, relay *service.OutboxRelay, cfg *config.Config) (*service.PostService, *controller.PostController, *controller.AuditController, *controller.WebhookController) {
+	auditRepo := repository.NewMongoAuditRepository(mongodb.DB)
 	postRepo := repository.NewMongoPostRepository(mongodb.DB)
-	postService := service.NewPostService(postRepo)
+	if cfg.PostCacheSize > 0 {
+		cachedRepo := repository.NewCachedPostRepository(postRepo, repository.CacheOptions{
+			Size: cfg.PostCacheSize,
+			TTL:  time.Duration(cfg.PostCacheTTLSeconds) * time.Second,
+		})
+		go logCacheStats(cachedRepo, cacheStatsInterval)
+		postRepo = cachedRepo
+	}
+
+	opts := []service.Option{
+		service.WithEstimatedCount(cfg.EstimatedCount),
+		service.WithValidator(validation.FromConfig(cfg)),
+		service.WithAuditLog(auditRepo),
+		service.WithOutbox(repository.NewMongoOutboxRepository(mongodb.DB), newTransactor(mongodb)),
+		// Relay new events right away instead of at the next poll
+		service.WithEventListener(relay.Notify),
+	}
+
+	var fragments *cache.LRU[string, []byte]
+	if cfg.FragmentCacheSize > 0 {
+		// Rendered list fragments are dropped whenever posts change
+		fragments = cache.NewLRU[string, []byte](cfg.FragmentCacheSize, time.Duration(cfg.FragmentCacheTTLSeconds)*time.Second)
+		opts = append(opts, service.WithChangeListener(func(ctx context.Context) {
+			fragments.Purge()
+		}))
+	}
 
-	templates := loadTemplates()
-	return controller.NewPostController(postService, templates, cfg)
+	postService := service.NewPostService(postRepo, opts...)
+	postController := controller.NewPostController(postService, templates, cfg)
+	if fragments != nil {
+		postController.UseFragmentCache(fragments)
+	}
+
+	auditController := controller.NewAuditController(service.NewAuditService(auditRepo), templates, cfg)
+	webhookController := controller.NewWebhookController(webhookService, templates, cfg)
+	return postService, postController, auditController, webhookController
+}
+
+// cacheStatsInterval is how often post cache counters are logged
+const cacheStatsInterval = 5 * time.Minute
+
+// logCacheStats periodically logs the post cache counters
+func logCacheStats(repo *repository.CachedPostRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		stats := repo.Stats()
+		slog.Info("Post cache stats",
+			"hits", stats.Hits,
+			"backendHits", stats.BackendHits,
+			"misses", stats.Misses,
+			"backendErrors", stats.BackendErrors,
+		)
+	}
 }
 
-// loadTemplates loads HTML templates
-func loadTemplates() *template.Template {
-	templates, err := web.LoadTemplates()
+// loadTemplates loads HTML templates from files and checks that every template the controllers use exists.
+// With reload set, templates are parsed again when they change.
+func loadTemplates(files fs.FS, reload bool) *web.Templates {
+	templates, err := web.NewTemplates(files, reload)
 	if err != nil {
 		slog.Error("Failed to load templates", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Templates loaded successfully")
+	if err := templates.Validate(controller.TemplateNames...); err != nil {
+		slog.Error("Missing templates", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("Templates loaded successfully", "reload", reload)
 	return templates
 }
 
+// routeMiddleware builds the rate limiting and request size middleware for each route group
+func routeMiddleware(cfg *config.Config, mongodb *db.MongoDB) httproutes.RouteMiddleware {
+	var store ratelimit.Store
+	switch cfg.RateLimitStore {
+	case "mongo":
+		mongoStore := ratelimit.NewMongoStore(mongodb.DB)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := mongoStore.EnsureIndexes(ctx); err != nil {
+			slog.Error("Failed to prepare rate limit store", "error", err)
+			os.Exit(1)
+		}
+		store = mongoStore
+	default:
+		store = ratelimit.NewMemoryStore()
+	}
+
+	keyFunc := middleware.KeyByIP
+	if cfg.RateLimitKey == "user" {
+		keyFunc = middleware.KeyByUser
+	}
+
+	var mw httproutes.RouteMiddleware
+	if limit := ratelimit.PerMinute(cfg.RateLimitReadPerMinute, cfg.RateLimitReadBurst); limit.Enabled() {
+		mw.Read = append(mw.Read, middleware.RateLimit(store, "read", limit, keyFunc))
+	}
+	if limit := ratelimit.PerMinute(cfg.RateLimitWritePerMinute, cfg.RateLimitWriteBurst); limit.Enabled() {
+		mw.Write = append(mw.Write, middleware.RateLimit(store, "write", limit, keyFunc))
+	}
+	if cfg.MaxRequestBodyBytes > 0 {
+		mw.Form = append(mw.Form, middleware.BodyLimit(cfg.MaxRequestBodyBytes))
+	}
+
+	slog.Info("Rate limiting configured",
+		"store", cfg.RateLimitStore,
+		"key", cfg.RateLimitKey,
+		"readPerMinute", cfg.RateLimitReadPerMinute,
+		"writePerMinute", cfg.RateLimitWritePerMinute,
+	)
+	return mw
+}
+
+// sessionSecret returns the configured session secret, or a random one if none is set
+func sessionSecret(cfg *config.Config) []byte {
+	if cfg.SessionSecret != "" {
+		return []byte(cfg.SessionSecret)
+	}
+
+	slog.Warn("SESSION_SECRET is not set, using a random secret; sessions won't survive restarts or span replicas")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.Error("Failed to generate session secret", "error", err)
+		os.Exit(1)
+	}
+	return secret
+}
+
+// defaultLocation returns the configured default time zone, exiting if it is unknown
+func defaultLocation(cfg *config.Config) *time.Location {
+	location, err := time.LoadLocation(cfg.DefaultTimezone)
+	if err != nil {
+		slog.Error("Invalid default time zone", "error", err, "timezone", cfg.DefaultTimezone)
+		os.Exit(1)
+	}
+	return location
+}
+
 // setupRouter configures the Gin router with middleware and routes
-func setupRouter(postController *controller.PostController) *gin.Engine {
+func setupRouter(cfg *config.Config, postController *controller.PostController, auditController *controller.AuditController, webhookController *controller.WebhookController, backupController *controller.BackupController, userService *service.UserService, tokenService *service.TokenService, ssoService *service.SSOService, templates *web.Templates, static http.FileSystem, mw httproutes.RouteMiddleware) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	// Client IPs key rate limits, audit entries and logs, so forwarded headers are only believed from known proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		slog.Error("Invalid TRUSTED_PROXIES", "error", err)
+		os.Exit(1)
+	}
+	router.HTMLRender = templates
 	router.Use(gin.Recovery())
+	router.Use(middleware.RequestID())
 	router.Use(middleware.Logger())
-	httproutes.SetupRoutes(router, postController)
+	router.Use(middleware.SecurityHeaders(middleware.SecurityConfig{
+		CSPReportOnly:  cfg.CSPReportOnly,
+		HSTSMaxAge:     cfg.HSTSMaxAge,
+		FrameAncestors: cfg.FrameAncestors,
+		ReferrerPolicy: cfg.ReferrerPolicy,
+	}))
+	router.Use(middleware.Locale(i18n.Default(), defaultLocation(cfg), cfg.CookieSecure))
+	router.Use(middleware.CSRF(sessionSecret(cfg), cfg.CookieSecure, cfg.MaxRequestBodyBytes))
+	router.Use(middleware.Authenticate(userService, cfg.CookieSecure))
+	router.Use(middleware.Actor(anonymousRole(cfg)))
+	// Machine clients sign in with API tokens instead of sessions
+	mw.API = append(mw.API, middleware.BearerAuth(tokenService))
+	httproutes.SetupRoutes(router, postController, static, mw)
+	httproutes.SetupAdminRoutes(router, auditController, webhookController, backupController, mw)
+	httproutes.SetupUserRoutes(router, controller.NewUserController(userService, templates, cfg), controller.NewTokenController(tokenService, templates), mw)
+	if ssoService != nil {
+		httproutes.SetupSSORoutes(router, controller.NewSSOController(ssoService, userService, templates, cfg), mw)
+	}
 	return router
 }
 
@@ -2,17 +2,23 @@ package integration
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
 	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func TestIntegrationAPI_Index(t *testing.T) {
@@ -110,9 +116,9 @@ func TestIntegrationAPI_CreatePost_Validation(t *testing.T) {
 	// Execute request
 	router.ServeHTTP(w, req)
 
-	// Verify response is bad request
-	if w.Code != http.StatusBadRequest {
-		t.Errorf("Expected status 400, got %d", w.Code)
+	// Verify the form is rejected as unprocessable
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422, got %d", w.Code)
 	}
 }
 
@@ -343,8 +349,6 @@ func TestIntegrationAPI_ShowEditForm(t *testing.T) {
 }
 
 func TestIntegrationAPI_ShowPost(t *testing.T) {
-	t.Skip("Skipping test - post-detail.html template not implemented in the application")
-
 	router, pool, resource, db := setupTestServer(t)
 	defer func() {
 		if err := pool.Purge(resource); err != nil {
@@ -381,3 +385,399 @@ func TestIntegrationAPI_ShowPost(t *testing.T) {
 		t.Error("Expected response to contain 'Test Content'")
 	}
 }
+
+func TestIntegrationAPI_ConditionalGet(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	postRepo := repository.NewMongoPostRepository(db)
+	if err := postRepo.Create(context.Background(), model.NewPost("Cached Title", "Cached Content")); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	// First request returns validators
+	req, _ := http.NewRequest("GET", "/posts", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag header")
+	}
+	if lastModified := w.Header().Get("Last-Modified"); lastModified != "" {
+		t.Errorf("Expected no Last-Modified header on per-session pages, got %q", lastModified)
+	}
+	if cacheControl := w.Header().Get("Cache-Control"); cacheControl != "private, no-cache" {
+		t.Errorf("Expected Cache-Control 'private, no-cache', got %q", cacheControl)
+	}
+
+	// Revalidating with the same ETag returns 304 without a body
+	req, _ = http.NewRequest("GET", "/posts", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected status 304, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected empty body, got %q", w.Body.String())
+	}
+
+	// A timestamp alone doesn't revalidate, since it can't tell the session or deletions apart
+	req, _ = http.NewRequest("GET", "/posts", nil)
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for If-Modified-Since, got %d", w.Code)
+	}
+
+	// A change to the collection invalidates the ETag
+	if err := postRepo.Create(context.Background(), model.NewPost("Another Title", "Another Content")); err != nil {
+		t.Fatalf("Failed to create post: %v", err)
+	}
+
+	req, _ = http.NewRequest("GET", "/posts", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 after a change, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Another Title") {
+		t.Error("Expected response to contain the new post")
+	}
+}
+
+func TestIntegrationAPI_JSONValidation(t *testing.T) {
+	router, pool, resource, _ := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	// Every failing field is reported
+	req, _ := http.NewRequest("POST", "/api/posts", strings.NewReader(`{"title": "", "content": ""}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("Expected status 422, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var body struct {
+		Error  string             `json:"error"`
+		Fields []model.FieldError `json:"fields"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(body.Fields) != 2 || body.Fields[0].Field != "title" || body.Fields[1].Field != "content" {
+		t.Errorf("Expected title and content errors, got %+v", body.Fields)
+	}
+	for _, fieldErr := range body.Fields {
+		if fieldErr.Code != model.CodeRequired {
+			t.Errorf("Expected code %q for %s, got %q", model.CodeRequired, fieldErr.Field, fieldErr.Code)
+		}
+	}
+
+	// A valid post is created
+	req, _ = http.NewRequest("POST", "/api/posts", strings.NewReader(`{"title": "API Post", "content": "Content", "tags": ["Go"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	var post model.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if post.Title != "API Post" || len(post.Tags) != 1 || post.Tags[0] != "go" {
+		t.Errorf("Unexpected created post: %+v", post)
+	}
+}
+
+func TestIntegrationAPI_ErrorMapping(t *testing.T) {
+	router, pool, resource, _ := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	missing := primitive.NewObjectID().Hex()
+
+	// Deleting an unknown post from the page is a 404 shown in the error region
+	req, _ := http.NewRequest("DELETE", "/posts/"+missing, nil)
+	req.Header.Set("HX-Request", "true")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("HX-Retarget"); got != "#error-region" {
+		t.Errorf("Expected HX-Retarget #error-region, got %q", got)
+	}
+	if !strings.Contains(w.Body.String(), "post not found") {
+		t.Errorf("Expected error fragment, got %s", w.Body.String())
+	}
+
+	// The same error from the JSON API is a JSON body
+	req, _ = http.NewRequest("DELETE", "/api/posts/"+missing, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Code != "post_not_found" {
+		t.Errorf("Expected post_not_found JSON error, got %s", w.Body.String())
+	}
+
+	// Malformed IDs are bad requests
+	req, _ = http.NewRequest("GET", "/api/posts/not-an-id", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestIntegrationAPI_AuditLog(t *testing.T) {
+	router, pool, resource, _ := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Create, update and delete a post through the API
+	w := serve("POST", "/api/posts", `{"title": "Audited", "content": "First version"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var post model.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+		t.Fatalf("Failed to decode post: %v", err)
+	}
+	createRequestID := w.Header().Get("X-Request-ID")
+
+	if w := serve("PUT", "/api/posts/"+post.ID.Hex(), `{"title": "Audited", "content": "Second version"}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", w.Code, w.Body.String())
+	}
+	if w := serve("DELETE", "/api/posts/"+post.ID.Hex(), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	// The export lists every change of the post, oldest first
+	w = serve("GET", "/admin/audit/export?post_id="+post.ID.Hex(), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d, body: %s", w.Code, w.Body.String())
+	}
+	var entries []model.AuditEntry
+	decoder := json.NewDecoder(w.Body)
+	for decoder.More() {
+		var entry model.AuditEntry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Failed to decode audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	var actions []model.AuditAction
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		if entry.Actor != "anonymous" || entry.IP != "192.0.2.1" || entry.RequestID == "" {
+			t.Errorf("Expected the anonymous actor from 192.0.2.1 with a request ID, got %+v", entry)
+		}
+	}
+	if fmt.Sprint(actions) != "[create update delete]" {
+		t.Fatalf("Expected create, update and delete entries, got %v", actions)
+	}
+	if entries[0].RequestID != createRequestID {
+		t.Errorf("Expected request ID %q, got %q", createRequestID, entries[0].RequestID)
+	}
+	if entries[1].Before.Content != "First version" || entries[1].After.Content != "Second version" {
+		t.Errorf("Expected snapshots around the update, got %+v and %+v", entries[1].Before, entries[1].After)
+	}
+	if entries[2].Before == nil || entries[2].After != nil {
+		t.Errorf("Expected only a before snapshot of the deleted post, got %+v", entries[2])
+	}
+
+	// The admin page filters by action
+	w = serve("GET", "/admin/audit?action=delete", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), post.ID.Hex()) || strings.Contains(w.Body.String(), "audit-create") {
+		t.Errorf("Expected only the delete entry on the filtered page, got %s", w.Body.String())
+	}
+
+	if w := serve("GET", "/admin/audit?post_id=not-an-id", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed post ID, got %d", w.Code)
+	}
+}
+
+func TestIntegrationAPI_Webhooks(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	// A local receiver records the webhook requests
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- r
+		bodies <- body
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	// Subscribe the receiver through the admin form
+	form := url.Values{"url": {receiver.URL}, "events": {"post.created"}}
+	req, _ := http.NewRequest("POST", "/admin/webhooks", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	webhooks, err := repository.NewMongoWebhookRepository(db).FindAll(context.Background())
+	if err != nil || len(webhooks) != 1 {
+		t.Fatalf("Expected one webhook, got %v, %v", webhooks, err)
+	}
+	if !strings.Contains(w.Body.String(), webhooks[0].Secret) {
+		t.Error("Expected the page to show the new webhook's secret")
+	}
+
+	// Creating a post writes its events to the outbox; the relay queues a delivery, which a worker sends
+	req, _ = http.NewRequest("POST", "/api/posts", strings.NewReader(`{"title": "Hooked", "content": "Content"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d, body: %s", w.Code, w.Body.String())
+	}
+
+	worker := service.NewWebhookService(repository.NewMongoWebhookRepository(db), repository.NewMongoDeliveryRepository(db), service.WebhookOptions{})
+	relay := service.NewOutboxRelay(repository.NewMongoOutboxRepository(db), []service.EventSink{worker}, service.RelayOptions{})
+	if _, err := relay.RelayDue(context.Background()); err != nil {
+		t.Fatalf("Failed to relay the outbox: %v", err)
+	}
+	if count, err := worker.DeliverDue(context.Background()); err != nil || count != 1 {
+		t.Fatalf("Expected 1 delivery, got %d, %v", count, err)
+	}
+
+	request, body := <-received, <-bodies
+	if got := request.Header.Get(service.WebhookEventHeader); got != "post.created" {
+		t.Errorf("Expected a post.created event, got %q", got)
+	}
+	timestamp, _ := strconv.ParseInt(request.Header.Get(service.WebhookTimestampHeader), 10, 64)
+	if !service.VerifyWebhook(webhooks[0].Secret, timestamp, body, request.Header.Get(service.WebhookSignatureHeader)) {
+		t.Errorf("Expected a valid signature, got %q", request.Header.Get(service.WebhookSignatureHeader))
+	}
+	if !strings.Contains(string(body), `"title":"Hooked"`) {
+		t.Errorf("Expected the created post in the payload, got %s", body)
+	}
+
+	// The delivery is listed as delivered
+	deliveryID := request.Header.Get(service.WebhookDeliveryHeader)
+	req, _ = http.NewRequest("GET", "/admin/webhooks?status=delivered", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), deliveryID) {
+		t.Errorf("Expected delivery %s on the page, got status %d", deliveryID, w.Code)
+	}
+}
+
+func TestIntegrationAPI_BulkAllMatchingFilters(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+	posts := []*model.Post{
+		{Title: "Draft news", Content: "Content", Status: model.StatusDraft, Tags: []string{"news"}},
+		{Title: "Draft recipe", Content: "Content", Status: model.StatusDraft, Tags: []string{"food"}},
+		{Title: "Published news", Content: "Content", Status: model.StatusPublished, Tags: []string{"news"}},
+	}
+	if _, err := repo.BulkUpsert(ctx, posts); err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+
+	// The bulk form carries the filters of the list it is shown on
+	req, _ := http.NewRequest("GET", "/posts?status=draft&sort=title", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if !strings.Contains(w.Body.String(), `name="filter" value="status=draft"`) {
+		t.Errorf("Expected the bulk form to carry the status filter without the sort, got %s", w.Body.String())
+	}
+
+	remaining := func(filter string) []string {
+		t.Helper()
+		form := url.Values{"action": {"delete"}, "scope": {"all"}, "filter": {filter}}
+		req, _ := http.NewRequest("POST", "/posts/bulk", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d, body: %s", w.Code, w.Body.String())
+		}
+
+		all, err := repo.FindAll(ctx, 10, 0)
+		if err != nil {
+			t.Fatalf("FindAll() error = %v", err)
+		}
+		titles := make([]string, len(all))
+		for i, post := range all {
+			titles[i] = post.Title
+		}
+		sort.Strings(titles)
+		return titles
+	}
+
+	if got := remaining("status=draft&tags=news"); fmt.Sprint(got) != "[Draft recipe Published news]" {
+		t.Errorf("Expected only the draft news to be deleted, %v remain", got)
+	}
+	if got := remaining("status=draft"); fmt.Sprint(got) != "[Published news]" {
+		t.Errorf("Expected only drafts to be deleted, %v remain", got)
+	}
+}
@@ -0,0 +1,112 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	database "github.com/iyhunko/go-htmx-mongo/internal/db"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIntegrationBackupRestore(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	ctx := context.Background()
+	posts := loadFixture(t, db, "demo")
+	webhookRepo := repository.NewMongoWebhookRepository(db)
+	if err := webhookRepo.Create(ctx, &model.Webhook{URL: "https://example.com/hook", Secret: "secret", Events: []model.EventType{model.EventPostCreated}, Active: true}); err != nil {
+		t.Fatalf("Create() webhook error = %v", err)
+	}
+
+	var archive bytes.Buffer
+	source := service.NewBackupService(repository.NewMongoBackupRepository(db, true), db.Name(), model.DefaultLimits)
+	manifest, err := source.Backup(ctx, &archive)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if !manifest.Consistent {
+		t.Error("Backup() on a replica set wasn't consistent")
+	}
+
+	// Restore into another database on the same server
+	restored := db.Client().Database("restoredb")
+	target := service.NewBackupService(repository.NewMongoBackupRepository(restored, true), restored.Name(), model.DefaultLimits)
+	if _, err := target.Restore(ctx, bytes.NewReader(archive.Bytes()), service.RestoreOptions{BatchSize: 3}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if err := database.Migrate(ctx, restored); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	restoredPosts := repository.NewMongoPostRepository(restored)
+	count, err := restoredPosts.Count(ctx)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != int64(len(posts)) {
+		t.Errorf("restored %d posts, want %d", count, len(posts))
+	}
+	post, err := restoredPosts.FindByID(ctx, posts[0].ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if post.Title != posts[0].Title || !post.CreatedAt.Equal(posts[0].CreatedAt) {
+		t.Errorf("restored post = %+v, want %+v", post, posts[0])
+	}
+	webhooks, err := restored.Collection("webhooks").CountDocuments(ctx, bson.M{})
+	if err != nil || webhooks != 1 {
+		t.Errorf("restored %d webhooks (error %v), want 1", webhooks, err)
+	}
+
+	// The migrated indexes work on the restored posts
+	results, err := restoredPosts.Search(ctx, posts[0].Title, 10, 0)
+	if err != nil || len(results) == 0 {
+		t.Errorf("Search() = %d posts, %v, want the restored post found", len(results), err)
+	}
+
+	if _, err := target.Restore(ctx, bytes.NewReader(archive.Bytes()), service.RestoreOptions{}); !errors.Is(err, service.ErrRestoreTargetNotEmpty) {
+		t.Errorf("Restore() into restored data error = %v, want ErrRestoreTargetNotEmpty", err)
+	}
+}
+
+func TestIntegrationAPI_DownloadBackup(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+	posts := loadFixture(t, db, "demo")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/backup", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/backup status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Type"); got != "application/gzip" {
+		t.Errorf("Content-Type = %q, want application/gzip", got)
+	}
+
+	verifier := service.NewBackupService(nil, "", model.DefaultLimits)
+	manifest, err := verifier.Verify(w.Body)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if manifest.Collections[0].Name != "posts" || manifest.Collections[0].Documents != int64(len(posts)) {
+		t.Errorf("manifest collections = %+v, want %d posts first", manifest.Collections, len(posts))
+	}
+}
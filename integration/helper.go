@@ -10,15 +10,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/iyhunko/go-htmx-mongo/internal/controller"
+	database "github.com/iyhunko/go-htmx-mongo/internal/db"
 	httproutes "github.com/iyhunko/go-htmx-mongo/internal/http"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
 	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/seed"
 	"github.com/iyhunko/go-htmx-mongo/internal/service"
 	"github.com/iyhunko/go-htmx-mongo/pkg/config"
 	"github.com/iyhunko/go-htmx-mongo/web"
 	"github.com/ory/dockertest/v3"
 	"github.com/ory/dockertest/v3/docker"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // findProjectRoot finds the project root directory
@@ -64,6 +70,8 @@ func setupMongoDB(t *testing.T) (*dockertest.Pool, *dockertest.Resource, *mongo.
 	resource, err := pool.RunWithOptions(&dockertest.RunOptions{
 		Repository: "mongo",
 		Tag:        "7",
+		// Transactions need a replica set; a single member is enough
+		Cmd: []string{"--replSet", "rs0", "--bind_ip_all"},
 		Env: []string{
 			"MONGO_INITDB_DATABASE=testdb",
 		},
@@ -81,7 +89,8 @@ func setupMongoDB(t *testing.T) (*dockertest.Pool, *dockertest.Resource, *mongo.
 	// Exponential backoff-retry
 	if err := pool.Retry(func() error {
 		var err error
-		mongoURI := fmt.Sprintf("mongodb://localhost:%s", resource.GetPort("27017/tcp"))
+		// The member is known by its address inside the container, so connect to it directly
+		mongoURI := fmt.Sprintf("mongodb://localhost:%s/?directConnection=true", resource.GetPort("27017/tcp"))
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -102,9 +111,60 @@ func setupMongoDB(t *testing.T) (*dockertest.Pool, *dockertest.Resource, *mongo.
 		t.Fatalf("Could not connect to docker: %s", err)
 	}
 
+	if err := initiateReplicaSet(pool, client); err != nil {
+		t.Fatalf("Could not initiate replica set: %s", err)
+	}
+
+	// Create the indexes the application relies on, e.g. the text index used for relevance sorting
+	if err := database.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Could not migrate database: %s", err)
+	}
+
 	return pool, resource, db
 }
 
+// initiateReplicaSet turns the fresh server into the single member of replica set rs0 and waits until it is primary
+func initiateReplicaSet(pool *dockertest.Pool, client *mongo.Client) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	config := bson.M{"_id": "rs0", "members": bson.A{bson.M{"_id": 0, "host": "localhost:27017"}}}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "replSetInitiate", Value: config}}).Err(); err != nil {
+		return err
+	}
+
+	return pool.Retry(func() error {
+		var hello struct {
+			IsWritablePrimary bool `bson:"isWritablePrimary"`
+		}
+		if err := client.Database("admin").RunCommand(context.Background(), bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+			return err
+		}
+		if !hello.IsWritablePrimary {
+			return fmt.Errorf("replica set member is not primary yet")
+		}
+		return nil
+	})
+}
+
+// loadFixture writes the named fixture set of the seed package to the posts collection and returns its posts
+func loadFixture(t *testing.T, db *mongo.Database, name string) []*model.Post {
+	t.Helper()
+
+	posts, err := seed.Fixture(name)
+	if err != nil {
+		t.Fatalf("Could not read fixture set: %s", err)
+	}
+	result, err := repository.NewMongoPostRepository(db).BulkUpsert(context.Background(), posts)
+	if err != nil {
+		t.Fatalf("Could not load fixture set: %s", err)
+	}
+	if len(result.Failed) > 0 {
+		t.Fatalf("Could not load %d posts of fixture set %s: %v", len(result.Failed), name, result.Failed)
+	}
+	return posts
+}
+
 // setupTestServer creates a test HTTP server with all dependencies
 func setupTestServer(t *testing.T) (*gin.Engine, *dockertest.Pool, *dockertest.Resource, *mongo.Database) {
 	// Skip if in short mode
@@ -131,7 +191,12 @@ func setupTestServer(t *testing.T) (*gin.Engine, *dockertest.Pool, *dockertest.R
 
 	// Initialize application layers
 	postRepo := repository.NewMongoPostRepository(db)
-	postService := service.NewPostService(postRepo)
+	auditRepo := repository.NewMongoAuditRepository(db)
+	webhookService := service.NewWebhookService(repository.NewMongoWebhookRepository(db), repository.NewMongoDeliveryRepository(db), service.WebhookOptions{})
+	postService := service.NewPostService(postRepo,
+		service.WithAuditLog(auditRepo),
+		service.WithOutbox(repository.NewMongoOutboxRepository(db), repository.NewMongoTransactor(db.Client())),
+	)
 
 	// Load templates
 	templates, err := web.LoadTemplates()
@@ -145,11 +210,27 @@ func setupTestServer(t *testing.T) (*gin.Engine, *dockertest.Pool, *dockertest.R
 	}
 
 	postController := controller.NewPostController(postService, templates, cfg)
+	auditController := controller.NewAuditController(service.NewAuditService(auditRepo), templates, cfg)
+	webhookController := controller.NewWebhookController(webhookService, templates, cfg)
+	backupController := controller.NewBackupController(service.NewBackupService(repository.NewMongoBackupRepository(db, false), db.Name(), model.DefaultLimits))
+	userService := newTestUserService(db)
+	tokenService := service.NewTokenService(repository.NewMongoTokenRepository(db), repository.NewMongoUserRepository(db))
 
 	// Setup router
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	httproutes.SetupRoutes(router, postController)
+	router.HTMLRender = templates
+	// Visitors who aren't signed in may do everything, so that tests of posts needn't sign in
+	router.Use(middleware.RequestID(), middleware.Authenticate(userService, false), middleware.Actor(model.RoleAdmin))
+	mw := httproutes.RouteMiddleware{API: []gin.HandlerFunc{middleware.BearerAuth(tokenService)}}
+	httproutes.SetupRoutes(router, postController, web.Static(web.Files("")), mw)
+	httproutes.SetupAdminRoutes(router, auditController, webhookController, backupController, mw)
+	httproutes.SetupUserRoutes(router, controller.NewUserController(userService, templates, cfg), controller.NewTokenController(tokenService, templates), mw)
 
 	return router, pool, resource, db
 }
+
+// newTestUserService creates a user service storing users in db, hashing passwords with the lowest cost
+func newTestUserService(db *mongo.Database) *service.UserService {
+	return service.NewUserService(repository.NewMongoUserRepository(db), repository.NewMongoSessionRepository(db), service.UserOptions{PasswordCost: bcrypt.MinCost})
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
 	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -322,3 +325,603 @@ func TestIntegrationMongoPostRepository_CountSearch(t *testing.T) {
 		t.Errorf("CountSearch() = %d, want 2", count)
 	}
 }
+
+func TestIntegrationMongoPostRepository_BulkUpsert(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	existing := model.NewPost("Existing Title", "Existing Content")
+	if err := repo.Create(ctx, existing); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	posts := []*model.Post{
+		{ID: existing.ID, Title: "Updated By ID", Content: "Updated Content"},
+		{Slug: "new-by-slug", Title: "Inserted By Slug", Content: "Slug Content"},
+		{Title: "Inserted Without Key", Content: "Plain Content"},
+	}
+
+	result, err := repo.BulkUpsert(ctx, posts)
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	if result.Inserted != 2 || result.Updated != 1 || len(result.Failed) != 0 {
+		t.Errorf("BulkUpsert() = %+v, want 2 inserted and 1 updated", result)
+	}
+
+	// Upserting the same slug again must update rather than insert
+	result, err = repo.BulkUpsert(ctx, []*model.Post{{Slug: "new-by-slug", Title: "Renamed", Content: "Slug Content"}})
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	if result.Inserted != 0 || result.Updated != 1 {
+		t.Errorf("BulkUpsert() by slug = %+v, want 1 updated", result)
+	}
+
+	count, err := repo.Count(ctx)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Count() = %d, want 3", count)
+	}
+
+	updated, err := repo.FindByID(ctx, existing.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if updated.Title != "Updated By ID" {
+		t.Errorf("FindByID() title = %s, want Updated By ID", updated.Title)
+	}
+}
+
+func TestIntegrationMongoPostRepository_FindPage(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		post := model.NewPost(fmt.Sprintf("Go Post %d", i), "Content")
+		if err := repo.Create(ctx, post); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond) // Ensure different timestamps
+	}
+	if err := repo.Create(ctx, model.NewPost("Python Post", "Content")); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		query         repository.PageQuery
+		wantPosts     int
+		wantTotal     int64
+		wantEstimated bool
+	}{
+		{"first page", repository.PageQuery{Limit: 4}, 4, 6, false},
+		{"last page", repository.PageQuery{Limit: 4, Offset: 4}, 2, 6, false},
+		{"search", repository.PageQuery{Search: "go", Limit: 4, Offset: 4}, 1, 5, false},
+		{"no matches", repository.PageQuery{Search: "rust", Limit: 4}, 0, 0, false},
+		{"estimated total", repository.PageQuery{Limit: 4, EstimateTotal: true}, 4, 6, true},
+		{"search is never estimated", repository.PageQuery{Search: "go", Limit: 4, EstimateTotal: true}, 4, 5, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := repo.FindPage(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("FindPage() error = %v", err)
+			}
+			if len(page.Posts) != tt.wantPosts {
+				t.Errorf("FindPage() returned %d posts, want %d", len(page.Posts), tt.wantPosts)
+			}
+			if page.Total != tt.wantTotal {
+				t.Errorf("FindPage() total = %d, want %d", page.Total, tt.wantTotal)
+			}
+			if page.Estimated != tt.wantEstimated {
+				t.Errorf("FindPage() estimated = %v, want %v", page.Estimated, tt.wantEstimated)
+			}
+		})
+	}
+
+	// Newest posts come first
+	page, err := repo.FindPage(ctx, repository.PageQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].Title != "Python Post" {
+		t.Errorf("FindPage() first post = %v, want Python Post", page.Posts)
+	}
+}
+
+func TestIntegrationMongoPostRepository_FindPageSortAndFilter(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	posts := []*model.Post{
+		{Title: "banana bread", Content: "Baking with bananas", Tags: []string{"food"}, Status: model.StatusPublished},
+		{Title: "Apple pie", Content: "Apple apple apple", Tags: []string{"food", "dessert"}, Status: model.StatusDraft},
+		{Title: "Cherry news", Content: "Cherry season opens, apple later", Tags: []string{"news"}},
+	}
+	for i, post := range posts {
+		post.CreatedAt = base.AddDate(0, 0, i)
+		post.UpdatedAt = base.AddDate(0, 0, 10-i)
+	}
+	if _, err := repo.BulkUpsert(ctx, posts); err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		query      repository.PageQuery
+		wantTitles []string
+	}{
+		{
+			name:       "created descending",
+			query:      repository.PageQuery{SortBy: repository.SortByCreated, Descending: true},
+			wantTitles: []string{"Cherry news", "Apple pie", "banana bread"},
+		},
+		{
+			name:       "updated descending",
+			query:      repository.PageQuery{SortBy: repository.SortByUpdated, Descending: true},
+			wantTitles: []string{"banana bread", "Apple pie", "Cherry news"},
+		},
+		{
+			name:       "title ascending ignores case",
+			query:      repository.PageQuery{SortBy: repository.SortByTitle},
+			wantTitles: []string{"Apple pie", "banana bread", "Cherry news"},
+		},
+		{
+			name:       "relevance",
+			query:      repository.PageQuery{Search: "apple", SortBy: repository.SortByRelevance},
+			wantTitles: []string{"Apple pie", "Cherry news"},
+		},
+		{
+			name: "created date range",
+			query: repository.PageQuery{
+				CreatedFrom: base.AddDate(0, 0, 1),
+				CreatedTo:   base.AddDate(0, 0, 2),
+			},
+			wantTitles: []string{"Apple pie"},
+		},
+		{
+			name:       "all tags",
+			query:      repository.PageQuery{Tags: []string{"food", "dessert"}},
+			wantTitles: []string{"Apple pie"},
+		},
+		{
+			name:       "published includes posts without status",
+			query:      repository.PageQuery{Status: model.StatusPublished, SortBy: repository.SortByTitle},
+			wantTitles: []string{"banana bread", "Cherry news"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Limit = 10
+			page, err := repo.FindPage(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("FindPage() error = %v", err)
+			}
+
+			titles := make([]string, len(page.Posts))
+			for i, post := range page.Posts {
+				titles[i] = post.Title
+			}
+			if fmt.Sprint(titles) != fmt.Sprint(tt.wantTitles) {
+				t.Errorf("FindPage() titles = %v, want %v", titles, tt.wantTitles)
+			}
+			if page.Total != int64(len(tt.wantTitles)) {
+				t.Errorf("FindPage() total = %d, want %d", page.Total, len(tt.wantTitles))
+			}
+		})
+	}
+}
+
+func TestIntegrationMongoPostRepository_FindPageSortsByIndex(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := tenant.WithID(context.Background(), "daily")
+
+	// The posts take far more than the sort may hold in memory, so sorting them anywhere but in an index fails
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	posts := make([]*model.Post, 300)
+	for i := range posts {
+		posts[i] = &model.Post{
+			Title:     fmt.Sprintf("Post %03d", i),
+			Slug:      fmt.Sprintf("post-%03d", i),
+			Content:   strings.Repeat("x", 1024),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt: base.Add(time.Duration(len(posts)-i) * time.Minute),
+		}
+	}
+	if _, err := repo.BulkUpsert(ctx, posts); err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+
+	admin := db.Client().Database("admin")
+	if err := admin.RunCommand(context.Background(), bson.D{
+		{Key: "setParameter", Value: 1},
+		{Key: "internalQueryMaxBlockingSortMemoryUsageBytes", Value: 32 * 1024},
+		{Key: "allowDiskUseByDefault", Value: false},
+	}).Err(); err != nil {
+		t.Fatalf("Failed to limit sort memory: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		query     repository.PageQuery
+		wantFirst string
+	}{
+		{
+			name:      "created descending",
+			query:     repository.PageQuery{SortBy: repository.SortByCreated, Descending: true},
+			wantFirst: "Post 199",
+		},
+		{
+			name:      "created ascending",
+			query:     repository.PageQuery{SortBy: repository.SortByCreated},
+			wantFirst: "Post 100",
+		},
+		{
+			name:      "updated descending",
+			query:     repository.PageQuery{SortBy: repository.SortByUpdated, Descending: true},
+			wantFirst: "Post 100",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Offset = 100
+			tt.query.Limit = 10
+			page, err := repo.FindPage(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("FindPage() error = %v, want the sort to use an index", err)
+			}
+			if len(page.Posts) != 10 || page.Posts[0].Title != tt.wantFirst {
+				t.Errorf("FindPage() returned %d posts starting with %v, want 10 starting with %s", len(page.Posts), page.Posts, tt.wantFirst)
+			}
+			if page.Total != int64(len(posts)) {
+				t.Errorf("FindPage() total = %d, want %d", page.Total, len(posts))
+			}
+		})
+	}
+}
+
+func TestIntegrationMongoPostRepository_Translations(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	elections := model.NewPost("Elections announced", "Voting starts in spring")
+	elections.SetTranslation("uk", "Оголошено вибори", "Голосування почнеться навесні")
+	elections.SetTranslation("de", "Wahlen angekündigt", "Die Abstimmung beginnt im Frühling")
+	weather := model.NewPost("Погода", "Завтра сонячно")
+	weather.Language = "uk"
+	for _, post := range []*model.Post{elections, weather} {
+		if err := repo.Create(ctx, post); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	found, err := repo.FindByID(ctx, elections.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if fmt.Sprint(found.Languages()) != "[en uk de]" {
+		t.Errorf("FindByID() languages = %v, want [en uk de]", found.Languages())
+	}
+
+	tests := []struct {
+		name       string
+		query      repository.PageQuery
+		wantTitles []string
+	}{
+		{"search across languages", repository.PageQuery{Search: "навесні"}, []string{"Elections announced"}},
+		{"search in a language", repository.PageQuery{Search: "вибори", Language: "uk"}, []string{"Elections announced"}},
+		{"search in another language", repository.PageQuery{Search: "вибори", Language: "de"}, nil},
+		{"available in a language", repository.PageQuery{Language: "uk", SortBy: repository.SortByTitle}, []string{"Elections announced", "Погода"}},
+		{"default language includes posts without one", repository.PageQuery{Language: "en"}, []string{"Elections announced"}},
+		{"relevance in a stemmed language", repository.PageQuery{Search: "abstimmung", Language: "de", SortBy: repository.SortByRelevance}, []string{"Elections announced"}},
+		{"relevance in an unstemmed language", repository.PageQuery{Search: "сонячно", Language: "uk", SortBy: repository.SortByRelevance}, []string{"Погода"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.query.Limit = 10
+			page, err := repo.FindPage(ctx, tt.query)
+			if err != nil {
+				t.Fatalf("FindPage() error = %v", err)
+			}
+
+			var titles []string
+			for _, post := range page.Posts {
+				titles = append(titles, post.Title)
+			}
+			if fmt.Sprint(titles) != fmt.Sprint(tt.wantTitles) {
+				t.Errorf("FindPage() titles = %v, want %v", titles, tt.wantTitles)
+			}
+		})
+	}
+
+	found.RemoveTranslation("de")
+	if err := repo.Update(ctx, found); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	found, err = repo.FindByID(ctx, elections.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if found.FindTranslation("de") != nil || found.FindTranslation("uk") == nil {
+		t.Errorf("Update() translations = %+v, want only uk", found.Translations)
+	}
+}
+
+func TestIntegrationFixtures(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	demo := loadFixture(t, db, "demo")
+	translations := loadFixture(t, db, "translations")
+	// Fixture posts have fixed IDs, so loading a set again adds nothing
+	loadFixture(t, db, "demo")
+
+	count, err := repo.Count(ctx)
+	if err != nil {
+		t.Fatalf("Count() error = %v", err)
+	}
+	if want := int64(len(demo) + len(translations)); count != want {
+		t.Errorf("Count() = %d, want %d", count, want)
+	}
+
+	page, err := repo.FindPage(ctx, repository.PageQuery{Language: "uk", SortBy: repository.SortByTitle, Limit: 10})
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+	if len(page.Posts) != 2 {
+		t.Errorf("FindPage() returned %d posts available in Ukrainian, want 2", len(page.Posts))
+	}
+}
+
+func TestIntegrationMongoPostRepository_RefreshTextLanguages(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	ctx := context.Background()
+
+	indexed := model.NewPost("Indexed", "Written by the application")
+	if err := repo.Create(ctx, indexed); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// Written by another tool, without text search languages
+	_, err := db.Collection("posts").InsertOne(ctx, bson.M{
+		"title":        "Wahlen angekündigt",
+		"content":      "Die Abstimmung beginnt im Frühling",
+		"language":     "de",
+		"translations": bson.A{bson.M{"language": "en", "title": "Elections announced", "content": "Voting starts in spring"}},
+		"created_at":   time.Now(),
+		"updated_at":   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+
+	updated, err := repo.RefreshTextLanguages(ctx)
+	if err != nil || updated != 1 {
+		t.Fatalf("RefreshTextLanguages() = %d, %v, want only the post written by the other tool updated", updated, err)
+	}
+	if updated, err := repo.RefreshTextLanguages(ctx); err != nil || updated != 0 {
+		t.Errorf("RefreshTextLanguages() again = %d, %v, want nothing left to update", updated, err)
+	}
+
+	page, err := repo.FindPage(ctx, repository.PageQuery{Search: "abstimmung", Language: "de", SortBy: repository.SortByRelevance, Limit: 10})
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+	if len(page.Posts) != 1 || page.Posts[0].TextLanguage == "" || page.Posts[0].Translations[0].TextLanguage == "" {
+		t.Errorf("FindPage() = %+v, want the refreshed post with text languages", page.Posts)
+	}
+}
+
+func TestIntegrationMongoOutboxRepository_Transactions(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	posts := repository.NewMongoPostRepository(db)
+	outbox := repository.NewMongoOutboxRepository(db)
+	transactor := repository.NewMongoTransactor(db.Client())
+	ctx := context.Background()
+	now := time.Now()
+
+	// A failed transaction writes neither the post nor its event
+	rolledBack := model.NewPost("Rolled back", "Content")
+	err := transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := posts.Create(ctx, rolledBack); err != nil {
+			return err
+		}
+		event := model.NewPostEvent(model.EventPostCreated, rolledBack.ID, rolledBack, now)
+		if err := outbox.Add(ctx, model.NewOutboxRecord(event, now)); err != nil {
+			return err
+		}
+		return fmt.Errorf("abort")
+	})
+	if err == nil {
+		t.Fatal("WithTransaction() error = nil, want the function's error")
+	}
+	if _, err := posts.FindByID(ctx, rolledBack.ID.Hex()); err != repository.ErrPostNotFound {
+		t.Errorf("FindByID() of the aborted post error = %v, want %v", err, repository.ErrPostNotFound)
+	}
+	if record, err := outbox.ClaimDue(ctx, now, time.Minute); err != nil || record != nil {
+		t.Errorf("ClaimDue() = %v, %v, want no record of the aborted transaction", record, err)
+	}
+
+	// A committed one writes both
+	post := model.NewPost("Committed", "Content")
+	var event model.PostEvent
+	err = transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := posts.Create(ctx, post); err != nil {
+			return err
+		}
+		event = model.NewPostEvent(model.EventPostCreated, post.ID, post, now)
+		return outbox.Add(ctx, model.NewOutboxRecord(event, now))
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() error = %v", err)
+	}
+
+	record, err := outbox.ClaimDue(ctx, now, time.Minute)
+	if err != nil || record == nil {
+		t.Fatalf("ClaimDue() = %v, %v, want the committed event", record, err)
+	}
+	if record.ID != event.ID || record.Event.PostID != post.ID || record.Event.Post == nil || record.Event.Post.Title != "Committed" {
+		t.Errorf("ClaimDue() = %+v, want the event of the committed post", record)
+	}
+	// Claimed records are hidden until the lease ends
+	if again, err := outbox.ClaimDue(ctx, now, time.Minute); err != nil || again != nil {
+		t.Errorf("ClaimDue() = %v, %v, want nothing while the record is leased", again, err)
+	}
+
+	record.Status = model.OutboxProcessed
+	record.HandledBy = []string{"webhooks"}
+	record.Attempts = 1
+	record.ProcessedAt = now
+	if err := outbox.SaveAttempt(ctx, record); err != nil {
+		t.Fatalf("SaveAttempt() error = %v", err)
+	}
+	if again, err := outbox.ClaimDue(ctx, now.Add(time.Hour), time.Minute); err != nil || again != nil {
+		t.Errorf("ClaimDue() = %v, %v, want nothing once the record is processed", again, err)
+	}
+}
+
+func TestIntegrationMongoPostWatcher(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	posts := repository.NewMongoPostRepository(db)
+	tokens := repository.NewMongoResumeTokenRepository(db)
+	watcher := repository.NewMongoPostWatcher(db)
+	transactor := repository.NewMongoTransactor(db.Client())
+
+	// watch collects the changes after token until the test ends
+	watch := func(token bson.Raw) (<-chan *repository.PostChange, <-chan bson.Raw) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		changes := make(chan *repository.PostChange, 10)
+		changeTokens := make(chan bson.Raw, 10)
+		go watcher.Watch(ctx, token, func(ctx context.Context, change *repository.PostChange, token bson.Raw) error {
+			if change != nil {
+				changes <- change
+				changeTokens <- token
+			}
+			return nil
+		})
+		return changes, changeTokens
+	}
+	next := func(changes <-chan *repository.PostChange) *repository.PostChange {
+		select {
+		case change := <-changes:
+			return change
+		case <-time.After(10 * time.Second):
+			t.Fatal("No change received")
+			return nil
+		}
+	}
+
+	changes, changeTokens := watch(nil)
+	// Let the stream open before writing
+	time.Sleep(time.Second)
+	ctx := context.Background()
+
+	post := model.NewPost("External", "Content")
+	post.Status = model.StatusDraft
+	if _, err := db.Collection("posts").InsertOne(ctx, post); err != nil {
+		t.Fatalf("InsertOne() error = %v", err)
+	}
+	inserted := next(changes)
+	if inserted.Operation != repository.OperationInsert || inserted.Post == nil || inserted.Post.Title != "External" {
+		t.Fatalf("change = %+v, want the insert with the post", inserted)
+	}
+	post.ID = inserted.PostID
+	if err := tokens.Save(ctx, "posts", <-changeTokens); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	// Changes made in transactions are the application's own and skipped
+	err := transactor.WithTransaction(ctx, func(ctx context.Context) error {
+		return posts.Create(ctx, model.NewPost("Application", "Content"))
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() error = %v", err)
+	}
+
+	if _, err := db.Collection("posts").UpdateByID(ctx, post.ID, bson.M{"$set": bson.M{"status": model.StatusPublished}}); err != nil {
+		t.Fatalf("UpdateByID() error = %v", err)
+	}
+	updated := next(changes)
+	if updated.Operation != repository.OperationUpdate || updated.PostID != post.ID || !updated.Published {
+		t.Errorf("change = %+v, want the update publishing the post", updated)
+	}
+
+	// A watcher resuming from the saved token starts with the change after it
+	token, err := tokens.Load(ctx, "posts")
+	if err != nil || token == nil {
+		t.Fatalf("Load() = %v, %v, want the saved token", token, err)
+	}
+	resumed, _ := watch(token)
+	if change := next(resumed); change.Operation != repository.OperationUpdate || change.PostID != post.ID {
+		t.Errorf("resumed change = %+v, want the update", change)
+	}
+}
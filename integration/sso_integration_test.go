@@ -0,0 +1,147 @@
+package integration
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/controller"
+	httproutes "github.com/iyhunko/go-htmx-mongo/internal/http"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc/oidctest"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+	"github.com/iyhunko/go-htmx-mongo/web"
+)
+
+func TestIntegrationSSO_Login(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	idp := oidctest.NewProvider(t, "news", "secret")
+	templates, err := web.LoadTemplates()
+	if err != nil {
+		t.Fatalf("Failed to load templates: %v", err)
+	}
+	users := newTestUserService(db)
+	sso := service.NewSSOService(oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "news", ClientSecret: "secret"}), users, service.SSOOptions{
+		Roles: service.RoleMapping{Claim: "groups", Groups: map[string]model.Role{"news-desk": model.RoleEditor}, Default: model.RoleReader},
+	})
+	cfg := &config.Config{OIDCIssuer: idp.Issuer(), OIDCProviderName: "Example SSO"}
+	httproutes.SetupSSORoutes(router, controller.NewSSOController(sso, users, templates, cfg), httproutes.RouteMiddleware{})
+
+	serve := func(target string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range w.Result().Cookies() {
+			if c.Name == name {
+				return c
+			}
+		}
+		return nil
+	}
+	// start begins a sign-in returning to next and follows the provider's redirect, returning the callback's
+	// path and query and the cookie keeping the sign-in
+	start := func(next string) (string, *http.Cookie) {
+		t.Helper()
+		w := serve("/login/oidc?next=" + url.QueryEscape(next))
+		login := cookie(w, "oidc_login")
+		if w.Code != http.StatusFound || login == nil || !login.HttpOnly {
+			t.Fatalf("start status = %d, cookie %v, want a redirect to the provider keeping the sign-in", w.Code, login)
+		}
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("authorize error = %v", err)
+		}
+		resp.Body.Close()
+		callback, err := url.Parse(resp.Header.Get("Location"))
+		if err != nil || callback.Path != "/login/oidc/callback" {
+			t.Fatalf("provider redirected to %q, want the callback", resp.Header.Get("Location"))
+		}
+		return callback.RequestURI(), login
+	}
+
+	// The first sign-in creates the user with the role of their groups and returns them to their page
+	idp.SignInAs(map[string]any{"sub": "u-1", "preferred_username": "Jane.Doe@corp.example", "groups": []string{"staff", "news-desk"}})
+	callback, login := start("/settings/tokens")
+	w := serve(callback, login)
+	auth := cookie(w, middleware.AuthCookieName)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/settings/tokens" || auth == nil {
+		t.Fatalf("callback status = %d, location %q, want signed in and sent to the settings", w.Code, w.Header().Get("Location"))
+	}
+	if cleared := cookie(w, "oidc_login"); cleared == nil || cleared.MaxAge >= 0 {
+		t.Error("the sign-in cookie isn't removed after the callback")
+	}
+	if w := serve("/settings/tokens", auth); w.Code != http.StatusOK {
+		t.Errorf("settings with the session status = %d, want %d", w.Code, http.StatusOK)
+	}
+
+	jane, err := repository.NewMongoUserRepository(db).FindByOIDCSubject(context.Background(), idp.Issuer(), "u-1")
+	if err != nil {
+		t.Fatalf("FindByOIDCSubject() error = %v", err)
+	}
+	if jane.Username != "jane.doe" || jane.Role != model.RoleEditor || jane.PasswordHash != "" {
+		t.Errorf("created user = %+v, want jane.doe as an editor without a password", jane)
+	}
+
+	// A callback can't be replayed, forged or completed without the browser that started it
+	if w := serve(callback, login); w.Code != http.StatusUnauthorized {
+		t.Errorf("replayed callback status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+	callback, login = start("/")
+	forged := strings.Replace(callback, "state=", "state=x", 1)
+	if w := serve(forged, login); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "single sign-on failed") {
+		t.Errorf("forged state status = %d, want %d with the reason", w.Code, http.StatusUnauthorized)
+	}
+	if w := serve(callback); w.Code != http.StatusUnauthorized {
+		t.Errorf("callback without the sign-in cookie status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	// Later sign-ins find the user by their subject and follow their groups
+	idp.SignInAs(map[string]any{"sub": "u-1", "preferred_username": "jane", "groups": []string{"staff"}})
+	callback, login = start("/")
+	if w := serve(callback, login); w.Code != http.StatusSeeOther {
+		t.Fatalf("second sign-in status = %d, body = %s", w.Code, w.Body.String())
+	}
+	all, err := repository.NewMongoUserRepository(db).FindAll(context.Background())
+	if err != nil || len(all) != 1 || all[0].Role != model.RoleReader || all[0].Username != "jane.doe" {
+		t.Errorf("users after the second sign-in = %v, %v, want jane.doe alone, now a reader", all, err)
+	}
+
+	// Existing accounts aren't taken over
+	ctx := service.WithActor(context.Background(), service.Actor{ID: "test", Role: model.RoleAdmin})
+	if _, err := users.CreateUser(ctx, service.UserInput{Username: "john", Password: "correct horse", Role: model.RoleAdmin}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	idp.SignInAs(map[string]any{"sub": "u-2", "preferred_username": "john"})
+	callback, login = start("/")
+	if w := serve(callback, login); w.Code != http.StatusConflict || cookie(w, middleware.AuthCookieName) != nil {
+		t.Errorf("sign-in as an existing user status = %d, want %d without a session", w.Code, http.StatusConflict)
+	}
+
+	// Users the provider refuses are told so
+	idp.SignInAs(nil)
+	callback, login = start("/")
+	if w := serve(callback, login); w.Code != http.StatusUnauthorized {
+		t.Errorf("refused sign-in status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
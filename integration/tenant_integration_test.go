@@ -0,0 +1,152 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+)
+
+func TestIntegrationMongoPostRepository_Tenants(t *testing.T) {
+	pool, resource, db := setupMongoDB(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	repo := repository.NewMongoPostRepository(db)
+	dailyCtx := tenant.WithID(context.Background(), "daily")
+	weeklyCtx := tenant.WithID(context.Background(), "weekly")
+
+	daily := model.NewPost("Daily Title", "Daily Content")
+	daily.Slug = "news"
+	if err := repo.Create(dailyCtx, daily); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// Slugs are unique per tenant
+	weekly := model.NewPost("Weekly Title", "Weekly Content")
+	weekly.Slug = "news"
+	if err := repo.Create(weeklyCtx, weekly); err != nil {
+		t.Fatalf("Create() of a slug used by another tenant error = %v", err)
+	}
+
+	if _, err := repo.FindByID(weeklyCtx, daily.ID.Hex()); !errors.Is(err, repository.ErrPostNotFound) {
+		t.Errorf("FindByID() of another tenant's post error = %v, want ErrPostNotFound", err)
+	}
+	if found, err := repo.FindByID(dailyCtx, daily.ID.Hex()); err != nil || found.TenantID != "daily" {
+		t.Errorf("FindByID() of an own post = %v, %v", found, err)
+	}
+
+	page, err := repo.FindPage(weeklyCtx, repository.PageQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("FindPage() error = %v", err)
+	}
+	if page.Total != 1 || len(page.Posts) != 1 || page.Posts[0].ID != weekly.ID {
+		t.Errorf("FindPage() = %d posts of %d, want only the weekly post", len(page.Posts), page.Total)
+	}
+	if count, err := repo.Count(dailyCtx); err != nil || count != 1 {
+		t.Errorf("Count() = %d, %v, want 1", count, err)
+	}
+
+	// Another tenant can neither change nor delete the post
+	stolen := *daily
+	stolen.Title = "Stolen"
+	if err := repo.Update(weeklyCtx, &stolen); !errors.Is(err, repository.ErrPostNotFound) {
+		t.Errorf("Update() of another tenant's post error = %v, want ErrPostNotFound", err)
+	}
+	if err := repo.Delete(weeklyCtx, daily.ID.Hex()); !errors.Is(err, repository.ErrPostNotFound) {
+		t.Errorf("Delete() of another tenant's post error = %v, want ErrPostNotFound", err)
+	}
+	deleted, err := repo.DeleteMany(weeklyCtx, repository.PostFilter{})
+	if err != nil {
+		t.Fatalf("DeleteMany() error = %v", err)
+	}
+	if deleted != 1 {
+		t.Errorf("DeleteMany() = %d, want only the weekly post deleted", deleted)
+	}
+
+	// Importing a post of another tenant by ID doesn't overwrite it
+	imported := &model.Post{ID: daily.ID, Title: "Imported", Content: "Imported Content"}
+	result, err := repo.BulkUpsert(weeklyCtx, []*model.Post{imported})
+	if err != nil {
+		t.Fatalf("BulkUpsert() error = %v", err)
+	}
+	if result.Updated != 0 || len(result.Failed) != 1 {
+		t.Errorf("BulkUpsert() of another tenant's post = %+v, want it to fail", result)
+	}
+
+	found, err := repo.FindByID(dailyCtx, daily.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if found.Title != "Daily Title" {
+		t.Errorf("daily post title = %q, want it unchanged by another tenant", found.Title)
+	}
+}
+
+func TestIntegrationAPI_Tenants(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	registry, err := tenant.NewRegistry([]tenant.Tenant{
+		{ID: "daily", Hosts: []string{"daily.example.com"}, Branding: tenant.Branding{Title: "The Daily"}},
+		{ID: "weekly", PathPrefix: "/weekly"},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	handler := tenant.Handler(registry, router)
+
+	postRepo := repository.NewMongoPostRepository(db)
+	for id, title := range map[string]string{tenant.DefaultID: "Default Title", "daily": "Daily Title", "weekly": "Weekly Title"} {
+		if err := postRepo.Create(tenant.WithID(context.Background(), id), model.NewPost(title, "Content")); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		host      string
+		path      string
+		wantTitle string
+		wantText  string
+	}{
+		{"default tenant", "example.com", "/posts", "Default Title", `href="/posts/view?id=`},
+		{"tenant by host", "daily.example.com", "/posts", "Daily Title", "The Daily"},
+		{"tenant by path prefix", "example.com", "/weekly/posts", "Weekly Title", `href="/weekly/posts/view?id=`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d", w.Code)
+			}
+			body := w.Body.String()
+			if !strings.Contains(body, tt.wantTitle) || !strings.Contains(body, tt.wantText) {
+				t.Errorf("Expected response to contain %q and %q", tt.wantTitle, tt.wantText)
+			}
+			for _, title := range []string{"Default Title", "Daily Title", "Weekly Title"} {
+				if title != tt.wantTitle && strings.Contains(body, title) {
+					t.Errorf("Response leaked the post %q of another tenant", title)
+				}
+			}
+		})
+	}
+}
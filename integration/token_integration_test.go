@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// tokenPattern finds a newly created API token on the settings page
+var tokenPattern = regexp.MustCompile(service.TokenPrefix + `[A-Za-z0-9_-]+`)
+
+func TestIntegrationAPI_Tokens(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	ctx := service.WithActor(context.Background(), service.Actor{ID: "test", Role: model.RoleAdmin})
+	users := newTestUserService(db)
+	jane, err := users.CreateUser(ctx, service.UserInput{Username: "jane", Password: "correct horse", Role: model.RoleAuthor})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	session, _, err := users.Login(ctx, "jane", "correct horse")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	auth := &http.Cookie{Name: middleware.AuthCookieName, Value: session}
+
+	serve := func(method, target, body string, cookie *http.Cookie, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if strings.HasPrefix(target, "/api/") {
+			req.Header.Set("Content-Type", "application/json")
+		} else if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	createToken := func(scopes ...string) string {
+		form := url.Values{"name": {"CI " + strings.Join(scopes, "+")}, "scopes": scopes, "expires_in": {"30"}}
+		w := serve(http.MethodPost, "/settings/tokens", form.Encode(), auth, "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create token status = %d, body = %s", w.Code, w.Body.String())
+		}
+		token := tokenPattern.FindString(w.Body.String())
+		if token == "" {
+			t.Fatal("the created token isn't shown")
+		}
+		return token
+	}
+
+	// The settings page is only for signed-in users, who may only get scopes their role can use
+	if w := serve(http.MethodGet, "/settings/tokens", "", nil, ""); w.Code != http.StatusSeeOther {
+		t.Errorf("anonymous settings status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	if w := serve(http.MethodGet, "/settings/tokens", "", auth, ""); w.Code != http.StatusOK {
+		t.Errorf("settings status = %d, want %d", w.Code, http.StatusOK)
+	}
+	form := url.Values{"name": {"backups"}, "scopes": {"admin"}, "expires_in": {"30"}}
+	if w := serve(http.MethodPost, "/settings/tokens", form.Encode(), auth, ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("create admin token as author status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	// Tokens act as their user, within their scopes
+	writer := createToken("read", "write")
+	w := serve(http.MethodPost, "/api/posts", `{"title": "From CI", "content": "Published by a script"}`, nil, writer)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create with token status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var post model.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+		t.Fatalf("failed to decode post: %v", err)
+	}
+	if post.AuthorID != jane.ID.Hex() || post.Status != model.StatusDraft {
+		t.Errorf("post created with a token = %q, %s, want written by jane as a draft", post.AuthorID, post.Status)
+	}
+	if w := serve(http.MethodDelete, "/api/posts/"+post.ID.Hex(), "", nil, writer); w.Code != http.StatusForbidden {
+		t.Errorf("delete with the token of an author status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	reader := createToken("read")
+	if w := serve(http.MethodGet, "/api/posts/"+post.ID.Hex(), "", nil, reader); w.Code != http.StatusOK {
+		t.Errorf("read with a read token status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if w := serve(http.MethodPost, "/api/posts", `{"title": "Denied", "content": "Read only"}`, nil, reader); w.Code != http.StatusForbidden {
+		t.Errorf("create with a read token status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(http.MethodGet, "/api/posts", "", nil, createToken("write")); w.Code != http.StatusForbidden {
+		t.Errorf("read with a write token status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	w = serve(http.MethodGet, "/api/posts", "", nil, service.TokenPrefix+"unknown")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("unknown token = %d, WWW-Authenticate %q, want %d with a challenge", w.Code, w.Header().Get("WWW-Authenticate"), http.StatusUnauthorized)
+	}
+
+	// Uses are recorded, and revoked tokens stop working
+	tokens, err := repository.NewMongoTokenRepository(db).FindForUser(context.Background(), jane.ID)
+	if err != nil || len(tokens) != 3 {
+		t.Fatalf("FindForUser() = %d tokens, %v, want 3", len(tokens), err)
+	}
+	var writerToken *model.APIToken
+	for _, token := range tokens {
+		if strings.HasPrefix(writer, token.Prefix) && token.HasScope(model.ScopeWrite) && token.HasScope(model.ScopeRead) {
+			writerToken = token
+		}
+	}
+	if writerToken == nil || writerToken.LastUsedAt.IsZero() || writerToken.ExpiresAt.IsZero() {
+		t.Fatalf("stored token = %+v, want its last use and expiry", writerToken)
+	}
+	if strings.Contains(writerToken.Hash, writer) {
+		t.Error("the token is stored in plain text")
+	}
+
+	if w := serve(http.MethodPost, "/settings/tokens/"+writerToken.ID.Hex()+"/delete", "", auth, ""); w.Code != http.StatusSeeOther {
+		t.Fatalf("revoke status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := serve(http.MethodGet, "/api/posts", "", nil, writer); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
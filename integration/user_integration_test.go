@@ -0,0 +1,98 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+func TestIntegrationAPI_UsersAndRoles(t *testing.T) {
+	router, pool, resource, db := setupTestServer(t)
+	defer func() {
+		if err := pool.Purge(resource); err != nil {
+			log.Printf("Could not purge resource: %s", err)
+		}
+	}()
+
+	ctx := service.WithActor(context.Background(), service.Actor{ID: "test", Role: model.RoleAdmin})
+	users := newTestUserService(db)
+	if _, err := users.CreateUser(ctx, service.UserInput{Username: "jane", Password: "correct horse", Role: model.RoleAuthor}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	serve := func(method, target, body, contentType string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		form := url.Values{"username": {"Jane"}, "password": {password}, "next": {"/posts?page=2"}}
+		return serve(http.MethodPost, "/login", form.Encode(), "application/x-www-form-urlencoded", nil)
+	}
+
+	if w := login("wrong horse"); w.Code != http.StatusUnauthorized {
+		t.Errorf("sign-in with a wrong password status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w := login("correct horse")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/posts?page=2" {
+		t.Fatalf("sign-in = %d to %q, want %d to the next page", w.Code, w.Header().Get("Location"), http.StatusSeeOther)
+	}
+	var auth *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == middleware.AuthCookieName {
+			auth = cookie
+		}
+	}
+	if auth == nil || !auth.HttpOnly {
+		t.Fatalf("sign-in cookie = %+v, want an HTTP-only auth cookie", auth)
+	}
+
+	// Authors write drafts under their name but may not delete posts or manage users
+	w = serve(http.MethodPost, "/api/posts", `{"title": "Draft", "content": "Written by jane"}`, "application/json", auth)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create as author status = %d, body = %s", w.Code, w.Body.String())
+	}
+	var post model.Post
+	if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+		t.Fatalf("failed to decode post: %v", err)
+	}
+	if post.AuthorID == "" || post.Status != model.StatusDraft {
+		t.Errorf("post of an author = %q, %s, want an author and a draft", post.AuthorID, post.Status)
+	}
+
+	if w := serve(http.MethodDelete, "/api/posts/"+post.ID.Hex(), "", "", auth); w.Code != http.StatusForbidden {
+		t.Errorf("delete as author status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(http.MethodGet, "/admin/users", "", "", auth); w.Code != http.StatusForbidden {
+		t.Errorf("users page as author status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if w := serve(http.MethodGet, "/", "", "", auth); !strings.Contains(w.Body.String(), "jane") || strings.Contains(w.Body.String(), "/admin/users") {
+		t.Errorf("home page as author doesn't name jane or links to the users page")
+	}
+
+	// Signing out ends the session, and the old cookie is removed when it is sent again
+	if w := serve(http.MethodPost, "/logout", "", "", auth); w.Code != http.StatusSeeOther {
+		t.Errorf("sign-out status = %d, want %d", w.Code, http.StatusSeeOther)
+	}
+	w = serve(http.MethodGet, "/", "", "", auth)
+	if !strings.Contains(w.Header().Get("Set-Cookie"), middleware.AuthCookieName+"=;") {
+		t.Errorf("Set-Cookie after sign-out = %q, want the auth cookie removed", w.Header().Get("Set-Cookie"))
+	}
+}
@@ -0,0 +1,298 @@
+// Package backup reads and writes backup archives: gzip compressed tar files holding a manifest
+// followed by one file of MongoDB Extended JSON Lines per collection
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// FormatVersion is the version of the archive layout written by Writer
+const FormatVersion = 1
+
+// manifestName is the name of the manifest, the first file of every archive
+const manifestName = "manifest.json"
+
+// maxDocumentSize bounds a single line; MongoDB documents are at most 16 MB as BSON
+const maxDocumentSize = 64 * 1024 * 1024
+
+// ErrInvalidArchive is returned for archives that are damaged, incomplete or not backups
+var ErrInvalidArchive = errors.New("invalid backup archive")
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// Database is the name of the database the backup was taken from
+	Database string `json:"database"`
+	// Consistent reports whether every collection was read at the same point in time
+	Consistent  bool         `json:"consistent"`
+	Collections []Collection `json:"collections"`
+}
+
+// Collection describes the file of one collection in an archive
+type Collection struct {
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Documents int64  `json:"documents"`
+	// SHA256 is the hex encoded checksum of the file
+	SHA256 string `json:"sha256"`
+}
+
+// fileTimeLayout formats creation times in archive names
+const fileTimeLayout = "20060102T150405Z"
+
+// FileName returns the name of an archive created at t, e.g. "backup-20240501T120000Z.tar.gz".
+// Names sort in the order the archives were created.
+func FileName(t time.Time) string {
+	return "backup-" + t.UTC().Format(fileTimeLayout) + ".tar.gz"
+}
+
+// ParseFileName returns the creation time of an archive named by FileName
+func ParseFileName(name string) (time.Time, bool) {
+	stamp, ok := strings.CutPrefix(name, "backup-")
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(fileTimeLayout, strings.TrimSuffix(stamp, ".tar.gz"))
+	return t, err == nil && FileName(t) == name
+}
+
+// Writer collects collections in temporary files, since tar entries need their size up front,
+// and then writes them with their manifest as an archive. Close removes the temporary files.
+type Writer struct {
+	dir         string
+	collections []*collectionFile
+}
+
+type collectionFile struct {
+	Collection
+	path   string
+	file   *os.File
+	buffer *bufio.Writer
+	hash   hash.Hash
+}
+
+// NewWriter creates a writer keeping its temporary files in a new directory under the system's temporary directory
+func NewWriter() (*Writer, error) {
+	dir, err := os.MkdirTemp("", "backup-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// StartCollection starts the file of the named collection; Add appends documents to it until the next collection starts
+func (w *Writer) StartCollection(name string) error {
+	if err := w.endCollection(); err != nil {
+		return err
+	}
+
+	c := &collectionFile{
+		Collection: Collection{Name: name, File: name + ".jsonl"},
+		path:       filepath.Join(w.dir, fmt.Sprintf("%d.jsonl", len(w.collections))),
+		hash:       sha256.New(),
+	}
+	file, err := os.Create(c.path)
+	if err != nil {
+		return err
+	}
+	c.file = file
+	c.buffer = bufio.NewWriter(io.MultiWriter(file, c.hash))
+	w.collections = append(w.collections, c)
+	return nil
+}
+
+// Add appends a document to the current collection as a line of canonical Extended JSON, which keeps its BSON types
+func (w *Writer) Add(doc bson.Raw) error {
+	if len(w.collections) == 0 || w.collections[len(w.collections)-1].file == nil {
+		return errors.New("no collection started")
+	}
+	c := w.collections[len(w.collections)-1]
+
+	data, err := bson.MarshalExtJSON(doc, true, false)
+	if err != nil {
+		return err
+	}
+	if _, err := c.buffer.Write(data); err != nil {
+		return err
+	}
+	if err := c.buffer.WriteByte('\n'); err != nil {
+		return err
+	}
+	c.Documents++
+	return nil
+}
+
+// endCollection completes the file of the current collection
+func (w *Writer) endCollection() error {
+	if len(w.collections) == 0 {
+		return nil
+	}
+	c := w.collections[len(w.collections)-1]
+	if c.file == nil {
+		return nil
+	}
+	if err := c.buffer.Flush(); err != nil {
+		return err
+	}
+	c.SHA256 = hex.EncodeToString(c.hash.Sum(nil))
+	err := c.file.Close()
+	c.file = nil
+	return err
+}
+
+// Finish writes the archive of the added collections to out and returns its manifest,
+// which is manifest with the format version and collections filled in
+func (w *Writer) Finish(out io.Writer, manifest Manifest) (*Manifest, error) {
+	if err := w.endCollection(); err != nil {
+		return nil, err
+	}
+	manifest.FormatVersion = FormatVersion
+	manifest.Collections = make([]Collection, len(w.collections))
+	for i, c := range w.collections {
+		manifest.Collections[i] = c.Collection
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	gz := gzip.NewWriter(out)
+	archive := tar.NewWriter(gz)
+	if err := writeEntry(archive, manifestName, int64(len(data)), manifest.CreatedAt, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	for _, c := range w.collections {
+		if err := w.writeCollection(archive, c, manifest.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (w *Writer) writeCollection(archive *tar.Writer, c *collectionFile, modTime time.Time) error {
+	file, err := os.Open(c.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	return writeEntry(archive, c.File, info.Size(), modTime, file)
+}
+
+// Close removes the temporary files
+func (w *Writer) Close() error {
+	for _, c := range w.collections {
+		if c.file != nil {
+			c.file.Close()
+		}
+	}
+	return os.RemoveAll(w.dir)
+}
+
+func writeEntry(archive *tar.Writer, name string, size int64, modTime time.Time, r io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0o644, Size: size, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := archive.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := io.Copy(archive, r)
+	return err
+}
+
+// Read reads an archive, calling fn with every document in the order of the manifest's collections.
+// It checks the document counts and checksums of the manifest as it goes: fn may have seen documents
+// of a damaged collection before Read reports it, so read archives once with a nil fn to only verify them.
+func Read(r io.Reader, fn func(collection string, doc bson.Raw) error) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+
+	header, err := archive.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("%w: missing manifest", ErrInvalidArchive)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrInvalidArchive, err)
+	}
+	if manifest.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("%w: unsupported format version %d", ErrInvalidArchive, manifest.FormatVersion)
+	}
+
+	for _, c := range manifest.Collections {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("%w: missing %s", ErrInvalidArchive, c.File)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if header.Name != c.File {
+			return nil, fmt.Errorf("%w: found %s where %s was expected", ErrInvalidArchive, header.Name, c.File)
+		}
+		if err := readCollection(archive, c, fn); err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+// readCollection reads the file of collection c, checking it against the manifest
+func readCollection(r io.Reader, c Collection, fn func(collection string, doc bson.Raw) error) error {
+	checksum := sha256.New()
+	scanner := bufio.NewScanner(io.TeeReader(r, checksum))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDocumentSize)
+
+	var documents int64
+	for scanner.Scan() {
+		documents++
+		var doc bson.Raw
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return fmt.Errorf("%w: %s line %d: %v", ErrInvalidArchive, c.File, documents, err)
+		}
+		if fn != nil {
+			if err := fn(c.Name, doc); err != nil {
+				return fmt.Errorf("%s line %d: %w", c.File, documents, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidArchive, c.File, err)
+	}
+
+	if documents != c.Documents {
+		return fmt.Errorf("%w: %s holds %d documents, the manifest lists %d", ErrInvalidArchive, c.File, documents, c.Documents)
+	}
+	if sum := hex.EncodeToString(checksum.Sum(nil)); sum != c.SHA256 {
+		return fmt.Errorf("%w: checksum of %s doesn't match the manifest", ErrInvalidArchive, c.File)
+	}
+	return nil
+}
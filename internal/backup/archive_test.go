@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func marshal(t *testing.T, doc bson.D) bson.Raw {
+	t.Helper()
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatalf("bson.Marshal() error = %v", err)
+	}
+	return raw
+}
+
+// writeArchive writes an archive of the collections, in order, and returns it
+func writeArchive(t *testing.T, collections map[string][]bson.Raw, order ...string) []byte {
+	t.Helper()
+	writer, err := NewWriter()
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	defer writer.Close()
+
+	for _, name := range order {
+		if err := writer.StartCollection(name); err != nil {
+			t.Fatalf("StartCollection() error = %v", err)
+		}
+		for _, doc := range collections[name] {
+			if err := writer.Add(doc); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := writer.Finish(&out, Manifest{CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Database: "newsdb", Consistent: true}); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	posts := []bson.Raw{
+		marshal(t, bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "First"}, {Key: "created_at", Value: created}}),
+		marshal(t, bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Second"}, {Key: "tags", Value: bson.A{"go", "news"}}, {Key: "views", Value: int64(42)}}),
+	}
+	data := writeArchive(t, map[string][]bson.Raw{"posts": posts}, "posts", "webhooks")
+
+	var read []bson.Raw
+	var collections []string
+	manifest, err := Read(bytes.NewReader(data), func(collection string, doc bson.Raw) error {
+		collections = append(collections, collection)
+		read = append(read, doc)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if manifest.FormatVersion != FormatVersion || manifest.Database != "newsdb" || !manifest.Consistent {
+		t.Errorf("manifest = %+v, want the written one", manifest)
+	}
+	if len(manifest.Collections) != 2 || manifest.Collections[0].Documents != 2 || manifest.Collections[1].Documents != 0 {
+		t.Errorf("manifest collections = %+v, want 2 posts and no webhooks", manifest.Collections)
+	}
+	if len(read) != 2 || collections[0] != "posts" {
+		t.Fatalf("Read() returned %d documents of %v, want the 2 posts", len(read), collections)
+	}
+	for i := range posts {
+		// Canonical Extended JSON keeps every BSON type, so documents come back byte for byte
+		if !bytes.Equal(read[i], posts[i]) {
+			t.Errorf("document %d = %s, want %s", i, read[i], posts[i])
+		}
+	}
+}
+
+func TestReadRejectsDamagedArchives(t *testing.T) {
+	doc := marshal(t, bson.D{{Key: "_id", Value: primitive.NewObjectID()}, {Key: "title", Value: "Post"}})
+	valid := writeArchive(t, map[string][]bson.Raw{"posts": {doc}}, "posts")
+
+	// rewrite copies the archive, letting edit change the contents of each file
+	rewrite := func(edit func(name string, data []byte) []byte) []byte {
+		gz, err := gzip.NewReader(bytes.NewReader(valid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		in := tar.NewReader(gz)
+		var out bytes.Buffer
+		gzOut := gzip.NewWriter(&out)
+		tarOut := tar.NewWriter(gzOut)
+		for {
+			header, err := in.Next()
+			if err == io.EOF {
+				break
+			}
+			data, _ := io.ReadAll(in)
+			if data = edit(header.Name, data); data == nil {
+				continue
+			}
+			header.Size = int64(len(data))
+			tarOut.WriteHeader(header)
+			tarOut.Write(data)
+		}
+		tarOut.Close()
+		gzOut.Close()
+		return out.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+	}{
+		{"not gzip", []byte("posts")},
+		{"changed document", rewrite(func(name string, data []byte) []byte {
+			return bytes.Replace(data, []byte("Post"), []byte("Tost"), 1)
+		})},
+		{"missing document", rewrite(func(name string, data []byte) []byte {
+			if name == "posts.jsonl" {
+				return []byte{}
+			}
+			return data
+		})},
+		{"missing collection", rewrite(func(name string, data []byte) []byte {
+			if name == "posts.jsonl" {
+				return nil
+			}
+			return data
+		})},
+		{"unsupported version", rewrite(func(name string, data []byte) []byte {
+			return bytes.Replace(data, []byte(`"format_version": 1`), []byte(`"format_version": 2`), 1)
+		})},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Read(bytes.NewReader(tt.archive), nil); !errors.Is(err, ErrInvalidArchive) {
+				t.Errorf("Read() error = %v, want ErrInvalidArchive", err)
+			}
+		})
+	}
+}
+
+func TestFileName(t *testing.T) {
+	created := time.Date(2024, 5, 1, 12, 30, 5, 0, time.FixedZone("CEST", 2*60*60))
+	name := FileName(created)
+	if name != "backup-20240501T103005Z.tar.gz" {
+		t.Errorf("FileName() = %q", name)
+	}
+
+	parsed, ok := ParseFileName(name)
+	if !ok || !parsed.Equal(created) {
+		t.Errorf("ParseFileName(%q) = %v, %v, want %v", name, parsed, ok, created)
+	}
+	for _, other := range []string{"backup.tar.gz", "backup-latest.tar.gz", "backup-20240501T103005Z.tar.gz.tmp", "notes.txt"} {
+		if _, ok := ParseFileName(other); ok {
+			t.Errorf("ParseFileName(%q) accepted a name FileName doesn't produce", other)
+		}
+	}
+}
@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Backend is a cache shared between application replicas, such as Redis or memcached.
+// Implementations must be safe for concurrent use. Values are opaque bytes.
+type Backend interface {
+	// Get returns the value stored under key and whether it was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for at most ttl
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the given keys; missing keys are not an error
+	Delete(ctx context.Context, keys ...string) error
+	// Purge removes every key with the given prefix
+	Purge(ctx context.Context, prefix string) error
+}
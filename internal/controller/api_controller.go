@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// errInvalidJSON is returned when a request body can't be decoded
+var errInvalidJSON = &service.Error{Kind: service.KindInvalid, Code: "invalid_json", Message: "invalid JSON body"}
+
+// APIListPosts returns a page of posts as JSON.
+// It accepts the same query parameters as the HTML posts list.
+func (c *PostController) APIListPosts(ctx *gin.Context) {
+	params := parseListParams(ctx)
+
+	query, err := params.query(pageSize(ctx, c.config))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	posts, pagination, err := c.service.ListPosts(ctx.Request.Context(), query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	// Posts restricted to a language are returned in it; otherwise titles and contents are the originals
+	if params.Language != "" {
+		for i, post := range posts {
+			posts[i] = post.Localized(params.Language)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"posts": posts, "pagination": pagination})
+}
+
+// APIGetPost returns a single post as JSON.
+// With the language query parameter, the title and content are in that language when it's available.
+func (c *PostController) APIGetPost(ctx *gin.Context) {
+	post, err := c.service.GetPost(ctx.Request.Context(), ctx.Param("id"))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	if language := ctx.Query("language"); language != "" {
+		post = post.Localized(language)
+	}
+
+	ctx.JSON(http.StatusOK, post)
+}
+
+// APICreatePost creates a post from a JSON body with title, content and tags.
+// Validation failures are returned as 422 with every failing field by the error middleware.
+func (c *PostController) APICreatePost(ctx *gin.Context) {
+	var input service.PostInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.Error(errInvalidJSON)
+		return
+	}
+
+	post, err := c.service.CreatePost(ctx.Request.Context(), input)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Post created via API", "id", post.ID.Hex())
+	ctx.JSON(http.StatusCreated, post)
+}
+
+// APIUpdatePost updates a post from a JSON body with title, content and tags.
+// Tags are left unchanged when omitted.
+func (c *PostController) APIUpdatePost(ctx *gin.Context) {
+	var input service.PostInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.Error(errInvalidJSON)
+		return
+	}
+
+	post, err := c.service.UpdatePost(ctx.Request.Context(), ctx.Param("id"), input)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Post updated via API", "id", post.ID.Hex())
+	ctx.JSON(http.StatusOK, post)
+}
+
+// APIDeletePost deletes a post
+func (c *PostController) APIDeletePost(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.service.DeletePost(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Post deleted via API", "id", id)
+	ctx.Status(http.StatusNoContent)
+}
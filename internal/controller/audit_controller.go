@@ -0,0 +1,175 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// AuditController handles the admin pages of the audit log
+type AuditController struct {
+	service   *service.AuditService
+	templates Templates
+	config    *config.Config
+}
+
+// NewAuditController creates a new audit log controller
+func NewAuditController(service *service.AuditService, templates Templates, cfg *config.Config) *AuditController {
+	return &AuditController{
+		service:   service,
+		templates: templates,
+		config:    cfg,
+	}
+}
+
+// auditParams is the state of the audit log page as carried in URL query parameters
+type auditParams struct {
+	Action string
+	PostID string
+	Actor  string
+	// From and To are inclusive dates
+	From string
+	To   string
+	Page int
+}
+
+// parseAuditParams reads the audit log filters from the request query
+func parseAuditParams(ctx *gin.Context) auditParams {
+	params := auditParams{
+		Action: strings.TrimSpace(ctx.Query("action")),
+		PostID: strings.TrimSpace(ctx.Query("post_id")),
+		Actor:  strings.TrimSpace(ctx.Query("actor")),
+		From:   strings.TrimSpace(ctx.Query("from")),
+		To:     strings.TrimSpace(ctx.Query("to")),
+		Page:   1,
+	}
+	if parsed, err := strconv.Atoi(ctx.Query("page")); err == nil && parsed > 0 {
+		params.Page = parsed
+	}
+	return params
+}
+
+// query converts the parameters into a service query
+func (p auditParams) query(pageSize int) (service.AuditQuery, error) {
+	query := service.AuditQuery{
+		Action:   p.Action,
+		PostID:   p.PostID,
+		Actor:    p.Actor,
+		Page:     p.Page,
+		PageSize: pageSize,
+	}
+
+	if p.From != "" {
+		from, err := time.Parse(dateLayout, p.From)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid from date %q", service.ErrValidationFailed, p.From)
+		}
+		query.From = from
+	}
+	if p.To != "" {
+		to, err := time.Parse(dateLayout, p.To)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid to date %q", service.ErrValidationFailed, p.To)
+		}
+		// The to date is inclusive
+		query.To = to.AddDate(0, 0, 1)
+	}
+
+	return query, nil
+}
+
+// values encodes the parameters, leaving out defaults
+func (p auditParams) values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("action", p.Action)
+	set("post_id", p.PostID)
+	set("actor", p.Actor)
+	set("from", p.From)
+	set("to", p.To)
+	if p.Page > 1 {
+		values.Set("page", strconv.Itoa(p.Page))
+	}
+	return values
+}
+
+// PageQuery returns the query string for page n of the audit log
+func (p auditParams) PageQuery(n int) template.URL {
+	p.Page = n
+	return template.URL(p.values().Encode())
+}
+
+// ExportQuery returns the query string exporting every entry matching the filters
+func (p auditParams) ExportQuery() template.URL {
+	p.Page = 1
+	return template.URL(p.values().Encode())
+}
+
+// Filtered reports whether any filter restricts the audit log
+func (p auditParams) Filtered() bool {
+	return p.Action != "" || p.PostID != "" || p.Actor != "" || p.From != "" || p.To != ""
+}
+
+// AuditLog shows a page of the audit log, newest first.
+// Query parameters: action, post_id, actor, from and to (inclusive dates), and page.
+func (c *AuditController) AuditLog(ctx *gin.Context) {
+	params := parseAuditParams(ctx)
+
+	query, err := params.query(pageSize(ctx, c.config))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	entries, pagination, err := c.service.ListEntries(ctx.Request.Context(), query)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	renderTemplate(ctx, c.templates, "audit-log.html", map[string]interface{}{
+		"Entries":    entries,
+		"Pagination": pagination,
+		"Filter":     params,
+		"Actions":    model.AuditActions,
+	})
+}
+
+// ExportAuditLog streams every audit entry matching the filters of AuditLog as JSON Lines, oldest first
+func (c *AuditController) ExportAuditLog(ctx *gin.Context) {
+	query, err := parseAuditParams(ctx).query(0)
+	if err == nil {
+		err = query.Validate()
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	ctx.Header("Content-Type", "application/x-ndjson")
+	ctx.Header("Content-Disposition", `attachment; filename="audit-log.jsonl"`)
+	ctx.Status(http.StatusOK)
+
+	count, err := c.service.ExportEntries(ctx.Request.Context(), ctx.Writer, query)
+	if err != nil {
+		// Headers are already sent, so the client sees a truncated body
+		slog.Error("Failed to export audit log", "error", err, "exported", count)
+		return
+	}
+
+	slog.Info("Audit log exported", "count", count)
+}
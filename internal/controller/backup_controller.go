@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/backup"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+)
+
+var errBackupNotFound = &service.Error{Kind: service.KindNotFound, Code: "not_found", Message: "backup not found"}
+
+// BackupController handles backup downloads
+type BackupController struct {
+	service *service.BackupService
+}
+
+// NewBackupController creates a new backup controller
+func NewBackupController(service *service.BackupService) *BackupController {
+	return &BackupController{service: service}
+}
+
+// DownloadBackup takes a backup and sends it as an archive download.
+// Archives hold the documents of every tenant, so only the default tenant's admins can download them.
+func (c *BackupController) DownloadBackup(ctx *gin.Context) {
+	if tenant.ID(ctx.Request.Context()) != tenant.DefaultID {
+		ctx.Error(errBackupNotFound)
+		return
+	}
+
+	out := &attachmentWriter{ctx: ctx, name: backup.FileName(time.Now()), contentType: "application/gzip"}
+	manifest, err := c.service.Backup(ctx.Request.Context(), out)
+	if err != nil {
+		if !out.started {
+			ctx.Error(err)
+			return
+		}
+		// Headers are already sent, so the client sees a truncated archive
+		slog.Error("Failed to send backup", "error", err)
+		return
+	}
+
+	slog.Info("Backup downloaded", "collections", len(manifest.Collections), "consistent", manifest.Consistent)
+}
+
+// attachmentWriter sends the response headers of a download on its first write,
+// so that errors before any data is ready are rendered as usual
+type attachmentWriter struct {
+	ctx         *gin.Context
+	name        string
+	contentType string
+	started     bool
+}
+
+func (w *attachmentWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.ctx.Header("Content-Type", w.contentType)
+		w.ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", w.name))
+		w.ctx.Status(http.StatusOK)
+	}
+	return w.ctx.Writer.Write(p)
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// BulkAction applies delete, tag, untag or status changes to the selected posts.
+// Form fields: action, ids (repeated), scope ("selected" or "all"), filter (the list's filters as a query string,
+// e.g. "search=go&status=draft", selecting the posts for scope "all"), tags and status.
+// Responds with a summary fragment and triggers a posts list refresh, also when the action stopped
+// after some of its batches were written.
+func (c *PostController) BulkAction(ctx *gin.Context) {
+	action := ctx.PostForm("action")
+	filter, err := url.ParseQuery(ctx.PostForm("filter"))
+	if err != nil {
+		ctx.Error(fmt.Errorf("%w: invalid filter %q", service.ErrValidationFailed, ctx.PostForm("filter")))
+		return
+	}
+	query, err := listParamsFrom(filter).query(0)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	selection := service.BulkSelection{
+		IDs:         ctx.PostFormArray("ids"),
+		AllMatching: ctx.PostForm("scope") == "all",
+		Filter:      query,
+	}
+
+	slog.Info("Applying bulk action", "action", action, "selected", len(selection.IDs), "allMatching", selection.AllMatching)
+
+	var summary *service.BulkSummary
+
+	switch action {
+	case service.BulkActionDelete:
+		summary, err = c.service.BulkDelete(ctx.Request.Context(), selection)
+	case service.BulkActionTag, service.BulkActionUntag:
+		tags := model.ParseTags(ctx.PostForm("tags"))
+		summary, err = c.service.BulkTag(ctx.Request.Context(), selection, tags, action == service.BulkActionUntag)
+	case service.BulkActionStatus:
+		status := model.PostStatus(ctx.PostForm("status"))
+		summary, err = c.service.BulkSetStatus(ctx.Request.Context(), selection, status)
+	default:
+		ctx.Error(fmt.Errorf("%w: unknown bulk action %q", service.ErrValidationFailed, action))
+		return
+	}
+
+	data := map[string]interface{}{"Summary": summary}
+	if err != nil {
+		if summary == nil || summary.Applied == 0 {
+			ctx.Error(err)
+			return
+		}
+		// Earlier batches were written, so the posts changed even though the action didn't complete
+		slog.Error("Bulk action stopped", "action", action, "applied", summary.Applied, "requested", summary.Requested, "error", err)
+		data["Error"] = middleware.Localizer(ctx).T("error." + service.CodeOf(err))
+	}
+
+	slog.Info("Bulk action applied",
+		"action", action,
+		"requested", summary.Requested,
+		"affected", summary.Affected,
+		"failures", len(summary.Failures),
+	)
+
+	ctx.Writer.Header().Set("HX-Trigger", "postsChanged")
+	c.render(ctx, "bulk-summary.html", data)
+}
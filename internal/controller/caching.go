@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/cache"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+)
+
+// UseFragmentCache enables server-side caching of rendered list fragments.
+// The cache must be purged whenever posts change, e.g. from a service change listener.
+func (c *PostController) UseFragmentCache(fragments *cache.LRU[string, []byte]) {
+	c.fragments = fragments
+}
+
+// notModified sets an ETag derived from the posts collection version and the session
+// and reports whether the client's cached copy is still current. In that case it has already
+// responded with 304 Not Modified and the handler must return.
+func (c *PostController) notModified(ctx *gin.Context) bool {
+	version, err := c.service.Version(ctx.Request.Context())
+	if err != nil {
+		// Caching is an optimization; serve a fresh response instead of failing
+		slog.Warn("Failed to get posts version", "error", err)
+		return false
+	}
+
+	// Pages embed the session's CSRF token, so the validator is per session as well as per URL.
+	// The URL is the one within the tenant, whose pages link with its path prefix.
+	// The actions shown depend on the signed-in user, who may change within a session.
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%d|%d|%s|%s|%s|%s|%s|%s",
+		version.LastModified.UnixNano(),
+		version.Count,
+		tenant.ID(ctx.Request.Context()),
+		ctx.Request.URL.RequestURI(),
+		middleware.CSRFToken(ctx),
+		ctx.GetHeader("HX-Request"),
+		localeKey(ctx),
+		actorKey(ctx),
+	)
+	etag := `W/"` + hex.EncodeToString(hash.Sum(nil))[:32] + `"`
+
+	header := ctx.Writer.Header()
+	header.Set("ETag", etag)
+	header.Add("Vary", "Cookie")
+	header.Add("Vary", "HX-Request")
+	header.Add("Vary", "Accept-Language")
+
+	// There's no Last-Modified validator: a timestamp misses deletions, which don't leave a newer one behind,
+	// and everything else the page depends on, so If-Modified-Since would revalidate stale pages.
+	if !etagMatches(ctx.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+
+	// The cached page carries the CSP nonce it was served with. Dropping the policy from the 304
+	// keeps the browser's stored policy, which matches that nonce, instead of replacing it.
+	header.Del("Content-Security-Policy")
+	header.Del("Content-Security-Policy-Report-Only")
+	ctx.Status(http.StatusNotModified)
+	ctx.Writer.WriteHeaderNow()
+	return true
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag using weak comparison
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// fragmentKey builds a fragment cache key from the template name and everything its output depends on.
+// Each part is prefixed with its length, so that different parts can't run together into the same key,
+// e.g. tenant "news" with page size 25 and tenant "news2" with page size 5.
+func fragmentKey(name string, parts ...interface{}) string {
+	var key strings.Builder
+	key.WriteString(name)
+	for _, part := range parts {
+		value := fmt.Sprint(part)
+		fmt.Fprintf(&key, "|%d:%s", len(value), value)
+	}
+	return key.String()
+}
+
+// localeKey identifies the language and time zone pages are rendered in, for cache keys
+func localeKey(ctx *gin.Context) string {
+	localizer := middleware.Localizer(ctx)
+	return localizer.Locale + "|" + localizer.Location.String()
+}
+
+// actorKey identifies whose actions pages show: the user, who may edit their own posts, and their role.
+// Anonymous visitors share a key.
+func actorKey(ctx *gin.Context) string {
+	actor := service.ActorFrom(ctx.Request.Context())
+	return actor.ID + "|" + string(actor.Role)
+}
+
+// writeCachedFragment writes the cached fragment for key and reports whether it was found
+func (c *PostController) writeCachedFragment(ctx *gin.Context, key string) bool {
+	if c.fragments == nil {
+		return false
+	}
+
+	fragment, ok := c.fragments.Get(key)
+	if !ok {
+		return false
+	}
+
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", fragment)
+	return true
+}
+
+// renderFragment renders a template that doesn't depend on per-request values such as the
+// CSRF token or CSP nonce, storing the output in the fragment cache. The output depends on the
+// request's language, time zone and actor, so the key must include them.
+func (c *PostController) renderFragment(ctx *gin.Context, key, name string, data map[string]interface{}) {
+	if c.fragments == nil {
+		c.render(ctx, name, data)
+		return
+	}
+
+	localizer := middleware.Localizer(ctx)
+	data["L"] = localizer
+	addTenant(ctx, data)
+	addActor(ctx, data)
+
+	var buf bytes.Buffer
+	if err := c.templates.ExecuteTemplate(&buf, name, data); err != nil {
+		slog.Error("Failed to execute template", "error", err, "template", name)
+		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": localizer.T("error.internal"), "L": localizer})
+		return
+	}
+
+	c.fragments.Set(key, buf.Bytes())
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", buf.Bytes())
+}
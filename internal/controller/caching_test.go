@@ -0,0 +1,25 @@
+package controller
+
+import "testing"
+
+func TestFragmentKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  []interface{}
+		equal bool
+	}{
+		{"same parts", []interface{}{"news", "page=2", 25}, []interface{}{"news", "page=2", 25}, true},
+		{"tenant and page size run together", []interface{}{"news", 25}, []interface{}{"news2", 5}, false},
+		{"separator inside a part", []interface{}{"a|b", "c"}, []interface{}{"a", "b|c"}, false},
+		{"length prefix inside a part", []interface{}{"1:a", ""}, []interface{}{"", "1:a"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := fragmentKey("posts-list.html", tt.a...), fragmentKey("posts-list.html", tt.b...)
+			if (a == b) != tt.equal {
+				t.Errorf("fragmentKey(%v) = %q and fragmentKey(%v) = %q, want equal %v", tt.a, a, tt.b, b, tt.equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// dateLayout is the format of date filters, as sent by <input type="date">
+const dateLayout = "2006-01-02"
+
+// listParams is the state of the post list as carried in URL query parameters.
+// Templates use it to build sort and pagination links that keep the other parameters.
+type listParams struct {
+	Search string
+	// Language restricts the list to posts available in a language; empty lists every language
+	Language string
+	// From and To are inclusive dates
+	From   string
+	To     string
+	Tags   string
+	Status string
+	Sort   string
+	// Order is "asc" or "desc"; empty uses the sort field's natural order
+	Order string
+	Page  int
+}
+
+// parseListParams reads the list parameters from the request query
+func parseListParams(ctx *gin.Context) listParams {
+	return listParamsFrom(ctx.Request.URL.Query())
+}
+
+// listParamsFrom reads the list parameters from query values
+func listParamsFrom(values url.Values) listParams {
+	params := listParams{
+		Search:   values.Get("search"),
+		Language: model.NormalizeLanguage(values.Get("language")),
+		From:     strings.TrimSpace(values.Get("from")),
+		To:       strings.TrimSpace(values.Get("to")),
+		Tags:     strings.TrimSpace(values.Get("tags")),
+		Status:   strings.TrimSpace(values.Get("status")),
+		Sort:     strings.TrimSpace(values.Get("sort")),
+		Order:    strings.TrimSpace(values.Get("order")),
+		Page:     1,
+	}
+	if parsed, err := strconv.Atoi(values.Get("page")); err == nil && parsed > 0 {
+		params.Page = parsed
+	}
+	return params
+}
+
+// query converts the parameters into a service query
+func (p listParams) query(pageSize int) (service.ListQuery, error) {
+	query := service.ListQuery{
+		Search:     p.Search,
+		Language:   p.Language,
+		Tags:       model.ParseTags(p.Tags),
+		Status:     model.PostStatus(p.Status),
+		Sort:       repository.SortField(p.Sort),
+		Descending: p.descending(),
+		Page:       p.Page,
+		PageSize:   pageSize,
+	}
+
+	if p.Order != "" && p.Order != "asc" && p.Order != "desc" {
+		return query, fmt.Errorf("%w: order must be asc or desc", service.ErrValidationFailed)
+	}
+	if p.From != "" {
+		from, err := time.Parse(dateLayout, p.From)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid from date %q", service.ErrValidationFailed, p.From)
+		}
+		query.CreatedFrom = from
+	}
+	if p.To != "" {
+		to, err := time.Parse(dateLayout, p.To)
+		if err != nil {
+			return query, fmt.Errorf("%w: invalid to date %q", service.ErrValidationFailed, p.To)
+		}
+		// The to date is inclusive
+		query.CreatedTo = to.AddDate(0, 0, 1)
+	}
+
+	return query, nil
+}
+
+// sortField returns the field the list is sorted by
+func (p listParams) sortField() string {
+	if p.Sort == "" {
+		return string(repository.SortByCreated)
+	}
+	return p.Sort
+}
+
+// descending reports whether the list is sorted in descending order.
+// Titles sort A to Z by default, everything else newest or most relevant first.
+func (p listParams) descending() bool {
+	if p.Order == "" {
+		return p.sortField() != string(repository.SortByTitle)
+	}
+	return p.Order == "desc"
+}
+
+// values encodes the parameters, leaving out defaults
+func (p listParams) values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("search", p.Search)
+	set("language", p.Language)
+	set("from", p.From)
+	set("to", p.To)
+	set("tags", p.Tags)
+	set("status", p.Status)
+	set("sort", p.Sort)
+	set("order", p.Order)
+	if p.Page > 1 {
+		values.Set("page", strconv.Itoa(p.Page))
+	}
+	return values
+}
+
+// FilterQuery returns the query string of the list's filters, without its sort and page.
+// Bulk actions on all matching posts send it, so that they select the posts the list shows.
+func (p listParams) FilterQuery() string {
+	p.Sort, p.Order, p.Page = "", "", 1
+	return p.values().Encode()
+}
+
+// PageQuery returns the query string for page n of the list
+func (p listParams) PageQuery(n int) template.URL {
+	p.Page = n
+	return template.URL(p.values().Encode())
+}
+
+// SortQuery returns the query string for sorting by field, starting at the first page.
+// Sorting by the current field again reverses the order.
+func (p listParams) SortQuery(field string) template.URL {
+	descending := field != string(repository.SortByTitle)
+	if p.sortField() == field {
+		descending = !p.descending()
+	}
+
+	p.Sort = field
+	p.Order = "asc"
+	if descending {
+		p.Order = "desc"
+	}
+	p.Page = 1
+	return template.URL(p.values().Encode())
+}
+
+// AriaSort returns the aria-sort state of the column for field
+func (p listParams) AriaSort(field string) string {
+	if p.sortField() != field {
+		return "none"
+	}
+	if p.descending() {
+		return "descending"
+	}
+	return "ascending"
+}
+
+// SortIndicator returns an arrow showing the sort direction of the column for field
+func (p listParams) SortIndicator(field string) string {
+	switch p.AriaSort(field) {
+	case "ascending":
+		return "▲"
+	case "descending":
+		return "▼"
+	default:
+		return ""
+	}
+}
+
+// Filtered reports whether any filter restricts the list
+func (p listParams) Filtered() bool {
+	return p.Search != "" || p.Language != "" || p.From != "" || p.To != "" || p.Tags != "" || p.Status != ""
+}
+
+// SortedBy reports whether the list is sorted by field, for marking the selected sort option
+func (p listParams) SortedBy(field string) bool {
+	return p.sortField() == field
+}
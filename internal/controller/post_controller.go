@@ -1,26 +1,58 @@
 package controller
 
 import (
-	"html/template"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"strconv"
+	"slices"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/cache"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
 	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
 	"github.com/iyhunko/go-htmx-mongo/pkg/config"
 )
 
+// errPostIDRequired is returned when a request doesn't name the post it applies to
+var errPostIDRequired = &service.Error{Kind: service.KindInvalid, Code: "post_id_required", Message: "post ID required"}
+
+// Templates renders named templates, e.g. *web.Templates or *template.Template
+type Templates interface {
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// TemplateNames lists every template the controller and the error middleware render,
+// checked at startup so a missing template fails fast
+var TemplateNames = []string{
+	"index.html",
+	"post-detail.html",
+	"posts-list.html",
+	"post-row.html",
+	"post-form.html",
+	"bulk-summary.html",
+	"audit-log.html",
+	"webhooks.html",
+	"login.html",
+	"users.html",
+	"tokens.html",
+	"error.html",
+}
+
 // PostController handles HTTP requests for posts
 type PostController struct {
 	service   *service.PostService
-	templates *template.Template
+	templates Templates
 	config    *config.Config
+	fragments *cache.LRU[string, []byte]
 }
 
 // NewPostController creates a new post controller
-func NewPostController(service *service.PostService, templates *template.Template, cfg *config.Config) *PostController {
+func NewPostController(service *service.PostService, templates Templates, cfg *config.Config) *PostController {
 	return &PostController{
 		service:   service,
 		templates: templates,
@@ -30,114 +62,118 @@ func NewPostController(service *service.PostService, templates *template.Templat
 
 // Index shows the home page with all posts
 func (c *PostController) Index(ctx *gin.Context) {
-	page := 1
-	if p := ctx.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
-	}
-
-	search := ctx.Query("search")
-	pageSize := c.config.PageSizeLimit
-
-	var posts []*model.Post
-	var totalPages int
-	var err error
+	params := parseListParams(ctx)
 
-	if search != "" {
-		posts, totalPages, err = c.service.SearchPosts(ctx.Request.Context(), search, page, pageSize)
-	} else {
-		posts, totalPages, err = c.service.GetPosts(ctx.Request.Context(), page, pageSize)
+	if c.notModified(ctx) {
+		return
 	}
 
+	data, err := c.listData(ctx, params)
 	if err != nil {
-		slog.Error("Failed to get posts", "error", err, "page", page, "search", search)
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
+		ctx.Error(err)
 		return
 	}
 
-	data := map[string]interface{}{
-		"Posts":       posts,
-		"CurrentPage": page,
-		"TotalPages":  totalPages,
-		"Search":      search,
-	}
-
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "index.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "index.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
-	}
+	c.render(ctx, "index.html", data)
 }
 
-// PostsList returns the posts list partial for HTMX
+// PostsList returns the posts list partial for HTMX.
+// Other requests, e.g. reloading a URL pushed into the history, get the full page.
 func (c *PostController) PostsList(ctx *gin.Context) {
-	page := 1
-	if p := ctx.Query("page"); p != "" {
-		if parsed, err := strconv.Atoi(p); err == nil && parsed > 0 {
-			page = parsed
-		}
+	if ctx.GetHeader("HX-Request") != "true" {
+		c.Index(ctx)
+		return
 	}
 
-	search := ctx.Query("search")
-	pageSize := c.config.PageSizeLimit
+	params := parseListParams(ctx)
 
-	var posts []*model.Post
-	var totalPages int
-	var err error
+	if c.notModified(ctx) {
+		return
+	}
 
-	if search != "" {
-		posts, totalPages, err = c.service.SearchPosts(ctx.Request.Context(), search, page, pageSize)
-	} else {
-		posts, totalPages, err = c.service.GetPosts(ctx.Request.Context(), page, pageSize)
+	cacheKey := fragmentKey("posts-list.html", tenant.ID(ctx.Request.Context()), params.values().Encode(), pageSize(ctx, c.config), localeKey(ctx), actorKey(ctx))
+	if c.writeCachedFragment(ctx, cacheKey) {
+		return
 	}
 
+	data, err := c.listData(ctx, params)
 	if err != nil {
-		slog.Error("Failed to get posts", "error", err, "page", page, "search", search)
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
+		ctx.Error(err)
 		return
 	}
 
-	data := map[string]interface{}{
-		"Posts":       posts,
-		"CurrentPage": page,
-		"TotalPages":  totalPages,
-		"Search":      search,
+	c.renderFragment(ctx, cacheKey, "posts-list.html", data)
+}
+
+// listData fetches the posts for the list parameters and builds the template data
+func (c *PostController) listData(ctx *gin.Context, params listParams) (map[string]interface{}, error) {
+	query, err := params.query(pageSize(ctx, c.config))
+	if err != nil {
+		return nil, err
+	}
+
+	posts, pagination, err := c.service.ListPosts(ctx.Request.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Posts are shown in the language the list is restricted to, or the interface language
+	languages := contentLanguages(ctx, params.Language)
+	for i, post := range posts {
+		posts[i] = post.Localized(languages...)
 	}
 
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "posts-list.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "posts-list.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
+	return map[string]interface{}{
+		"Posts":      posts,
+		"Pagination": pagination,
+		"Search":     params.Search,
+		"List":       params,
+		"Statuses":   model.PostStatuses,
+		"Languages":  filterLanguages(ctx, params.Language),
+		"Language":   languages[0],
+	}, nil
+}
+
+// filterLanguages returns the languages offered by the list's language filter:
+// the interface languages and the selected language, if it is another one
+func filterLanguages(ctx *gin.Context, selected string) []string {
+	var languages []string
+	for _, language := range middleware.Localizer(ctx).Languages() {
+		languages = append(languages, language.Code)
+	}
+	if selected != "" && !slices.Contains(languages, selected) {
+		languages = append(languages, selected)
 	}
+	return languages
 }
 
-// ShowCreateForm shows the create post form
+// ShowCreateForm shows the create post form, or ErrForbidden to actors who can't create posts
 func (c *PostController) ShowCreateForm(ctx *gin.Context) {
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "post-form.html", map[string]interface{}{"Mode": "create"}); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "post-form.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
+	if !service.ActorFrom(ctx.Request.Context()).Can(model.PermCreate) {
+		ctx.Error(service.ErrForbidden)
+		return
 	}
+	c.render(ctx, "post-form.html", c.formData(ctx, "create", service.PostInput{}, nil))
 }
 
 // CreatePost handles post creation
 func (c *PostController) CreatePost(ctx *gin.Context) {
-	title := ctx.PostForm("title")
-	content := ctx.PostForm("content")
+	input := postInputFromForm(ctx)
 
-	slog.Info("Creating new post", "title", title)
+	slog.Info("Creating new post", "title", input.Title)
 
-	post, err := c.service.CreatePost(ctx.Request.Context(), title, content)
+	post, err := c.service.CreatePost(ctx.Request.Context(), input)
 	if err != nil {
-		slog.Warn("Failed to create post", "error", err, "title", title)
-		data := map[string]interface{}{
-			"Mode":    "create",
-			"Error":   err.Error(),
-			"Title":   title,
-			"Content": content,
-		}
-		ctx.Writer.WriteHeader(http.StatusBadRequest)
-		if err := c.templates.ExecuteTemplate(ctx.Writer, "post-form.html", data); err != nil {
-			slog.Error("Failed to execute template", "error", err, "template", "post-form.html")
+		if service.KindOf(err) != service.KindValidation {
+			ctx.Error(err)
+			return
 		}
+		slog.Warn("Invalid post submitted", "error", err, "title", input.Title)
+		// The form targets the posts table on success; show it again in place instead
+		ctx.Header("HX-Retarget", "#form-container")
+		ctx.Header("HX-Reswap", "innerHTML")
+		ctx.Writer.WriteHeader(http.StatusUnprocessableEntity)
+		c.render(ctx, "post-form.html", c.formData(ctx, "create", input, err))
 		return
 	}
 
@@ -148,94 +184,75 @@ func (c *PostController) CreatePost(ctx *gin.Context) {
 		"Post": post,
 	}
 	ctx.Writer.Header().Set("HX-Trigger", "postCreated")
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "post-row.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "post-row.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
-	}
+	c.render(ctx, "post-row.html", data)
 }
 
 // ShowPost displays a single post
 func (c *PostController) ShowPost(ctx *gin.Context) {
 	id := ctx.Query("id")
 	if id == "" {
-		slog.Warn("Post ID required but not provided")
-		ctx.HTML(http.StatusBadRequest, "error.html", gin.H{"Error": "Post ID required"})
+		ctx.Error(errPostIDRequired)
 		return
 	}
 
 	post, err := c.service.GetPost(ctx.Request.Context(), id)
 	if err != nil {
-		slog.Warn("Post not found", "id", id, "error", err)
-		ctx.HTML(http.StatusNotFound, "error.html", gin.H{"Error": "Post not found"})
+		ctx.Error(err)
 		return
 	}
 
-	data := map[string]interface{}{
-		"Post": post,
-	}
-
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "post-detail.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "post-detail.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
-	}
+	c.render(ctx, "post-detail.html", c.detailData(ctx, post, ctx.Query("language")))
 }
 
-// ShowEditForm shows the edit post form
+// ShowEditForm shows the edit post form, or ErrForbidden to actors who can't edit the post
 func (c *PostController) ShowEditForm(ctx *gin.Context) {
 	id := ctx.Query("id")
 	if id == "" {
-		slog.Warn("Post ID required but not provided")
-		ctx.HTML(http.StatusBadRequest, "error.html", gin.H{"Error": "Post ID required"})
+		ctx.Error(errPostIDRequired)
 		return
 	}
 
 	post, err := c.service.GetPost(ctx.Request.Context(), id)
 	if err != nil {
-		slog.Warn("Post not found for edit", "id", id, "error", err)
-		ctx.HTML(http.StatusNotFound, "error.html", gin.H{"Error": "Post not found"})
+		ctx.Error(err)
 		return
 	}
-
-	data := map[string]interface{}{
-		"Mode": "edit",
-		"Post": post,
+	if !service.ActorFrom(ctx.Request.Context()).CanEdit(post) {
+		ctx.Error(service.ErrForbidden)
+		return
 	}
 
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "post-form.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "post-form.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
-	}
+	data := c.formData(ctx, "edit", service.PostInput{Title: post.Title, Content: post.Content, Tags: post.Tags, Language: post.Language}, nil)
+	data["Post"] = post
+
+	c.render(ctx, "post-form.html", data)
 }
 
 // UpdatePost handles post update
 func (c *PostController) UpdatePost(ctx *gin.Context) {
 	id := ctx.Param("id")
-	title := ctx.PostForm("title")
-	content := ctx.PostForm("content")
+	input := postInputFromForm(ctx)
 
-	slog.Info("Updating post", "id", id, "title", title)
+	slog.Info("Updating post", "id", id, "title", input.Title)
 
-	post, err := c.service.UpdatePost(ctx.Request.Context(), id, title, content)
+	post, err := c.service.UpdatePost(ctx.Request.Context(), id, input)
 	if err != nil {
-		slog.Warn("Failed to update post", "id", id, "error", err)
+		if service.KindOf(err) != service.KindValidation {
+			ctx.Error(err)
+			return
+		}
+		slog.Warn("Invalid post submitted", "id", id, "error", err)
 		// Get the original post to display in form
-		originalPost, _ := c.service.GetPost(ctx.Request.Context(), id)
-		if originalPost == nil {
-			ctx.HTML(http.StatusNotFound, "error.html", gin.H{"Error": "Post not found"})
+		originalPost, getErr := c.service.GetPost(ctx.Request.Context(), id)
+		if getErr != nil {
+			ctx.Error(getErr)
 			return
 		}
 
-		data := map[string]interface{}{
-			"Mode":    "edit",
-			"Post":    originalPost,
-			"Error":   err.Error(),
-			"Title":   title,
-			"Content": content,
-		}
-		ctx.Writer.WriteHeader(http.StatusBadRequest)
-		if err := c.templates.ExecuteTemplate(ctx.Writer, "post-form.html", data); err != nil {
-			slog.Error("Failed to execute template", "error", err, "template", "post-form.html")
-		}
+		data := c.formData(ctx, "edit", input, err)
+		data["Post"] = originalPost
+		ctx.Writer.WriteHeader(http.StatusUnprocessableEntity)
+		c.render(ctx, "post-form.html", data)
 		return
 	}
 
@@ -245,26 +262,54 @@ func (c *PostController) UpdatePost(ctx *gin.Context) {
 	data := map[string]interface{}{
 		"Post": post,
 	}
-	if err := c.templates.ExecuteTemplate(ctx.Writer, "post-row.html", data); err != nil {
-		slog.Error("Failed to execute template", "error", err, "template", "post-row.html")
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Internal server error"})
+	c.render(ctx, "post-row.html", data)
+}
+
+// postInputFromForm reads the post form fields; tags are comma separated
+func postInputFromForm(ctx *gin.Context) service.PostInput {
+	return service.PostInput{
+		Title:   ctx.PostForm("title"),
+		Content: ctx.PostForm("content"),
+		Tags:    model.ParseTags(ctx.PostForm("tags")),
+		// The form shows the default language, so an empty field keeps a post's language
+		Language: ctx.PostForm("language"),
+	}
+}
+
+// formData builds the post form template data from submitted values.
+// Validation failures in err are shown next to their fields, in the request's language.
+func (c *PostController) formData(ctx *gin.Context, mode string, input service.PostInput, err error) map[string]interface{} {
+	data := map[string]interface{}{
+		"Mode":       mode,
+		"Title":      input.Title,
+		"Content":    input.Content,
+		"Tags":       strings.Join(input.Tags, ", "),
+		"Language":   input.Language,
+		"Errors":     model.ValidationErrors(nil),
+		"TitleMax":   c.config.TitleMaxLength,
+		"ContentMax": c.config.ContentMaxLength,
+	}
+
+	var validationErrs model.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		data["Errors"] = middleware.Localizer(ctx).ValidationErrors(validationErrs)
 	}
+
+	return data
 }
 
 // DeletePost handles post deletion
 func (c *PostController) DeletePost(ctx *gin.Context) {
 	id := ctx.Param("id")
 	if id == "" {
-		slog.Warn("Post ID required but not provided for deletion")
-		ctx.HTML(http.StatusBadRequest, "error.html", gin.H{"Error": "Post ID required"})
+		ctx.Error(errPostIDRequired)
 		return
 	}
 
 	slog.Info("Deleting post", "id", id)
 
 	if err := c.service.DeletePost(ctx.Request.Context(), id); err != nil {
-		slog.Error("Failed to delete post", "id", id, "error", err)
-		ctx.HTML(http.StatusInternalServerError, "error.html", gin.H{"Error": "Failed to delete post"})
+		ctx.Error(err)
 		return
 	}
 
@@ -273,3 +318,24 @@ func (c *PostController) DeletePost(ctx *gin.Context) {
 	// Return empty response - HTMX will remove the row
 	ctx.Status(http.StatusOK)
 }
+
+// render executes the named template, adding values shared by all templates to data
+func (c *PostController) render(ctx *gin.Context, name string, data map[string]interface{}) {
+	renderTemplate(ctx, c.templates, name, data)
+}
+
+// renderTemplate executes the named template of templates, adding values shared by all templates to data
+func renderTemplate(ctx *gin.Context, templates Templates, name string, data map[string]interface{}) {
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	data["CSRFToken"] = middleware.CSRFToken(ctx)
+	data["CSPNonce"] = middleware.CSPNonce(ctx)
+	data["L"] = middleware.Localizer(ctx)
+	addTenant(ctx, data)
+	addActor(ctx, data)
+
+	if err := templates.ExecuteTemplate(ctx.Writer, name, data); err != nil {
+		ctx.Error(fmt.Errorf("failed to execute template %s: %w", name, err))
+	}
+}
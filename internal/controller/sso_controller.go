@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+const (
+	// ssoCookieName is the cookie keeping a single sign-on in progress until the provider's callback
+	ssoCookieName = "oidc_login"
+	// ssoCookieMaxAge is how long users have to sign in at the provider, in seconds
+	ssoCookieMaxAge = 10 * 60
+)
+
+// SSOController handles signing in with the OpenID Connect provider
+type SSOController struct {
+	service   *service.SSOService
+	users     *service.UserService
+	templates Templates
+	config    *config.Config
+}
+
+// NewSSOController creates a new single sign-on controller
+func NewSSOController(sso *service.SSOService, users *service.UserService, templates Templates, cfg *config.Config) *SSOController {
+	return &SSOController{
+		service:   sso,
+		users:     users,
+		templates: templates,
+		config:    cfg,
+	}
+}
+
+// ssoLogin is a sign-in in progress and the page to return to afterwards, kept in the browser
+type ssoLogin struct {
+	oidc.AuthRequest
+	Next string `json:"next"`
+}
+
+// StartLogin sends the browser to the provider to sign in. The next query parameter is the page to return to afterwards.
+func (c *SSOController) StartLogin(ctx *gin.Context) {
+	req, authURL, err := c.service.Begin(ctx.Request.Context(), c.redirectURL(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	value, err := json.Marshal(ssoLogin{AuthRequest: req, Next: localPath(ctx.Query("next"))})
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	c.setCookie(ctx, base64.RawURLEncoding.EncodeToString(value), ssoCookieMaxAge)
+	ctx.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the sign-in the provider sent the browser back from, sets the auth cookie and redirects to
+// the page the sign-in started from. Failed and refused sign-ins show the sign-in page with the reason.
+func (c *SSOController) Callback(ctx *gin.Context) {
+	login, ok := c.login(ctx)
+	// Each sign-in is completed once
+	c.setCookie(ctx, "", -1)
+	if !ok || subtle.ConstantTimeCompare([]byte(ctx.Query("state")), []byte(login.State)) != 1 {
+		slog.Warn("Single sign-on callback without a matching sign-in", "ip", ctx.ClientIP())
+		c.fail(ctx, service.ErrSSOFailed)
+		return
+	}
+	if reason := ctx.Query("error"); reason != "" {
+		slog.Warn("Single sign-on refused by the provider", "error", reason, "description", ctx.Query("error_description"))
+		c.fail(ctx, service.ErrSSOFailed)
+		return
+	}
+
+	token, user, err := c.service.Complete(ctx.Request.Context(), ctx.Query("code"), login.AuthRequest)
+	switch service.KindOf(err) {
+	case service.KindUnauthorized, service.KindForbidden, service.KindConflict:
+		c.fail(ctx, err)
+		return
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("User signed in with single sign-on", "id", user.ID.Hex(), "username", user.Username, "role", user.Role)
+	middleware.SetAuthCookie(ctx, token, int(c.users.SessionTTL().Seconds()), c.config.CookieSecure)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, login.Next))
+}
+
+// fail shows the sign-in page with the error's message and status
+func (c *SSOController) fail(ctx *gin.Context, err error) {
+	data := loginData(c.config, "/")
+	data["Error"] = middleware.Localizer(ctx).T("error." + service.CodeOf(err))
+	ctx.Status(middleware.StatusFor(err))
+	renderTemplate(ctx, c.templates, "login.html", data)
+}
+
+// login returns the sign-in in progress kept by the browser
+func (c *SSOController) login(ctx *gin.Context) (ssoLogin, bool) {
+	var login ssoLogin
+	value, err := ctx.Cookie(ssoCookieName)
+	if err != nil || value == "" {
+		return login, false
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || json.Unmarshal(decoded, &login) != nil || login.State == "" {
+		return login, false
+	}
+	return login, true
+}
+
+// setCookie keeps the sign-in in progress in an HttpOnly cookie sent only to the callback. It's Lax,
+// since the provider sends the browser back with a cross-site navigation.
+func (c *SSOController) setCookie(ctx *gin.Context, value string, maxAge int) {
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(ssoCookieName, value, maxAge, tenantPath(ctx, "/login/oidc"), "", c.config.CookieSecure, true)
+}
+
+// redirectURL returns the callback URL registered at the provider. Unless configured, it's the callback on the
+// request's host, over HTTPS when cookies are, e.g. behind a proxy terminating TLS.
+func (c *SSOController) redirectURL(ctx *gin.Context) string {
+	if c.config.OIDCRedirectURL != "" {
+		return c.config.OIDCRedirectURL
+	}
+	scheme := "http"
+	if ctx.Request.TLS != nil || c.config.CookieSecure {
+		scheme = "https"
+	}
+	return scheme + "://" + ctx.Request.Host + tenantPath(ctx, "/login/oidc/callback")
+}
@@ -0,0 +1,28 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// pageSize returns the number of items per page for the request's tenant, which may override the configured one
+func pageSize(ctx *gin.Context, cfg *config.Config) int {
+	if size := tenant.From(ctx.Request.Context()).PageSize; size > 0 {
+		return size
+	}
+	return cfg.PageSizeLimit
+}
+
+// addTenant adds the request's tenant and the base path of its pages to template data.
+// Templates prefix the links to pages with Base, since the tenant's path prefix is stripped before routing.
+func addTenant(ctx *gin.Context, data map[string]interface{}) {
+	t := tenant.From(ctx.Request.Context())
+	data["Tenant"] = t
+	data["Base"] = t.PathPrefix
+}
+
+// tenantPath returns the path of the request's tenant's page at p, e.g. for redirects
+func tenantPath(ctx *gin.Context, p string) string {
+	return tenant.From(ctx.Request.Context()).Path(p)
+}
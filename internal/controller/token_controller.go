@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// TokenExpiryDays are the lifetimes offered for new API tokens, in days; 0 never expires
+var TokenExpiryDays = []int64{7, 30, 90, 365, 0}
+
+// defaultTokenExpiryDays is the lifetime selected for new API tokens
+const defaultTokenExpiryDays = 30
+
+// TokenController handles the settings page where signed-in users create and revoke their API tokens
+type TokenController struct {
+	service   *service.TokenService
+	templates Templates
+}
+
+// NewTokenController creates a new API token controller
+func NewTokenController(service *service.TokenService, templates Templates) *TokenController {
+	return &TokenController{
+		service:   service,
+		templates: templates,
+	}
+}
+
+// Tokens shows the API tokens of the signed-in user with a form to create one
+func (c *TokenController) Tokens(ctx *gin.Context) {
+	data, err := c.pageData(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	renderTemplate(ctx, c.templates, "tokens.html", data)
+}
+
+// CreateToken creates an API token with the name, scopes and expires_in (days) form fields
+// and shows it once with 201. Invalid fields show the page again with 422 and the entered values.
+func (c *TokenController) CreateToken(ctx *gin.Context) {
+	days, err := strconv.Atoi(ctx.DefaultPostForm("expires_in", strconv.Itoa(defaultTokenExpiryDays)))
+	if err != nil {
+		ctx.Error(service.ErrValidationFailed)
+		return
+	}
+	var scopes []model.TokenScope
+	for _, scope := range ctx.PostFormArray("scopes") {
+		scopes = append(scopes, model.TokenScope(scope))
+	}
+	input := service.TokenInput{
+		Name:      ctx.PostForm("name"),
+		Scopes:    scopes,
+		ExpiresIn: time.Duration(days) * 24 * time.Hour,
+	}
+
+	secret, token, err := c.service.CreateToken(ctx.Request.Context(), input)
+	var fields model.ValidationErrors
+	if errors.As(err, &fields) {
+		data, pageErr := c.pageData(ctx)
+		if pageErr != nil {
+			ctx.Error(pageErr)
+			return
+		}
+		data["Errors"] = middleware.Localizer(ctx).ValidationErrors(fields)
+		data["Input"] = input
+		data["Checked"] = scopeSet(input.Scopes)
+		data["ExpiresIn"] = days
+		ctx.Status(http.StatusUnprocessableEntity)
+		renderTemplate(ctx, c.templates, "tokens.html", data)
+		return
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("API token created", "id", token.ID.Hex(), "user", token.UserID.Hex(), "scopes", token.Scopes)
+
+	data, err := c.pageData(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	data["Created"] = token
+	data["Secret"] = secret
+	ctx.Status(http.StatusCreated)
+	renderTemplate(ctx, c.templates, "tokens.html", data)
+}
+
+// RevokeToken deletes the API token and redirects to the tokens
+func (c *TokenController) RevokeToken(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if err := c.service.RevokeToken(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("API token revoked", "id", id)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/settings/tokens"))
+}
+
+// pageData lists the tokens of the signed-in user and the scopes and lifetimes they may choose for new ones
+func (c *TokenController) pageData(ctx *gin.Context) (map[string]interface{}, error) {
+	tokens, err := c.service.ListTokens(ctx.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"Tokens":     tokens,
+		"Scopes":     service.ActorFrom(ctx.Request.Context()).Role.Scopes(),
+		"ExpiryDays": TokenExpiryDays,
+		"ExpiresIn":  defaultTokenExpiryDays,
+		"Input":      service.TokenInput{},
+		"Checked":    scopeSet([]model.TokenScope{model.ScopeRead}),
+		"Errors":     model.ValidationErrors(nil),
+		"Now":        time.Now(),
+	}, nil
+}
+
+// scopeSet returns the scopes to check on the form
+func scopeSet(scopes []model.TokenScope) map[model.TokenScope]bool {
+	set := make(map[model.TokenScope]bool, len(scopes))
+	for _, scope := range scopes {
+		set[scope] = true
+	}
+	return set
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/transfer"
+)
+
+// ExportPosts streams all posts, or the posts matching the search query, as JSON Lines or CSV
+func (c *PostController) ExportPosts(ctx *gin.Context) {
+	format, err := transfer.ParseFormat(ctx.Query("format"))
+	if err != nil {
+		ctx.Error(fmt.Errorf("%w: %w", service.ErrValidationFailed, err))
+		return
+	}
+
+	search := ctx.Query("search")
+
+	ctx.Header("Content-Type", format.ContentType())
+	ctx.Header("Content-Disposition", `attachment; filename="posts.`+string(format)+`"`)
+	ctx.Status(http.StatusOK)
+
+	count, err := c.service.ExportPosts(ctx.Request.Context(), ctx.Writer, format, search)
+	if err != nil {
+		// Headers are already sent, so the client sees a truncated body
+		slog.Error("Failed to export posts", "error", err, "format", format, "exported", count)
+		return
+	}
+
+	slog.Info("Posts exported", "format", format, "search", search, "count", count)
+}
+
+// ImportPosts imports posts from an uploaded file (multipart field "file") or the raw request body.
+// Query parameters: format (jsonl or csv), dry_run (bool) and batch_size (int).
+// Responds with a JSON report including per-line errors.
+func (c *PostController) ImportPosts(ctx *gin.Context) {
+	format, err := transfer.ParseFormat(ctx.Query("format"))
+	if err != nil {
+		ctx.Error(fmt.Errorf("%w: %w", service.ErrValidationFailed, err))
+		return
+	}
+
+	opts := service.ImportOptions{}
+	opts.DryRun, _ = strconv.ParseBool(ctx.Query("dry_run"))
+	opts.BatchSize, _ = strconv.Atoi(ctx.Query("batch_size"))
+
+	var input io.Reader = ctx.Request.Body
+	if fileHeader, err := ctx.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			ctx.Error(fmt.Errorf("%w: failed to read uploaded file: %w", service.ErrValidationFailed, err))
+			return
+		}
+		defer file.Close()
+		input = file
+	}
+
+	slog.Info("Importing posts", "format", format, "dryRun", opts.DryRun)
+
+	report, err := c.service.ImportPosts(ctx.Request.Context(), input, format, opts)
+	if err != nil {
+		slog.Error("Failed to import posts", "error", err, "format", format)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	slog.Info("Posts imported",
+		"processed", report.Processed,
+		"inserted", report.Inserted,
+		"updated", report.Updated,
+		"errors", len(report.Errors),
+		"dryRun", report.DryRun,
+	)
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// contentLanguages returns the languages to show post content in, most preferred first:
+// the requested language, if any, then the language of the user interface
+func contentLanguages(ctx *gin.Context, requested string) []string {
+	locale := middleware.Localizer(ctx).Locale
+	if requested == "" || requested == locale {
+		return []string{locale}
+	}
+	return []string{requested, locale}
+}
+
+// detailData builds the post detail page data for post in the requested content language.
+// Translation form values and failures are added by the caller.
+func (c *PostController) detailData(ctx *gin.Context, post *model.Post, requested string) map[string]interface{} {
+	requested = model.NormalizeLanguage(requested)
+	localized := post.Localized(contentLanguages(ctx, requested)...)
+
+	return map[string]interface{}{
+		"Post":      localized,
+		"Original":  post,
+		"Requested": requested,
+		// A missing translation falls back to the interface language, then the original
+		"Fallback":    requested != "" && localized.DisplayLanguage != requested,
+		"Errors":      model.ValidationErrors(nil),
+		"Translation": model.Translation{},
+	}
+}
+
+// translationURL returns the detail page of a post in a language
+func translationURL(id, language string) string {
+	values := url.Values{"id": {id}}
+	if language != "" {
+		values.Set("language", language)
+	}
+	return "/posts/view?" + values.Encode()
+}
+
+// SaveTranslation adds or replaces a translation from the form on the post detail page.
+// Form fields: language, title and content. On success it redirects to the translation;
+// invalid translations show the page again with every failing field.
+func (c *PostController) SaveTranslation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	language := model.NormalizeLanguage(ctx.PostForm("language"))
+	input := service.TranslationInput{
+		Title:   ctx.PostForm("title"),
+		Content: ctx.PostForm("content"),
+	}
+
+	slog.Info("Saving translation", "id", id, "language", language)
+
+	post, err := c.service.SaveTranslation(ctx.Request.Context(), id, language, input)
+	if err != nil {
+		if service.KindOf(err) != service.KindValidation {
+			ctx.Error(err)
+			return
+		}
+		slog.Warn("Invalid translation submitted", "id", id, "language", language, "error", err)
+
+		original, getErr := c.service.GetPost(ctx.Request.Context(), id)
+		if getErr != nil {
+			ctx.Error(getErr)
+			return
+		}
+
+		data := c.detailData(ctx, original, ctx.Query("language"))
+		data["Translation"] = model.Translation{Language: language, Title: input.Title, Content: input.Content}
+		var validationErrs model.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			data["Errors"] = middleware.Localizer(ctx).ValidationErrors(validationErrs)
+		}
+		ctx.Writer.WriteHeader(http.StatusUnprocessableEntity)
+		c.render(ctx, "post-detail.html", data)
+		return
+	}
+
+	slog.Info("Translation saved", "id", post.ID.Hex(), "language", language)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, translationURL(post.ID.Hex(), language)))
+}
+
+// DeleteTranslation removes the translation named by the language form field and redirects to the post
+func (c *PostController) DeleteTranslation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	language := ctx.PostForm("language")
+
+	slog.Info("Deleting translation", "id", id, "language", language)
+
+	post, err := c.service.DeleteTranslation(ctx.Request.Context(), id, language)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Translation deleted", "id", id, "language", language)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, translationURL(post.ID.Hex(), "")))
+}
+
+// APISaveTranslation adds or replaces the translation of a post from a JSON body with title and content
+func (c *PostController) APISaveTranslation(ctx *gin.Context) {
+	var input service.TranslationInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.Error(errInvalidJSON)
+		return
+	}
+
+	post, err := c.service.SaveTranslation(ctx.Request.Context(), ctx.Param("id"), ctx.Param("language"), input)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Translation saved via API", "id", post.ID.Hex(), "language", ctx.Param("language"))
+	ctx.JSON(http.StatusOK, post)
+}
+
+// APIDeleteTranslation removes the translation of a post
+func (c *PostController) APIDeleteTranslation(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if _, err := c.service.DeleteTranslation(ctx.Request.Context(), id, ctx.Param("language")); err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("Translation deleted via API", "id", id, "language", ctx.Param("language"))
+	ctx.Status(http.StatusNoContent)
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// UserController handles signing in and out and the admin page of users and their roles
+type UserController struct {
+	service   *service.UserService
+	templates Templates
+	config    *config.Config
+}
+
+// NewUserController creates a new user controller
+func NewUserController(service *service.UserService, templates Templates, cfg *config.Config) *UserController {
+	return &UserController{
+		service:   service,
+		templates: templates,
+		config:    cfg,
+	}
+}
+
+// ShowLogin shows the sign-in form. The next query parameter is the page to return to afterwards.
+func (c *UserController) ShowLogin(ctx *gin.Context) {
+	renderTemplate(ctx, c.templates, "login.html", loginData(c.config, localPath(ctx.Query("next"))))
+}
+
+// Login signs in with the username and password form fields, sets the auth cookie and redirects to the
+// page in the next form field. Wrong credentials show the form again with 401.
+func (c *UserController) Login(ctx *gin.Context) {
+	username := ctx.PostForm("username")
+	next := localPath(ctx.PostForm("next"))
+
+	token, user, err := c.service.Login(ctx.Request.Context(), username, ctx.PostForm("password"))
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		slog.Warn("Sign-in failed", "username", model.NormalizeUsername(username), "ip", ctx.ClientIP())
+		ctx.Status(http.StatusUnauthorized)
+		data := loginData(c.config, next)
+		data["Username"] = username
+		data["Error"] = middleware.Localizer(ctx).T("error.invalid_credentials")
+		renderTemplate(ctx, c.templates, "login.html", data)
+		return
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+
+	slog.Info("User signed in", "id", user.ID.Hex(), "username", user.Username)
+	middleware.SetAuthCookie(ctx, token, int(c.service.SessionTTL().Seconds()), c.config.CookieSecure)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, next))
+}
+
+// Logout ends the session of the auth cookie, removes the cookie and redirects to the home page
+func (c *UserController) Logout(ctx *gin.Context) {
+	if token, err := ctx.Cookie(middleware.AuthCookieName); err == nil && token != "" {
+		if err := c.service.Logout(ctx.Request.Context(), token); err != nil {
+			ctx.Error(err)
+			return
+		}
+	}
+	middleware.ClearAuthCookie(ctx, c.config.CookieSecure)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/"))
+}
+
+// Users shows the users with a form to change each one's role, a form to add a user
+// and the permissions of every role
+func (c *UserController) Users(ctx *gin.Context) {
+	data, err := c.pageData(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	renderTemplate(ctx, c.templates, "users.html", data)
+}
+
+// CreateUser adds a user with the username, password and role form fields.
+// Invalid fields show the page again with 422 and the entered name and role.
+func (c *UserController) CreateUser(ctx *gin.Context) {
+	input := service.UserInput{
+		Username: ctx.PostForm("username"),
+		Password: ctx.PostForm("password"),
+		Role:     model.Role(ctx.PostForm("role")),
+	}
+
+	user, err := c.service.CreateUser(ctx.Request.Context(), input)
+	var fields model.ValidationErrors
+	if errors.As(err, &fields) {
+		data, pageErr := c.pageData(ctx)
+		if pageErr != nil {
+			ctx.Error(pageErr)
+			return
+		}
+		data["Errors"] = middleware.Localizer(ctx).ValidationErrors(fields)
+		data["Input"] = input
+		ctx.Status(http.StatusUnprocessableEntity)
+		renderTemplate(ctx, c.templates, "users.html", data)
+		return
+	}
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("User created", "id", user.ID.Hex(), "username", user.Username, "role", user.Role)
+
+	data, err := c.pageData(ctx)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	data["Created"] = user
+	ctx.Status(http.StatusCreated)
+	renderTemplate(ctx, c.templates, "users.html", data)
+}
+
+// SetRole gives the user the role in the role form field and redirects to the users
+func (c *UserController) SetRole(ctx *gin.Context) {
+	id := ctx.Param("id")
+	role := model.Role(ctx.PostForm("role"))
+
+	user, err := c.service.SetRole(ctx.Request.Context(), id, role)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("User role changed", "id", id, "username", user.Username, "role", role)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/admin/users"))
+}
+
+// pageData lists the users and the roles and permissions to show on the users page
+func (c *UserController) pageData(ctx *gin.Context) (map[string]interface{}, error) {
+	users, err := c.service.ListUsers(ctx.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"Users":       users,
+		"Roles":       model.Roles,
+		"Permissions": model.Permissions,
+		"Input":       service.UserInput{Role: model.RoleReader},
+		"Errors":      model.ValidationErrors(nil),
+	}, nil
+}
+
+// loginData returns the data of the sign-in page returning to next, with the single sign-on provider, if any
+func loginData(cfg *config.Config, next string) map[string]interface{} {
+	data := map[string]interface{}{
+		"Next": next,
+		"SSO":  "",
+	}
+	if cfg.OIDCIssuer != "" {
+		data["SSO"] = cfg.OIDCProviderName
+	}
+	return data
+}
+
+// addActor adds the actor of the request and the signed-in user to template data,
+// so that templates only show the actions the actor may take
+func addActor(ctx *gin.Context, data map[string]interface{}) {
+	data["Actor"] = service.ActorFrom(ctx.Request.Context())
+	data["User"] = middleware.CurrentUser(ctx)
+}
+
+// localPath returns p if it is a path on this site, e.g. the page to return to after signing in, and "/" otherwise
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,182 @@
+package controller
+
+import (
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// WebhookController handles the admin pages of webhooks and their deliveries
+type WebhookController struct {
+	service   *service.WebhookService
+	templates Templates
+	config    *config.Config
+}
+
+// NewWebhookController creates a new webhook controller
+func NewWebhookController(service *service.WebhookService, templates Templates, cfg *config.Config) *WebhookController {
+	return &WebhookController{
+		service:   service,
+		templates: templates,
+		config:    cfg,
+	}
+}
+
+// deliveryParams is the state of the deliveries list as carried in URL query parameters
+type deliveryParams struct {
+	Status    string
+	WebhookID string
+	Page      int
+}
+
+// parseDeliveryParams reads the delivery filters from the request query
+func parseDeliveryParams(ctx *gin.Context) deliveryParams {
+	params := deliveryParams{
+		Status:    strings.TrimSpace(ctx.Query("status")),
+		WebhookID: strings.TrimSpace(ctx.Query("webhook_id")),
+		Page:      1,
+	}
+	if parsed, err := strconv.Atoi(ctx.Query("page")); err == nil && parsed > 0 {
+		params.Page = parsed
+	}
+	return params
+}
+
+// values encodes the parameters, leaving out defaults
+func (p deliveryParams) values() url.Values {
+	values := url.Values{}
+	if p.Status != "" {
+		values.Set("status", p.Status)
+	}
+	if p.WebhookID != "" {
+		values.Set("webhook_id", p.WebhookID)
+	}
+	if p.Page > 1 {
+		values.Set("page", strconv.Itoa(p.Page))
+	}
+	return values
+}
+
+// PageQuery returns the query string for page n of the deliveries
+func (p deliveryParams) PageQuery(n int) template.URL {
+	p.Page = n
+	return template.URL(p.values().Encode())
+}
+
+// StatusQuery returns the query string listing deliveries with the given status, or any status when empty
+func (p deliveryParams) StatusQuery(status string) template.URL {
+	p.Status = status
+	p.Page = 1
+	return template.URL(p.values().Encode())
+}
+
+// Webhooks shows the webhooks, a form to add one and a page of their deliveries, newest first.
+// Query parameters: status (pending, delivered or dead), webhook_id and page.
+func (c *WebhookController) Webhooks(ctx *gin.Context) {
+	data, err := c.pageData(ctx, parseDeliveryParams(ctx))
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	renderTemplate(ctx, c.templates, "webhooks.html", data)
+}
+
+// CreateWebhook subscribes the URL in the url form field to the events in the events fields.
+// The page is shown with the new webhook's secret, which isn't shown again.
+func (c *WebhookController) CreateWebhook(ctx *gin.Context) {
+	input := service.WebhookInput{
+		URL:    ctx.PostForm("url"),
+		Events: ctx.PostFormArray("events"),
+		Secret: ctx.PostForm("secret"),
+	}
+
+	webhook, err := c.service.CreateWebhook(ctx.Request.Context(), input)
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("Webhook created", "id", webhook.ID.Hex(), "url", webhook.URL, "events", webhook.Events)
+
+	data, err := c.pageData(ctx, deliveryParams{Page: 1})
+	if err != nil {
+		ctx.Error(err)
+		return
+	}
+	data["Created"] = webhook
+	ctx.Status(http.StatusCreated)
+	renderTemplate(ctx, c.templates, "webhooks.html", data)
+}
+
+// SetWebhookActive pauses the webhook, or resumes it when the active form field is "true", and redirects to the webhooks
+func (c *WebhookController) SetWebhookActive(ctx *gin.Context) {
+	id := ctx.Param("id")
+	active := ctx.PostForm("active") == "true"
+
+	if err := c.service.SetWebhookActive(ctx.Request.Context(), id, active); err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("Webhook updated", "id", id, "active", active)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/admin/webhooks"))
+}
+
+// DeleteWebhook removes the webhook and redirects to the webhooks
+func (c *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := c.service.DeleteWebhook(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("Webhook deleted", "id", id)
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/admin/webhooks"))
+}
+
+// ReplayDelivery queues the delivery to be sent again and redirects to the deliveries with the status form field
+func (c *WebhookController) ReplayDelivery(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	if err := c.service.ReplayDelivery(ctx.Request.Context(), id); err != nil {
+		ctx.Error(err)
+		return
+	}
+	slog.Info("Webhook delivery replayed", "id", id)
+
+	params := deliveryParams{Status: ctx.PostForm("status"), WebhookID: ctx.PostForm("webhook_id")}
+	ctx.Redirect(http.StatusSeeOther, tenantPath(ctx, "/admin/webhooks?"+string(params.PageQuery(1))+"#deliveries"))
+}
+
+// pageData loads the webhooks and the page of deliveries selected by params
+func (c *WebhookController) pageData(ctx *gin.Context, params deliveryParams) (map[string]interface{}, error) {
+	webhooks, err := c.service.ListWebhooks(ctx.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, pagination, err := c.service.ListDeliveries(ctx.Request.Context(), service.DeliveryQuery{
+		Status:    params.Status,
+		WebhookID: params.WebhookID,
+		Page:      params.Page,
+		PageSize:  pageSize(ctx, c.config),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"Webhooks":   webhooks,
+		"Deliveries": deliveries,
+		"Pagination": pagination,
+		"Filter":     params,
+		"Events":     model.EventTypes,
+		"Statuses":   model.DeliveryStatuses,
+	}, nil
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -15,10 +16,28 @@ import (
 type MongoDB struct {
 	Client *mongo.Client
 	DB     *mongo.Database
+	// Transactions reports whether the server supports multi-document transactions,
+	// which takes a replica set or a sharded cluster
+	Transactions bool
 }
 
 // Connect establishes a connection to MongoDB and performs auto-migration
 func Connect(ctx context.Context, uri, dbName string) (*MongoDB, error) {
+	mongodb, err := Open(ctx, uri, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Perform auto-migration
+	if err := Migrate(ctx, mongodb.DB); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return mongodb, nil
+}
+
+// Open establishes a connection to MongoDB without migrating, e.g. to check connectivity
+func Open(ctx context.Context, uri, dbName string) (*MongoDB, error) {
 	slog.Info("Connecting to MongoDB", "uri", uri, "database", dbName)
 
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
@@ -31,21 +50,32 @@ func Connect(ctx context.Context, uri, dbName string) (*MongoDB, error) {
 		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
 	}
 
-	slog.Info("Successfully connected to MongoDB")
-
-	db := client.Database(dbName)
-
-	// Perform auto-migration
-	if err := migrate(ctx, db); err != nil {
-		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	transactions, err := SupportsTransactions(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check MongoDB topology: %w", err)
 	}
+	slog.Info("Successfully connected to MongoDB", "transactions", transactions)
 
 	return &MongoDB{
-		Client: client,
-		DB:     db,
+		Client:       client,
+		DB:           client.Database(dbName),
+		Transactions: transactions,
 	}, nil
 }
 
+// SupportsTransactions reports whether the server client is connected to is a replica set member
+// or a mongos router, the deployments that support multi-document transactions
+func SupportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello); err != nil {
+		return false, err
+	}
+	return hello.SetName != "" || hello.Msg == "isdbgrid", nil
+}
+
 // Disconnect closes the MongoDB connection
 func (m *MongoDB) Disconnect(ctx context.Context) error {
 	if m.Client != nil {
@@ -55,8 +85,9 @@ func (m *MongoDB) Disconnect(ctx context.Context) error {
 	return nil
 }
 
-// migrate performs auto-migration of MongoDB collections and indexes
-func migrate(ctx context.Context, db *mongo.Database) error {
+// Migrate performs auto-migration of MongoDB collections and indexes.
+// Connect runs it; tests connecting on their own call it to get the same indexes.
+func Migrate(ctx context.Context, db *mongo.Database) error {
 	slog.Info("Starting database migration")
 
 	// Create posts collection if it doesn't exist
@@ -69,10 +100,87 @@ func migrate(ctx context.Context, db *mongo.Database) error {
 		return err
 	}
 
+	// Create the audit log collection and its indexes
+	if err := createCollection(ctx, db, "audit_log"); err != nil {
+		return err
+	}
+	if err := createAuditIndexes(ctx, db); err != nil {
+		return err
+	}
+
+	// Create the webhook collections and their indexes
+	for _, name := range []string{"webhooks", "webhook_deliveries"} {
+		if err := createCollection(ctx, db, name); err != nil {
+			return err
+		}
+	}
+	if err := createWebhookIndexes(ctx, db); err != nil {
+		return err
+	}
+
+	// Create the outbox collection and its indexes
+	if err := createCollection(ctx, db, "outbox"); err != nil {
+		return err
+	}
+	if err := createOutboxIndexes(ctx, db); err != nil {
+		return err
+	}
+
+	// Create the collection of change stream resume tokens
+	if err := createCollection(ctx, db, "resume_tokens"); err != nil {
+		return err
+	}
+
+	// Create the collections of users and their sessions and their indexes
+	for _, name := range []string{"users", "sessions"} {
+		if err := createCollection(ctx, db, name); err != nil {
+			return err
+		}
+	}
+	if err := createUserIndexes(ctx, db); err != nil {
+		return err
+	}
+
+	// Create the collection of API tokens and its indexes
+	if err := createCollection(ctx, db, "api_tokens"); err != nil {
+		return err
+	}
+	if err := createTokenIndexes(ctx, db); err != nil {
+		return err
+	}
+
+	// Give documents stored before tenants existed to the default tenant
+	if err := backfillTenants(ctx, db); err != nil {
+		return err
+	}
+
 	slog.Info("Database migration completed successfully")
 	return nil
 }
 
+// migratedCollections lists the collections whose indexes Migrate creates
+var migratedCollections = []string{"posts", "audit_log", "webhooks", "webhook_deliveries", "outbox", "resume_tokens", "users", "sessions", "api_tokens"}
+
+// RebuildIndexes drops every index of the migrated collections, except those on _id, and creates them again.
+// Queries relying on an index, such as searches, fail or slow down until it is rebuilt.
+func RebuildIndexes(ctx context.Context, db *mongo.Database) error {
+	for _, name := range migratedCollections {
+		if _, err := db.Collection(name).Indexes().DropAll(ctx); err != nil {
+			return fmt.Errorf("failed to drop indexes of %s: %w", name, err)
+		}
+		slog.Info("Dropped indexes", "collection", name)
+	}
+	return Migrate(ctx, db)
+}
+
+// RebuildTextIndex drops the text index of posts and creates it again, e.g. after the search languages changed
+func RebuildTextIndex(ctx context.Context, db *mongo.Database) error {
+	if err := dropIndexIfExists(ctx, db.Collection("posts"), "posts_text"); err != nil {
+		return err
+	}
+	return createPostsIndexes(ctx, db)
+}
+
 // createCollection creates a collection if it doesn't exist
 func createCollection(ctx context.Context, db *mongo.Database, name string) error {
 	collections, err := db.ListCollectionNames(ctx, bson.M{"name": name})
@@ -97,35 +205,302 @@ func createCollection(ctx context.Context, db *mongo.Database, name string) erro
 func createPostsIndexes(ctx context.Context, db *mongo.Database) error {
 	collection := db.Collection("posts")
 
-	// Create index on created_at for sorting
+	// Every query of posts is scoped to a tenant, so the indexes from before tenants existed are replaced,
+	// and pages are sorted with the ID as a tiebreaker, so the sort indexes without it are replaced too
+	for _, name := range []string{"created_at_desc", "updated_at_desc", "slug_unique", "tenant_created_at_desc", "tenant_updated_at_desc"} {
+		if err := dropIndexIfExists(ctx, collection, name); err != nil {
+			return err
+		}
+	}
+
+	// Create index on created_at for sorting a tenant's posts
 	indexModel := mongo.IndexModel{
-		Keys: bson.D{{Key: "created_at", Value: -1}},
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}},
 		Options: options.Index().
-			SetName("created_at_desc"),
+			SetName("tenant_created_at_id_desc"),
 	}
 
 	_, err := collection.Indexes().CreateOne(ctx, indexModel)
 	if err != nil {
 		return fmt.Errorf("failed to create created_at index: %w", err)
 	}
-	slog.Info("Created index on posts.created_at")
+	slog.Info("Created index on posts.tenant_id and posts.created_at")
+
+	// Create index on updated_at for sorting a tenant's posts and finding the latest change for HTTP caching
+	updatedAtIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}},
+		Options: options.Index().
+			SetName("tenant_updated_at_id_desc"),
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, updatedAtIndexModel)
+	if err != nil {
+		return fmt.Errorf("failed to create updated_at index: %w", err)
+	}
+	slog.Info("Created index on posts.tenant_id and posts.updated_at")
+
+	// A collection can only have one text index, so the one from before translations existed goes first
+	if err := dropIndexIfExists(ctx, collection, "title_content_text"); err != nil {
+		return err
+	}
 
-	// Create text index for search on title and content
+	// Create text index for search on title and content in every language.
+	// Each post and translation is stemmed in the language named by its text_language field.
 	textIndexModel := mongo.IndexModel{
 		Keys: bson.D{
 			{Key: "title", Value: "text"},
 			{Key: "content", Value: "text"},
+			{Key: "translations.title", Value: "text"},
+			{Key: "translations.content", Value: "text"},
 		},
 		Options: options.Index().
-			SetName("title_content_text"),
+			SetName("posts_text").
+			SetDefaultLanguage("english").
+			SetLanguageOverride("text_language"),
 	}
 
 	_, err = collection.Indexes().CreateOne(ctx, textIndexModel)
 	if err != nil {
 		return fmt.Errorf("failed to create text index: %w", err)
 	}
-	slog.Info("Created text index on posts.title and posts.content")
+	slog.Info("Created text index on posts and their translations")
+
+	// Create index on translation languages, used to list posts available in a language
+	languageIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "translations.language", Value: 1}},
+		Options: options.Index().
+			SetName("translations_language"),
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, languageIndexModel)
+	if err != nil {
+		return fmt.Errorf("failed to create translations language index: %w", err)
+	}
+	slog.Info("Created index on posts.translations.language")
+
+	// Create unique index on slug within a tenant, used to match posts on import.
+	// Only documents that have a slug are indexed, so posts without one don't collide.
+	slugIndexModel := mongo.IndexModel{
+		Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "slug", Value: 1}},
+		Options: options.Index().
+			SetName("tenant_slug_unique").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slug": bson.M{"$type": "string"}}),
+	}
+
+	_, err = collection.Indexes().CreateOne(ctx, slugIndexModel)
+	if err != nil {
+		return fmt.Errorf("failed to create slug index: %w", err)
+	}
+	slog.Info("Created unique index on posts.tenant_id and posts.slug")
+
+	return nil
+}
+
+// createAuditIndexes creates indexes for the audit log, which is listed newest first,
+// optionally filtered by post or actor
+func createAuditIndexes(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("audit_log")
+
+	// The audit log is listed per tenant
+	if err := dropIndexIfExists(ctx, collection, "time_desc"); err != nil {
+		return err
+	}
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "time", Value: -1}},
+			Options: options.Index().SetName("tenant_time_desc"),
+		},
+		{
+			Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "time", Value: -1}},
+			Options: options.Index().SetName("post_id_time"),
+		},
+		{
+			Keys:    bson.D{{Key: "actor", Value: 1}, {Key: "time", Value: -1}},
+			Options: options.Index().SetName("actor_time"),
+		},
+	}
+
+	if _, err := collection.Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create audit log indexes: %w", err)
+	}
+	slog.Info("Created indexes on audit_log")
+
+	return nil
+}
+
+// createWebhookIndexes creates indexes for finding subscribed webhooks, due deliveries and recent deliveries.
+// Webhooks and the deliveries listed in the admin UI are found per tenant; due deliveries are claimed for every tenant.
+func createWebhookIndexes(ctx context.Context, db *mongo.Database) error {
+	if err := dropIndexIfExists(ctx, db.Collection("webhooks"), "events_active"); err != nil {
+		return err
+	}
+	if err := dropIndexIfExists(ctx, db.Collection("webhook_deliveries"), "created_at_desc"); err != nil {
+		return err
+	}
+
+	_, err := db.Collection("webhooks").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "events", Value: 1}, {Key: "active", Value: 1}},
+		Options: options.Index().SetName("tenant_events_active"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create webhook indexes: %w", err)
+	}
+
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName("status_next_attempt_at"),
+		},
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("tenant_created_at_desc"),
+		},
+		{
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("webhook_id_created_at"),
+		},
+		{
+			// A webhook gets one delivery per event, however often the outbox relays the event
+			Keys: bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().
+				SetName("webhook_id_event_id_unique").
+				SetUnique(true).
+				SetPartialFilterExpression(bson.M{"event_id": bson.M{"$type": "objectId"}}),
+		},
+	}
+	if _, err := db.Collection("webhook_deliveries").Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create webhook delivery indexes: %w", err)
+	}
+	slog.Info("Created indexes on webhooks and webhook_deliveries")
+
+	return nil
+}
+
+// outboxRetention is how long processed outbox records are kept
+const outboxRetention = 7 * 24 * time.Hour
+
+// createOutboxIndexes creates the index relays claim records with, and expires processed records
+func createOutboxIndexes(ctx context.Context, db *mongo.Database) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName("status_next_attempt_at"),
+		},
+		{
+			// Pending records have no processed_at, so only processed ones expire
+			Keys: bson.D{{Key: "processed_at", Value: 1}},
+			Options: options.Index().
+				SetName("processed_at_ttl").
+				SetExpireAfterSeconds(int32(outboxRetention.Seconds())),
+		},
+	}
+	if _, err := db.Collection("outbox").Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create outbox indexes: %w", err)
+	}
+	slog.Info("Created indexes on outbox")
+
+	return nil
+}
+
+// createUserIndexes creates the unique indexes on user names and single sign-on identities within a tenant, and expires sessions
+func createUserIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("users").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tenant_id", Value: 1}, {Key: "username", Value: 1}},
+			Options: options.Index().SetName("tenant_username_unique").SetUnique(true),
+		},
+		{
+			// Single sign-on finds users by their identity at the provider; local users have none
+			Keys: bson.D{{Key: "tenant_id", Value: 1}, {Key: "oidc_issuer", Value: 1}, {Key: "oidc_subject", Value: 1}},
+			Options: options.Index().SetName("tenant_oidc_subject_unique").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"oidc_subject": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create user indexes: %w", err)
+	}
+
+	indexModels := []mongo.IndexModel{
+		{
+			// Signing out everywhere deletes the sessions of a user
+			Keys:    bson.D{{Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("user_id"),
+		},
+		{
+			Keys: bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().
+				SetName("expires_at_ttl").
+				SetExpireAfterSeconds(0),
+		},
+	}
+	if _, err := db.Collection("sessions").Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create session indexes: %w", err)
+	}
+	slog.Info("Created indexes on users and sessions")
+
+	return nil
+}
+
+// createTokenIndexes creates indexes for API tokens, which are looked up by their hash on every API request
+// and listed per user on the settings page
+func createTokenIndexes(ctx context.Context, db *mongo.Database) error {
+	indexModels := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "hash", Value: 1}},
+			Options: options.Index().SetName("hash_unique").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("user_id_created_at_desc"),
+		},
+	}
+	if _, err := db.Collection("api_tokens").Indexes().CreateMany(ctx, indexModels); err != nil {
+		return fmt.Errorf("failed to create API token indexes: %w", err)
+	}
+	slog.Info("Created indexes on api_tokens")
+
+	return nil
+}
+
+// tenantCollections lists the collections whose documents belong to a tenant
+var tenantCollections = []string{"posts", "audit_log", "webhooks", "webhook_deliveries"}
+
+// backfillTenants sets the default tenant on documents without a tenant, e.g. those stored before tenants existed
+// or posts written by other tools, so that they are indexed with the default tenant's documents
+func backfillTenants(ctx context.Context, db *mongo.Database) error {
+	for _, name := range tenantCollections {
+		result, err := db.Collection(name).UpdateMany(ctx,
+			bson.M{"tenant_id": bson.M{"$in": bson.A{"", nil}}},
+			bson.M{"$set": bson.M{"tenant_id": tenant.DefaultID}},
+		)
+		if err != nil {
+			return fmt.Errorf("failed to set the default tenant on %s: %w", name, err)
+		}
+		if result.ModifiedCount > 0 {
+			slog.Info("Set the default tenant on documents without one", "collection", name, "count", result.ModifiedCount)
+		}
+	}
+	return nil
+}
+
+// dropIndexIfExists drops the named index of collection, doing nothing if there is no such index
+func dropIndexIfExists(ctx context.Context, collection *mongo.Collection, name string) error {
+	specs, err := collection.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list indexes: %w", err)
+	}
 
+	for _, spec := range specs {
+		if spec.Name != name {
+			continue
+		}
+		if _, err := collection.Indexes().DropOne(ctx, name); err != nil {
+			return fmt.Errorf("failed to drop index %s: %w", name, err)
+		}
+		slog.Info("Dropped index", "collection", collection.Name(), "name", name)
+	}
 	return nil
 }
 
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+)
+
+const (
+	// AuthCookieName is the cookie carrying the session token of the signed-in user.
+	// It is separate from the CSRF session cookie, which every visitor gets.
+	AuthCookieName = "auth"
+	// userKey is the gin context key holding the signed-in user
+	userKey = "user"
+)
+
+// Authenticate is a middleware that signs in the user of the request's session cookie,
+// setting UserIDKey and the user for the Actor middleware and templates.
+// Cookies of ended sessions are removed; other requests continue without a user.
+func Authenticate(users *service.UserService, secureCookie bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, err := c.Cookie(AuthCookieName)
+		if err != nil || token == "" {
+			c.Next()
+			return
+		}
+
+		user, err := users.Authenticate(c.Request.Context(), token)
+		switch {
+		case err == nil:
+			c.Set(UserIDKey, user.ID.Hex())
+			c.Set(userKey, user)
+		case errors.Is(err, service.ErrSessionExpired):
+			ClearAuthCookie(c, secureCookie)
+		default:
+			slog.Error("Failed to authenticate session", "error", err)
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the signed-in user of the request, or nil for anonymous visitors
+func CurrentUser(c *gin.Context) *model.User {
+	if user, ok := c.Get(userKey); ok {
+		return user.(*model.User)
+	}
+	return nil
+}
+
+// SetAuthCookie stores the session token in the auth cookie of the request's tenant for maxAge seconds
+func SetAuthCookie(c *gin.Context, token string, maxAge int, secureCookie bool) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(AuthCookieName, token, maxAge, authCookiePath(c), "", secureCookie, true)
+}
+
+// ClearAuthCookie removes the auth cookie of the request's tenant
+func ClearAuthCookie(c *gin.Context, secureCookie bool) {
+	SetAuthCookie(c, "", -1, secureCookie)
+}
+
+// authCookiePath limits the auth cookie to the pages of the request's tenant,
+// since sessions of tenants served under a path prefix don't sign in to the others
+func authCookiePath(c *gin.Context) string {
+	if prefix := tenant.From(c.Request.Context()).PathPrefix; prefix != "" {
+		return prefix
+	}
+	return "/"
+}
+
+// Require is a middleware that rejects requests whose actor lacks permission p with 403.
+// Anonymous visitors loading a page are sent to the sign-in page instead, which returns them afterwards.
+// Services check permissions as well; Require keeps pages that are only useful with p out of reach.
+func Require(p model.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if service.ActorFrom(c.Request.Context()).Can(p) {
+			c.Next()
+			return
+		}
+		deny(c)
+	}
+}
+
+// RequireUser is a middleware that only lets signed-in users through, e.g. to their own settings.
+// Anonymous visitors are treated like by Require.
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentUser(c) != nil {
+			c.Next()
+			return
+		}
+		deny(c)
+	}
+}
+
+// deny sends anonymous visitors loading a page to the sign-in page and rejects other requests with 403
+func deny(c *gin.Context) {
+	actor := service.ActorFrom(c.Request.Context())
+	if actor.ID == service.AnonymousActor && c.Request.Method == http.MethodGet && c.GetHeader("HX-Request") != "true" && !wantsJSON(c) {
+		login := tenant.From(c.Request.Context()).Path("/login") + "?" + url.Values{"next": {c.Request.URL.RequestURI()}}.Encode()
+		c.Redirect(http.StatusSeeOther, login)
+		c.Abort()
+		return
+	}
+
+	c.Error(service.ErrForbidden)
+	c.Abort()
+}
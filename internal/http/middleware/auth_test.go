@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+func TestRequire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		actor        service.Actor
+		path         string
+		htmx         bool
+		wantStatus   int
+		wantLocation string
+	}{
+		{name: "allowed", actor: service.Actor{ID: "user-1", Role: model.RoleAdmin}, path: "/admin/users", wantStatus: http.StatusOK},
+		{name: "signed in without permission", actor: service.Actor{ID: "user-1", Role: model.RoleEditor}, path: "/admin/users", wantStatus: http.StatusForbidden},
+		{name: "anonymous page", actor: service.Actor{ID: service.AnonymousActor, Role: model.RoleReader}, path: "/admin/users?page=2", wantStatus: http.StatusSeeOther, wantLocation: "/login?next=%2Fadmin%2Fusers%3Fpage%3D2"},
+		{name: "anonymous htmx", actor: service.Actor{ID: service.AnonymousActor, Role: model.RoleReader}, path: "/admin/users", htmx: true, wantStatus: http.StatusForbidden},
+		{name: "anonymous API", actor: service.Actor{ID: service.AnonymousActor, Role: model.RoleReader}, path: "/api/users", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{.Error}}`)))
+			router.Use(Errors(), func(c *gin.Context) {
+				c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), tt.actor))
+			}, Require(model.PermManage))
+			handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+			router.GET("/admin/users", handler)
+			router.GET("/api/users", handler)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.htmx {
+				req.Header.Set("HX-Request", "true")
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+		})
+	}
+}
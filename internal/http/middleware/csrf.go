@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// SessionCookieName is the cookie identifying the browser session
+	SessionCookieName = "session_id"
+	// CSRFHeaderName is the request header carrying the anti-forgery token, set by htmx via hx-headers
+	CSRFHeaderName = "X-CSRF-Token"
+	// CSRFFormField is the form field carrying the anti-forgery token for plain form posts
+	CSRFFormField = "csrf_token"
+	// csrfTokenKey is the gin context key holding the token for the current session
+	csrfTokenKey = "csrf_token"
+	// csrfDeferredKey is the gin context key marking requests left to VerifyCSRF, holding their form body limit
+	csrfDeferredKey = "csrf_deferred"
+	// sessionIDBytes is the amount of randomness in a session ID
+	sessionIDBytes = 32
+)
+
+// CSRF is a middleware protecting mutating requests against cross-site request forgery.
+// It issues a session cookie and derives a per-session token from it with HMAC-SHA256,
+// so no server-side state is needed. POST, PUT, PATCH and DELETE requests must send the
+// token in the X-CSRF-Token header or the csrf_token form field, or they are rejected with 403.
+// Reading the form field parses the body before route middleware runs, so bodies sending the token that way
+// are limited to maxFormBytes here; 0 doesn't limit them.
+// Requests with an "Authorization: Bearer" header are left to VerifyCSRF, which runs after BearerAuth.
+func CSRF(secret []byte, secureCookie bool, maxFormBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := c.Cookie(SessionCookieName)
+		if err != nil || !validSessionID(sessionID) {
+			sessionID = newSessionID()
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(SessionCookieName, sessionID, 0, "/", "", secureCookie, true)
+		}
+
+		token := csrfToken(secret, sessionID)
+		c.Set(csrfTokenKey, token)
+
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		// Route middleware hasn't checked the API token yet
+		if _, ok := bearerToken(c.Request); ok {
+			c.Set(csrfDeferredKey, maxFormBytes)
+			c.Next()
+			return
+		}
+
+		if !verifyCSRFToken(c, token, maxFormBytes) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// VerifyCSRF is a middleware checking the anti-forgery token of requests the CSRF middleware left to it.
+// Browsers don't send Authorization headers to other sites without CORS, which this site doesn't allow,
+// so requests BearerAuth authenticated can't be forged and skip the check; the rest need the token like
+// any other request. It must run after BearerAuth, on every route accepting mutating requests.
+func VerifyCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxFormBytes, deferred := c.Get(csrfDeferredKey)
+		if !deferred || c.GetBool(tokenAuthenticatedKey) {
+			c.Next()
+			return
+		}
+		if !verifyCSRFToken(c, CSRFToken(c), maxFormBytes.(int64)) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// verifyCSRFToken checks the token sent in the header or form field against token,
+// aborting the request and returning false if it doesn't match
+func verifyCSRFToken(c *gin.Context, token string, maxFormBytes int64) bool {
+	provided := c.GetHeader(CSRFHeaderName)
+	if provided == "" {
+		if maxFormBytes > 0 && !limitBody(c, maxFormBytes) {
+			return false
+		}
+		provided = c.PostForm(CSRFFormField)
+	}
+
+	if !hmac.Equal([]byte(provided), []byte(token)) {
+		slog.Warn("CSRF token missing or invalid",
+			"method", c.Request.Method,
+			"path", c.Request.URL.Path,
+			"provided", provided != "",
+		)
+		RenderError(c, http.StatusForbidden, "csrf_failed", Localizer(c).T("error.csrf_failed"), nil)
+		return false
+	}
+	return true
+}
+
+// CSRFToken returns the anti-forgery token for the current request's session, for use in templates
+func CSRFToken(c *gin.Context) string {
+	return c.GetString(csrfTokenKey)
+}
+
+// SessionID returns the session ID of the current request, issued by the CSRF middleware
+func SessionID(c *gin.Context) string {
+	if sessionID, err := c.Cookie(SessionCookieName); err == nil && validSessionID(sessionID) {
+		return sessionID
+	}
+	return ""
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func newSessionID() string {
+	b := make([]byte, sessionIDBytes)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic("failed to generate session id: " + err.Error())
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func validSessionID(sessionID string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(sessionID)
+	return err == nil && len(decoded) == sessionIDBytes
+}
+
+func csrfToken(secret []byte, sessionID string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(sessionID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
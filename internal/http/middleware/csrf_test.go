@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newCSRFRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{.Error}}`)))
+	router.Use(CSRF([]byte("test-secret"), false, 1024))
+	router.GET("/form", func(c *gin.Context) {
+		c.String(http.StatusOK, CSRFToken(c))
+	})
+	ok := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	router.POST("/posts", VerifyCSRF(), ok)
+	// Stands in for BearerAuth accepting the token
+	signIn := func(c *gin.Context) {
+		c.Set(tokenAuthenticatedKey, true)
+	}
+	router.POST("/api/posts", signIn, VerifyCSRF(), ok)
+	return router
+}
+
+func TestCSRF(t *testing.T) {
+	router := newCSRFRouter()
+
+	// Obtain a session cookie and its token
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != SessionCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("GET /form cookies = %v, want one HttpOnly session cookie", cookies)
+	}
+	session := cookies[0]
+	token := w.Body.String()
+
+	tests := []struct {
+		name       string
+		path       string
+		cookie     *http.Cookie
+		header     string
+		formToken  string
+		formPad    int
+		bearer     string
+		wantStatus int
+	}{
+		{name: "token in header", cookie: session, header: token, wantStatus: http.StatusOK},
+		{name: "token in form field", cookie: session, formToken: token, wantStatus: http.StatusOK},
+		{name: "token in form field over the body limit", cookie: session, formToken: token, formPad: 2048, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "token in header over the body limit", cookie: session, header: token, formPad: 2048, wantStatus: http.StatusOK},
+		{name: "missing token", cookie: session, wantStatus: http.StatusForbidden},
+		{name: "wrong token", cookie: session, header: "forged", wantStatus: http.StatusForbidden},
+		{name: "token without session", header: token, wantStatus: http.StatusForbidden},
+		{name: "API token", path: "/api/posts", bearer: "Bearer ghm_secret", wantStatus: http.StatusOK},
+		{name: "API token not checked by BearerAuth", bearer: "Bearer ghm_secret", wantStatus: http.StatusForbidden},
+		{name: "API token not checked by BearerAuth with a token", cookie: session, header: token, bearer: "Bearer ghm_secret", wantStatus: http.StatusOK},
+		{name: "API token not checked by BearerAuth over the body limit", cookie: session, formToken: token, formPad: 2048, bearer: "Bearer ghm_secret", wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "other authorization", bearer: "Basic amFuZTpzZWNyZXQ=", wantStatus: http.StatusForbidden},
+		{
+			name:       "token from another session",
+			cookie:     &http.Cookie{Name: SessionCookieName, Value: newSessionID()},
+			header:     token,
+			wantStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.formToken != "" {
+				form.Set(CSRFFormField, tt.formToken)
+			}
+			if tt.formPad > 0 {
+				form.Set("content", strings.Repeat("x", tt.formPad))
+			}
+			path := tt.path
+			if path == "" {
+				path = "/posts"
+			}
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			if tt.header != "" {
+				req.Header.Set(CSRFHeaderName, tt.header)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", tt.bearer)
+			}
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("POST %s status = %d, want %d", path, w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
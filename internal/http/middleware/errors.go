@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// ErrorRegion is the element HTMX error responses are swapped into
+const ErrorRegion = "#error-region"
+
+// jsonErrorsKey marks requests whose errors are rendered as JSON
+const jsonErrorsKey = "json_errors"
+
+// Errors is a middleware that renders the last error a handler added with c.Error.
+// Service errors are mapped to status codes by kind, any other error is a 500.
+// Handlers that already wrote a response are left alone.
+func Errors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+
+		err := c.Errors.Last().Err
+		status := StatusFor(err)
+		if status >= http.StatusInternalServerError {
+			slog.Error("Request failed", "error", err, "method", c.Request.Method, "path", c.Request.URL.Path)
+		} else {
+			slog.Warn("Request rejected", "error", err, "status", status, "method", c.Request.Method, "path", c.Request.URL.Path)
+		}
+
+		message := localizedMessage(Localizer(c), err, status)
+		RenderError(c, status, service.CodeOf(err), message, err)
+	}
+}
+
+// localizedMessage translates the message of err by its code. Errors with added details, e.g. the
+// reason for ErrValidationFailed, keep their message. Internal errors may include details that
+// aren't meant for users and always get a generic message.
+func localizedMessage(l *i18n.Localizer, err error, status int) string {
+	if status >= http.StatusInternalServerError {
+		return l.T("error.internal")
+	}
+
+	var fields model.ValidationErrors
+	if errors.As(err, &fields) {
+		return l.ValidationErrors(fields).Error()
+	}
+
+	var svcErr *service.Error
+	if errors.As(err, &svcErr) && err.Error() == svcErr.Message && l.Has("error."+svcErr.Code) {
+		return l.T("error." + svcErr.Code)
+	}
+	return err.Error()
+}
+
+// StatusFor returns the HTTP status code for a service error kind
+func StatusFor(err error) int {
+	switch service.KindOf(err) {
+	case service.KindInvalid:
+		return http.StatusBadRequest
+	case service.KindUnauthorized:
+		return http.StatusUnauthorized
+	case service.KindForbidden:
+		return http.StatusForbidden
+	case service.KindNotFound:
+		return http.StatusNotFound
+	case service.KindConflict:
+		return http.StatusConflict
+	case service.KindValidation:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// RenderError writes an error response and aborts the request.
+// API requests get JSON with the code, the message and any invalid fields in err.
+// Other requests get the error fragment; HTMX requests have it swapped into the error region,
+// whatever their own target is.
+func RenderError(c *gin.Context, status int, code, message string, err error) {
+	defer c.Abort()
+
+	if wantsJSON(c) {
+		body := gin.H{"error": message, "code": code}
+		var fields model.ValidationErrors
+		if errors.As(err, &fields) {
+			body["error"] = "validation failed"
+			body["fields"] = Localizer(c).ValidationErrors(fields)
+		}
+		c.JSON(status, body)
+		return
+	}
+
+	if c.GetHeader("HX-Request") == "true" {
+		c.Header("HX-Retarget", ErrorRegion)
+		c.Header("HX-Reswap", "innerHTML")
+	}
+	c.HTML(status, "error.html", gin.H{"Error": message, "L": Localizer(c)})
+}
+
+// JSONErrors is a middleware that makes errors render as JSON, for routes outside /api used by scripts
+func JSONErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(jsonErrorsKey, true)
+		c.Next()
+	}
+}
+
+// wantsJSON reports whether the request is for the JSON API, or a route using JSONErrors, or only accepts JSON
+func wantsJSON(c *gin.Context) bool {
+	if c.GetBool(jsonErrorsKey) {
+		return true
+	}
+	if c.Request.URL.Path == "/api" || strings.HasPrefix(c.Request.URL.Path, "/api/") {
+		return true
+	}
+	accept := c.GetHeader("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
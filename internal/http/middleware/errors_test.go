@@ -0,0 +1,141 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+func TestErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fieldErrs := model.ValidationErrors{{Field: "title", Code: model.CodeRequired, Message: "title is required"}}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{"invalid", fmt.Errorf("%w: cannot sort by views", service.ErrValidationFailed), http.StatusBadRequest, "validation failed: cannot sort by views"},
+		{"not found", service.ErrPostNotFound, http.StatusNotFound, "post not found"},
+		{"conflict", service.ErrConflict, http.StatusConflict, service.ErrConflict.Message},
+		{"forbidden", service.ErrForbidden, http.StatusForbidden, service.ErrForbidden.Message},
+		{"unauthorized", service.ErrInvalidToken, http.StatusUnauthorized, service.ErrInvalidToken.Message},
+		{"validation", &service.Error{Kind: service.KindValidation, Code: "invalid_fields", Message: "title is required", Err: fieldErrs}, http.StatusUnprocessableEntity, "title is required"},
+		{"internal", errors.New("connection refused"), http.StatusInternalServerError, "Internal server error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{.Error}}`)))
+			router.Use(Errors())
+			handler := func(c *gin.Context) { c.Error(tt.err) }
+			router.GET("/posts", handler)
+			router.GET("/api/posts", handler)
+
+			req := httptest.NewRequest(http.MethodGet, "/posts", nil)
+			req.Header.Set("HX-Request", "true")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+			if got := w.Header().Get("HX-Retarget"); got != ErrorRegion {
+				t.Errorf("HX-Retarget = %q, want %q", got, ErrorRegion)
+			}
+			if got := w.Header().Get("HX-Reswap"); got != "innerHTML" {
+				t.Errorf("HX-Reswap = %q, want innerHTML", got)
+			}
+
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+
+			var body struct {
+				Error  string             `json:"error"`
+				Code   string             `json:"code"`
+				Fields []model.FieldError `json:"fields"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to decode JSON error: %v, body: %s", err, w.Body.String())
+			}
+			if w.Code != tt.wantStatus {
+				t.Errorf("API status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if body.Code != service.CodeOf(tt.err) {
+				t.Errorf("API code = %q, want %q", body.Code, service.CodeOf(tt.err))
+			}
+			if w.Header().Get("HX-Retarget") != "" {
+				t.Errorf("API response has HX-Retarget")
+			}
+			if wantFields := tt.wantStatus == http.StatusUnprocessableEntity; wantFields != (len(body.Fields) == 1) {
+				t.Errorf("API fields = %+v", body.Fields)
+			}
+		})
+	}
+}
+
+func TestErrorsWrittenResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Errors())
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		c.Error(errors.New("late failure"))
+	})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("response = %d %q, want the handler's response unchanged", w.Code, w.Body.String())
+	}
+}
+
+func TestErrorsLocalized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	fieldErrs := model.ValidationErrors{{Field: "title", Code: model.CodeRequired, Message: "title is required"}}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantBody string
+	}{
+		{"service error", service.ErrPostNotFound, "Публікацію не знайдено"},
+		{"validation", &service.Error{Kind: service.KindValidation, Code: "invalid_fields", Message: "title is required", Err: fieldErrs}, "Поле «заголовок» обов&#39;язкове"},
+		{"error with details", fmt.Errorf("%w: cannot sort by views", service.ErrValidationFailed), "validation failed: cannot sort by views"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{.Error}}`)))
+			router.Use(Locale(i18n.Default(), time.UTC, false))
+			router.Use(Errors())
+			router.GET("/posts", func(c *gin.Context) { c.Error(tt.err) })
+
+			req := httptest.NewRequest(http.MethodGet, "/posts", nil)
+			req.Header.Set("Accept-Language", "uk")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+)
+
+const (
+	// LocaleCookieName remembers the language picked with the lang query parameter
+	LocaleCookieName = "lang"
+	// LocaleQueryParam switches the language, e.g. ?lang=uk
+	LocaleQueryParam = "lang"
+	// TimezoneCookieName holds the browser's IANA time zone, set by a script in the layout
+	TimezoneCookieName = "tz"
+	// localizerKey is the gin context key holding the localizer of the current request
+	localizerKey = "localizer"
+	// localeCookieMaxAge keeps the picked language for a year
+	localeCookieMaxAge = 365 * 24 * 60 * 60
+)
+
+// Locale is a middleware that picks the language and time zone of each request.
+// The language comes from the lang query parameter, which is remembered in a cookie, then the cookie,
+// then Accept-Language. The time zone comes from the tz cookie and defaults to defaultLocation.
+func Locale(bundle *i18n.Bundle, defaultLocation *time.Location, secureCookie bool) gin.HandlerFunc {
+	var locations sync.Map
+
+	return func(c *gin.Context) {
+		locale := ""
+		if requested := c.Query(LocaleQueryParam); bundle.Supports(requested) {
+			locale = requested
+			c.SetSameSite(http.SameSiteLaxMode)
+			c.SetCookie(LocaleCookieName, locale, localeCookieMaxAge, "/", "", secureCookie, false)
+		} else if cookie, err := c.Cookie(LocaleCookieName); err == nil && bundle.Supports(cookie) {
+			locale = cookie
+		} else {
+			locale = bundle.Match(c.GetHeader("Accept-Language"))
+		}
+
+		location := defaultLocation
+		if name, err := c.Cookie(TimezoneCookieName); err == nil && name != "" {
+			if cached, ok := locations.Load(name); ok {
+				location = cached.(*time.Location)
+			} else if loaded, err := time.LoadLocation(name); err == nil {
+				locations.Store(name, loaded)
+				location = loaded
+			}
+		}
+
+		c.Set(localizerKey, bundle.Localizer(locale, location))
+		c.Next()
+	}
+}
+
+// Localizer returns the localizer of the current request.
+// Without the Locale middleware, messages are in the default locale and times in UTC.
+func Localizer(c *gin.Context) *i18n.Localizer {
+	if value, ok := c.Get(localizerKey); ok {
+		return value.(*i18n.Localizer)
+	}
+	return i18n.Default().Localizer(i18n.DefaultLocale, time.UTC)
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+)
+
+func TestLocale(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		url            string
+		cookies        []*http.Cookie
+		acceptLanguage string
+		wantLocale     string
+		wantLocation   string
+		wantCookie     bool
+	}{
+		{"default", "/", nil, "", "en", "UTC", false},
+		{"accept language", "/", nil, "uk-UA,uk;q=0.9", "uk", "UTC", false},
+		{"cookie over header", "/", []*http.Cookie{{Name: LocaleCookieName, Value: "en"}}, "uk", "en", "UTC", false},
+		{"query over cookie", "/?lang=uk", []*http.Cookie{{Name: LocaleCookieName, Value: "en"}}, "", "uk", "UTC", true},
+		{"unsupported query", "/?lang=xx", nil, "uk", "uk", "UTC", false},
+		{"unsupported cookie", "/", []*http.Cookie{{Name: LocaleCookieName, Value: "xx"}}, "", "en", "UTC", false},
+		{"time zone", "/", []*http.Cookie{{Name: TimezoneCookieName, Value: "Europe/Kyiv"}}, "", "en", "Europe/Kyiv", false},
+		{"unknown time zone", "/", []*http.Cookie{{Name: TimezoneCookieName, Value: "Mars/Olympus"}}, "", "en", "UTC", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *i18n.Localizer
+			router := gin.New()
+			router.Use(Locale(i18n.Default(), time.UTC, false))
+			router.GET("/", func(c *gin.Context) { got = Localizer(c) })
+
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if got.Locale != tt.wantLocale {
+				t.Errorf("Locale = %q, want %q", got.Locale, tt.wantLocale)
+			}
+			if got.Location.String() != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got.Location, tt.wantLocation)
+			}
+			setCookie := rec.Header().Get("Set-Cookie")
+			if gotCookie := strings.HasPrefix(setCookie, LocaleCookieName+"="+tt.wantLocale); gotCookie != tt.wantCookie {
+				t.Errorf("Set-Cookie = %q, want the locale cookie set: %v", setCookie, tt.wantCookie)
+			}
+		})
+	}
+}
+
+func TestLocalizerWithoutMiddleware(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if got := Localizer(c); got.Locale != i18n.DefaultLocale || got.Location != time.UTC {
+		t.Errorf("Localizer() = %s in %s, want the default locale in UTC", got.Locale, got.Location)
+	}
+}
@@ -21,6 +21,7 @@ func Logger() gin.HandlerFunc {
 			"path", path,
 			"status", c.Writer.Status(),
 			"duration", duration.String(),
+			"requestId", c.GetString(RequestIDKey),
 		)
 	}
 }
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/ratelimit"
+)
+
+// UserIDKey is the gin context key holding the authenticated user's ID
+const UserIDKey = "user_id"
+
+// KeyFunc identifies the client a request is rate limited as
+type KeyFunc func(c *gin.Context) string
+
+// KeyByIP rate limits requests per client IP address
+func KeyByIP(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// KeyByUser rate limits requests per authenticated user, falling back to the client IP for anonymous requests
+func KeyByUser(c *gin.Context) string {
+	if userID := c.GetString(UserIDKey); userID != "" {
+		return "user:" + userID
+	}
+	return KeyByIP(c)
+}
+
+// RateLimit is a middleware that limits requests with a token bucket per client.
+// The name separates buckets of different route groups sharing the same store.
+// Requests over the limit get 429 Too Many Requests with a Retry-After header.
+// If the store fails, requests are allowed so that an outage doesn't take the site down.
+func RateLimit(store ratelimit.Store, name string, limit ratelimit.Limit, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := name + ":" + keyFunc(c)
+
+		result, err := store.Take(c.Request.Context(), key, limit)
+		if err != nil {
+			slog.Error("Rate limiter unavailable, allowing request", "error", err, "group", name)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		if !result.Allowed {
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			slog.Warn("Rate limit exceeded",
+				"group", name,
+				"key", key,
+				"path", c.Request.URL.Path,
+				"retryAfter", retryAfter,
+			)
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			RenderError(c, http.StatusTooManyRequests, "rate_limited",
+				Localizer(c).T("error.rate_limited", "seconds", retryAfter), nil)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// BodyLimit is a middleware that rejects request bodies larger than maxBytes
+func BodyLimit(maxBytes int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limitBody(c, maxBytes) {
+			c.Next()
+		}
+	}
+}
+
+// limitBody caps the request body at maxBytes. Bodies declaring a larger length are rejected with
+// 413 Request Entity Too Large right away, and limitBody reports false.
+func limitBody(c *gin.Context, maxBytes int64) bool {
+	if c.Request.ContentLength > maxBytes {
+		slog.Warn("Request body too large", "path", c.Request.URL.Path, "contentLength", c.Request.ContentLength)
+		RenderError(c, http.StatusRequestEntityTooLarge, "too_large", Localizer(c).T("error.too_large"), nil)
+		return false
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+	return true
+}
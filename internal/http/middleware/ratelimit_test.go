@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestKeyByIPTrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{name: "direct", remoteAddr: "203.0.113.7:5000", want: "ip:203.0.113.7"},
+		{name: "forged header without trusted proxies", remoteAddr: "203.0.113.7:5000", forwarded: "198.51.100.1", want: "ip:203.0.113.7"},
+		{name: "forged header from an untrusted address", trusted: []string{"10.0.0.0/8"}, remoteAddr: "203.0.113.7:5000", forwarded: "198.51.100.1", want: "ip:203.0.113.7"},
+		{name: "trusted proxy", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.1.2.3:5000", forwarded: "198.51.100.1", want: "ip:198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			if err := router.SetTrustedProxies(tt.trusted); err != nil {
+				t.Fatalf("SetTrustedProxies() error = %v", err)
+			}
+			var key string
+			router.GET("/", func(c *gin.Context) {
+				key = KeyByIP(c)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+				req.Header.Set("X-Real-IP", tt.forwarded)
+			}
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if key != tt.want {
+				t.Errorf("KeyByIP() = %q, want %q", key, tt.want)
+			}
+		})
+	}
+}
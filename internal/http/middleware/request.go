@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+// RequestIDKey is the gin context key holding the request ID
+const RequestIDKey = "request_id"
+
+// RequestIDHeader carries the request ID in requests from proxies and in every response
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern limits request IDs accepted from clients to short, log-safe tokens
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID is a middleware that identifies every request, so its log lines and audit entries can be correlated.
+// It keeps a well-formed X-Request-ID set by a proxy and generates one otherwise.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// newRequestID returns a random request ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Actor is a middleware that attributes changes made by the request to its user, IP address and request ID
+// in the audit log, and grants the request the permissions of the user's role.
+// Requests without an authenticated user are attributed to service.AnonymousActor and get the anonymous role.
+func Actor(anonymous model.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := service.Actor{
+			ID:        c.GetString(UserIDKey),
+			Role:      anonymous,
+			IP:        c.ClientIP(),
+			RequestID: c.GetString(RequestIDKey),
+		}
+		if user := CurrentUser(c); user != nil {
+			actor.Role = user.Role
+		}
+		if actor.ID == "" {
+			actor.ID = service.AnonymousActor
+		}
+
+		c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), actor))
+		c.Next()
+	}
+}
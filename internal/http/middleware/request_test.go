@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRequestIDAndActor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := primitive.NewObjectID()
+
+	tests := []struct {
+		name          string
+		requestID     string
+		user          *model.User
+		wantRequestID string
+		wantActor     string
+		wantRole      model.Role
+	}{
+		{name: "generated", wantActor: service.AnonymousActor, wantRole: model.RoleReader},
+		{name: "from proxy", requestID: "abc-123", wantRequestID: "abc-123", wantActor: service.AnonymousActor, wantRole: model.RoleReader},
+		{name: "malformed", requestID: "bad id\n", wantActor: service.AnonymousActor, wantRole: model.RoleReader},
+		{name: "authenticated user", user: &model.User{ID: userID, Role: model.RoleEditor}, wantActor: userID.Hex(), wantRole: model.RoleEditor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(RequestID(), func(c *gin.Context) {
+				if tt.user != nil {
+					c.Set(UserIDKey, tt.user.ID.Hex())
+					c.Set(userKey, tt.user)
+				}
+			}, Actor(model.RoleReader))
+
+			var actor service.Actor
+			router.GET("/", func(c *gin.Context) {
+				actor = service.ActorFrom(c.Request.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.requestID != "" {
+				req.Header.Set(RequestIDHeader, tt.requestID)
+			}
+			req.RemoteAddr = "192.0.2.1:1234"
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if tt.wantRequestID != "" && requestID != tt.wantRequestID {
+				t.Errorf("%s = %q, want %q", RequestIDHeader, requestID, tt.wantRequestID)
+			}
+			if tt.wantRequestID == "" && len(requestID) != 32 {
+				t.Errorf("%s = %q, want a generated ID", RequestIDHeader, requestID)
+			}
+			if actor.Role != tt.wantRole {
+				t.Errorf("ActorFrom().Role = %q, want %q", actor.Role, tt.wantRole)
+			}
+			if actor.ID != tt.wantActor || actor.IP != "192.0.2.1" || actor.RequestID != requestID {
+				t.Errorf("ActorFrom() = %+v, want %s from 192.0.2.1 in request %s", actor, tt.wantActor, requestID)
+			}
+		})
+	}
+}
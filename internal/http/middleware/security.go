@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// cspNonceKey is the gin context key holding the Content-Security-Policy nonce of the current request
+const cspNonceKey = "csp_nonce"
+
+// SecurityConfig configures the security headers set on every response
+type SecurityConfig struct {
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only so violations are reported but not blocked
+	CSPReportOnly bool
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds; zero disables the header
+	HSTSMaxAge int
+	// FrameAncestors lists who may embed the site in a frame, e.g. "'none'" or "'self' https://partner.example"
+	FrameAncestors string
+	// ReferrerPolicy is the Referrer-Policy header value
+	ReferrerPolicy string
+}
+
+// SecurityHeaders is a middleware that sets a strict Content-Security-Policy with a per-request nonce
+// and the usual hardening headers. Templates must add the nonce (see CSPNonce) to inline scripts.
+func SecurityHeaders(cfg SecurityConfig) gin.HandlerFunc {
+	frameAncestors := cfg.FrameAncestors
+	if frameAncestors == "" {
+		frameAncestors = "'none'"
+	}
+
+	cspHeader := "Content-Security-Policy"
+	if cfg.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	return func(c *gin.Context) {
+		nonce := newNonce()
+		c.Set(cspNonceKey, nonce)
+
+		header := c.Writer.Header()
+		header.Set(cspHeader, strings.Join([]string{
+			"default-src 'self'",
+			"script-src 'self' 'nonce-" + nonce + "'",
+			"style-src 'self' 'nonce-" + nonce + "'",
+			"img-src 'self' data:",
+			"object-src 'none'",
+			"base-uri 'self'",
+			"form-action 'self'",
+			"frame-ancestors " + frameAncestors,
+		}, "; "))
+		header.Set("X-Content-Type-Options", "nosniff")
+		header.Set("Cross-Origin-Opener-Policy", "same-origin")
+		if cfg.ReferrerPolicy != "" {
+			header.Set("Referrer-Policy", cfg.ReferrerPolicy)
+		}
+		if frameAncestors == "'none'" {
+			// For browsers that don't support frame-ancestors
+			header.Set("X-Frame-Options", "DENY")
+		}
+		// Browsers ignore HSTS received over plain HTTP, so only send it on HTTPS requests
+		if cfg.HSTSMaxAge > 0 && isHTTPS(c) {
+			header.Set("Strict-Transport-Security", "max-age="+strconv.Itoa(cfg.HSTSMaxAge)+"; includeSubDomains")
+		}
+
+		c.Next()
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the current request, for use in templates
+func CSPNonce(c *gin.Context) string {
+	return c.GetString(cspNonceKey)
+}
+
+func isHTTPS(c *gin.Context) bool {
+	return c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic("failed to generate nonce: " + err.Error())
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
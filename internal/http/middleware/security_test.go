@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(SecurityHeaders(SecurityConfig{HSTSMaxAge: 600, ReferrerPolicy: "no-referrer"}))
+	router.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, CSPNonce(c))
+	})
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := serve(httptest.NewRequest(http.MethodGet, "/", nil))
+	nonce := first.Body.String()
+	csp := first.Header().Get("Content-Security-Policy")
+
+	if nonce == "" || !strings.Contains(csp, "script-src 'self' 'nonce-"+nonce+"'") {
+		t.Errorf("Content-Security-Policy = %q, want script nonce %q", csp, nonce)
+	}
+	if !strings.Contains(csp, "frame-ancestors 'none'") {
+		t.Errorf("Content-Security-Policy = %q, want frame-ancestors 'none' by default", csp)
+	}
+	if got := first.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+	}
+	if got := first.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Referrer-Policy = %q, want no-referrer", got)
+	}
+	if got := first.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q on plain HTTP, want none", got)
+	}
+
+	secureReq := httptest.NewRequest(http.MethodGet, "/", nil)
+	secureReq.TLS = &tls.ConnectionState{}
+	second := serve(secureReq)
+
+	if second.Body.String() == nonce {
+		t.Errorf("CSPNonce() repeated across requests")
+	}
+	if got := second.Header().Get("Strict-Transport-Security"); got != "max-age=600; includeSubDomains" {
+		t.Errorf("Strict-Transport-Security = %q, want max-age=600; includeSubDomains", got)
+	}
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		header    string
+		wantToken string
+		wantOK    bool
+	}{
+		{"Bearer ghm_secret", "ghm_secret", true},
+		{"bearer  ghm_secret ", "ghm_secret", true},
+		{"Bearer ", "", false},
+		{"Basic amFuZTpzZWNyZXQ=", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/posts", nil)
+			req.Header.Set("Authorization", tt.header)
+			token, ok := bearerToken(req)
+			if token != tt.wantToken || ok != tt.wantOK {
+				t.Errorf("bearerToken() = %q, %v, want %q, %v", token, ok, tt.wantToken, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		actor      service.Actor
+		wantStatus int
+	}{
+		{"browser", service.Actor{ID: "user-1", Role: model.RoleReader}, http.StatusOK},
+		{"token with scope", service.Actor{ID: "user-1", Role: model.RoleReader, Scopes: []model.TokenScope{model.ScopeRead}}, http.StatusOK},
+		{"token without scope", service.Actor{ID: "user-1", Role: model.RoleEditor, Scopes: []model.TokenScope{model.ScopeWrite}}, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.SetHTMLTemplate(template.Must(template.New("error.html").Parse(`{{.Error}}`)))
+			router.Use(Errors(), func(c *gin.Context) {
+				c.Request = c.Request.WithContext(service.WithActor(c.Request.Context(), tt.actor))
+			}, RequireScope(model.ScopeRead))
+			router.GET("/api/posts", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/posts", nil))
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
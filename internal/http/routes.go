@@ -1,22 +1,133 @@
 package http
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/iyhunko/go-htmx-mongo/internal/controller"
+	"github.com/iyhunko/go-htmx-mongo/internal/http/middleware"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+// Cache-Control policies applied to route groups
+const (
+	// cacheRevalidate lets browsers keep pages but revalidate them with ETags on every use
+	cacheRevalidate = "private, no-cache"
+	// cacheNever is used for forms, which embed CSRF tokens, and downloads
+	cacheNever = "no-store"
+	// cacheStatic is used for static assets
+	cacheStatic = "public, max-age=3600"
 )
 
-// SetupRoutes configures all application routes
-func SetupRoutes(router *gin.Engine, postController *controller.PostController) {
+// RouteMiddleware holds middleware applied to groups of routes
+type RouteMiddleware struct {
+	// Read is applied to routes that only read data
+	Read []gin.HandlerFunc
+	// Write is applied to routes that create, change or delete data
+	Write []gin.HandlerFunc
+	// Form is applied to form submissions, but not to bulk import uploads
+	Form []gin.HandlerFunc
+	// API is applied first to routes that machine clients call: the JSON API, exports, imports and backups,
+	// e.g. to accept API tokens before rate limits key requests by user
+	API []gin.HandlerFunc
+}
+
+// SetupRoutes configures all application routes, serving static assets from static
+func SetupRoutes(router *gin.Engine, postController *controller.PostController, static http.FileSystem, mw RouteMiddleware) {
+	// Render errors that handlers add to the context
+	router.Use(middleware.Errors())
+
 	// Serve static files
-	router.Static("/static", "web/static")
+	router.Group("/", middleware.CacheControl(cacheStatic)).StaticFS("/static", static)
 
 	// Post routes
-	router.GET("/", postController.Index)
-	router.GET("/posts", postController.PostsList)
-	router.POST("/posts", postController.CreatePost)
-	router.PUT("/posts/:id", postController.UpdatePost)
-	router.DELETE("/posts/:id", postController.DeletePost)
-	router.GET("/posts/new", postController.ShowCreateForm)
-	router.GET("/posts/edit", postController.ShowEditForm)
-	router.GET("/posts/view", postController.ShowPost)
+	read := router.Group("/", mw.Read...)
+	listing := read.Group("/", middleware.CacheControl(cacheRevalidate))
+	listing.GET("/", postController.Index)
+	listing.GET("/posts", postController.PostsList)
+
+	uncached := read.Group("/", middleware.CacheControl(cacheNever))
+	uncached.GET("/posts/new", postController.ShowCreateForm)
+	uncached.GET("/posts/edit", postController.ShowEditForm)
+	uncached.GET("/posts/view", postController.ShowPost)
+
+	// Forms check anti-forgery tokens that the CSRF middleware leaves to route middleware, see VerifyCSRF
+	write := router.Group("/", append(mw.Write, middleware.VerifyCSRF(), middleware.CacheControl(cacheNever))...)
+	form := write.Group("/", mw.Form...)
+	form.POST("/posts", postController.CreatePost)
+	form.PUT("/posts/:id", postController.UpdatePost)
+	form.DELETE("/posts/:id", postController.DeletePost)
+	form.POST("/posts/bulk", postController.BulkAction)
+	form.POST("/posts/:id/translations", postController.SaveTranslation)
+	form.POST("/posts/:id/translations/delete", postController.DeleteTranslation)
+
+	// JSON API, exports and imports. API tokens need the read scope to read posts.
+	apiRead := router.Group("/", append(append(mw.API, mw.Read...), middleware.CacheControl(cacheNever), middleware.RequireScope(model.ScopeRead))...)
+	apiRead.GET("/posts/export", middleware.JSONErrors(), postController.ExportPosts)
+	apiRead.GET("/api/posts", postController.APIListPosts)
+	apiRead.GET("/api/posts/:id", postController.APIGetPost)
+
+	apiImport := router.Group("/", append(append(mw.API, mw.Write...), middleware.VerifyCSRF(), middleware.CacheControl(cacheNever))...)
+	apiImport.POST("/posts/import", middleware.JSONErrors(), postController.ImportPosts)
+
+	apiWrite := apiImport.Group("/api", mw.Form...)
+	apiWrite.POST("/posts", postController.APICreatePost)
+	apiWrite.PUT("/posts/:id", postController.APIUpdatePost)
+	apiWrite.DELETE("/posts/:id", postController.APIDeletePost)
+	apiWrite.PUT("/posts/:id/translations/:language", postController.APISaveTranslation)
+	apiWrite.DELETE("/posts/:id/translations/:language", postController.APIDeleteTranslation)
+}
+
+// SetupAdminRoutes configures the admin pages. They must be set up after SetupRoutes, which installs the error middleware.
+// The audit log needs the moderate permission, webhooks and backups the manage permission.
+func SetupAdminRoutes(router *gin.Engine, auditController *controller.AuditController, webhookController *controller.WebhookController, backupController *controller.BackupController, mw RouteMiddleware) {
+	admin := router.Group("/admin", append(mw.Read, middleware.CacheControl(cacheNever))...)
+	admin.GET("/audit", middleware.Require(model.PermModerate), auditController.AuditLog)
+	admin.GET("/webhooks", middleware.Require(model.PermManage), webhookController.Webhooks)
+
+	// Exports and backups, which API tokens with the admin scope may download
+	downloads := router.Group("/admin", append(append(mw.API, mw.Read...), middleware.CacheControl(cacheNever))...)
+	downloads.GET("/audit/export", middleware.Require(model.PermModerate), middleware.JSONErrors(), auditController.ExportAuditLog)
+	downloads.GET("/backup", middleware.Require(model.PermManage), middleware.JSONErrors(), backupController.DownloadBackup)
+
+	adminForm := router.Group("/admin", append(append(mw.Write, mw.Form...), middleware.VerifyCSRF(), middleware.CacheControl(cacheNever), middleware.Require(model.PermManage))...)
+	adminForm.POST("/webhooks", webhookController.CreateWebhook)
+	adminForm.POST("/webhooks/:id/active", webhookController.SetWebhookActive)
+	adminForm.POST("/webhooks/:id/delete", webhookController.DeleteWebhook)
+	adminForm.POST("/webhooks/deliveries/:id/replay", webhookController.ReplayDelivery)
+}
+
+// SetupUserRoutes configures signing in and out, the settings page of API tokens, which needs a signed-in user,
+// and the admin page of users, which needs the manage permission.
+// They must be set up after SetupRoutes, which installs the error middleware.
+func SetupUserRoutes(router *gin.Engine, userController *controller.UserController, tokenController *controller.TokenController, mw RouteMiddleware) {
+	router.Group("/", append(mw.Read, middleware.CacheControl(cacheNever))...).GET("/login", userController.ShowLogin)
+
+	// Sign-in attempts count against the write rate limit, which slows down guessing passwords
+	form := router.Group("/", append(append(mw.Write, mw.Form...), middleware.VerifyCSRF(), middleware.CacheControl(cacheNever))...)
+	form.POST("/login", userController.Login)
+	form.POST("/logout", userController.Logout)
+
+	admin := router.Group("/admin", append(mw.Read, middleware.CacheControl(cacheNever), middleware.Require(model.PermManage))...)
+	admin.GET("/users", userController.Users)
+
+	adminForm := form.Group("/admin", middleware.Require(model.PermManage))
+	adminForm.POST("/users", userController.CreateUser)
+	adminForm.POST("/users/:id/role", userController.SetRole)
+
+	settings := router.Group("/settings", append(mw.Read, middleware.CacheControl(cacheNever), middleware.RequireUser())...)
+	settings.GET("/tokens", tokenController.Tokens)
+
+	settingsForm := form.Group("/settings", middleware.RequireUser())
+	settingsForm.POST("/tokens", tokenController.CreateToken)
+	settingsForm.POST("/tokens/:id/delete", tokenController.RevokeToken)
+}
+
+// SetupSSORoutes configures signing in with the OpenID Connect provider: /login/oidc sends the browser to the
+// provider, which sends it back to /login/oidc/callback. Like password sign-ins, they count against the write rate limit.
+// They must be set up after SetupRoutes, which installs the error middleware.
+func SetupSSORoutes(router *gin.Engine, ssoController *controller.SSOController, mw RouteMiddleware) {
+	sso := router.Group("/login/oidc", append(mw.Write, middleware.CacheControl(cacheNever))...)
+	sso.GET("", ssoController.StartLogin)
+	sso.GET("/callback", ssoController.Callback)
 }
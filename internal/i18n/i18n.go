@@ -0,0 +1,296 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// DefaultLocale is used when none of the client's preferred languages is supported.
+// Its catalog is also the fallback for messages missing from other catalogs.
+const DefaultLocale = "en"
+
+// catalogs holds one JSON message catalog per locale, e.g. locales/uk.json
+//
+//go:embed locales/*.json
+var catalogs embed.FS
+
+// Catalog maps message keys to messages. Messages may contain {name} placeholders, and plural
+// messages are stored under the key followed by the CLDR plural form, e.g. "posts.count.few".
+type Catalog map[string]string
+
+// Bundle holds the message catalogs of every supported locale
+type Bundle struct {
+	locales  []string
+	catalogs map[string]Catalog
+	tags     map[string]language.Tag
+	matcher  language.Matcher
+}
+
+// NewBundle loads the catalogs in fsys, one "<locale>.json" file per locale in the locales directory.
+// The default locale must be among them.
+func NewBundle(fsys fs.FS) (*Bundle, error) {
+	files, err := fs.Glob(fsys, "locales/*.json")
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bundle{catalogs: map[string]Catalog{}, tags: map[string]language.Tag{}}
+	for _, file := range files {
+		locale := strings.TrimSuffix(path.Base(file), ".json")
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid locale %q: %w", locale, err)
+		}
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var catalog Catalog
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog %s: %w", file, err)
+		}
+
+		b.catalogs[locale] = catalog
+		b.tags[locale] = tag
+	}
+
+	if _, ok := b.catalogs[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("catalog for the default locale %q is missing", DefaultLocale)
+	}
+
+	// The default locale comes first, so the matcher falls back to it
+	b.locales = append(b.locales, DefaultLocale)
+	for locale := range b.catalogs {
+		if locale != DefaultLocale {
+			b.locales = append(b.locales, locale)
+		}
+	}
+	sort.Strings(b.locales[1:])
+
+	tags := make([]language.Tag, len(b.locales))
+	for i, locale := range b.locales {
+		tags[i] = b.tags[locale]
+	}
+	b.matcher = language.NewMatcher(tags)
+
+	return b, nil
+}
+
+var (
+	defaultBundle     *Bundle
+	defaultBundleOnce sync.Once
+)
+
+// Default returns the bundle of catalogs embedded in the binary
+func Default() *Bundle {
+	defaultBundleOnce.Do(func() {
+		bundle, err := NewBundle(catalogs)
+		if err != nil {
+			// The embedded catalogs are checked by tests, so this is a programming error
+			panic(err)
+		}
+		defaultBundle = bundle
+	})
+	return defaultBundle
+}
+
+// Locales returns the supported locales, the default locale first
+func (b *Bundle) Locales() []string {
+	return b.locales
+}
+
+// Supports reports whether there is a catalog for locale
+func (b *Bundle) Supports(locale string) bool {
+	_, ok := b.catalogs[locale]
+	return ok
+}
+
+// Match returns the supported locale that best matches the preferences, which are
+// Accept-Language header values or locale names, most important first
+func (b *Bundle) Match(preferences ...string) string {
+	var tags []language.Tag
+	for _, preference := range preferences {
+		if preference == "" {
+			continue
+		}
+		parsed, _, err := language.ParseAcceptLanguage(preference)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, parsed...)
+	}
+
+	_, index, confidence := b.matcher.Match(tags...)
+	if confidence == language.No {
+		return DefaultLocale
+	}
+	return b.locales[index]
+}
+
+// Localizer returns a localizer for locale, which must be supported, showing times in loc.
+// A nil loc shows times in UTC.
+func (b *Bundle) Localizer(locale string, loc *time.Location) *Localizer {
+	if !b.Supports(locale) {
+		locale = DefaultLocale
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return &Localizer{
+		bundle:   b,
+		Locale:   locale,
+		Location: loc,
+		tag:      b.tags[locale],
+		catalog:  b.catalogs[locale],
+		fallback: b.catalogs[DefaultLocale],
+	}
+}
+
+// Localizer translates messages and formats dates for one locale and time zone
+type Localizer struct {
+	Locale   string
+	Location *time.Location
+
+	bundle   *Bundle
+	tag      language.Tag
+	catalog  Catalog
+	fallback Catalog
+}
+
+// Language is a supported locale with its name in its own language, for language switchers
+type Language struct {
+	Code string
+	Name string
+}
+
+// Languages returns every supported locale, the default locale first
+func (l *Localizer) Languages() []Language {
+	languages := make([]Language, len(l.bundle.locales))
+	for i, locale := range l.bundle.locales {
+		languages[i] = Language{Code: locale, Name: l.bundle.catalogs[locale]["language.name"]}
+	}
+	return languages
+}
+
+// LanguageName returns the name of a content language, e.g. "Ukrainian" for "uk",
+// or the code itself when the catalogs don't name it
+func (l *Localizer) LanguageName(code string) string {
+	if message, ok := l.lookup("languages." + code); ok {
+		return message
+	}
+	return code
+}
+
+// Has reports whether there is a message for key
+func (l *Localizer) Has(key string) bool {
+	_, ok := l.lookup(key)
+	return ok
+}
+
+func (l *Localizer) lookup(key string) (string, bool) {
+	if message, ok := l.catalog[key]; ok {
+		return message, true
+	}
+	message, ok := l.fallback[key]
+	return message, ok
+}
+
+// T returns the message for key with its {name} placeholders replaced by args, which are name/value pairs.
+// Missing messages are returned as their key, so they stand out without breaking the page.
+func (l *Localizer) T(key string, args ...interface{}) string {
+	message, ok := l.lookup(key)
+	if !ok {
+		return key
+	}
+	return replacePlaceholders(message, args)
+}
+
+// N returns the plural form of the message for key that matches n, e.g. "posts.count.one".
+// The count is available to the message as {n}.
+func (l *Localizer) N(key string, n int64, args ...interface{}) string {
+	args = append([]interface{}{"n", n}, args...)
+	form := pluralForms[plural.Cardinal.MatchPlural(l.tag, int(n), 0, 0, 0, 0)]
+	if message, ok := l.lookup(key + "." + form); ok {
+		return replacePlaceholders(message, args)
+	}
+	return l.T(key+".other", args...)
+}
+
+// pluralForms names the CLDR plural forms as used in catalog keys
+var pluralForms = map[plural.Form]string{
+	plural.Other: "other",
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+}
+
+// replacePlaceholders replaces {name} in message by the value following name in args
+func replacePlaceholders(message string, args []interface{}) string {
+	if len(args) < 2 || !strings.Contains(message, "{") {
+		return message
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(message)
+}
+
+// FormatDateTime formats t in the localizer's time zone with the locale's date and time layout
+func (l *Localizer) FormatDateTime(t time.Time) string {
+	return t.In(l.Location).Format(l.T("format.datetime"))
+}
+
+// FormatDate formats t in the localizer's time zone with the locale's date layout
+func (l *Localizer) FormatDate(t time.Time) string {
+	return t.In(l.Location).Format(l.T("format.date"))
+}
+
+// ValidationErrors returns errs with translated messages. Messages are looked up as
+// "validation.<field>.<code>", then "validation.<code>"; the field name is available as {field}.
+// Failures without a translation keep their message.
+func (l *Localizer) ValidationErrors(errs model.ValidationErrors) model.ValidationErrors {
+	if errs == nil {
+		return nil
+	}
+
+	translated := make(model.ValidationErrors, len(errs))
+	for i, fieldErr := range errs {
+		args := []interface{}{"field", l.T("field." + fieldErr.Field)}
+		for _, name := range sortedKeys(fieldErr.Params) {
+			args = append(args, name, fieldErr.Params[name])
+		}
+
+		for _, key := range []string{"validation." + fieldErr.Field + "." + fieldErr.Code, "validation." + fieldErr.Code} {
+			if message, ok := l.lookup(key); ok {
+				fieldErr.Message = replacePlaceholders(message, args)
+				break
+			}
+		}
+		translated[i] = fieldErr
+	}
+	return translated
+}
+
+func sortedKeys(params map[string]string) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,170 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+func TestCatalogsComplete(t *testing.T) {
+	bundle := Default()
+	if got := bundle.Locales(); len(got) < 2 || got[0] != DefaultLocale {
+		t.Fatalf("Locales() = %v, want the default locale first and at least one other", got)
+	}
+
+	fallback := bundle.catalogs[DefaultLocale]
+	for _, locale := range bundle.Locales()[1:] {
+		catalog := bundle.catalogs[locale]
+		for key := range fallback {
+			// Plural forms differ between languages, "other" is the one every language has
+			if base, form, ok := cutPluralForm(key); ok {
+				if _, found := catalog[base+".other"]; !found {
+					t.Errorf("catalog %s is missing %s.other (from %s)", locale, base, form)
+				}
+				continue
+			}
+			if _, found := catalog[key]; !found {
+				t.Errorf("catalog %s is missing %q", locale, key)
+			}
+		}
+		for key := range catalog {
+			if _, found := fallback[key]; !found {
+				if base, _, ok := cutPluralForm(key); ok && fallback[base+".other"] != "" {
+					continue
+				}
+				t.Errorf("catalog %s has %q, which the default catalog lacks", locale, key)
+			}
+		}
+	}
+}
+
+// cutPluralForm splits "posts.count.one" into "posts.count" and "one"
+func cutPluralForm(key string) (string, string, bool) {
+	i := strings.LastIndex(key, ".")
+	if i < 0 {
+		return "", "", false
+	}
+	for _, form := range pluralForms {
+		if key[i+1:] == form {
+			return key[:i], form, true
+		}
+	}
+	return "", "", false
+}
+
+func TestMatch(t *testing.T) {
+	bundle := Default()
+
+	tests := []struct {
+		preferences []string
+		want        string
+	}{
+		{[]string{""}, "en"},
+		{[]string{"uk-UA,uk;q=0.9,en;q=0.8"}, "uk"},
+		{[]string{"en-US,en;q=0.9,uk;q=0.5"}, "en"},
+		{[]string{"fr-FR,fr;q=0.9"}, "en"},
+		{[]string{"de", "uk"}, "uk"},
+		{[]string{"not a language"}, "en"},
+	}
+
+	for _, tt := range tests {
+		if got := bundle.Match(tt.preferences...); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.preferences, got, tt.want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	en := Default().Localizer("en", nil)
+	uk := Default().Localizer("uk", nil)
+
+	if got := en.T("empty.search", "search", "golang"); !strings.Contains(got, "golang") {
+		t.Errorf("T() = %q, want the search placeholder replaced", got)
+	}
+	if got := uk.T("error.post_not_found"); got != "Публікацію не знайдено" {
+		t.Errorf("T() = %q, want the Ukrainian message", got)
+	}
+	if got := uk.T("missing.key"); got != "missing.key" {
+		t.Errorf("T() of a missing key = %q, want the key", got)
+	}
+
+	uk.catalog = Catalog{}
+	if got := uk.T("error.post_not_found"); got != "post not found" {
+		t.Errorf("T() of a key missing from the catalog = %q, want the default locale's message", got)
+	}
+}
+
+func TestN(t *testing.T) {
+	en := Default().Localizer("en", nil)
+	uk := Default().Localizer("uk", nil)
+
+	tests := []struct {
+		localizer *Localizer
+		n         int64
+		want      string
+	}{
+		{en, 1, "1 post"},
+		{en, 2, "2 posts"},
+		{en, 0, "0 posts"},
+		{uk, 1, "1 публікація"},
+		{uk, 2, "2 публікації"},
+		{uk, 5, "5 публікацій"},
+		{uk, 11, "11 публікацій"},
+		{uk, 21, "21 публікація"},
+		{uk, 22, "22 публікації"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.localizer.N("posts.count", tt.n); got != tt.want {
+			t.Errorf("N(%s, %d) = %q, want %q", tt.localizer.Locale, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestFormatDateTime(t *testing.T) {
+	kyiv, err := time.LoadLocation("Europe/Kyiv")
+	if err != nil {
+		t.Skipf("time zone data unavailable: %v", err)
+	}
+	at := time.Date(2024, time.March, 5, 22, 30, 0, 0, time.UTC)
+
+	if got := Default().Localizer("en", nil).FormatDateTime(at); got != "Mar 05, 2024 22:30" {
+		t.Errorf("FormatDateTime() = %q, want UTC in the English layout", got)
+	}
+	if got := Default().Localizer("uk", kyiv).FormatDateTime(at); got != "06.03.2024 00:30" {
+		t.Errorf("FormatDateTime() = %q, want Kyiv time in the Ukrainian layout", got)
+	}
+	if got := Default().Localizer("uk", kyiv).FormatDate(at); got != "06.03.2024" {
+		t.Errorf("FormatDate() = %q, want the date in Kyiv", got)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	var errs model.ValidationErrors
+	errs.Add("title", model.CodeRequired, "title is required")
+	errs.Add("title", model.CodeTooLong, "title must be less than 200 characters", "max", "200")
+	errs.Add("title", "custom", "kept as is")
+
+	got := Default().Localizer("uk", nil).ValidationErrors(errs)
+	want := []string{
+		"Поле «заголовок» обов'язкове",
+		"Поле «заголовок» має містити менше ніж 200 символів",
+		"kept as is",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("ValidationErrors() = %v, want %d errors", got, len(want))
+	}
+	for i := range want {
+		if got[i].Message != want[i] {
+			t.Errorf("ValidationErrors()[%d].Message = %q, want %q", i, got[i].Message, want[i])
+		}
+		if got[i].Code != errs[i].Code || got[i].Field != errs[i].Field {
+			t.Errorf("ValidationErrors()[%d] = %+v, want the field and code kept", i, got[i])
+		}
+	}
+	if errs[0].Message != "title is required" {
+		t.Errorf("ValidationErrors() modified its argument")
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditAction is the kind of change an audit entry records
+type AuditAction string
+
+const (
+	AuditCreate AuditAction = "create"
+	AuditUpdate AuditAction = "update"
+	AuditDelete AuditAction = "delete"
+	// AuditImport records a post written by an import, which may have created or replaced it
+	AuditImport AuditAction = "import"
+)
+
+// AuditActions lists every audit action
+var AuditActions = []AuditAction{AuditCreate, AuditUpdate, AuditDelete, AuditImport}
+
+// Valid reports whether a is a known audit action
+func (a AuditAction) Valid() bool {
+	return slices.Contains(AuditActions, a)
+}
+
+// AuditEntry records who changed a post, when, and how.
+// Entries are only ever appended, never changed or deleted.
+type AuditEntry struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Time   time.Time          `bson:"time" json:"time"`
+	Action AuditAction        `bson:"action" json:"action"`
+	// PostID is zero for imported posts that were matched by slug
+	PostID primitive.ObjectID `bson:"post_id,omitempty" json:"post_id,omitempty"`
+	// Actor identifies who made the change, e.g. a user ID, "anonymous" or "cli"
+	Actor     string `bson:"actor" json:"actor"`
+	IP        string `bson:"ip,omitempty" json:"ip,omitempty"`
+	RequestID string `bson:"request_id,omitempty" json:"request_id,omitempty"`
+	// Source names the operation behind changes to many posts at once, e.g. "bulk" or "import"
+	Source string `bson:"source,omitempty" json:"source,omitempty"`
+	// Details describes changes that have no snapshots, e.g. the tags added by a bulk action
+	Details string `bson:"details,omitempty" json:"details,omitempty"`
+	// Before and After are snapshots of the post around the change; Before is nil for created posts
+	// and After for deleted ones. Bulk actions record neither.
+	Before *Post `bson:"before,omitempty" json:"before,omitempty"`
+	After  *Post `bson:"after,omitempty" json:"after,omitempty"`
+	// TenantID is the newsroom of the changed post, set by the repository
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
+
+// AuditChange is a post field that differs between the snapshots of an audit entry
+type AuditChange struct {
+	Field  string
+	Before string
+	After  string
+}
+
+// Changes lists the post fields that differ between the Before and After snapshots.
+// Every set field counts as changed when one of the snapshots is missing.
+func (e *AuditEntry) Changes() []AuditChange {
+	if e.Before == nil && e.After == nil {
+		return nil
+	}
+
+	before, after := auditFields(e.Before), auditFields(e.After)
+	var changes []AuditChange
+	for i, field := range before {
+		if field.value != after[i].value {
+			changes = append(changes, AuditChange{Field: field.name, Before: field.value, After: after[i].value})
+		}
+	}
+	return changes
+}
+
+type auditField struct {
+	name  string
+	value string
+}
+
+// auditFields returns the user visible fields of post in a fixed order; all values are empty for nil
+func auditFields(post *Post) []auditField {
+	names := []string{"title", "content", "slug", "tags", "status", "language", "translations"}
+	fields := make([]auditField, len(names))
+	for i, name := range names {
+		fields[i].name = name
+	}
+	if post == nil {
+		return fields
+	}
+
+	var translations []string
+	for _, translation := range post.Translations {
+		translations = append(translations, translation.Language+": "+translation.Title)
+	}
+
+	fields[0].value = post.Title
+	fields[1].value = post.Content
+	fields[2].value = post.Slug
+	fields[3].value = strings.Join(post.Tags, ", ")
+	fields[4].value = string(post.EffectiveStatus())
+	fields[5].value = post.OriginalLanguage()
+	fields[6].value = strings.Join(translations, "\n")
+	return fields
+}
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAuditEntryChanges(t *testing.T) {
+	before := NewPost("Title", "Content")
+	after := *before
+	after.Title = "New title"
+	after.Tags = []string{"go", "mongo"}
+
+	tests := []struct {
+		name   string
+		entry  AuditEntry
+		fields []string
+	}{
+		{"update", AuditEntry{Before: before, After: &after}, []string{"title", "tags"}},
+		{"unchanged", AuditEntry{Before: before, After: before}, nil},
+		{"create", AuditEntry{After: before}, []string{"title", "content", "status", "language"}},
+		{"no snapshots", AuditEntry{Details: "add tags: go"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fields []string
+			for _, change := range tt.entry.Changes() {
+				fields = append(fields, change.Field)
+			}
+			if fmt.Sprint(fields) != fmt.Sprint(tt.fields) {
+				t.Errorf("Changes() fields = %v, want %v", fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OutboxStatus is the state of an outbox record
+type OutboxStatus string
+
+const (
+	// OutboxPending records wait to be relayed to the sinks that haven't handled them yet
+	OutboxPending OutboxStatus = "pending"
+	// OutboxProcessed records were handled by every sink
+	OutboxProcessed OutboxStatus = "processed"
+)
+
+// OutboxRecord is an event written in the same transaction as the change it describes,
+// and kept until it has been relayed to every sink
+type OutboxRecord struct {
+	// ID is the ID of the event
+	ID     primitive.ObjectID `bson:"_id" json:"id"`
+	Event  PostEvent          `bson:"event" json:"event"`
+	Status OutboxStatus       `bson:"status" json:"status"`
+	// HandledBy names the sinks that have handled the event, so retries skip them
+	HandledBy []string `bson:"handled_by" json:"handled_by"`
+	Attempts  int      `bson:"attempts" json:"attempts"`
+	// NextAttemptAt is when a pending record is due; relays push it back while they process the record
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	LastError     string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	CreatedAt     time.Time `bson:"created_at" json:"created_at"`
+	ProcessedAt   time.Time `bson:"processed_at,omitempty" json:"processed_at,omitempty"`
+}
+
+// NewOutboxRecord creates a pending record of event, due at once
+func NewOutboxRecord(event PostEvent, now time.Time) *OutboxRecord {
+	return &OutboxRecord{
+		ID:            event.ID,
+		Event:         event,
+		Status:        OutboxPending,
+		HandledBy:     []string{},
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+}
@@ -1,53 +1,149 @@
 package model
 
 import (
-	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// PostStatus is the publication state of a post
+type PostStatus string
+
+const (
+	StatusDraft     PostStatus = "draft"
+	StatusPublished PostStatus = "published"
+	StatusArchived  PostStatus = "archived"
+)
+
+// PostStatuses lists all valid post statuses
+var PostStatuses = []PostStatus{StatusDraft, StatusPublished, StatusArchived}
+
+// Valid reports whether s is a known post status
+func (s PostStatus) Valid() bool {
+	for _, status := range PostStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // Post represents a news article
 type Post struct {
 	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
 	Title     string             `bson:"title" json:"title"`
 	Content   string             `bson:"content" json:"content"`
+	Slug      string             `bson:"slug,omitempty" json:"slug,omitempty"`
+	Tags      []string           `bson:"tags,omitempty" json:"tags,omitempty"`
+	Status    PostStatus         `bson:"status,omitempty" json:"status,omitempty"`
 	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+
+	// Language is the language of the title and content; empty means DefaultLanguage
+	Language     string        `bson:"language,omitempty" json:"language,omitempty"`
+	Translations []Translation `bson:"translations,omitempty" json:"translations,omitempty"`
+	// TextLanguage is the text search language the post is indexed in, set by the repository
+	TextLanguage string `bson:"text_language,omitempty" json:"-"`
+	// DisplayLanguage is the language the title and content are in after Localized; it isn't stored
+	DisplayLanguage string `bson:"-" json:"display_language,omitempty"`
+	// AuthorID is the ID of the user who wrote the post; empty for posts written anonymously or by other tools
+	AuthorID string `bson:"author_id,omitempty" json:"author_id,omitempty"`
+	// TenantID is the newsroom the post belongs to, set by the repository; empty means the default tenant
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
+
+// EffectiveStatus returns the post status, treating posts stored before statuses existed as published
+func (p *Post) EffectiveStatus() PostStatus {
+	if p.Status == "" {
+		return StatusPublished
+	}
+	return p.Status
 }
 
-// Validate validates post fields.
-// It checks that title and content are not empty and within length limits.
-// Returns an error describing the validation failure, or nil if validation passes.
+// slugPattern matches lowercase URL-friendly identifiers such as "breaking-news-2024"
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// Validate validates post fields against DefaultLimits.
+// It checks that title and content are not empty and within length limits,
+// and that the optional slug, status and tags are well-formed.
+// Returns ValidationErrors listing every failing field, or nil if validation passes.
 func (p *Post) Validate() error {
-	if strings.TrimSpace(p.Title) == "" {
-		return errors.New("title is required")
+	return p.ValidateLimits(DefaultLimits).Err()
+}
+
+// ValidateLimits validates post fields against the given limits and returns every failure
+func (p *Post) ValidateLimits(limits Limits) ValidationErrors {
+	var errs ValidationErrors
+
+	validateLength(&errs, "title", p.Title, limits.TitleMin, limits.TitleMax)
+	validateLength(&errs, "content", p.Content, limits.ContentMin, limits.ContentMax)
+
+	if p.Slug != "" && (len(p.Slug) > 200 || !slugPattern.MatchString(p.Slug)) {
+		errs.Add("slug", CodeInvalid, "slug must contain only lowercase letters, digits and hyphens")
 	}
-	if len(p.Title) > 200 {
-		return errors.New("title must be less than 200 characters")
+	if p.Status != "" && !p.Status.Valid() {
+		errs.Add("status", CodeInvalid, "status must be one of draft, published or archived")
 	}
-	if strings.TrimSpace(p.Content) == "" {
-		return errors.New("content is required")
+	if limits.MaxTags > 0 && len(p.Tags) > limits.MaxTags {
+		errs.Add("tags", CodeTooMany, fmt.Sprintf("a post can have at most %d tags", limits.MaxTags), "max", strconv.Itoa(limits.MaxTags))
 	}
-	if len(p.Content) > 10000 {
-		return errors.New("content must be less than 10000 characters")
+	p.validateLanguages(&errs)
+
+	return errs
+}
+
+// validateLength checks that a required text field is within [min, max] characters; zero max is unbounded
+func validateLength(errs *ValidationErrors, field, value string, min, max int) {
+	length := utf8.RuneCountInString(strings.TrimSpace(value))
+	switch {
+	case length == 0:
+		errs.Add(field, CodeRequired, field+" is required")
+	case length < min:
+		errs.Add(field, CodeTooShort, fmt.Sprintf("%s must be at least %d characters", field, min), "min", strconv.Itoa(min))
+	case max > 0 && length > max:
+		errs.Add(field, CodeTooLong, fmt.Sprintf("%s must be less than %d characters", field, max), "max", strconv.Itoa(max))
 	}
-	return nil
 }
 
-// NewPost creates a new post with timestamps.
+// NewPost creates a new published post with timestamps.
 // It trims whitespace from title and content and sets CreatedAt and UpdatedAt to current time.
 func NewPost(title, content string) *Post {
 	now := time.Now()
 	return &Post{
 		Title:     strings.TrimSpace(title),
 		Content:   strings.TrimSpace(content),
+		Status:    StatusPublished,
 		CreatedAt: now,
 		UpdatedAt: now,
 	}
 }
 
+// NormalizeTags trims, lowercases and de-duplicates tags, dropping empty ones.
+// The order of first occurrence is preserved.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// ParseTags splits a comma separated list of tags and normalizes it
+func ParseTags(value string) []string {
+	return NormalizeTags(strings.Split(value, ","))
+}
+
 // Update updates the post content and timestamp.
 // It trims whitespace from title and content and updates UpdatedAt to current time.
 func (p *Post) Update(title, content string) {
@@ -10,6 +10,7 @@ func TestPostValidate(t *testing.T) {
 		name        string
 		title       string
 		content     string
+		slug        string
 		wantErr     bool
 		expectedErr string
 	}{
@@ -67,6 +68,21 @@ func TestPostValidate(t *testing.T) {
 			content: "Test Content",
 			wantErr: false,
 		},
+		{
+			name:        "invalid slug",
+			title:       "Test Title",
+			content:     "Test Content",
+			slug:        "Not A Slug",
+			wantErr:     true,
+			expectedErr: "slug must contain only lowercase letters, digits and hyphens",
+		},
+		{
+			name:    "valid slug",
+			title:   "Test Title",
+			content: "Test Content",
+			slug:    "test-title-2024",
+			wantErr: false,
+		},
 		{
 			name:    "content at max length",
 			title:   "Test Title",
@@ -78,6 +94,7 @@ func TestPostValidate(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			post := NewPost(tt.title, tt.content)
+			post.Slug = tt.slug
 			err := post.Validate()
 
 			if tt.wantErr {
@@ -152,3 +169,24 @@ func TestPostUpdate(t *testing.T) {
 		t.Errorf("Update() UpdatedAt should be after original UpdatedAt")
 	}
 }
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "empty", input: "", want: []string{}},
+		{name: "trims and lowercases", input: " Go , MongoDB", want: []string{"go", "mongodb"}},
+		{name: "drops duplicates and blanks", input: "go,,GO, htmx ,go", want: []string{"go", "htmx"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseTags(tt.input)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("ParseTags(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TokenScope limits what an API token may do on behalf of its user
+type TokenScope string
+
+const (
+	// ScopeRead allows reading posts through the API
+	ScopeRead TokenScope = "read"
+	// ScopeWrite allows creating, editing, publishing and deleting posts
+	ScopeWrite TokenScope = "write"
+	// ScopeAdmin allows bulk actions, imports, the audit log and managing users, webhooks and backups
+	ScopeAdmin TokenScope = "admin"
+)
+
+// TokenScopes lists every scope
+var TokenScopes = []TokenScope{ScopeRead, ScopeWrite, ScopeAdmin}
+
+// scopePermissions holds the permissions each scope lets a token use; reading needs no permission
+var scopePermissions = map[TokenScope][]Permission{
+	ScopeRead:  {},
+	ScopeWrite: {PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish},
+	ScopeAdmin: {PermModerate, PermManage},
+}
+
+// Valid reports whether s is a known scope
+func (s TokenScope) Valid() bool {
+	_, ok := scopePermissions[s]
+	return ok
+}
+
+// Allows reports whether the scope lets a token use permission p. The token's user must have p as well.
+func (s TokenScope) Allows(p Permission) bool {
+	return slices.Contains(scopePermissions[s], p)
+}
+
+// Scopes returns the scopes that let tokens of users with role r do something: read,
+// and every scope allowing a permission of the role
+func (r Role) Scopes() []TokenScope {
+	var scopes []TokenScope
+	for _, scope := range TokenScopes {
+		if scope == ScopeRead || slices.ContainsFunc(scopePermissions[scope], r.Can) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// TokenNameMaxLength is the longest name of an API token, in characters
+const TokenNameMaxLength = 100
+
+// APIToken lets scripts and CI jobs call the API as a user, with the permissions of their scopes.
+// Like sessions, tokens are stored under their hash; the token itself is only shown when it is created.
+type APIToken struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name   string             `bson:"name" json:"name"`
+	// Prefix is the start of the token, shown to tell tokens apart
+	Prefix string `bson:"prefix" json:"prefix"`
+	// Hash is the SHA-256 hash of the token
+	Hash      string       `bson:"hash" json:"-"`
+	Scopes    []TokenScope `bson:"scopes" json:"scopes"`
+	CreatedAt time.Time    `bson:"created_at" json:"created_at"`
+	// ExpiresAt is when the token stops working; zero never expires
+	ExpiresAt time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	// LastUsedAt is when the token was last accepted, to the minute; zero if it never was
+	LastUsedAt time.Time `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+	// TenantID is the newsroom the token calls, set by the repository
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
+
+// HasScope reports whether the token was given scope s
+func (t *APIToken) HasScope(s TokenScope) bool {
+	return slices.Contains(t.Scopes, s)
+}
+
+// Expired reports whether the token no longer works at now
+func (t *APIToken) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !t.ExpiresAt.After(now)
+}
+
+// ValidateToken checks the name and scopes of a new API token of a user with role and returns every failure
+func ValidateToken(name string, scopes []TokenScope, role Role) ValidationErrors {
+	var errs ValidationErrors
+	switch {
+	case strings.TrimSpace(name) == "":
+		errs.Add("name", CodeRequired, "name is required")
+	case utf8.RuneCountInString(name) > TokenNameMaxLength:
+		errs.Add("name", CodeTooLong, "name must be less than 100 characters", "max", "100")
+	}
+	if len(scopes) == 0 {
+		errs.Add("scopes", CodeRequired, "scopes is required")
+	}
+	allowed := role.Scopes()
+	for _, scope := range scopes {
+		if !slices.Contains(allowed, scope) {
+			names := make([]string, len(allowed))
+			for i, s := range allowed {
+				names[i] = string(s)
+			}
+			list := strings.Join(names, ", ")
+			errs.Add("scopes", CodeInvalid, "scopes must be one of "+list, "scopes", list)
+			break
+		}
+	}
+	return errs
+}
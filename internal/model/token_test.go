@@ -0,0 +1,57 @@
+package model
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRoleScopes(t *testing.T) {
+	tests := []struct {
+		role Role
+		want []TokenScope
+	}{
+		{RoleReader, []TokenScope{ScopeRead}},
+		{RoleAuthor, []TokenScope{ScopeRead, ScopeWrite}},
+		{RoleEditor, []TokenScope{ScopeRead, ScopeWrite, ScopeAdmin}},
+		{RoleAdmin, []TokenScope{ScopeRead, ScopeWrite, ScopeAdmin}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			if got := tt.role.Scopes(); !slices.Equal(got, tt.want) {
+				t.Errorf("%s.Scopes() = %v, want %v", tt.role, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		tokenName  string
+		scopes     []TokenScope
+		role       Role
+		wantFields []string
+	}{
+		{"valid", "CI", []TokenScope{ScopeRead, ScopeWrite}, RoleAuthor, nil},
+		{"no name", " ", []TokenScope{ScopeRead}, RoleAuthor, []string{"name"}},
+		{"long name", strings.Repeat("a", TokenNameMaxLength+1), []TokenScope{ScopeRead}, RoleAuthor, []string{"name"}},
+		{"no scopes", "CI", nil, RoleAuthor, []string{"scopes"}},
+		{"unknown scope", "CI", []TokenScope{"delete"}, RoleAdmin, []string{"scopes"}},
+		{"scope beyond role", "CI", []TokenScope{ScopeAdmin}, RoleAuthor, []string{"scopes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateToken(tt.tokenName, tt.scopes, tt.role)
+			var fields []string
+			for _, fieldErr := range errs {
+				fields = append(fields, fieldErr.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Errorf("ValidateToken() fields = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
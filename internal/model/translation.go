@@ -0,0 +1,146 @@
+package model
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultLanguage is the language of posts that don't specify one, including posts stored before translations existed
+const DefaultLanguage = "en"
+
+// languagePattern matches lowercase language codes with optional subtags, e.g. "uk" or "pt-br"
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(?:-[a-z0-9]{2,8})*$`)
+
+// ValidLanguage reports whether language is a well-formed language code
+func ValidLanguage(language string) bool {
+	return languagePattern.MatchString(language)
+}
+
+// NormalizeLanguage lowercases and trims a language code, e.g. " pt-BR" becomes "pt-br"
+func NormalizeLanguage(language string) string {
+	return strings.ToLower(strings.TrimSpace(language))
+}
+
+// Translation is the title and content of a post in another language.
+// Translations are stored with the post, so they share its ID, tags and status.
+type Translation struct {
+	Language string `bson:"language" json:"language"`
+	Title    string `bson:"title" json:"title"`
+	Content  string `bson:"content" json:"content"`
+	// TextLanguage is the text search language the translation is indexed in, set by the repository
+	TextLanguage string    `bson:"text_language,omitempty" json:"-"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// OriginalLanguage returns the language of the post's own title and content
+func (p *Post) OriginalLanguage() string {
+	if p.Language == "" {
+		return DefaultLanguage
+	}
+	return p.Language
+}
+
+// Languages returns the languages the post is available in, the original first
+func (p *Post) Languages() []string {
+	languages := make([]string, 0, len(p.Translations)+1)
+	languages = append(languages, p.OriginalLanguage())
+	for _, translation := range p.Translations {
+		languages = append(languages, translation.Language)
+	}
+	return languages
+}
+
+// FindTranslation returns the translation into language, or nil if there is none
+func (p *Post) FindTranslation(language string) *Translation {
+	for i := range p.Translations {
+		if p.Translations[i].Language == language {
+			return &p.Translations[i]
+		}
+	}
+	return nil
+}
+
+// SetTranslation adds the translation, replacing any existing one in the same language.
+// It trims whitespace from title and content and updates the timestamps.
+func (p *Post) SetTranslation(language, title, content string) {
+	now := time.Now()
+	translation := Translation{
+		Language:  language,
+		Title:     strings.TrimSpace(title),
+		Content:   strings.TrimSpace(content),
+		UpdatedAt: now,
+	}
+
+	if existing := p.FindTranslation(language); existing != nil {
+		*existing = translation
+	} else {
+		p.Translations = append(p.Translations, translation)
+	}
+	p.UpdatedAt = now
+}
+
+// RemoveTranslation removes the translation into language and reports whether there was one
+func (p *Post) RemoveTranslation(language string) bool {
+	for i, translation := range p.Translations {
+		if translation.Language == language {
+			p.Translations = append(p.Translations[:i:i], p.Translations[i+1:]...)
+			p.UpdatedAt = time.Now()
+			return true
+		}
+	}
+	return false
+}
+
+// Localized returns a copy of the post with the title and content in the first of the
+// preferred languages it is available in, falling back to the original.
+// A language with a region, e.g. "pt-br", also matches a translation into the base language, "pt".
+func (p *Post) Localized(preferred ...string) *Post {
+	localized := *p
+	localized.DisplayLanguage = p.OriginalLanguage()
+
+	for _, language := range preferred {
+		language = NormalizeLanguage(language)
+		for _, candidate := range []string{language, baseLanguage(language)} {
+			if candidate == "" {
+				continue
+			}
+			if candidate == p.OriginalLanguage() {
+				return &localized
+			}
+			if translation := p.FindTranslation(candidate); translation != nil {
+				localized.Title = translation.Title
+				localized.Content = translation.Content
+				localized.DisplayLanguage = translation.Language
+				return &localized
+			}
+		}
+	}
+	return &localized
+}
+
+// baseLanguage returns the language without subtags, e.g. "pt" for "pt-br", or "" if there are none
+func baseLanguage(language string) string {
+	if i := strings.IndexByte(language, '-'); i > 0 {
+		return language[:i]
+	}
+	return ""
+}
+
+// validateLanguages checks the language codes of the post and its translations
+func (p *Post) validateLanguages(errs *ValidationErrors) {
+	if p.Language != "" && !ValidLanguage(p.Language) {
+		errs.Add("language", CodeInvalid, "language must be a language code such as en or uk")
+	}
+
+	seen := map[string]bool{p.OriginalLanguage(): true}
+	for _, translation := range p.Translations {
+		switch {
+		case !ValidLanguage(translation.Language):
+			errs.Add("translations", CodeInvalid, "translations must have a language code such as en or uk")
+		case seen[translation.Language]:
+			errs.Add("translations", CodeDuplicate, "a post can have one translation per language, other than its own", "language", translation.Language)
+		}
+		seen[translation.Language] = true
+	}
+}
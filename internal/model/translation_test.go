@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLocalized(t *testing.T) {
+	post := NewPost("Elections announced", "Voting starts in spring")
+	post.SetTranslation("uk", "  Оголошено вибори ", "Голосування почнеться навесні")
+	post.SetTranslation("pt", "Eleições anunciadas", "A votação começa na primavera")
+
+	tests := []struct {
+		name         string
+		preferred    []string
+		wantTitle    string
+		wantLanguage string
+	}{
+		{"no preference", nil, "Elections announced", "en"},
+		{"original", []string{"en"}, "Elections announced", "en"},
+		{"translation", []string{"uk"}, "Оголошено вибори", "uk"},
+		{"case and spaces", []string{" UK "}, "Оголошено вибори", "uk"},
+		{"base language", []string{"pt-br"}, "Eleições anunciadas", "pt"},
+		{"first available", []string{"de", "uk"}, "Оголошено вибори", "uk"},
+		{"missing falls back to original", []string{"de"}, "Elections announced", "en"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			localized := post.Localized(tt.preferred...)
+			if localized.Title != tt.wantTitle || localized.DisplayLanguage != tt.wantLanguage {
+				t.Errorf("Localized(%q) = %q in %q, want %q in %q", tt.preferred, localized.Title, localized.DisplayLanguage, tt.wantTitle, tt.wantLanguage)
+			}
+		})
+	}
+
+	if post.Title != "Elections announced" || post.DisplayLanguage != "" {
+		t.Errorf("Localized() modified the post")
+	}
+}
+
+func TestSetTranslation(t *testing.T) {
+	post := NewPost("Title", "Content")
+	post.SetTranslation("uk", "Заголовок", "Зміст")
+	post.SetTranslation("de", "Titel", "Inhalt")
+	post.SetTranslation("uk", "Новий заголовок", "Новий зміст")
+
+	if got := fmt.Sprint(post.Languages()); got != "[en uk de]" {
+		t.Errorf("Languages() = %s, want [en uk de]", got)
+	}
+	if translation := post.FindTranslation("uk"); translation == nil || translation.Title != "Новий заголовок" {
+		t.Errorf("FindTranslation(uk) = %+v, want the replaced translation", translation)
+	}
+
+	if !post.RemoveTranslation("uk") {
+		t.Errorf("RemoveTranslation(uk) = false, want true")
+	}
+	if post.RemoveTranslation("uk") {
+		t.Errorf("RemoveTranslation(uk) of a removed translation = true, want false")
+	}
+	if got := fmt.Sprint(post.Languages()); got != "[en de]" {
+		t.Errorf("Languages() after removal = %s, want [en de]", got)
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  string
+		languages []string
+		wantCodes []string
+	}{
+		{"default language", "", []string{"uk"}, nil},
+		{"language with region", "pt-br", []string{"en"}, nil},
+		{"invalid language", "English", nil, []string{"language/invalid"}},
+		{"invalid translation language", "", []string{"u k"}, []string{"translations/invalid"}},
+		{"translation into the original language", "uk", []string{"uk"}, []string{"translations/duplicate"}},
+		{"duplicate translations", "", []string{"de", "de"}, []string{"translations/duplicate"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := NewPost("Title", "Content")
+			post.Language = tt.language
+			for _, language := range tt.languages {
+				post.Translations = append(post.Translations, Translation{Language: language, Title: "Title", Content: "Content"})
+			}
+
+			var codes []string
+			for _, fieldErr := range post.ValidateLimits(DefaultLimits) {
+				codes = append(codes, fieldErr.Field+"/"+fieldErr.Code)
+			}
+			if fmt.Sprint(codes) != fmt.Sprint(tt.wantCodes) {
+				t.Errorf("ValidateLimits() = %v, want %v", codes, tt.wantCodes)
+			}
+		})
+	}
+}
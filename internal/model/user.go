@@ -0,0 +1,147 @@
+package model
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Role is a set of permissions granted to users
+type Role string
+
+const (
+	// RoleReader may only read posts
+	RoleReader Role = "reader"
+	// RoleAuthor writes posts and edits their own, which are drafts until an editor publishes them
+	RoleAuthor Role = "author"
+	// RoleEditor edits, publishes and deletes every post and moderates them in bulk
+	RoleEditor Role = "editor"
+	// RoleAdmin may do everything, including managing users, webhooks and backups
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists every role, from the fewest permissions to the most
+var Roles = []Role{RoleReader, RoleAuthor, RoleEditor, RoleAdmin}
+
+// Permission allows an action
+type Permission string
+
+const (
+	// PermCreate allows writing new posts
+	PermCreate Permission = "create"
+	// PermEditOwn allows editing posts the user wrote, and their translations
+	PermEditOwn Permission = "edit_own"
+	// PermEditAny allows editing every post, and their translations
+	PermEditAny Permission = "edit_any"
+	// PermDelete allows deleting posts
+	PermDelete Permission = "delete"
+	// PermPublish allows changing the status of posts, e.g. publishing drafts
+	PermPublish Permission = "publish"
+	// PermModerate allows bulk actions, imports and reading the audit log
+	PermModerate Permission = "moderate"
+	// PermManage allows managing users, webhooks and backups
+	PermManage Permission = "manage"
+)
+
+// Permissions lists every permission
+var Permissions = []Permission{PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate, PermManage}
+
+// rolePermissions holds the permissions granted by each role
+var rolePermissions = map[Role][]Permission{
+	RoleReader: {},
+	RoleAuthor: {PermCreate, PermEditOwn},
+	RoleEditor: {PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate},
+	RoleAdmin:  {PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate, PermManage},
+}
+
+// Valid reports whether r is a known role
+func (r Role) Valid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// Can reports whether the role grants permission p. Unknown roles grant nothing.
+func (r Role) Can(p Permission) bool {
+	return slices.Contains(rolePermissions[r], p)
+}
+
+// usernamePattern matches lowercase user names such as "jane.doe"
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,31}$`)
+
+// Password length limits in bytes; bcrypt ignores everything after 72 bytes
+const (
+	PasswordMinLength = 8
+	PasswordMaxLength = 72
+)
+
+// User is a person signing in to the site
+type User struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Username string             `bson:"username" json:"username"`
+	// PasswordHash is the bcrypt hash of the password; it's empty for users who only sign in with single sign-on
+	PasswordHash string    `bson:"password_hash" json:"-"`
+	Role         Role      `bson:"role" json:"role"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time `bson:"updated_at" json:"updated_at"`
+	// OIDCIssuer and OIDCSubject identify the user at the OpenID Connect provider they were created by
+	OIDCIssuer  string `bson:"oidc_issuer,omitempty" json:"-"`
+	OIDCSubject string `bson:"oidc_subject,omitempty" json:"-"`
+	// TenantID is the newsroom the user signs in to, set by the repository
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
+
+// SSO reports whether the user was created by single sign-on
+func (u *User) SSO() bool {
+	return u.OIDCSubject != ""
+}
+
+// NormalizeUsername trims and lowercases a user name, so that names are compared case-insensitively
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// ValidateUser checks the user name, password and role of a new user and returns every failure
+func ValidateUser(username, password string, role Role) ValidationErrors {
+	errs := ValidateUsername(username)
+	errs = append(errs, ValidatePassword(password)...)
+	if !role.Valid() {
+		errs.Add("role", CodeInvalid, "role must be one of reader, author, editor or admin")
+	}
+	return errs
+}
+
+// ValidateUsername checks a user name
+func ValidateUsername(username string) ValidationErrors {
+	var errs ValidationErrors
+	if !usernamePattern.MatchString(username) {
+		errs.Add("username", CodeInvalid, "username must be 3 to 32 lowercase letters, digits, dots, hyphens or underscores")
+	}
+	return errs
+}
+
+// ValidatePassword checks that a password is long enough for bcrypt to protect it and short enough for bcrypt to use all of it
+func ValidatePassword(password string) ValidationErrors {
+	var errs ValidationErrors
+	switch {
+	case len(password) < PasswordMinLength:
+		errs.Add("password", CodeTooShort, "password must be at least 8 characters", "min", "8")
+	case len(password) > PasswordMaxLength:
+		errs.Add("password", CodeTooLong, "password must be at most 72 bytes", "max", "72")
+	}
+	return errs
+}
+
+// Session is a signed-in browser. The token identifying it is only given to the browser; the session is stored
+// under the token's hash, so that tokens can't be taken from the database.
+type Session struct {
+	// ID is the SHA-256 hash of the session token
+	ID        string             `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	CreatedAt time.Time          `bson:"created_at"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	// TenantID is the newsroom the session is signed in to, set by the repository
+	TenantID string `bson:"tenant_id,omitempty"`
+}
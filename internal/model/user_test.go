@@ -0,0 +1,67 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRoleCan(t *testing.T) {
+	tests := []struct {
+		role Role
+		want []Permission
+	}{
+		{RoleReader, nil},
+		{RoleAuthor, []Permission{PermCreate, PermEditOwn}},
+		{RoleEditor, []Permission{PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate}},
+		{RoleAdmin, []Permission{PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate, PermManage}},
+		{Role("owner"), nil},
+	}
+
+	all := []Permission{PermCreate, PermEditOwn, PermEditAny, PermDelete, PermPublish, PermModerate, PermManage}
+	for _, tt := range tests {
+		t.Run(string(tt.role), func(t *testing.T) {
+			for _, p := range all {
+				want := false
+				for _, granted := range tt.want {
+					want = want || granted == p
+				}
+				if got := tt.role.Can(p); got != want {
+					t.Errorf("%s.Can(%s) = %v, want %v", tt.role, p, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		name       string
+		username   string
+		password   string
+		role       Role
+		wantFields []string
+	}{
+		{"valid", "jane.doe", "correct horse", RoleAuthor, nil},
+		{"short username", "jd", "correct horse", RoleAuthor, []string{"username"}},
+		{"uppercase username", "Jane", "correct horse", RoleAuthor, []string{"username"}},
+		{"username with spaces", "jane doe", "correct horse", RoleAuthor, []string{"username"}},
+		{"short password", "jane", "secret", RoleAuthor, []string{"password"}},
+		{"long password", "jane", strings.Repeat("a", 73), RoleAuthor, []string{"password"}},
+		{"unknown role", "jane", "correct horse", Role("owner"), []string{"role"}},
+		{"everything invalid", "", "", "", []string{"username", "password", "role"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := ValidateUser(tt.username, tt.password, tt.role)
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("ValidateUser() = %v, want failures of %v", errs, tt.wantFields)
+			}
+			for i, field := range tt.wantFields {
+				if errs[i].Field != field {
+					t.Errorf("failure %d is of %s, want %s", i, errs[i].Field, field)
+				}
+			}
+		})
+	}
+}
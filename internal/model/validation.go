@@ -0,0 +1,87 @@
+package model
+
+import (
+	"strings"
+)
+
+// Validation error codes identify the kind of failure independently of the message,
+// so clients can react to them and messages can be translated
+const (
+	CodeRequired   = "required"
+	CodeTooShort   = "too_short"
+	CodeTooLong    = "too_long"
+	CodeInvalid    = "invalid"
+	CodeTooMany    = "too_many"
+	CodeBannedWord = "banned_word"
+	CodeMissingTag = "missing_tag"
+	CodeDuplicate  = "duplicate"
+)
+
+// FieldError describes why a single field is invalid.
+// Params hold the values used in the message, e.g. "max", so it can be translated.
+type FieldError struct {
+	Field   string            `json:"field"`
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Params  map[string]string `json:"params,omitempty"`
+}
+
+// ValidationErrors lists every failing field of a post.
+// A single failure reads like its message, so it can be shown as a plain error.
+type ValidationErrors []FieldError
+
+// Error joins the messages of all failures
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// For returns the message of the first failure of field, or an empty string if the field is valid
+func (e ValidationErrors) For(field string) string {
+	for _, fieldErr := range e {
+		if fieldErr.Field == field {
+			return fieldErr.Message
+		}
+	}
+	return ""
+}
+
+// Add records a failure of field. Params are name/value pairs of the values used in the message.
+func (e *ValidationErrors) Add(field, code, message string, params ...string) {
+	fieldErr := FieldError{Field: field, Code: code, Message: message}
+	if len(params) > 0 {
+		fieldErr.Params = make(map[string]string, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			fieldErr.Params[params[i]] = params[i+1]
+		}
+	}
+	*e = append(*e, fieldErr)
+}
+
+// Err returns the errors as an error, or nil when there are none
+func (e ValidationErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Limits bounds the length of post fields, in characters.
+// A zero minimum only requires a non-blank value.
+type Limits struct {
+	TitleMin   int
+	TitleMax   int
+	ContentMin int
+	ContentMax int
+	MaxTags    int
+}
+
+// DefaultLimits are the limits applied by Validate
+var DefaultLimits = Limits{
+	TitleMax:   200,
+	ContentMax: 10000,
+	MaxTags:    20,
+}
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventType names a change of posts that webhooks can subscribe to
+type EventType string
+
+const (
+	EventPostCreated EventType = "post.created"
+	EventPostUpdated EventType = "post.updated"
+	EventPostDeleted EventType = "post.deleted"
+	// EventPostPublished is sent in addition to post.created or post.updated when a post becomes published
+	EventPostPublished EventType = "post.published"
+)
+
+// EventTypes lists every event type
+var EventTypes = []EventType{EventPostCreated, EventPostUpdated, EventPostDeleted, EventPostPublished}
+
+// Valid reports whether t is a known event type
+func (t EventType) Valid() bool {
+	return slices.Contains(EventTypes, t)
+}
+
+// PostEvent describes a change of a single post
+type PostEvent struct {
+	// ID identifies the event; consumers use it as an idempotency key to drop events they already handled
+	ID     primitive.ObjectID `bson:"id" json:"id"`
+	Type   EventType          `bson:"type" json:"type"`
+	PostID primitive.ObjectID `bson:"post_id" json:"post_id"`
+	// Post is the post after the change, or before it for deletions.
+	// It is nil for changes made by bulk actions, which only know the post ID.
+	Post *Post     `bson:"post,omitempty" json:"post,omitempty"`
+	Time time.Time `bson:"time" json:"time"`
+	// TenantID is the newsroom of the changed post; events without one are sent to no webhook
+	TenantID string `bson:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+}
+
+// NewPostEvent creates an event of type t with a new ID
+func NewPostEvent(t EventType, postID primitive.ObjectID, post *Post, now time.Time) PostEvent {
+	return PostEvent{ID: primitive.NewObjectID(), Type: t, PostID: postID, Post: post, Time: now}
+}
+
+// Webhook is a subscription of an HTTP endpoint to post events
+type Webhook struct {
+	ID  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	URL string             `bson:"url" json:"url"`
+	// Secret signs payloads with HMAC-SHA256, so receivers can check they come from this application
+	Secret    string      `bson:"secret" json:"-"`
+	Events    []EventType `bson:"events" json:"events"`
+	Active    bool        `bson:"active" json:"active"`
+	CreatedAt time.Time   `bson:"created_at" json:"created_at"`
+	// TenantID is the newsroom whose events the webhook receives, set by the repository
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
+
+// Subscribed reports whether the webhook receives events of type t
+func (w *Webhook) Subscribed(t EventType) bool {
+	return w.Active && slices.Contains(w.Events, t)
+}
+
+// DeliveryStatus is the state of a webhook delivery
+type DeliveryStatus string
+
+const (
+	// DeliveryPending deliveries are waiting for their first or next attempt
+	DeliveryPending DeliveryStatus = "pending"
+	// DeliveryDelivered deliveries were accepted by the receiver with a 2xx response
+	DeliveryDelivered DeliveryStatus = "delivered"
+	// DeliveryDead deliveries failed every attempt and wait in the dead-letter list to be replayed
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// DeliveryStatuses lists every delivery status
+var DeliveryStatuses = []DeliveryStatus{DeliveryPending, DeliveryDelivered, DeliveryDead}
+
+// Valid reports whether s is a known delivery status
+func (s DeliveryStatus) Valid() bool {
+	return slices.Contains(DeliveryStatuses, s)
+}
+
+// Delivery is one event sent, or to be sent, to one webhook.
+// Its ID doubles as the idempotency key receivers can use to drop duplicates.
+type Delivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookID primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	// EventID is the ID of the delivered event; a webhook gets a single delivery per event
+	EventID primitive.ObjectID `bson:"event_id,omitempty" json:"event_id,omitempty"`
+	URL     string             `bson:"url" json:"url"`
+	Event   EventType          `bson:"event" json:"event"`
+	// Payload is the JSON body sent to the webhook
+	Payload  string         `bson:"payload" json:"payload"`
+	Status   DeliveryStatus `bson:"status" json:"status"`
+	Attempts int            `bson:"attempts" json:"attempts"`
+	// NextAttemptAt is when a pending delivery is due; workers push it back while they attempt the delivery
+	NextAttemptAt time.Time `bson:"next_attempt_at" json:"next_attempt_at"`
+	// LastError and LastStatusCode describe the latest failed attempt
+	LastError      string    `bson:"last_error,omitempty" json:"last_error,omitempty"`
+	LastStatusCode int       `bson:"last_status_code,omitempty" json:"last_status_code,omitempty"`
+	CreatedAt      time.Time `bson:"created_at" json:"created_at"`
+	DeliveredAt    time.Time `bson:"delivered_at,omitempty" json:"delivered_at,omitempty"`
+	// TenantID is the newsroom of the webhook, set by the repository
+	TenantID string `bson:"tenant_id,omitempty" json:"-"`
+}
@@ -0,0 +1,248 @@
+// Package oidc signs users in with an OpenID Connect provider. It discovers the provider's endpoints,
+// runs the authorization code flow with PKCE and verifies ID tokens with the provider's JSON Web Key Set.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidToken is returned when an ID token is malformed, badly signed, expired or meant for another client
+var ErrInvalidToken = errors.New("invalid ID token")
+
+const (
+	// maxResponseBytes limits the size of discovery, key set and token responses
+	maxResponseBytes = 1 << 20
+	// defaultTimeout bounds requests to the provider when no HTTP client is configured
+	defaultTimeout = 10 * time.Second
+)
+
+// Config identifies the provider and this application as its client
+type Config struct {
+	// Issuer is the provider's issuer URL; its discovery document is at Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Scopes are requested in addition to "openid", e.g. "groups"; nil requests "profile" and "email"
+	Scopes []string
+	// HTTPClient sends requests to the provider; nil uses a client with a 10 second timeout
+	HTTPClient *http.Client
+}
+
+// Metadata holds the parts of the provider's discovery document the flow needs
+type Metadata struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	CodeChallengeMethods  []string `json:"code_challenge_methods_supported"`
+}
+
+// Provider runs sign-ins with an OpenID Connect provider. Its metadata is discovered on first use and kept,
+// and its signing keys are fetched again when a token is signed with an unknown key, e.g. after a key rotation.
+type Provider struct {
+	config Config
+	client *http.Client
+	now    func() time.Time
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+// NewProvider creates a provider with the configuration. It doesn't contact the provider until the first sign-in.
+func NewProvider(config Config) *Provider {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+	if config.Scopes == nil {
+		config.Scopes = []string{"profile", "email"}
+	}
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	return &Provider{
+		config: config,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+// AuthRequest is a sign-in in progress. It must be kept by the browser's session between redirecting to the provider
+// and the provider's callback, e.g. in a cookie, and is used once.
+type AuthRequest struct {
+	// State is sent back by the provider and must match, so that callbacks can't be forged
+	State string `json:"state"`
+	// Nonce is echoed in the ID token, so that tokens can't be replayed into another sign-in
+	Nonce string `json:"nonce"`
+	// Verifier is the PKCE code verifier, so that a stolen authorization code is useless
+	Verifier string `json:"verifier"`
+	// RedirectURL is the callback the provider sends the browser back to
+	RedirectURL string `json:"redirect_url"`
+}
+
+// NewAuthRequest starts a sign-in returning to redirectURL, with random state, nonce and code verifier
+func NewAuthRequest(redirectURL string) (AuthRequest, error) {
+	values := make([]string, 3)
+	for i := range values {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return AuthRequest{}, fmt.Errorf("failed to generate sign-in secrets: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return AuthRequest{State: values[0], Nonce: values[1], Verifier: values[2], RedirectURL: redirectURL}, nil
+}
+
+// CodeChallenge returns the S256 PKCE challenge of the request's verifier
+func (r AuthRequest) CodeChallenge() string {
+	sum := sha256.Sum256([]byte(r.Verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider's authorization URL to send the browser to for req
+func (p *Provider) AuthCodeURL(ctx context.Context, req AuthRequest) (string, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	endpoint, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.config.ClientID)
+	query.Set("redirect_uri", req.RedirectURL)
+	query.Set("scope", strings.Join(p.scopes(), " "))
+	query.Set("state", req.State)
+	query.Set("nonce", req.Nonce)
+	query.Set("code_challenge", req.CodeChallenge())
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+	return endpoint.String(), nil
+}
+
+// scopes returns the requested scopes, starting with "openid"
+func (p *Provider) scopes() []string {
+	scopes := []string{"openid"}
+	for _, scope := range p.config.Scopes {
+		if scope != "" && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+// tokenResponse is the provider's answer to exchanging an authorization code
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange trades the authorization code of the provider's callback for an ID token, and verifies it for req
+func (p *Provider) Exchange(ctx context.Context, code string, req AuthRequest) (*IDToken, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {req.RedirectURL},
+		"code_verifier": {req.Verifier},
+	}
+	if p.config.ClientSecret == "" {
+		// Public clients identify themselves without a secret
+		form.Set("client_id", p.config.ClientID)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		// RFC 6749 section 2.3.1 form-encodes the credentials before basic authentication
+		request.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token tokenResponse
+	status, err := p.do(request, &token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	if status != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("provider rejected authorization code with status %d: %s", status, strings.TrimSpace(token.Error+" "+token.ErrorDescription))
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("%w: the token response has no ID token", ErrInvalidToken)
+	}
+	return p.Verify(ctx, token.IDToken, req.Nonce)
+}
+
+// Metadata returns the provider's discovery document, fetching it on first use.
+// The document must name the configured issuer, so that a compromised discovery endpoint can't redirect sign-ins.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, p.config.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+	var metadata Metadata
+	status, err := p.do(request, &metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover provider: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to discover provider: status %d", status)
+	}
+
+	switch {
+	case strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer:
+		return nil, fmt.Errorf("provider issuer %q doesn't match the configured issuer %q", metadata.Issuer, p.config.Issuer)
+	case metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "":
+		return nil, errors.New("provider discovery document lacks the authorization, token or key set endpoint")
+	case len(metadata.CodeChallengeMethods) > 0 && !slices.Contains(metadata.CodeChallengeMethods, "S256"):
+		return nil, errors.New("provider doesn't support S256 PKCE code challenges")
+	}
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// do sends request and decodes the JSON response into v, returning the status code
+func (p *Provider) do(request *http.Request, v any) (int, error) {
+	response, err := p.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBytes))
+	if err != nil {
+		return response.StatusCode, err
+	}
+	if err := json.Unmarshal(body, v); err != nil && response.StatusCode == http.StatusOK {
+		return response.StatusCode, fmt.Errorf("invalid JSON response: %w", err)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,225 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc/oidctest"
+)
+
+const redirectURL = "http://news.example/login/oidc/callback"
+
+// authorize follows the provider's authorization URL for req and returns the callback's query
+func authorize(t *testing.T, p *Provider, req AuthRequest) url.Values {
+	t.Helper()
+	authURL, err := p.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("authorize error = %v", err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), redirectURL) {
+		t.Fatalf("authorize redirected to %q, want the callback", resp.Header.Get("Location"))
+	}
+	return location.Query()
+}
+
+func TestProviderSignIn(t *testing.T) {
+	idp := oidctest.NewProvider(t, "news", "s3cret&=")
+	idp.SignInAs(map[string]any{"sub": "u-1", "preferred_username": "jane", "groups": []string{"staff", "editors"}})
+	p := NewProvider(Config{Issuer: idp.Issuer() + "/", ClientID: "news", ClientSecret: "s3cret&=", Scopes: []string{"profile", "openid", "groups"}})
+
+	req, err := NewAuthRequest(redirectURL)
+	if err != nil {
+		t.Fatalf("NewAuthRequest() error = %v", err)
+	}
+	authURL, err := p.AuthCodeURL(context.Background(), req)
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+	query, _ := url.Parse(authURL)
+	if got := query.Query().Get("scope"); got != "openid profile groups" {
+		t.Errorf("scope = %q, want openid first and once", got)
+	}
+	if got := query.Query().Get("code_challenge"); got == "" || got == req.Verifier || query.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("code_challenge = %q, want the S256 challenge of the verifier", got)
+	}
+
+	callback := authorize(t, p, req)
+	if callback.Get("state") != req.State {
+		t.Errorf("state = %q, want %q", callback.Get("state"), req.State)
+	}
+
+	stolen := req
+	stolen.Verifier = "another-verifier-of-enough-length-for-pkce-0123456789"
+	if _, err := p.Exchange(context.Background(), callback.Get("code"), stolen); err == nil {
+		t.Error("Exchange() with another verifier succeeded, want the code refused")
+	}
+
+	callback = authorize(t, p, req)
+	token, err := p.Exchange(context.Background(), callback.Get("code"), req)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if token.Subject != "u-1" || token.Issuer != idp.Issuer() || token.String("preferred_username") != "jane" {
+		t.Errorf("token = %+v, want jane's claims", token)
+	}
+	if groups := token.Strings("groups"); len(groups) != 2 || groups[1] != "editors" {
+		t.Errorf("groups = %v, want staff and editors", groups)
+	}
+	if _, err := p.Exchange(context.Background(), callback.Get("code"), req); err == nil {
+		t.Error("Exchange() of a used code succeeded, want it refused")
+	}
+}
+
+func TestProviderVerify(t *testing.T) {
+	idp := oidctest.NewProvider(t, "news", "secret")
+	p := NewProvider(Config{Issuer: idp.Issuer(), ClientID: "news", ClientSecret: "secret"})
+	valid := func(change func(claims map[string]any)) string {
+		claims := idp.Claims("u-1", "n-1")
+		if change != nil {
+			change(claims)
+		}
+		return idp.IDToken(claims)
+	}
+	resign := func(token, header string) string {
+		parts := strings.Split(token, ".")
+		return base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + parts[1] + "." + parts[2]
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{"valid", valid(nil), false},
+		{"several audiences for this client", valid(func(c map[string]any) { c["aud"] = []string{"other", "news"}; c["azp"] = "news" }), false},
+		{"expired within skew", valid(func(c map[string]any) { c["exp"] = time.Now().Add(-30 * time.Second).Unix() }), false},
+		{"expired", valid(func(c map[string]any) { c["exp"] = time.Now().Add(-5 * time.Minute).Unix() }), true},
+		{"no expiry", valid(func(c map[string]any) { delete(c, "exp") }), true},
+		{"issued in the future", valid(func(c map[string]any) { c["iat"] = time.Now().Add(time.Hour).Unix() }), true},
+		{"another issuer", valid(func(c map[string]any) { c["iss"] = "https://evil.example" }), true},
+		{"another client", valid(func(c map[string]any) { c["aud"] = "other" }), true},
+		{"several audiences for another party", valid(func(c map[string]any) { c["aud"] = []string{"other", "news"}; c["azp"] = "other" }), true},
+		{"another nonce", valid(func(c map[string]any) { c["nonce"] = "n-2" }), true},
+		{"no subject", valid(func(c map[string]any) { delete(c, "sub") }), true},
+		{"unsigned", resign(valid(nil), `{"alg":"none"}`), true},
+		{"symmetric", resign(valid(nil), `{"alg":"HS256","kid":"key-1"}`), true},
+		{"unknown key", resign(valid(nil), `{"alg":"RS256","kid":"key-9"}`), true},
+		{"tampered", strings.Replace(valid(nil), ".", ".e30", 1), true},
+		{"malformed", "not-a-token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Verify(context.Background(), tt.token, "n-1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify() error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestProviderKeyRotation(t *testing.T) {
+	idp := oidctest.NewProvider(t, "news", "secret")
+	p := NewProvider(Config{Issuer: idp.Issuer(), ClientID: "news", ClientSecret: "secret"})
+	if _, err := p.Verify(context.Background(), idp.IDToken(idp.Claims("u-1", "")), ""); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	idp.RotateKey()
+	rotated := idp.IDToken(idp.Claims("u-1", ""))
+	if _, err := p.Verify(context.Background(), rotated, ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() right after fetching the keys error = %v, want the new key unknown until the keys may be fetched again", err)
+	}
+	p.now = func() time.Time { return time.Now().Add(keyRefreshInterval) }
+	if _, err := p.Verify(context.Background(), rotated, ""); err != nil {
+		t.Errorf("Verify() with a rotated key error = %v, want the keys fetched again", err)
+	}
+}
+
+func TestProviderDiscovery(t *testing.T) {
+	idp := oidctest.NewProvider(t, "news", "secret")
+
+	// A discovery document naming another issuer is refused
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{Issuer: idp.Issuer(), AuthorizationEndpoint: "a", TokenEndpoint: "t", JWKSURI: "j"})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	p := NewProvider(Config{Issuer: server.URL, ClientID: "news"})
+	if _, err := p.Metadata(context.Background()); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("Metadata() of a mismatched issuer error = %v, want it refused", err)
+	}
+
+	p = NewProvider(Config{Issuer: idp.Issuer(), ClientID: "news"})
+	metadata, err := p.Metadata(context.Background())
+	if err != nil || metadata.TokenEndpoint != idp.Issuer()+"/token" {
+		t.Errorf("Metadata() = %+v, %v, want the provider's endpoints", metadata, err)
+	}
+}
+
+func TestProviderVerifyECDSA(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	var issuer string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{Issuer: issuer, AuthorizationEndpoint: issuer + "/authorize", TokenEndpoint: issuer + "/token", JWKSURI: issuer + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{{
+			KeyType: "EC",
+			KeyID:   "ec",
+			Curve:   "P-256",
+			X:       base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+			Y:       base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	issuer = server.URL
+
+	now := time.Now()
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"ES256","kid":"ec"}`))
+	claims, _ := json.Marshal(map[string]any{"iss": issuer, "sub": "u-1", "aud": "news", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()})
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	p := NewProvider(Config{Issuer: issuer, ClientID: "news"})
+	if _, err := p.Verify(context.Background(), signed+"."+base64.RawURLEncoding.EncodeToString(signature), ""); err != nil {
+		t.Errorf("Verify() of an ES256 token error = %v", err)
+	}
+	signature[0] ^= 0xff
+	if _, err := p.Verify(context.Background(), signed+"."+base64.RawURLEncoding.EncodeToString(signature), ""); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() of a bad ES256 signature error = %v, want ErrInvalidToken", err)
+	}
+}
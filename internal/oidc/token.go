@@ -0,0 +1,354 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// clockSkew is how far the provider's clock may be from ours when checking token times
+	clockSkew = time.Minute
+	// keyRefreshInterval is how often the key set may be fetched again for tokens signed with unknown keys
+	keyRefreshInterval = time.Minute
+)
+
+// algorithm verifies the signatures of one JWS algorithm
+type algorithm struct {
+	hash   func() hash.Hash
+	hashID crypto.Hash
+	// curve is set for ECDSA algorithms
+	curve elliptic.Curve
+}
+
+// algorithms are the signature algorithms ID tokens may use. Unsigned ("none") and symmetric (HS*) tokens are never
+// accepted, since the client secret would be enough to forge them.
+var algorithms = map[string]algorithm{
+	"RS256": {hash: sha256.New, hashID: crypto.SHA256},
+	"RS384": {hash: sha512.New384, hashID: crypto.SHA384},
+	"RS512": {hash: sha512.New, hashID: crypto.SHA512},
+	"ES256": {hash: sha256.New, hashID: crypto.SHA256, curve: elliptic.P256()},
+	"ES384": {hash: sha512.New384, hashID: crypto.SHA384, curve: elliptic.P384()},
+}
+
+// IDToken is a verified ID token
+type IDToken struct {
+	Issuer   string
+	Subject  string
+	Audience []string
+	Expiry   time.Time
+	IssuedAt time.Time
+	// Claims holds every claim of the token, including the standard ones above
+	Claims map[string]any
+}
+
+// String returns the string claim, or "" when it's missing or not a string
+func (t *IDToken) String(claim string) string {
+	s, _ := t.Claims[claim].(string)
+	return s
+}
+
+// Strings returns the claim as a list of strings, accepting a single string for a list of one, e.g. for "groups"
+func (t *IDToken) Strings(claim string) []string {
+	switch v := t.Claims[claim].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// header is the JOSE header of a signed token
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// Verify checks the ID token's signature with the provider's keys, that it was issued by the provider for this client
+// and hasn't expired, and that it carries nonce, and returns its claims
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: not a signed JWT", ErrInvalidToken)
+	}
+	var head header
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return nil, fmt.Errorf("%w: invalid header: %v", ErrInvalidToken, err)
+	}
+	alg, ok := algorithms[head.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, head.Algorithm)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+
+	key, err := p.key(ctx, head.KeyID, alg)
+	if err != nil {
+		return nil, err
+	}
+	h := alg.hash()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if !verifySignature(key, alg, h.Sum(nil), signature) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	return p.checkClaims(ctx, parts[1], nonce)
+}
+
+// checkClaims decodes the token's payload and checks its issuer, audience, times and nonce
+func (p *Provider) checkClaims(ctx context.Context, payload, nonce string) (*IDToken, error) {
+	var claims map[string]any
+	if err := decodeSegment(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid payload: %v", ErrInvalidToken, err)
+	}
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &IDToken{Claims: claims}
+	token.Issuer = token.String("iss")
+	token.Subject = token.String("sub")
+	token.Audience = token.Strings("aud")
+	expiry, hasExpiry := numericDate(claims["exp"])
+	issuedAt, hasIssuedAt := numericDate(claims["iat"])
+	token.Expiry, token.IssuedAt = expiry, issuedAt
+	now := p.now()
+
+	switch {
+	case token.Issuer != metadata.Issuer:
+		return nil, fmt.Errorf("%w: issued by %q", ErrInvalidToken, token.Issuer)
+	case token.Subject == "":
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case !slices.Contains(token.Audience, p.config.ClientID):
+		return nil, fmt.Errorf("%w: issued for %v", ErrInvalidToken, token.Audience)
+	case len(token.Audience) > 1 && token.String("azp") != p.config.ClientID:
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidToken, token.String("azp"))
+	case !hasExpiry || !now.Before(expiry.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	case !hasIssuedAt || issuedAt.After(now.Add(clockSkew)):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case nonce != "" && subtle.ConstantTimeCompare([]byte(token.String("nonce")), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	return token, nil
+}
+
+// numericDate converts a JWT NumericDate claim, in seconds since the epoch, to a time
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+// decodeSegment decodes a base64url JWT segment as JSON, keeping numbers exact
+func decodeSegment(segment string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// verifySignature checks the signature of digest with the public key
+func verifySignature(key crypto.PublicKey, alg algorithm, digest, signature []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return alg.curve == nil && rsa.VerifyPKCS1v15(key, alg.hashID, digest, signature) == nil
+	case *ecdsa.PublicKey:
+		// JWS signatures are the fixed-size big-endian r and s, not ASN.1
+		size := (alg.curve.Params().BitSize + 7) / 8
+		if key.Curve != alg.curve || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+	}
+	return false
+}
+
+// keySet is the provider's signing keys by key ID
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// jwk is a JSON Web Key of the provider's key set
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// key returns the provider's key with the ID for alg, fetching the key set when it's unknown.
+// Tokens without a key ID may use the only key of the set.
+func (p *Provider) key(ctx context.Context, keyID string, alg algorithm) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	if keys == nil || keys.find(keyID) == nil && p.now().Sub(keys.fetchedAt) >= keyRefreshInterval {
+		fetched, err := p.fetchKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+		keys = fetched
+	}
+	key := keys.find(keyID)
+	if key == nil {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidToken, keyID)
+	}
+	if _, isECDSA := key.(*ecdsa.PublicKey); isECDSA != (alg.curve != nil) {
+		return nil, fmt.Errorf("%w: signing key %q doesn't match the algorithm", ErrInvalidToken, keyID)
+	}
+	return key, nil
+}
+
+// find returns the key with the ID, or the only key for an empty ID
+func (s *keySet) find(keyID string) crypto.PublicKey {
+	if keyID == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key
+		}
+	}
+	return s.keys[keyID]
+}
+
+// fetchKeys downloads the provider's key set and keeps it
+func (p *Provider) fetchKeys(ctx context.Context) (*keySet, error) {
+	metadata, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key set request: %w", err)
+	}
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	status, err := p.do(request, &document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch key set: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch key set: status %d", status)
+	}
+
+	keys := &keySet{keys: make(map[string]crypto.PublicKey, len(document.Keys)), fetchedAt: p.now()}
+	for _, k := range document.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Keys the application can't use, e.g. of other types, are skipped rather than failing the set
+		if key, err := k.publicKey(); err == nil {
+			keys.keys[k.KeyID] = key
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	return keys, nil
+}
+
+// publicKey decodes the RSA or EC public key
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if n.BitLen() < 2048 || !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("weak or invalid RSA key %q", k.KeyID)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var check ecdh.Curve
+		switch k.Curve {
+		case "P-256":
+			curve, check = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, check = elliptic.P384(), ecdh.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// The uncompressed point must be on the curve, or signatures could be forged
+		size := (curve.Params().BitSize + 7) / 8
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		if x.BitLen() > 8*size || y.BitLen() > 8*size {
+			return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+		}
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := check.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid EC key %q: %w", k.KeyID, err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+}
+
+// decodeBigInt decodes a base64url big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,70 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := PerMinute(60, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Take(ctx, "client", limit)
+		if err != nil {
+			t.Fatalf("Take() unexpected error = %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("Take() request %d denied, want allowed within burst", i+1)
+		}
+		if result.Remaining != 2-i {
+			t.Errorf("Take() remaining = %d, want %d", result.Remaining, 2-i)
+		}
+	}
+
+	result, _ := store.Take(ctx, "client", limit)
+	if result.Allowed {
+		t.Fatalf("Take() allowed request over burst")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("Take() retry after = %v, want 1s", result.RetryAfter)
+	}
+
+	// Other clients have their own bucket
+	if result, _ := store.Take(ctx, "other", limit); !result.Allowed {
+		t.Errorf("Take() denied a different key")
+	}
+
+	// One token is refilled per second
+	now = now.Add(time.Second)
+	if result, _ := store.Take(ctx, "client", limit); !result.Allowed {
+		t.Errorf("Take() denied after refill")
+	}
+	if result, _ := store.Take(ctx, "client", limit); result.Allowed {
+		t.Errorf("Take() allowed more than the refilled tokens")
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	limit := PerMinute(60, 5)
+	store.Take(context.Background(), "idle", limit)
+
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "active", limit)
+
+	if _, ok := store.buckets["idle"]; ok {
+		t.Errorf("sweep() kept a bucket that was already full")
+	}
+	if _, ok := store.buckets["active"]; !ok {
+		t.Errorf("sweep() removed an active bucket")
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionName is the collection holding shared token buckets
+const CollectionName = "rate_limits"
+
+// bucketTTL is how long an untouched bucket is kept before MongoDB expires it
+const bucketTTL = time.Hour
+
+// MongoStore keeps token buckets in MongoDB so that limits are shared by all replicas.
+// Each Take is a single atomic findAndModify evaluated with the server clock.
+type MongoStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoStore creates a store backed by the rate_limits collection.
+// Call EnsureIndexes once at startup so that idle buckets expire.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{collection: db.Collection(CollectionName)}
+}
+
+// EnsureIndexes creates the TTL index that removes idle buckets
+func (s *MongoStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().
+			SetName("expires_at_ttl").
+			SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create rate limit TTL index: %w", err)
+	}
+	return nil
+}
+
+func (s *MongoStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	burst := float64(limit.Burst)
+	hasTokens := bson.M{"$gte": bson.A{"$tokens", 1}}
+
+	// Refill the bucket for the time elapsed since the last request, then take a token if one is available.
+	// Stages run in order, so the second stage sees the refilled token count.
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.D{
+			{Key: "tokens", Value: bson.M{"$min": bson.A{
+				burst,
+				bson.M{"$add": bson.A{
+					bson.M{"$ifNull": bson.A{"$tokens", burst}},
+					bson.M{"$multiply": bson.A{
+						bson.M{"$divide": bson.A{
+							bson.M{"$subtract": bson.A{"$$NOW", bson.M{"$ifNull": bson.A{"$updated_at", "$$NOW"}}}},
+							1000,
+						}},
+						limit.Rate,
+					}},
+				}},
+			}}},
+			{Key: "updated_at", Value: "$$NOW"},
+		}}},
+		{{Key: "$set", Value: bson.D{
+			{Key: "allowed", Value: hasTokens},
+			{Key: "tokens", Value: bson.M{"$cond": bson.A{hasTokens, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}},
+			{Key: "expires_at", Value: bson.M{"$add": bson.A{"$$NOW", bucketTTL.Milliseconds()}}},
+		}}},
+	}
+
+	opts := options.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
+
+	var doc struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc)
+	if mongo.IsDuplicateKeyError(err) {
+		// Two requests raced to create the bucket; the retry finds the existing document
+		err = s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline, opts).Decode(&doc)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return newResult(doc.Allowed, doc.Tokens, limit), nil
+}
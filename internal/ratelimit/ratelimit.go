@@ -0,0 +1,48 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit configures a token bucket: Burst tokens at most, refilled at Rate tokens per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute creates a limit allowing n requests per minute with the given burst
+func PerMinute(n float64, burst int) Limit {
+	return Limit{Rate: n / 60, Burst: burst}
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long to wait until a token becomes available; zero when allowed
+	RetryAfter time.Duration
+}
+
+// Store keeps token buckets keyed by client
+type Store interface {
+	// Take removes one token from the bucket identified by key, creating a full bucket if needed
+	Take(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// newResult builds a result from the number of tokens left after taking
+func newResult(allowed bool, tokens float64, limit Limit) Result {
+	result := Result{Allowed: allowed, Remaining: int(math.Floor(tokens))}
+	if !allowed {
+		missing := 1 - tokens
+		result.RetryAfter = time.Duration(missing / limit.Rate * float64(time.Second))
+	}
+	return result
+}
@@ -0,0 +1,152 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditCollection is the name of the collection holding the audit log
+const AuditCollection = "audit_log"
+
+// AuditRepository stores the audit log. It is append-only: entries can't be changed or deleted.
+type AuditRepository interface {
+	// Append stores the entries, assigning their IDs. Entries without a tenant get the tenant of ctx.
+	Append(ctx context.Context, entries ...*model.AuditEntry) error
+	// FindPage returns one page of entries matching the filter, newest first, and the number of matching entries
+	FindPage(ctx context.Context, filter AuditFilter, limit, offset int) (*AuditPage, error)
+	// Stream calls fn for every entry matching the filter, oldest first,
+	// without loading the whole result set into memory
+	Stream(ctx context.Context, filter AuditFilter, fn func(*model.AuditEntry) error) error
+}
+
+// AuditFilter selects audit entries. All set criteria must match; an empty filter matches every entry.
+type AuditFilter struct {
+	Action model.AuditAction
+	PostID primitive.ObjectID
+	Actor  string
+	// From and To restrict entries to those recorded in [From, To). Zero values leave the range open.
+	From time.Time
+	To   time.Time
+}
+
+// AuditPage is a page of audit entries and the total number of entries matching the filter
+type AuditPage struct {
+	Entries []*model.AuditEntry
+	Total   int64
+}
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoAuditRepository creates a new MongoDB audit log repository
+func NewMongoAuditRepository(db *mongo.Database) AuditRepository {
+	return &mongoAuditRepository{
+		collection: db.Collection(AuditCollection),
+	}
+}
+
+func (r *mongoAuditRepository) Append(ctx context.Context, entries ...*model.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		if entry.ID.IsZero() {
+			entry.ID = primitive.NewObjectID()
+		}
+		if entry.Time.IsZero() {
+			entry.Time = time.Now()
+		}
+		if entry.TenantID == "" {
+			entry.TenantID = tenant.ID(ctx)
+		}
+		documents[i] = entry
+	}
+
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	return err
+}
+
+func (r *mongoAuditRepository) FindPage(ctx context.Context, filter AuditFilter, limit, offset int) (*AuditPage, error) {
+	query := scoped(ctx, filter.bson())
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*model.AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return &AuditPage{Entries: entries, Total: total}, nil
+}
+
+func (r *mongoAuditRepository) Stream(ctx context.Context, filter AuditFilter, fn func(*model.AuditEntry) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, scoped(ctx, filter.bson()), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry model.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(&entry); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// bson converts the filter into a MongoDB query document
+func (f AuditFilter) bson() bson.M {
+	query := bson.M{}
+	if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if !f.PostID.IsZero() {
+		query["post_id"] = f.PostID
+	}
+	if f.Actor != "" {
+		query["actor"] = f.Actor
+	}
+
+	recorded := bson.M{}
+	if !f.From.IsZero() {
+		recorded["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		recorded["$lt"] = f.To
+	}
+	if len(recorded) > 0 {
+		query["time"] = recorded
+	}
+	return query
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BackupRepository reads and writes whole collections for backups and restores
+type BackupRepository interface {
+	// Snapshot runs fn so that reads made with the context passed to fn see the database at a single point in time.
+	// consistent is false when the server doesn't support snapshot reads; fn then reads the latest data.
+	Snapshot(ctx context.Context, fn func(ctx context.Context) error) (consistent bool, err error)
+	// Each calls fn with every document of collection, in _id order; doc is only valid until fn returns
+	Each(ctx context.Context, collection string, fn func(doc bson.Raw) error) error
+	// Count returns the number of documents in collection
+	Count(ctx context.Context, collection string) (int64, error)
+	// Drop removes collection with its documents and indexes
+	Drop(ctx context.Context, collection string) error
+	// Insert writes documents to collection as they are
+	Insert(ctx context.Context, collection string, docs []bson.Raw) error
+}
+
+type mongoBackupRepository struct {
+	db        *mongo.Database
+	snapshots bool
+}
+
+// NewMongoBackupRepository creates a new MongoDB backup repository.
+// Snapshot reads need a replica set or sharded cluster; without them, snapshots should be false.
+func NewMongoBackupRepository(db *mongo.Database, snapshots bool) BackupRepository {
+	return &mongoBackupRepository{db: db, snapshots: snapshots}
+}
+
+func (r *mongoBackupRepository) Snapshot(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	if !r.snapshots {
+		return false, fn(ctx)
+	}
+
+	session, err := r.db.Client().StartSession(options.Session().SetSnapshot(true))
+	if err != nil {
+		return false, err
+	}
+	defer session.EndSession(ctx)
+	return true, fn(mongo.NewSessionContext(ctx, session))
+}
+
+func (r *mongoBackupRepository) Each(ctx context.Context, collection string, fn func(doc bson.Raw) error) error {
+	cursor, err := r.db.Collection(collection).Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		if err := fn(cursor.Current); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoBackupRepository) Count(ctx context.Context, collection string) (int64, error) {
+	return r.db.Collection(collection).CountDocuments(ctx, bson.M{})
+}
+
+func (r *mongoBackupRepository) Drop(ctx context.Context, collection string) error {
+	return r.db.Collection(collection).Drop(ctx)
+}
+
+func (r *mongoBackupRepository) Insert(ctx context.Context, collection string, docs []bson.Raw) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	documents := make([]interface{}, len(docs))
+	for i, doc := range docs {
+		documents[i] = doc
+	}
+	_, err := r.db.Collection(collection).InsertMany(ctx, documents)
+	return err
+}
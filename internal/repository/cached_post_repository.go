@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/cache"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/sync/singleflight"
+)
+
+// postCacheKeyPrefix prefixes the keys of cached posts in the shared backend
+const postCacheKeyPrefix = "post:"
+
+// CacheOptions configures a CachedPostRepository
+type CacheOptions struct {
+	// Size is the maximum number of posts kept in process
+	Size int
+	// TTL bounds how long a cached post is served, in process and in the backend
+	TTL time.Duration
+	// Backend is an optional cache shared between replicas, consulted on local misses
+	Backend cache.Backend
+}
+
+// CacheStats holds cache counters since the repository was created
+type CacheStats struct {
+	// Hits counts lookups served from the in-process cache
+	Hits int64
+	// BackendHits counts lookups served from the shared backend
+	BackendHits int64
+	// Misses counts lookups that went to the underlying repository
+	Misses int64
+	// BackendErrors counts failed backend operations, which are otherwise ignored
+	BackendErrors int64
+}
+
+// CachedPostRepository is a read-through cache for single posts in front of another PostRepository.
+// FindByID is served from an in-process LRU, then the optional shared backend, then the wrapped
+// repository, with concurrent misses for the same post collapsed into one query. Writes go to the
+// wrapped repository and invalidate the affected posts. All other methods pass through.
+type CachedPostRepository struct {
+	PostRepository
+	local   *cache.LRU[string, *model.Post]
+	backend cache.Backend
+	ttl     time.Duration
+	group   singleflight.Group
+	// generation is incremented by every invalidation, so loads that overlap a write don't cache stale posts
+	generation atomic.Uint64
+
+	hits          atomic.Int64
+	backendHits   atomic.Int64
+	misses        atomic.Int64
+	backendErrors atomic.Int64
+}
+
+// NewCachedPostRepository wraps repo with a read-through cache
+func NewCachedPostRepository(repo PostRepository, opts CacheOptions) *CachedPostRepository {
+	return &CachedPostRepository{
+		PostRepository: repo,
+		local:          cache.NewLRU[string, *model.Post](opts.Size, opts.TTL),
+		backend:        opts.Backend,
+		ttl:            opts.TTL,
+	}
+}
+
+// Stats returns a snapshot of the cache counters
+func (r *CachedPostRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:          r.hits.Load(),
+		BackendHits:   r.backendHits.Load(),
+		Misses:        r.misses.Load(),
+		BackendErrors: r.backendErrors.Load(),
+	}
+}
+
+// FindByID returns a copy of the cached post, loading it on a miss.
+// Errors, including ErrPostNotFound, are not cached.
+// Posts are cached by ID for every tenant, so posts of other tenants than the one of ctx are reported as not found.
+func (r *CachedPostRepository) FindByID(ctx context.Context, id string) (*model.Post, error) {
+	current := tenant.From(ctx)
+	if post, ok := r.local.Get(id); ok {
+		if !current.Owns(post.TenantID) {
+			return nil, ErrPostNotFound
+		}
+		r.hits.Add(1)
+		return clonePost(post), nil
+	}
+
+	// Callers of the shared load receive the same post, so each gets its own copy
+	value, err, shared := r.group.Do(id, func() (interface{}, error) {
+		generation := r.generation.Load()
+
+		if post := r.backendGet(ctx, id); post != nil {
+			r.backendHits.Add(1)
+			if r.generation.Load() == generation {
+				r.local.Set(id, post)
+			}
+			return post, nil
+		}
+
+		r.misses.Add(1)
+		post, err := r.PostRepository.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if r.generation.Load() == generation {
+			r.local.Set(id, clonePost(post))
+			r.backendSet(ctx, id, post)
+		}
+		return post, nil
+	})
+	if errors.Is(err, ErrPostNotFound) && shared {
+		// The shared load may have run for another tenant, which can't see the post
+		r.misses.Add(1)
+		return r.PostRepository.FindByID(ctx, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	post := value.(*model.Post)
+	if !current.Owns(post.TenantID) {
+		return nil, ErrPostNotFound
+	}
+	return clonePost(post), nil
+}
+
+// Update writes the post and invalidates its cached copy
+func (r *CachedPostRepository) Update(ctx context.Context, post *model.Post) error {
+	err := r.PostRepository.Update(ctx, post)
+	r.invalidate(ctx, post.ID.Hex())
+	return err
+}
+
+// Delete deletes the post and invalidates its cached copy
+func (r *CachedPostRepository) Delete(ctx context.Context, id string) error {
+	err := r.PostRepository.Delete(ctx, id)
+	r.invalidate(ctx, id)
+	return err
+}
+
+// BulkUpsert writes the posts and invalidates the whole cache, since posts matched by slug
+// may replace cached posts whose IDs aren't known here
+func (r *CachedPostRepository) BulkUpsert(ctx context.Context, posts []*model.Post) (*BulkUpsertResult, error) {
+	result, err := r.PostRepository.BulkUpsert(ctx, posts)
+	r.purge(ctx)
+	return result, err
+}
+
+// UpdateMany applies the changes and invalidates the affected posts
+func (r *CachedPostRepository) UpdateMany(ctx context.Context, filter PostFilter, changes PostChanges) (int64, error) {
+	modified, err := r.PostRepository.UpdateMany(ctx, filter, changes)
+	r.invalidateFilter(ctx, filter)
+	return modified, err
+}
+
+// DeleteMany deletes the matching posts and invalidates them
+func (r *CachedPostRepository) DeleteMany(ctx context.Context, filter PostFilter) (int64, error) {
+	deleted, err := r.PostRepository.DeleteMany(ctx, filter)
+	r.invalidateFilter(ctx, filter)
+	return deleted, err
+}
+
+// Invalidate drops the cached copies of the posts with the given IDs, e.g. after they were changed by another process
+func (r *CachedPostRepository) Invalidate(ctx context.Context, ids ...string) {
+	r.invalidate(ctx, ids...)
+}
+
+// invalidateFilter invalidates the posts selected by filter, or everything when it selects by search.
+// Invalidation also runs after failed writes, which may have been partially applied.
+func (r *CachedPostRepository) invalidateFilter(ctx context.Context, filter PostFilter) {
+	if filter.IDs == nil || filter.Search != "" {
+		r.purge(ctx)
+		return
+	}
+
+	ids := make([]string, len(filter.IDs))
+	for i, id := range filter.IDs {
+		ids[i] = id.Hex()
+	}
+	r.invalidate(ctx, ids...)
+}
+
+func (r *CachedPostRepository) invalidate(ctx context.Context, ids ...string) {
+	r.generation.Add(1)
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		// Later lookups must not join loads that may have read the post before the write
+		r.group.Forget(id)
+		r.local.Delete(id)
+		keys[i] = postCacheKeyPrefix + id
+	}
+
+	if r.backend == nil || len(keys) == 0 {
+		return
+	}
+	if err := r.backend.Delete(ctx, keys...); err != nil {
+		r.backendErrors.Add(1)
+		slog.Warn("Failed to invalidate cached posts", "count", len(keys), "error", err)
+	}
+}
+
+func (r *CachedPostRepository) purge(ctx context.Context) {
+	r.generation.Add(1)
+	r.local.Purge()
+
+	if r.backend == nil {
+		return
+	}
+	if err := r.backend.Purge(ctx, postCacheKeyPrefix); err != nil {
+		r.backendErrors.Add(1)
+		slog.Warn("Failed to purge cached posts", "error", err)
+	}
+}
+
+// backendGet returns the post stored in the shared backend, or nil when it's missing or unavailable
+func (r *CachedPostRepository) backendGet(ctx context.Context, id string) *model.Post {
+	if r.backend == nil {
+		return nil
+	}
+
+	data, ok, err := r.backend.Get(ctx, postCacheKeyPrefix+id)
+	if err != nil {
+		r.backendErrors.Add(1)
+		slog.Warn("Failed to read cached post", "id", id, "error", err)
+		return nil
+	}
+	if !ok {
+		return nil
+	}
+
+	var post model.Post
+	if err := bson.Unmarshal(data, &post); err != nil {
+		r.backendErrors.Add(1)
+		slog.Warn("Failed to decode cached post", "id", id, "error", err)
+		return nil
+	}
+	return &post
+}
+
+func (r *CachedPostRepository) backendSet(ctx context.Context, id string, post *model.Post) {
+	if r.backend == nil {
+		return
+	}
+
+	data, err := bson.Marshal(post)
+	if err == nil {
+		err = r.backend.Set(ctx, postCacheKeyPrefix+id, data, r.ttl)
+	}
+	if err != nil {
+		r.backendErrors.Add(1)
+		slog.Warn("Failed to cache post", "id", id, "error", err)
+	}
+}
+
+// clonePost returns a copy of post that shares no mutable state with it
+func clonePost(post *model.Post) *model.Post {
+	clone := *post
+	if post.Tags != nil {
+		clone.Tags = append([]string(nil), post.Tags...)
+	}
+	if post.Translations != nil {
+		clone.Translations = append([]model.Translation(nil), post.Translations...)
+	}
+	return &clone
+}
@@ -0,0 +1,271 @@
+package repository
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakePostRepository serves posts from a map and counts FindByID calls.
+// Methods not overridden panic through the nil embedded interface.
+type fakePostRepository struct {
+	PostRepository
+	mu      sync.Mutex
+	posts   map[string]*model.Post
+	finds   atomic.Int64
+	release chan struct{}
+}
+
+func newFakePostRepository(posts ...*model.Post) *fakePostRepository {
+	repo := &fakePostRepository{posts: make(map[string]*model.Post)}
+	for _, post := range posts {
+		repo.posts[post.ID.Hex()] = post
+	}
+	return repo
+}
+
+func (f *fakePostRepository) FindByID(ctx context.Context, id string) (*model.Post, error) {
+	f.finds.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	post, ok := f.posts[id]
+	if !ok || !tenant.From(ctx).Owns(post.TenantID) {
+		return nil, ErrPostNotFound
+	}
+	return clonePost(post), nil
+}
+
+func (f *fakePostRepository) Update(ctx context.Context, post *model.Post) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.posts[post.ID.Hex()] = clonePost(post)
+	return nil
+}
+
+func (f *fakePostRepository) Delete(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.posts, id)
+	return nil
+}
+
+// fakeBackend is an in-memory cache.Backend
+type fakeBackend struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func (b *fakeBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	value, ok := b.values[key]
+	return value, ok, nil
+}
+
+func (b *fakeBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.values[key] = value
+	return nil
+}
+
+func (b *fakeBackend) Delete(ctx context.Context, keys ...string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, key := range keys {
+		delete(b.values, key)
+	}
+	return nil
+}
+
+func (b *fakeBackend) Purge(ctx context.Context, prefix string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.values {
+		if strings.HasPrefix(key, prefix) {
+			delete(b.values, key)
+		}
+	}
+	return nil
+}
+
+func newTestPost(title string) *model.Post {
+	post := model.NewPost(title, "Content")
+	post.ID = primitive.NewObjectID()
+	return post
+}
+
+func TestCachedPostRepositoryReadThrough(t *testing.T) {
+	post := newTestPost("Cached")
+	inner := newFakePostRepository(post)
+	repo := NewCachedPostRepository(inner, CacheOptions{Size: 10, TTL: time.Minute})
+	ctx := context.Background()
+
+	first, err := repo.FindByID(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	// Callers own the returned post; changing it must not affect the cache
+	first.Title = "Changed by caller"
+
+	second, err := repo.FindByID(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if second.Title != "Cached" {
+		t.Errorf("FindByID() title = %q, want %q", second.Title, "Cached")
+	}
+	if got := inner.finds.Load(); got != 1 {
+		t.Errorf("inner FindByID called %d times, want 1", got)
+	}
+
+	stats := repo.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Stats() = %+v, want 1 hit and 1 miss", stats)
+	}
+
+	if _, err := repo.FindByID(ctx, primitive.NewObjectID().Hex()); err != ErrPostNotFound {
+		t.Errorf("FindByID() of unknown post error = %v, want %v", err, ErrPostNotFound)
+	}
+}
+
+func TestCachedPostRepositoryInvalidation(t *testing.T) {
+	post := newTestPost("Original")
+	inner := newFakePostRepository(post)
+	backend := &fakeBackend{values: make(map[string][]byte)}
+	repo := NewCachedPostRepository(inner, CacheOptions{Size: 10, TTL: time.Minute, Backend: backend})
+	ctx := context.Background()
+	id := post.ID.Hex()
+
+	if _, err := repo.FindByID(ctx, id); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if len(backend.values) != 1 {
+		t.Fatalf("backend holds %d posts, want 1", len(backend.values))
+	}
+
+	updated := clonePost(post)
+	updated.Title = "Updated"
+	if err := repo.Update(ctx, updated); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(backend.values) != 0 {
+		t.Errorf("backend holds %d posts after Update, want 0", len(backend.values))
+	}
+
+	got, err := repo.FindByID(ctx, id)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.Title != "Updated" {
+		t.Errorf("FindByID() after Update title = %q, want %q", got.Title, "Updated")
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.FindByID(ctx, id); err != ErrPostNotFound {
+		t.Errorf("FindByID() after Delete error = %v, want %v", err, ErrPostNotFound)
+	}
+}
+
+func TestCachedPostRepositoryBackendHit(t *testing.T) {
+	post := newTestPost("Shared")
+	backend := &fakeBackend{values: make(map[string][]byte)}
+	ctx := context.Background()
+
+	// Another replica loads the post into the shared backend
+	other := NewCachedPostRepository(newFakePostRepository(post), CacheOptions{Size: 10, TTL: time.Minute, Backend: backend})
+	if _, err := other.FindByID(ctx, post.ID.Hex()); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+
+	inner := newFakePostRepository(post)
+	repo := NewCachedPostRepository(inner, CacheOptions{Size: 10, TTL: time.Minute, Backend: backend})
+	got, err := repo.FindByID(ctx, post.ID.Hex())
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.Title != "Shared" || got.ID != post.ID {
+		t.Errorf("FindByID() = %+v, want post %s", got, post.ID.Hex())
+	}
+	if inner.finds.Load() != 0 {
+		t.Errorf("inner FindByID called %d times, want 0", inner.finds.Load())
+	}
+	if stats := repo.Stats(); stats.BackendHits != 1 {
+		t.Errorf("Stats().BackendHits = %d, want 1", stats.BackendHits)
+	}
+}
+
+func TestCachedPostRepositorySingleflight(t *testing.T) {
+	post := newTestPost("Hot")
+	inner := newFakePostRepository(post)
+	inner.release = make(chan struct{})
+	repo := NewCachedPostRepository(inner, CacheOptions{Size: 10, TTL: time.Minute})
+
+	const callers = 10
+	var started, done sync.WaitGroup
+	started.Add(callers)
+	done.Add(callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			defer done.Done()
+			started.Done()
+			if _, err := repo.FindByID(context.Background(), post.ID.Hex()); err != nil {
+				t.Errorf("FindByID() error = %v", err)
+			}
+		}()
+	}
+
+	// Give the callers time to join the in-flight load before releasing it
+	started.Wait()
+	time.Sleep(50 * time.Millisecond)
+	close(inner.release)
+	done.Wait()
+
+	if got := inner.finds.Load(); got != 1 {
+		t.Errorf("inner FindByID called %d times, want 1", got)
+	}
+}
+
+func TestCachedPostRepositoryTenants(t *testing.T) {
+	post := newTestPost("Daily news")
+	post.TenantID = "daily"
+	repo := NewCachedPostRepository(newFakePostRepository(post), CacheOptions{Size: 10, TTL: time.Minute, Backend: &fakeBackend{values: make(map[string][]byte)}})
+	daily := tenant.WithID(context.Background(), "daily")
+	weekly := tenant.WithID(context.Background(), "weekly")
+
+	// Another tenant misses before and after the post is cached
+	if _, err := repo.FindByID(weekly, post.ID.Hex()); err != ErrPostNotFound {
+		t.Errorf("FindByID() by another tenant error = %v, want %v", err, ErrPostNotFound)
+	}
+	if _, err := repo.FindByID(daily, post.ID.Hex()); err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if _, err := repo.FindByID(weekly, post.ID.Hex()); err != ErrPostNotFound {
+		t.Errorf("FindByID() of a cached post by another tenant error = %v, want %v", err, ErrPostNotFound)
+	}
+	if _, err := repo.FindByID(context.Background(), post.ID.Hex()); err != ErrPostNotFound {
+		t.Errorf("FindByID() of a cached post by the default tenant error = %v, want %v", err, ErrPostNotFound)
+	}
+
+	// The shared backend keeps the tenant of cached posts
+	repo.local.Purge()
+	if _, err := repo.FindByID(weekly, post.ID.Hex()); err != ErrPostNotFound {
+		t.Errorf("FindByID() of a post in the backend by another tenant error = %v, want %v", err, ErrPostNotFound)
+	}
+	if _, err := repo.FindByID(daily, post.ID.Hex()); err != nil {
+		t.Errorf("FindByID() of a post in the backend error = %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ResumeTokenCollection holds the positions of change stream watchers
+const ResumeTokenCollection = "resume_tokens"
+
+var (
+	// ErrChangeStreamsUnsupported is returned by watchers on servers without change streams, such as standalone ones
+	ErrChangeStreamsUnsupported = errors.New("change streams are not supported by this server")
+	// ErrResumeTokenExpired is returned by watchers whose resume token is no longer in the oplog
+	ErrResumeTokenExpired = errors.New("resume token is no longer in the oplog")
+)
+
+// Server error codes of change streams
+const (
+	changeStreamsUnsupportedCode = 40573
+	changeStreamFatalErrorCode   = 280
+	changeStreamHistoryLostCode  = 286
+)
+
+// Change stream operations on posts
+const (
+	OperationInsert  = "insert"
+	OperationUpdate  = "update"
+	OperationReplace = "replace"
+	OperationDelete  = "delete"
+)
+
+// PostChange is a change of a post written outside a transaction, as seen on the change stream of posts
+type PostChange struct {
+	// Operation is OperationInsert, OperationUpdate, OperationReplace or OperationDelete
+	Operation string
+	PostID    primitive.ObjectID
+	// Post is the post as it is now; nil for deletions and for posts deleted since the change
+	Post *model.Post
+	// Published reports whether an update set the status to published
+	Published bool
+	// Time is the cluster time of the change, which is unique among changes written outside transactions
+	Time primitive.Timestamp
+}
+
+// PostWatcher follows changes of posts
+type PostWatcher interface {
+	// Watch calls fn with every change of posts written outside a transaction, from the change after token on,
+	// or from now when token is nil. The application writes posts in transactions, so its own changes are skipped.
+	// fn gets the resume token following the change; it is also called with a nil change whenever
+	// the stream advances without changes, so that idle watchers keep a recent token.
+	// Watch returns when ctx is canceled, fn fails or the stream fails.
+	Watch(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *PostChange, token bson.Raw) error) error
+}
+
+// ResumeTokenRepository stores the positions of change stream watchers, so they resume where they stopped
+type ResumeTokenRepository interface {
+	// Load returns the token stored under name, or nil if there is none
+	Load(ctx context.Context, name string) (bson.Raw, error)
+	// Save stores token under name; a nil token removes it
+	Save(ctx context.Context, name string, token bson.Raw) error
+}
+
+type mongoPostWatcher struct {
+	collection *mongo.Collection
+	maxAwait   time.Duration
+}
+
+// NewMongoPostWatcher creates a watcher of the posts collection's change stream,
+// which needs a replica set or sharded cluster
+func NewMongoPostWatcher(db *mongo.Database) PostWatcher {
+	return &mongoPostWatcher{
+		collection: db.Collection("posts"),
+		maxAwait:   time.Second,
+	}
+}
+
+// postChangeEvent is the part of a change stream event the watcher reads
+type postChangeEvent struct {
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	DocumentKey   struct {
+		ID primitive.ObjectID `bson:"_id"`
+	} `bson:"documentKey"`
+	FullDocument      *model.Post `bson:"fullDocument"`
+	UpdateDescription struct {
+		UpdatedFields bson.M `bson:"updatedFields"`
+	} `bson:"updateDescription"`
+}
+
+func (w *mongoPostWatcher) Watch(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *PostChange, token bson.Raw) error) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"operationType": bson.M{"$in": bson.A{OperationInsert, OperationUpdate, OperationReplace, OperationDelete}},
+			// Changes written in transactions carry a transaction number
+			"txnNumber": bson.M{"$exists": false},
+		}}},
+	}
+	opts := options.ChangeStream().
+		SetFullDocument(options.UpdateLookup).
+		SetMaxAwaitTime(w.maxAwait)
+	if token != nil {
+		opts.SetStartAfter(token)
+	}
+
+	stream, err := w.collection.Watch(ctx, pipeline, opts)
+	if err != nil {
+		return watchError(err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	last := token
+	for {
+		if stream.TryNext(ctx) {
+			var event postChangeEvent
+			if err := stream.Decode(&event); err != nil {
+				return err
+			}
+			change := &PostChange{
+				Operation: event.OperationType,
+				PostID:    event.DocumentKey.ID,
+				Post:      event.FullDocument,
+				Published: event.UpdateDescription.UpdatedFields["status"] == string(model.StatusPublished),
+				Time:      event.ClusterTime,
+			}
+			last = stream.ResumeToken()
+			if err := fn(ctx, change, last); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := stream.Err(); err != nil {
+			return watchError(err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if current := stream.ResumeToken(); current != nil && !bytes.Equal(current, last) {
+			last = current
+			if err := fn(ctx, nil, last); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watchError translates the server errors of change streams that watchers handle
+func watchError(err error) error {
+	var serverErr mongo.ServerError
+	if !errors.As(err, &serverErr) {
+		return err
+	}
+	switch {
+	case serverErr.HasErrorCode(changeStreamsUnsupportedCode):
+		return ErrChangeStreamsUnsupported
+	case serverErr.HasErrorCode(changeStreamHistoryLostCode), serverErr.HasErrorCode(changeStreamFatalErrorCode):
+		return ErrResumeTokenExpired
+	}
+	return err
+}
+
+type mongoResumeTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoResumeTokenRepository creates a new MongoDB resume token repository
+func NewMongoResumeTokenRepository(db *mongo.Database) ResumeTokenRepository {
+	return &mongoResumeTokenRepository{
+		collection: db.Collection(ResumeTokenCollection),
+	}
+}
+
+func (r *mongoResumeTokenRepository) Load(ctx context.Context, name string) (bson.Raw, error) {
+	var document struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := r.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&document)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return document.Token, nil
+}
+
+func (r *mongoResumeTokenRepository) Save(ctx context.Context, name string, token bson.Raw) error {
+	if token == nil {
+		_, err := r.collection.DeleteOne(ctx, bson.M{"_id": name})
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"token": token, "updated_at": time.Now()}}
+	_, err := r.collection.UpdateByID(ctx, name, update, options.Update().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OutboxCollection holds events waiting to be relayed
+const OutboxCollection = "outbox"
+
+var ErrOutboxRecordNotFound = errors.New("outbox record not found")
+
+// OutboxRepository stores events written together with the changes they describe and hands them to relays
+type OutboxRepository interface {
+	// Add stores new records. Called with the context of a transaction, the records are part of it.
+	// Records of events that are already stored are skipped, so that events derived from the same change,
+	// e.g. by several change stream watchers, are stored once. Within a transaction a duplicate aborts it.
+	Add(ctx context.Context, records ...*model.OutboxRecord) error
+	// ClaimDue returns the oldest pending record that is due and postpones it by lease,
+	// so that other relays skip it while it is processed. It returns nil when no record is due.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxRecord, error)
+	// SaveAttempt stores the outcome of an attempt: the status, handling sinks, attempts, next attempt, last error and processing time
+	SaveAttempt(ctx context.Context, record *model.OutboxRecord) error
+}
+
+// Transactor runs functions in database transactions
+type Transactor interface {
+	// WithTransaction runs fn in a transaction, committing it when fn returns nil and aborting it otherwise.
+	// Repository calls made with the context passed to fn are part of the transaction.
+	// fn may be run again when the transaction hits a transient error, so it must not keep state between runs.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// NewMongoTransactor creates a transactor running MongoDB transactions, which need a replica set or sharded cluster
+func NewMongoTransactor(client *mongo.Client) Transactor {
+	return &mongoTransactor{client: client}
+}
+
+func (t *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sessCtx)
+	})
+	return err
+}
+
+type mongoOutboxRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoOutboxRepository creates a new MongoDB outbox repository
+func NewMongoOutboxRepository(db *mongo.Database) OutboxRepository {
+	return &mongoOutboxRepository{
+		collection: db.Collection(OutboxCollection),
+	}
+}
+
+func (r *mongoOutboxRepository) Add(ctx context.Context, records ...*model.OutboxRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(records))
+	for i, record := range records {
+		documents[i] = record
+	}
+
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if err != nil && !onlyDuplicates(err) {
+		return err
+	}
+	return nil
+}
+
+func (r *mongoOutboxRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxRecord, error) {
+	filter := bson.M{
+		"status":          model.OutboxPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	// ObjectIDs grow with time, so the oldest event comes first
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var record model.OutboxRecord
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (r *mongoOutboxRepository) SaveAttempt(ctx context.Context, record *model.OutboxRecord) error {
+	set := bson.M{
+		"status":          record.Status,
+		"handled_by":      record.HandledBy,
+		"attempts":        record.Attempts,
+		"next_attempt_at": record.NextAttemptAt,
+		"last_error":      record.LastError,
+	}
+	if !record.ProcessedAt.IsZero() {
+		set["processed_at"] = record.ProcessedAt
+	}
+
+	result, err := r.collection.UpdateByID(ctx, record.ID, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOutboxRecordNotFound
+	}
+	return nil
+}
@@ -3,10 +3,13 @@ package repository
 import (
 	"context"
 	"errors"
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,8 +17,10 @@ import (
 )
 
 var (
-	ErrPostNotFound = errors.New("post not found")
-	ErrInvalidID    = errors.New("invalid post id")
+	ErrPostNotFound   = errors.New("post not found")
+	ErrInvalidID      = errors.New("invalid post id")
+	ErrNothingToApply = errors.New("no changes to apply")
+	ErrDuplicate      = errors.New("a post with the same slug already exists")
 )
 
 type mongoPostRepository struct {
@@ -34,8 +39,13 @@ func (r *mongoPostRepository) Create(ctx context.Context, post *model.Post) erro
 	post.ID = primitive.NewObjectID()
 	post.CreatedAt = time.Now()
 	post.UpdatedAt = time.Now()
+	post.TenantID = tenant.ID(ctx)
+	setTextLanguages(post)
 
 	_, err := r.collection.InsertOne(ctx, post)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
 	return err
 }
 
@@ -46,7 +56,7 @@ func (r *mongoPostRepository) FindByID(ctx context.Context, id string) (*model.P
 	}
 
 	var post model.Post
-	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&post)
+	err = r.collection.FindOne(ctx, scoped(ctx, bson.M{"_id": objectID})).Decode(&post)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, ErrPostNotFound
@@ -63,7 +73,7 @@ func (r *mongoPostRepository) FindAll(ctx context.Context, limit, offset int) ([
 		SetSkip(int64(offset)).
 		SetSort(bson.D{{Key: "created_at", Value: -1}})
 
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, scoped(ctx, nil), opts)
 	if err != nil {
 		return nil, err
 	}
@@ -78,15 +88,7 @@ func (r *mongoPostRepository) FindAll(ctx context.Context, limit, offset int) ([
 }
 
 func (r *mongoPostRepository) Search(ctx context.Context, query string, limit, offset int) ([]*model.Post, error) {
-	// Escape special regex characters to prevent regex injection
-	escapedQuery := regexp.QuoteMeta(query)
-
-	filter := bson.M{
-		"$or": []bson.M{
-			{"title": bson.M{"$regex": escapedQuery, "$options": "i"}},
-			{"content": bson.M{"$regex": escapedQuery, "$options": "i"}},
-		},
-	}
+	filter := scoped(ctx, searchFilter(query))
 
 	opts := options.Find().
 		SetLimit(int64(limit)).
@@ -109,16 +111,20 @@ func (r *mongoPostRepository) Search(ctx context.Context, query string, limit, o
 
 func (r *mongoPostRepository) Update(ctx context.Context, post *model.Post) error {
 	post.UpdatedAt = time.Now()
+	setTextLanguages(post)
 
 	update := bson.M{
 		"$set": bson.M{
-			"title":      post.Title,
-			"content":    post.Content,
-			"updated_at": post.UpdatedAt,
+			"title":         post.Title,
+			"content":       post.Content,
+			"language":      post.Language,
+			"text_language": post.TextLanguage,
+			"translations":  post.Translations,
+			"updated_at":    post.UpdatedAt,
 		},
 	}
 
-	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": post.ID}, update)
+	result, err := r.collection.UpdateOne(ctx, scoped(ctx, bson.M{"_id": post.ID}), update)
 	if err != nil {
 		return err
 	}
@@ -136,7 +142,7 @@ func (r *mongoPostRepository) Delete(ctx context.Context, id string) error {
 		return ErrInvalidID
 	}
 
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	result, err := r.collection.DeleteOne(ctx, scoped(ctx, bson.M{"_id": objectID}))
 	if err != nil {
 		return err
 	}
@@ -149,18 +155,570 @@ func (r *mongoPostRepository) Delete(ctx context.Context, id string) error {
 }
 
 func (r *mongoPostRepository) Count(ctx context.Context) (int64, error) {
-	return r.collection.CountDocuments(ctx, bson.M{})
+	return r.collection.CountDocuments(ctx, scoped(ctx, nil))
 }
 
 func (r *mongoPostRepository) CountSearch(ctx context.Context, query string) (int64, error) {
-	// Escape special regex characters to prevent regex injection
-	escapedQuery := regexp.QuoteMeta(query)
+	return r.collection.CountDocuments(ctx, scoped(ctx, searchFilter(query)))
+}
+
+func (r *mongoPostRepository) FindPage(ctx context.Context, query PageQuery) (*PostPage, error) {
+	if query.EstimateTotal && !query.Filtered() {
+		return r.findPageEstimated(ctx, query)
+	}
+
+	relevance := query.SortBy == SortByRelevance && query.Search != ""
+
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: scoped(ctx, pageFilter(query, relevance))}}}
+	if relevance {
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.M{
+			textScoreField: bson.M{"$meta": "textScore"},
+		}}})
+	}
+	// The sort comes before $facet, whose sub-pipelines can't use indexes, so that sorting by date follows an index
+	// instead of sorting every matching post in memory
+	pipeline = append(pipeline, bson.D{{Key: "$sort", Value: pageSort(query, relevance)}})
+	pipeline = append(pipeline, bson.D{{Key: "$facet", Value: bson.M{
+		"posts": bson.A{
+			bson.M{"$skip": int64(query.Offset)},
+			bson.M{"$limit": int64(query.Limit)},
+		},
+		"total": bson.A{
+			bson.M{"$count": "count"},
+		},
+	}}})
+
+	opts := options.Aggregate()
+	if query.SortBy == SortByTitle {
+		opts.SetCollation(titleCollation)
+	}
+
+	cursor, err := r.collection.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	// $facet always produces exactly one document; total is empty when nothing matches
+	var results []struct {
+		Posts []*model.Post `bson:"posts"`
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	page := &PostPage{Posts: []*model.Post{}}
+	if len(results) == 0 {
+		return page, nil
+	}
+	if results[0].Posts != nil {
+		page.Posts = results[0].Posts
+	}
+	if len(results[0].Total) > 0 {
+		page.Total = results[0].Total[0].Count
+	}
+
+	return page, nil
+}
+
+// findPageEstimated fetches an unfiltered page and takes the total from collection metadata.
+// The metadata counts the posts of every tenant, so the server refuses estimates when it serves several tenants.
+func (r *mongoPostRepository) findPageEstimated(ctx context.Context, query PageQuery) (*PostPage, error) {
+	opts := options.Find().
+		SetLimit(int64(query.Limit)).
+		SetSkip(int64(query.Offset)).
+		SetSort(pageSort(query, false))
+	if query.SortBy == SortByTitle {
+		opts.SetCollation(titleCollation)
+	}
+
+	cursor, err := r.collection.Find(ctx, scoped(ctx, nil), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	posts := []*model.Post{}
+	if err := cursor.All(ctx, &posts); err != nil {
+		return nil, err
+	}
+
+	total, err := r.collection.EstimatedDocumentCount(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostPage{Posts: posts, Total: total, Estimated: true}, nil
+}
+
+func (r *mongoPostRepository) Stream(ctx context.Context, query string, fn func(*model.Post) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.collection.Find(ctx, scoped(ctx, searchFilter(query)), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var post model.Post
+		if err := cursor.Decode(&post); err != nil {
+			return err
+		}
+		if err := fn(&post); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// refreshBatchSize is the number of posts RefreshTextLanguages updates per bulk write
+const refreshBatchSize = 500
+
+func (r *mongoPostRepository) RefreshTextLanguages(ctx context.Context) (int64, error) {
+	projection := bson.M{"language": 1, "text_language": 1, "translations.language": 1, "translations.text_language": 1}
+	cursor, err := r.collection.Find(ctx, scoped(ctx, nil), options.Find().SetProjection(projection))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var updated int64
+	models := make([]mongo.WriteModel, 0, refreshBatchSize)
+	flush := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		result, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			return err
+		}
+		updated += result.ModifiedCount
+		models = models[:0]
+		return nil
+	}
+
+	for cursor.Next(ctx) {
+		var post model.Post
+		if err := cursor.Decode(&post); err != nil {
+			return updated, err
+		}
+
+		stored := post.TextLanguage
+		storedTranslations := make([]string, len(post.Translations))
+		for i, translation := range post.Translations {
+			storedTranslations[i] = translation.TextLanguage
+		}
+		setTextLanguages(&post)
+
+		set := bson.M{}
+		if post.TextLanguage != stored {
+			set["text_language"] = post.TextLanguage
+		}
+		for i, translation := range post.Translations {
+			if translation.TextLanguage != storedTranslations[i] {
+				set[fmt.Sprintf("translations.%d.text_language", i)] = translation.TextLanguage
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": post.ID}).SetUpdate(bson.M{"$set": set}))
+		if len(models) == refreshBatchSize {
+			if err := flush(); err != nil {
+				return updated, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return updated, err
+	}
+	return updated, flush()
+}
+
+func (r *mongoPostRepository) BulkUpsert(ctx context.Context, posts []*model.Post) (*BulkUpsertResult, error) {
+	result := &BulkUpsertResult{Failed: make(map[int]error)}
+	if len(posts) == 0 {
+		return result, nil
+	}
+
+	now := time.Now()
+	// Posts matched by ID in another tenant aren't updated; inserting them fails on the duplicate ID
+	tenantID := tenant.ID(ctx)
+	models := make([]mongo.WriteModel, 0, len(posts))
+	for _, post := range posts {
+		post.TenantID = tenantID
+		if post.CreatedAt.IsZero() {
+			post.CreatedAt = now
+		}
+		if post.UpdatedAt.IsZero() {
+			post.UpdatedAt = now
+		}
+		setTextLanguages(post)
+
+		var filter bson.M
+		switch {
+		case !post.ID.IsZero():
+			filter = bson.M{"_id": post.ID}
+		case post.Slug != "":
+			filter = bson.M{"slug": post.Slug}
+		default:
+			post.ID = primitive.NewObjectID()
+			filter = bson.M{"_id": post.ID}
+		}
+
+		set := bson.M{
+			"title":      post.Title,
+			"content":    post.Content,
+			"updated_at": post.UpdatedAt,
+		}
+		if post.Slug != "" {
+			set["slug"] = post.Slug
+		}
+		if post.Tags != nil {
+			set["tags"] = post.Tags
+		}
+		if post.Status != "" {
+			set["status"] = post.Status
+		}
+		if post.Language != "" {
+			set["language"] = post.Language
+		}
+		set["text_language"] = post.TextLanguage
+		if post.Translations != nil {
+			set["translations"] = post.Translations
+		}
+
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(scoped(ctx, filter)).
+			SetUpdate(bson.M{
+				"$set":         set,
+				"$setOnInsert": bson.M{"created_at": post.CreatedAt, tenantField: tenantID},
+			}).
+			SetUpsert(true))
+	}
+
+	res, err := r.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+	if res != nil {
+		result.Inserted = res.UpsertedCount
+		result.Updated = res.MatchedCount
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && len(bulkErr.WriteErrors) > 0 {
+		for _, writeErr := range bulkErr.WriteErrors {
+			result.Failed[writeErr.Index] = errors.New(writeErr.Message)
+		}
+		return result, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *mongoPostRepository) FindIDs(ctx context.Context, filter PostFilter) ([]primitive.ObjectID, error) {
+	opts := options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.D{{Key: "_id", Value: 1}})
+	if filter.Limit > 0 {
+		opts.SetLimit(int64(filter.Limit))
+	}
+
+	cursor, err := r.collection.Find(ctx, scoped(ctx, filter.bson()), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var docs []struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+
+	ids := make([]primitive.ObjectID, len(docs))
+	for i, doc := range docs {
+		ids[i] = doc.ID
+	}
+	return ids, nil
+}
+
+func (r *mongoPostRepository) UpdateMany(ctx context.Context, filter PostFilter, changes PostChanges) (int64, error) {
+	if len(changes.AddTags) > 0 && len(changes.RemoveTags) > 0 {
+		return 0, errors.New("cannot add and remove tags in the same update")
+	}
+
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	applied := false
+
+	if changes.Status != "" {
+		set["status"] = changes.Status
+		applied = true
+	}
+	if len(changes.AddTags) > 0 {
+		update["$addToSet"] = bson.M{"tags": bson.M{"$each": changes.AddTags}}
+		applied = true
+	}
+	if len(changes.RemoveTags) > 0 {
+		update["$pull"] = bson.M{"tags": bson.M{"$in": changes.RemoveTags}}
+		applied = true
+	}
+	if !applied {
+		return 0, ErrNothingToApply
+	}
+
+	result, err := r.collection.UpdateMany(ctx, scoped(ctx, filter.bson()), update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *mongoPostRepository) DeleteMany(ctx context.Context, filter PostFilter) (int64, error) {
+	result, err := r.collection.DeleteMany(ctx, scoped(ctx, filter.bson()))
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoPostRepository) Version(ctx context.Context) (*CollectionVersion, error) {
+	opts := options.FindOne().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}}).
+		SetProjection(bson.M{"updated_at": 1})
+
+	var latest struct {
+		UpdatedAt time.Time `bson:"updated_at"`
+	}
+	err := r.collection.FindOne(ctx, scoped(ctx, nil), opts).Decode(&latest)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	count, err := r.collection.CountDocuments(ctx, scoped(ctx, nil))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CollectionVersion{LastModified: latest.UpdatedAt, Count: count}, nil
+}
 
-	filter := bson.M{
+// bson converts the filter into a MongoDB query document
+func (f PostFilter) bson() bson.M {
+	filter := pageFilter(PageQuery{
+		Search:      f.Search,
+		Language:    f.Language,
+		CreatedFrom: f.CreatedFrom,
+		CreatedTo:   f.CreatedTo,
+		Tags:        f.Tags,
+		Status:      f.Status,
+	}, false)
+	ids := bson.M{}
+	if f.IDs != nil {
+		ids["$in"] = f.IDs
+	}
+	if !f.After.IsZero() {
+		ids["$gt"] = f.After
+	}
+	if len(ids) > 0 {
+		filter["_id"] = ids
+	}
+	return filter
+}
+
+// textScoreField holds the text search score of a post while sorting by relevance
+const textScoreField = "_score"
+
+// sortKeys maps the sortable fields to document fields; it is the whitelist of sortable columns
+var sortKeys = map[SortField]string{
+	SortByCreated: "created_at",
+	SortByUpdated: "updated_at",
+	SortByTitle:   "title",
+}
+
+// titleCollation sorts titles case-insensitively
+var titleCollation = &options.Collation{Locale: "en", Strength: 2}
+
+// pageFilter builds the filter for a page query.
+// With relevance set, the search uses the text index so results can be scored.
+func pageFilter(query PageQuery, relevance bool) bson.M {
+	var conditions []bson.M
+
+	switch {
+	case relevance && query.Language != "":
+		// Stem the search terms like the text in that language was stemmed
+		conditions = append(conditions,
+			bson.M{"$text": bson.M{"$search": query.Search, "$language": textLanguage(query.Language)}},
+			languageFilter(query.Language),
+		)
+	case relevance:
+		conditions = append(conditions, bson.M{"$text": bson.M{"$search": query.Search}})
+	case query.Language != "" && query.Search != "":
+		conditions = append(conditions, languageSearchFilter(query.Search, query.Language))
+	case query.Language != "":
+		conditions = append(conditions, languageFilter(query.Language))
+	case query.Search != "":
+		conditions = append(conditions, searchFilter(query.Search))
+	}
+
+	created := bson.M{}
+	if !query.CreatedFrom.IsZero() {
+		created["$gte"] = query.CreatedFrom
+	}
+	if !query.CreatedTo.IsZero() {
+		created["$lt"] = query.CreatedTo
+	}
+	if len(created) > 0 {
+		conditions = append(conditions, bson.M{"created_at": created})
+	}
+
+	if len(query.Tags) > 0 {
+		conditions = append(conditions, bson.M{"tags": bson.M{"$all": query.Tags}})
+	}
+
+	if query.Status == model.StatusPublished {
+		// Posts created before statuses existed have none and count as published
+		conditions = append(conditions, bson.M{"status": bson.M{"$in": bson.A{model.StatusPublished, "", nil}}})
+	} else if query.Status != "" {
+		conditions = append(conditions, bson.M{"status": query.Status})
+	}
+
+	switch len(conditions) {
+	case 0:
+		return bson.M{}
+	case 1:
+		return conditions[0]
+	default:
+		return bson.M{"$and": conditions}
+	}
+}
+
+// pageSort builds the sort document for a page query.
+// Ties are broken by ID so pages don't overlap.
+func pageSort(query PageQuery, relevance bool) bson.D {
+	if relevance {
+		// Text scores can only be sorted highest first
+		return bson.D{
+			{Key: textScoreField, Value: -1},
+			{Key: "created_at", Value: -1},
+			{Key: "_id", Value: -1},
+		}
+	}
+
+	key, ok := sortKeys[query.SortBy]
+	if !ok {
+		key = sortKeys[SortByCreated]
+	}
+
+	direction := 1
+	if query.Descending {
+		direction = -1
+	}
+
+	return bson.D{
+		{Key: key, Value: direction},
+		{Key: "_id", Value: direction},
+	}
+}
+
+// searchFilter builds a case-insensitive filter on title and content in every language.
+// An empty query matches all posts.
+func searchFilter(query string) bson.M {
+	if query == "" {
+		return bson.M{}
+	}
+
+	pattern := searchPattern(query)
+	return bson.M{
 		"$or": []bson.M{
-			{"title": bson.M{"$regex": escapedQuery, "$options": "i"}},
-			{"content": bson.M{"$regex": escapedQuery, "$options": "i"}},
+			{"title": pattern},
+			{"content": pattern},
+			{"translations.title": pattern},
+			{"translations.content": pattern},
 		},
 	}
-	return r.collection.CountDocuments(ctx, filter)
+}
+
+// searchPattern builds a case-insensitive regular expression matching query literally
+func searchPattern(query string) bson.M {
+	// Escape special regex characters to prevent regex injection
+	return bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}
+}
+
+// originalLanguageFilter matches posts written in language.
+// Posts stored before languages existed have none and count as written in the default language.
+func originalLanguageFilter(language string) bson.M {
+	if language == model.DefaultLanguage {
+		return bson.M{"language": bson.M{"$in": bson.A{language, "", nil}}}
+	}
+	return bson.M{"language": language}
+}
+
+// languageFilter matches posts available in language, as the original or a translation
+func languageFilter(language string) bson.M {
+	return bson.M{"$or": []bson.M{
+		originalLanguageFilter(language),
+		{"translations.language": language},
+	}}
+}
+
+// languageSearchFilter matches posts whose title or content in language contains query, case-insensitively
+func languageSearchFilter(query, language string) bson.M {
+	pattern := searchPattern(query)
+	return bson.M{"$or": []bson.M{
+		{"$and": []bson.M{
+			originalLanguageFilter(language),
+			{"$or": []bson.M{{"title": pattern}, {"content": pattern}}},
+		}},
+		{"translations": bson.M{"$elemMatch": bson.M{
+			"language": language,
+			"$or":      []bson.M{{"title": pattern}, {"content": pattern}},
+		}}},
+	}}
+}
+
+// textLanguages maps language codes to the languages MongoDB text search can stem
+var textLanguages = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fi": "finnish",
+	"fr": "french",
+	"hu": "hungarian",
+	"it": "italian",
+	"nb": "norwegian",
+	"nl": "dutch",
+	"pt": "portuguese",
+	"ro": "romanian",
+	"ru": "russian",
+	"sv": "swedish",
+	"tr": "turkish",
+}
+
+// textLanguage returns the text search language for a language code.
+// Languages MongoDB can't stem, e.g. Ukrainian, are indexed word by word.
+func textLanguage(language string) string {
+	if name, ok := textLanguages[language]; ok {
+		return name
+	}
+	if name, ok := textLanguages[strings.SplitN(language, "-", 2)[0]]; ok {
+		return name
+	}
+	return "none"
+}
+
+// setTextLanguages sets the languages the text index uses for the post and its translations
+func setTextLanguages(post *model.Post) {
+	post.TextLanguage = textLanguage(post.OriginalLanguage())
+	for i := range post.Translations {
+		post.Translations[i].TextLanguage = textLanguage(post.Translations[i].Language)
+	}
 }
@@ -0,0 +1,22 @@
+package repository
+
+import "testing"
+
+func TestTextLanguage(t *testing.T) {
+	tests := []struct {
+		language string
+		want     string
+	}{
+		{"en", "english"},
+		{"de", "german"},
+		{"pt-br", "portuguese"},
+		{"uk", "none"},
+		{"", "none"},
+	}
+
+	for _, tt := range tests {
+		if got := textLanguage(tt.language); got != tt.want {
+			t.Errorf("textLanguage(%q) = %q, want %q", tt.language, got, tt.want)
+		}
+	}
+}
@@ -2,8 +2,11 @@ package repository
 
 import (
 	"context"
+	"strings"
+	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // PostRepository defines the interface for post data operations
@@ -16,4 +19,148 @@ type PostRepository interface {
 	Delete(ctx context.Context, id string) error
 	Count(ctx context.Context) (int64, error)
 	CountSearch(ctx context.Context, query string) (int64, error)
+	// FindPage returns one page of posts matching the query, ordered by its SortBy field and Descending flag,
+	// together with the total number of matching posts in a single round-trip
+	FindPage(ctx context.Context, query PageQuery) (*PostPage, error)
+	// Stream calls fn for every post matching the search query (all posts when the query is empty),
+	// oldest first, without loading the whole result set into memory.
+	Stream(ctx context.Context, query string, fn func(*model.Post) error) error
+	// BulkUpsert inserts or updates the given posts in a single bulk write.
+	// Posts are matched by ID when set, otherwise by slug; posts with neither are inserted.
+	BulkUpsert(ctx context.Context, posts []*model.Post) (*BulkUpsertResult, error)
+	// FindIDs returns the IDs of all posts matching the filter in ascending order
+	FindIDs(ctx context.Context, filter PostFilter) ([]primitive.ObjectID, error)
+	// UpdateMany applies the changes to all posts matching the filter and returns the number of modified posts
+	UpdateMany(ctx context.Context, filter PostFilter, changes PostChanges) (int64, error)
+	// DeleteMany deletes all posts matching the filter and returns the number of deleted posts
+	DeleteMany(ctx context.Context, filter PostFilter) (int64, error)
+	// Version returns the latest modification time and the number of posts,
+	// which together change whenever a post is created, updated or deleted
+	Version(ctx context.Context) (*CollectionVersion, error)
+	// RefreshTextLanguages sets the text search languages of posts whose stored ones don't match their languages,
+	// e.g. posts written by other tools, and returns the number of updated posts
+	RefreshTextLanguages(ctx context.Context) (int64, error)
+}
+
+// SortField is a field post lists can be sorted by
+type SortField string
+
+const (
+	SortByCreated SortField = "created"
+	SortByUpdated SortField = "updated"
+	SortByTitle   SortField = "title"
+	// SortByRelevance orders search results by text score, most relevant first.
+	// It matches whole words with the text index instead of substrings, and
+	// falls back to SortByCreated when there is no search query.
+	SortByRelevance SortField = "relevance"
+)
+
+// SortFields lists the fields post lists can be sorted by
+var SortFields = []SortField{SortByCreated, SortByUpdated, SortByTitle, SortByRelevance}
+
+// Valid reports whether the post list can be sorted by f
+func (f SortField) Valid() bool {
+	for _, field := range SortFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// PageQuery selects, filters and orders a page of posts
+type PageQuery struct {
+	// Search matches title or content, case-insensitively; empty matches every post
+	Search string
+	// Language restricts posts to those available in the language, as the original or a translation,
+	// and Search to their title and content in that language. Empty searches every language.
+	Language string
+	// CreatedFrom and CreatedTo restrict posts to those created in [CreatedFrom, CreatedTo).
+	// Zero values leave the range open.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	// Tags restricts posts to those having every tag
+	Tags []string
+	// Status restricts posts to a status; posts without one count as published
+	Status model.PostStatus
+
+	// SortBy defaults to SortByCreated
+	SortBy     SortField
+	Descending bool
+
+	Limit  int
+	Offset int
+	// EstimateTotal takes the total of unfiltered queries from collection metadata
+	// instead of counting documents, trading accuracy for speed on large collections
+	EstimateTotal bool
+}
+
+// Filtered reports whether the query restricts the posts in any way
+func (q PageQuery) Filtered() bool {
+	return q.Search != "" || q.Language != "" || !q.CreatedFrom.IsZero() || !q.CreatedTo.IsZero() || len(q.Tags) > 0 || q.Status != ""
+}
+
+// PostPage is a page of posts and the total number of posts matching the query
+type PostPage struct {
+	Posts []*model.Post
+	Total int64
+	// Estimated is set when Total is an estimate rather than an exact count
+	Estimated bool
+}
+
+// CollectionVersion identifies the state of the posts collection for HTTP caching
+type CollectionVersion struct {
+	LastModified time.Time
+	Count        int64
+}
+
+// PostFilter selects posts for bulk operations.
+// All set criteria must match; an empty filter matches every post.
+type PostFilter struct {
+	// IDs restricts the filter to the given posts when non-nil
+	IDs []primitive.ObjectID
+	// Search matches title or content case-insensitively, in any language unless Language is set
+	Search string
+	// Language, CreatedFrom, CreatedTo, Tags and Status restrict the posts like the PageQuery fields of the same name,
+	// so that a filtered list and a bulk action on it select the same posts
+	Language    string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Tags        []string
+	Status      model.PostStatus
+	// After restricts the filter to posts with greater IDs when set, to page through posts in ID order
+	After primitive.ObjectID
+	// Limit caps the number of IDs FindIDs returns when positive; writes ignore it
+	Limit int
+}
+
+// PostChanges describes a partial update applied to many posts at once.
+// Tags can't be added and removed in the same update.
+type PostChanges struct {
+	AddTags    []string
+	RemoveTags []string
+	Status     model.PostStatus
+}
+
+// String describes the changes, e.g. "add tags: go, mongo; status: archived"
+func (c PostChanges) String() string {
+	var parts []string
+	if len(c.AddTags) > 0 {
+		parts = append(parts, "add tags: "+strings.Join(c.AddTags, ", "))
+	}
+	if len(c.RemoveTags) > 0 {
+		parts = append(parts, "remove tags: "+strings.Join(c.RemoveTags, ", "))
+	}
+	if c.Status != "" {
+		parts = append(parts, "status: "+string(c.Status))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// BulkUpsertResult summarizes the outcome of a bulk upsert
+type BulkUpsertResult struct {
+	Inserted int64
+	Updated  int64
+	// Failed maps the index of a post in the input slice to the error that prevented writing it
+	Failed map[int]error
 }
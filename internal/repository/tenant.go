@@ -0,0 +1,32 @@
+package repository
+
+import (
+	"context"
+	"maps"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// tenantField is the document field holding the ID of the tenant a document belongs to
+const tenantField = "tenant_id"
+
+// scoped returns a copy of filter that only matches documents of the tenant carried by ctx.
+// Every query of a tenant's documents goes through it, so that no tenant can read or change another's.
+func scoped(ctx context.Context, filter bson.M) bson.M {
+	scopedFilter := maps.Clone(filter)
+	if scopedFilter == nil {
+		scopedFilter = bson.M{}
+	}
+	scopedFilter[tenantField] = tenantFilter(tenant.ID(ctx))
+	return scopedFilter
+}
+
+// tenantFilter matches the documents of the tenant with the given ID.
+// Documents stored before tenants existed have no tenant ID and belong to the default tenant.
+func tenantFilter(id string) any {
+	if id == tenant.DefaultID {
+		return bson.M{"$in": bson.A{id, "", nil}}
+	}
+	return id
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TokenCollection is the collection of API tokens
+const TokenCollection = "api_tokens"
+
+var ErrTokenNotFound = errors.New("API token not found")
+
+// TokenRepository stores API tokens. Tokens belong to the tenant of the context they are created in.
+type TokenRepository interface {
+	// Create stores a new token, assigning its ID
+	Create(ctx context.Context, token *model.APIToken) error
+	// FindByHash returns the token stored under the hash
+	FindByHash(ctx context.Context, hash string) (*model.APIToken, error)
+	// FindForUser returns the tokens of the user, newest first
+	FindForUser(ctx context.Context, userID primitive.ObjectID) ([]*model.APIToken, error)
+	// Delete removes the token with the ID if it belongs to the user, or returns ErrTokenNotFound
+	Delete(ctx context.Context, id, userID primitive.ObjectID) error
+	// Touch records that the token was used at the time
+	Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error
+}
+
+type mongoTokenRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoTokenRepository creates a new MongoDB API token repository
+func NewMongoTokenRepository(db *mongo.Database) TokenRepository {
+	return &mongoTokenRepository{
+		collection: db.Collection(TokenCollection),
+	}
+}
+
+func (r *mongoTokenRepository) Create(ctx context.Context, token *model.APIToken) error {
+	token.ID = primitive.NewObjectID()
+	token.TenantID = tenant.ID(ctx)
+
+	_, err := r.collection.InsertOne(ctx, token)
+	return err
+}
+
+func (r *mongoTokenRepository) FindByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	var token model.APIToken
+	err := r.collection.FindOne(ctx, scoped(ctx, bson.M{"hash": hash})).Decode(&token)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (r *mongoTokenRepository) FindForUser(ctx context.Context, userID primitive.ObjectID) ([]*model.APIToken, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+	cursor, err := r.collection.Find(ctx, scoped(ctx, bson.M{"user_id": userID}), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []*model.APIToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *mongoTokenRepository) Delete(ctx context.Context, id, userID primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id, "user_id": userID}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+func (r *mongoTokenRepository) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{"$set": bson.M{"last_used_at": at}})
+	return err
+}
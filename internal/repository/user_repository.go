@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections of users and their sessions
+const (
+	UserCollection    = "users"
+	SessionCollection = "sessions"
+)
+
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrUsernameTaken   = errors.New("a user with the same name already exists")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// UserRepository stores users. Users belong to the tenant of the context they are created in.
+type UserRepository interface {
+	// Create stores a new user, assigning its ID, or returns ErrUsernameTaken
+	Create(ctx context.Context, user *model.User) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error)
+	FindByUsername(ctx context.Context, username string) (*model.User, error)
+	// FindByOIDCSubject returns the user created by single sign-on for the subject at the OpenID Connect issuer
+	FindByOIDCSubject(ctx context.Context, issuer, subject string) (*model.User, error)
+	// FindAll returns every user, ordered by user name
+	FindAll(ctx context.Context) ([]*model.User, error)
+	// CountByRole returns the number of users with the role
+	CountByRole(ctx context.Context, role model.Role) (int64, error)
+	SetRole(ctx context.Context, id primitive.ObjectID, role model.Role) error
+	SetPasswordHash(ctx context.Context, id primitive.ObjectID, hash string) error
+}
+
+// SessionRepository stores the sessions of signed-in users. Sessions belong to the tenant of the context they are
+// created in, so that a session of one tenant doesn't sign in to another served from the same host.
+type SessionRepository interface {
+	Create(ctx context.Context, session *model.Session) error
+	// Find returns the session with the ID unless it expired before now
+	Find(ctx context.Context, id string, now time.Time) (*model.Session, error)
+	Delete(ctx context.Context, id string) error
+	// DeleteForUser ends every session of the user, e.g. after their password changed
+	DeleteForUser(ctx context.Context, userID primitive.ObjectID) error
+}
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoUserRepository creates a new MongoDB user repository
+func NewMongoUserRepository(db *mongo.Database) UserRepository {
+	return &mongoUserRepository{
+		collection: db.Collection(UserCollection),
+	}
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *model.User) error {
+	now := time.Now()
+	user.ID = primitive.NewObjectID()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	user.TenantID = tenant.ID(ctx)
+
+	_, err := r.collection.InsertOne(ctx, user)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrUsernameTaken
+	}
+	return err
+}
+
+func (r *mongoUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoUserRepository) FindByUsername(ctx context.Context, username string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"username": username})
+}
+
+func (r *mongoUserRepository) FindByOIDCSubject(ctx context.Context, issuer, subject string) (*model.User, error) {
+	return r.findOne(ctx, bson.M{"oidc_issuer": issuer, "oidc_subject": subject})
+}
+
+func (r *mongoUserRepository) FindAll(ctx context.Context) ([]*model.User, error) {
+	cursor, err := r.collection.Find(ctx, scoped(ctx, nil), options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []*model.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) CountByRole(ctx context.Context, role model.Role) (int64, error) {
+	return r.collection.CountDocuments(ctx, scoped(ctx, bson.M{"role": role}))
+}
+
+func (r *mongoUserRepository) SetRole(ctx context.Context, id primitive.ObjectID, role model.Role) error {
+	return r.update(ctx, id, bson.M{"role": role})
+}
+
+func (r *mongoUserRepository) SetPasswordHash(ctx context.Context, id primitive.ObjectID, hash string) error {
+	return r.update(ctx, id, bson.M{"password_hash": hash})
+}
+
+// findOne returns the user of the tenant of ctx matching filter
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*model.User, error) {
+	var user model.User
+	err := r.collection.FindOne(ctx, scoped(ctx, filter)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// update sets fields of the user of the tenant of ctx with the ID
+func (r *mongoUserRepository) update(ctx context.Context, id primitive.ObjectID, fields bson.M) error {
+	fields["updated_at"] = time.Now()
+	result, err := r.collection.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{"$set": fields})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+type mongoSessionRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoSessionRepository creates a new MongoDB session repository
+func NewMongoSessionRepository(db *mongo.Database) SessionRepository {
+	return &mongoSessionRepository{
+		collection: db.Collection(SessionCollection),
+	}
+}
+
+func (r *mongoSessionRepository) Create(ctx context.Context, session *model.Session) error {
+	session.TenantID = tenant.ID(ctx)
+
+	_, err := r.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (r *mongoSessionRepository) Find(ctx context.Context, id string, now time.Time) (*model.Session, error) {
+	// Expired sessions are removed by a TTL index, which runs about once a minute
+	filter := scoped(ctx, bson.M{"_id": id, "expires_at": bson.M{"$gt": now}})
+
+	var session model.Session
+	err := r.collection.FindOne(ctx, filter).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (r *mongoSessionRepository) Delete(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id}))
+	return err
+}
+
+func (r *mongoSessionRepository) DeleteForUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, scoped(ctx, bson.M{"user_id": userID}))
+	return err
+}
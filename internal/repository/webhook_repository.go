@@ -0,0 +1,303 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("delivery not found")
+)
+
+// WebhookRepository stores webhook subscriptions. Webhooks belong to the tenant of the context they are created in.
+type WebhookRepository interface {
+	Create(ctx context.Context, webhook *model.Webhook) error
+	// FindAll returns every webhook, oldest first
+	FindAll(ctx context.Context) ([]*model.Webhook, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error)
+	// FindSubscribed returns the active webhooks subscribed to events of type t
+	FindSubscribed(ctx context.Context, t model.EventType) ([]*model.Webhook, error)
+	SetActive(ctx context.Context, id primitive.ObjectID, active bool) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// DeliveryRepository stores webhook deliveries and hands due ones to workers
+type DeliveryRepository interface {
+	// Enqueue stores new deliveries, assigning IDs to those without one and the tenant of ctx to those without a tenant.
+	// Deliveries of an event its webhook already has a delivery of are skipped.
+	Enqueue(ctx context.Context, deliveries ...*model.Delivery) error
+	// ClaimDue returns the pending delivery, of any tenant, that has been due the longest and postpones it by lease,
+	// so that other workers skip it while it is attempted. It returns nil when no delivery is due.
+	// A delivery whose worker dies is attempted again once the lease expires.
+	ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.Delivery, error)
+	// SaveAttempt stores the outcome of an attempt: the status, attempts, next attempt, last error and delivery time
+	SaveAttempt(ctx context.Context, delivery *model.Delivery) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (*model.Delivery, error)
+	// FindPage returns one page of deliveries matching the filter, newest first, and the number of matching deliveries
+	FindPage(ctx context.Context, filter DeliveryFilter, limit, offset int) (*DeliveryPage, error)
+	// Requeue makes a delivery pending again, due at now, with its attempts reset
+	Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) error
+}
+
+// DeliveryFilter selects deliveries. All set criteria must match; an empty filter matches every delivery.
+type DeliveryFilter struct {
+	WebhookID primitive.ObjectID
+	Status    model.DeliveryStatus
+}
+
+// DeliveryPage is a page of deliveries and the total number of deliveries matching the filter
+type DeliveryPage struct {
+	Deliveries []*model.Delivery
+	Total      int64
+}
+
+type mongoWebhookRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoWebhookRepository creates a new MongoDB webhook repository
+func NewMongoWebhookRepository(db *mongo.Database) WebhookRepository {
+	return &mongoWebhookRepository{
+		collection: db.Collection("webhooks"),
+	}
+}
+
+func (r *mongoWebhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.TenantID = tenant.ID(ctx)
+
+	_, err := r.collection.InsertOne(ctx, webhook)
+	return err
+}
+
+func (r *mongoWebhookRepository) FindAll(ctx context.Context) ([]*model.Webhook, error) {
+	return r.find(ctx, nil)
+}
+
+func (r *mongoWebhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error) {
+	var webhook model.Webhook
+	err := r.collection.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&webhook)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &webhook, nil
+}
+
+func (r *mongoWebhookRepository) FindSubscribed(ctx context.Context, t model.EventType) ([]*model.Webhook, error) {
+	return r.find(ctx, bson.M{"active": true, "events": t})
+}
+
+func (r *mongoWebhookRepository) SetActive(ctx context.Context, id primitive.ObjectID, active bool) error {
+	result, err := r.collection.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), bson.M{"$set": bson.M{"active": active}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *mongoWebhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, scoped(ctx, bson.M{"_id": id}))
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// find returns the webhooks of the tenant of ctx matching filter, oldest first
+func (r *mongoWebhookRepository) find(ctx context.Context, filter bson.M) ([]*model.Webhook, error) {
+	cursor, err := r.collection.Find(ctx, scoped(ctx, filter), options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	webhooks := []*model.Webhook{}
+	if err := cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+type mongoDeliveryRepository struct {
+	collection *mongo.Collection
+}
+
+// NewMongoDeliveryRepository creates a new MongoDB webhook delivery repository
+func NewMongoDeliveryRepository(db *mongo.Database) DeliveryRepository {
+	return &mongoDeliveryRepository{
+		collection: db.Collection("webhook_deliveries"),
+	}
+}
+
+func (r *mongoDeliveryRepository) Enqueue(ctx context.Context, deliveries ...*model.Delivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	documents := make([]interface{}, len(deliveries))
+	for i, delivery := range deliveries {
+		if delivery.ID.IsZero() {
+			delivery.ID = primitive.NewObjectID()
+		}
+		if delivery.TenantID == "" {
+			delivery.TenantID = tenant.ID(ctx)
+		}
+		documents[i] = delivery
+	}
+
+	// Unordered, so that a delivery enqueued before doesn't keep the others from being inserted
+	_, err := r.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if onlyDuplicates(err) {
+		return nil
+	}
+	return err
+}
+
+func (r *mongoDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.Delivery, error) {
+	filter := bson.M{
+		"status":          model.DeliveryPending,
+		"next_attempt_at": bson.M{"$lte": now},
+	}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery model.Delivery
+	err := r.collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *mongoDeliveryRepository) SaveAttempt(ctx context.Context, delivery *model.Delivery) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":           delivery.Status,
+			"attempts":         delivery.Attempts,
+			"next_attempt_at":  delivery.NextAttemptAt,
+			"last_error":       delivery.LastError,
+			"last_status_code": delivery.LastStatusCode,
+			"delivered_at":     delivery.DeliveredAt,
+		},
+	}
+
+	result, err := r.collection.UpdateByID(ctx, delivery.ID, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+func (r *mongoDeliveryRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Delivery, error) {
+	var delivery model.Delivery
+	err := r.collection.FindOne(ctx, scoped(ctx, bson.M{"_id": id})).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &delivery, nil
+}
+
+func (r *mongoDeliveryRepository) FindPage(ctx context.Context, filter DeliveryFilter, limit, offset int) (*DeliveryPage, error) {
+	query := scoped(ctx, filter.bson())
+
+	total, err := r.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(int64(limit)).
+		SetSkip(int64(offset))
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	deliveries := []*model.Delivery{}
+	if err := cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return &DeliveryPage{Deliveries: deliveries, Total: total}, nil
+}
+
+func (r *mongoDeliveryRepository) Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	update := bson.M{
+		"$set": bson.M{
+			"status":          model.DeliveryPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+		},
+	}
+
+	result, err := r.collection.UpdateOne(ctx, scoped(ctx, bson.M{"_id": id}), update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrDeliveryNotFound
+	}
+	return nil
+}
+
+// bson converts the filter into a MongoDB query document
+func (f DeliveryFilter) bson() bson.M {
+	query := bson.M{}
+	if !f.WebhookID.IsZero() {
+		query["webhook_id"] = f.WebhookID
+	}
+	if f.Status != "" {
+		query["status"] = f.Status
+	}
+	return query
+}
+
+// duplicateKeyCode is the MongoDB error code of unique index violations
+const duplicateKeyCode = 11000
+
+// onlyDuplicates reports whether err is a bulk write error made only of duplicate key errors
+func onlyDuplicates(err error) bool {
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || len(bulkErr.WriteErrors) == 0 || bulkErr.WriteConcernError != nil {
+		return false
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		if writeErr.Code != duplicateKeyCode {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package seed
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/transfer"
+)
+
+// fixtureFiles holds the fixture sets as JSON Lines, in the format of the admin CLI's export
+//
+//go:embed fixtures/*.jsonl
+var fixtureFiles embed.FS
+
+// ErrUnknownFixture is returned for fixture sets that don't exist
+var ErrUnknownFixture = errors.New("unknown fixture set")
+
+// FixtureNames returns the names of the fixture sets, sorted
+func FixtureNames() []string {
+	entries, err := fs.ReadDir(fixtureFiles, "fixtures")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())))
+	}
+	return names
+}
+
+// Fixture returns the posts of the named fixture set.
+// Fixture posts have fixed IDs, so loading a set again updates its posts instead of adding duplicates.
+func Fixture(name string) ([]*model.Post, error) {
+	var file fs.File
+	err := fs.ErrNotExist
+	if !strings.ContainsAny(name, "/.") {
+		file, err = fixtureFiles.Open("fixtures/" + name + ".jsonl")
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w %q, expected one of %s", ErrUnknownFixture, name, strings.Join(FixtureNames(), ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder, err := transfer.NewDecoder(file, transfer.FormatJSONL)
+	if err != nil {
+		return nil, err
+	}
+	var posts []*model.Post
+	for {
+		record, err := decoder.Next()
+		if err == io.EOF {
+			return posts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if record.Err != nil {
+			return nil, fmt.Errorf("fixture set %s, line %d: %w", name, record.Line, record.Err)
+		}
+		posts = append(posts, record.Post)
+	}
+}
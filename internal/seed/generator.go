@@ -0,0 +1,214 @@
+// Package seed generates fake posts and provides named fixture sets for development, demos and tests
+package seed
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultSpan is the period creation times of generated posts are spread over when no span is given
+const DefaultSpan = 365 * 24 * time.Hour
+
+// Options configures generated posts
+type Options struct {
+	// Count is the number of posts to generate
+	Count int
+	// Seed makes generation deterministic: the same seed, options and end time give the same posts
+	Seed int64
+	// Limits bounds the length of titles and content and the number of tags; zero limits mean model.DefaultLimits.
+	// Content is at most model.DefaultLimits.ContentMax characters when the limits leave it unbounded.
+	Limits model.Limits
+	// End is the latest creation time; zero means the start of the current day in UTC
+	End time.Time
+	// Span is the period before End creation times are spread over; zero means DefaultSpan
+	Span time.Duration
+}
+
+// Generate returns opts.Count posts with English titles and content of varying length, tags and statuses.
+// Recent days get more posts than older ones, and some posts were updated after their creation.
+// The posts have IDs, so that loading them again with the same options updates them instead of adding duplicates.
+func Generate(opts Options) []*model.Post {
+	g := newGenerator(opts)
+	posts := make([]*model.Post, opts.Count)
+	for i := range posts {
+		posts[i] = g.post()
+	}
+	return posts
+}
+
+type generator struct {
+	rand   *rand.Rand
+	limits model.Limits
+	end    time.Time
+	span   time.Duration
+}
+
+func newGenerator(opts Options) *generator {
+	g := &generator{
+		rand:   rand.New(rand.NewSource(opts.Seed)),
+		limits: opts.Limits,
+		end:    opts.End,
+		span:   opts.Span,
+	}
+	if g.limits == (model.Limits{}) {
+		g.limits = model.DefaultLimits
+	}
+	if g.limits.TitleMax <= 0 {
+		g.limits.TitleMax = model.DefaultLimits.TitleMax
+	}
+	if g.limits.ContentMax <= 0 {
+		g.limits.ContentMax = model.DefaultLimits.ContentMax
+	}
+	if g.end.IsZero() {
+		g.end = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if g.span <= 0 {
+		g.span = DefaultSpan
+	}
+	return g
+}
+
+// post generates the next post; the order of random draws is fixed, so a seed always gives the same posts
+func (g *generator) post() *model.Post {
+	// Squaring the fraction puts more posts close to the end
+	age := g.rand.Float64()
+	created := g.end.Add(-time.Duration(age * age * float64(g.span))).Truncate(time.Second)
+	updated := created
+	if g.rand.Intn(10) < 3 {
+		updated = created.Add(time.Duration(g.rand.Int63n(int64(g.end.Sub(created)) + 1))).Truncate(time.Second)
+	}
+
+	post := &model.Post{ID: g.objectID(created), CreatedAt: created, UpdatedAt: updated}
+	post.Title = g.title()
+	post.Content = g.content()
+	post.Tags = g.tags()
+	post.Status = g.status()
+	return post
+}
+
+// objectID returns an ObjectID of the creation time, like the ID MongoDB would have given the post
+func (g *generator) objectID(created time.Time) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[0:4], uint32(created.Unix()))
+	binary.BigEndian.PutUint64(id[4:12], g.rand.Uint64())
+	return id
+}
+
+// title returns a headline, now and then a long one close to the title limit
+func (g *generator) title() string {
+	title := g.pick(subjects) + " " + g.pick(verbs) + " " + g.pick(objects)
+	if g.rand.Intn(10) < 4 {
+		title += " " + g.pick(circumstances)
+	}
+	long := g.rand.Intn(20) == 0
+	for len(title) < g.limits.TitleMin || (long && len(title) < g.limits.TitleMax) {
+		title += ", " + g.pick(circumstances)
+	}
+	return truncate(title, g.limits.TitleMax, g.limits.TitleMin)
+}
+
+// content returns paragraphs of news-like sentences: mostly short articles, some longer ones
+// and a few close to the content limit
+func (g *generator) content() string {
+	limit := g.limits.ContentMax
+	var lower, upper int
+	switch n := g.rand.Intn(10); {
+	case n < 6:
+		lower, upper = 200, 1500
+	case n < 9:
+		lower, upper = 1500, 4000
+	default:
+		lower, upper = 4000, limit
+	}
+	upper = min(upper, limit)
+	lower = min(lower, upper)
+	// Some room above the minimum lets the content end with a whole word
+	target := max(lower+g.rand.Intn(upper-lower+1), min(g.limits.ContentMin+100, limit))
+
+	var b strings.Builder
+	for b.Len() < target {
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(g.paragraph())
+	}
+	return truncate(b.String(), min(target, limit), g.limits.ContentMin)
+}
+
+// paragraph returns two to six sentences
+func (g *generator) paragraph() string {
+	sentences := make([]string, 2+g.rand.Intn(5))
+	for i := range sentences {
+		sentences[i] = g.sentence()
+	}
+	return strings.Join(sentences, " ")
+}
+
+func (g *generator) sentence() string {
+	switch g.rand.Intn(6) {
+	case 0:
+		return fmt.Sprintf("%s said the %s would %s %s.", g.pick(subjects), g.pick(nouns), g.pick(actions), g.pick(timeframes))
+	case 1:
+		return fmt.Sprintf("According to %s, %d %s %s the %s last %s.", g.pick(sources), 10+g.rand.Intn(4990), g.pick(people), g.pick(reactions), g.pick(nouns), g.pick(periods))
+	case 2:
+		return fmt.Sprintf("Officials expect the %s to %s by %s.", g.pick(nouns), g.pick(actions), g.pick(months))
+	case 3:
+		return fmt.Sprintf("Critics argue that the %s cannot %s without more %s.", g.pick(nouns), g.pick(actions), g.pick(resources))
+	case 4:
+		return fmt.Sprintf("The %s has been discussed since %d, when %s first raised it.", g.pick(nouns), 2005+g.rand.Intn(18), strings.ToLower(g.pick(subjects)))
+	default:
+		return fmt.Sprintf("\"We want the %s to %s %s,\" said a spokesperson for %s.", g.pick(nouns), g.pick(actions), g.pick(timeframes), strings.ToLower(g.pick(subjects)))
+	}
+}
+
+// tags returns up to four distinct tags, within the tag limit
+func (g *generator) tags() []string {
+	count := g.rand.Intn(5)
+	if g.limits.MaxTags > 0 {
+		count = min(count, g.limits.MaxTags)
+	}
+	tags := make([]string, 0, count)
+	for _, i := range g.rand.Perm(len(tagPool))[:count] {
+		tags = append(tags, tagPool[i])
+	}
+	return tags
+}
+
+// status returns published for most posts, then draft and archived
+func (g *generator) status() model.PostStatus {
+	switch n := g.rand.Intn(100); {
+	case n < 80:
+		return model.StatusPublished
+	case n < 92:
+		return model.StatusDraft
+	default:
+		return model.StatusArchived
+	}
+}
+
+func (g *generator) pick(words []string) string {
+	return words[g.rand.Intn(len(words))]
+}
+
+// truncate shortens ASCII text to at most maxLength characters, cutting after the last full sentence
+// or else the last word that keeps it at least minLength characters long
+func truncate(text string, maxLength, minLength int) string {
+	if len(text) <= maxLength {
+		return text
+	}
+	// Looking one character past the limit finds sentences and words that end right at it
+	end := text[:maxLength+1]
+	if cut := max(strings.LastIndex(end, ". "), strings.LastIndex(end, ".\n")) + 1; cut > 0 && cut >= minLength {
+		return text[:cut]
+	}
+	if cut := strings.LastIndexAny(end, " \n"); cut > minLength {
+		return strings.TrimRight(text[:cut], ", \n")
+	}
+	return text[:maxLength]
+}
@@ -0,0 +1,135 @@
+package seed
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	end := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	first := Generate(Options{Count: 50, Seed: 42, End: end})
+	second := Generate(Options{Count: 50, Seed: 42, End: end})
+	if !reflect.DeepEqual(first, second) {
+		t.Error("Generate() with the same seed returned different posts")
+	}
+
+	other := Generate(Options{Count: 50, Seed: 43, End: end})
+	if reflect.DeepEqual(first, other) {
+		t.Error("Generate() with another seed returned the same posts")
+	}
+}
+
+func TestGenerateRespectsLimits(t *testing.T) {
+	end := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		limits model.Limits
+	}{
+		{name: "default limits", limits: model.Limits{}},
+		{name: "tight limits", limits: model.Limits{TitleMin: 30, TitleMax: 40, ContentMin: 100, ContentMax: 300, MaxTags: 1}},
+		{name: "long minimums", limits: model.Limits{TitleMin: 150, TitleMax: 200, ContentMin: 5000, ContentMax: 6000, MaxTags: 20}},
+		{name: "unbounded content", limits: model.Limits{TitleMax: 100, MaxTags: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limits := tt.limits
+			if limits == (model.Limits{}) {
+				limits = model.DefaultLimits
+			}
+
+			posts := Generate(Options{Count: 200, Seed: 7, Limits: tt.limits, End: end, Span: 30 * 24 * time.Hour})
+			for _, post := range posts {
+				if errs := post.ValidateLimits(limits); len(errs) > 0 {
+					t.Fatalf("post %q is invalid: %v", post.Title, errs)
+				}
+				if post.CreatedAt.Before(end.Add(-30*24*time.Hour)) || post.CreatedAt.After(end) {
+					t.Errorf("CreatedAt = %v, want within the 30 days before %v", post.CreatedAt, end)
+				}
+				if post.UpdatedAt.Before(post.CreatedAt) || post.UpdatedAt.After(end) {
+					t.Errorf("UpdatedAt = %v, want between CreatedAt %v and %v", post.UpdatedAt, post.CreatedAt, end)
+				}
+				if !post.ID.Timestamp().Equal(post.CreatedAt) {
+					t.Errorf("ID time = %v, want CreatedAt %v", post.ID.Timestamp(), post.CreatedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateVaries(t *testing.T) {
+	posts := Generate(Options{Count: 1000, Seed: 1})
+
+	statuses := map[model.PostStatus]int{}
+	var untagged, longContent, longTitles, updated int
+	ids := map[string]bool{}
+	for _, post := range posts {
+		statuses[post.Status]++
+		if len(post.Tags) == 0 {
+			untagged++
+		}
+		if len(post.Content) > 9000 {
+			longContent++
+		}
+		if len(post.Title) > 150 {
+			longTitles++
+		}
+		if post.UpdatedAt.After(post.CreatedAt) {
+			updated++
+		}
+		ids[post.ID.Hex()] = true
+	}
+
+	for _, status := range model.PostStatuses {
+		if statuses[status] == 0 {
+			t.Errorf("no %s posts were generated", status)
+		}
+	}
+	if untagged == 0 || longContent == 0 || longTitles == 0 || updated == 0 {
+		t.Errorf("got %d untagged posts, %d with long content, %d with long titles and %d updated, want some of each", untagged, longContent, longTitles, updated)
+	}
+	if len(ids) != len(posts) {
+		t.Errorf("generated %d distinct IDs for %d posts", len(ids), len(posts))
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	names := FixtureNames()
+	if !reflect.DeepEqual(names, []string{"demo", "translations"}) {
+		t.Errorf("FixtureNames() = %v, want [demo translations]", names)
+	}
+
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			posts, err := Fixture(name)
+			if err != nil {
+				t.Fatalf("Fixture() error = %v", err)
+			}
+			if len(posts) == 0 {
+				t.Fatal("Fixture() returned no posts")
+			}
+			ids := map[string]bool{}
+			for _, post := range posts {
+				if err := post.Validate(); err != nil {
+					t.Errorf("post %q is invalid: %v", post.Title, err)
+				}
+				if post.ID.IsZero() || ids[post.ID.Hex()] {
+					t.Errorf("post %q has a missing or duplicate ID", post.Title)
+				}
+				ids[post.ID.Hex()] = true
+			}
+		})
+	}
+
+	for _, name := range []string{"missing", "../fixtures/demo", "demo.jsonl"} {
+		if _, err := Fixture(name); !errors.Is(err, ErrUnknownFixture) {
+			t.Errorf("Fixture(%q) error = %v, want ErrUnknownFixture", name, err)
+		}
+	}
+}
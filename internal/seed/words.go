@@ -0,0 +1,63 @@
+package seed
+
+// Vocabulary of generated posts. Words are ASCII, so that lengths in bytes are lengths in characters.
+var (
+	subjects = []string{
+		"City council", "Local startup", "University researchers", "National bank", "Health ministry",
+		"Tech company", "Football club", "Climate activists", "Regional airline", "School board",
+		"Film festival", "Energy regulator", "City museum", "Farmers union", "Transport workers",
+		"Space agency", "Hospital staff", "Tourism board", "Housing association", "Chamber of commerce",
+	}
+	verbs = []string{
+		"approves", "announces", "delays", "unveils", "rejects", "expands", "reviews",
+		"launches", "questions", "celebrates", "cuts", "invests in", "backs", "pauses",
+	}
+	objects = []string{
+		"new budget", "plans for a second campus", "record harvest", "electric bus fleet", "data privacy rules",
+		"summer schedule", "renewable energy project", "housing reform", "quarterly results", "cycling network",
+		"vaccination campaign", "exhibition of modern art", "water supply upgrade", "night train service",
+		"youth sports program", "satellite launch", "tax relief package", "river clean-up", "free museum days",
+	}
+	circumstances = []string{
+		"after long debate", "amid rising costs", "ahead of elections", "despite protests", "for the first time",
+		"in record time", "as demand grows", "after public consultation", "following a court ruling",
+		"with support from neighbors", "as the winter approaches", "under pressure from residents",
+	}
+	nouns = []string{
+		"project", "proposal", "program", "budget", "plan", "agreement", "initiative", "reform",
+		"investment", "schedule", "partnership", "pilot", "study", "campaign", "contract",
+	}
+	actions = []string{
+		"create hundreds of jobs", "reduce waiting times", "cut emissions", "attract new visitors",
+		"lower energy bills", "improve safety", "support small businesses", "go ahead as planned",
+		"take longer than expected", "cost more than estimated", "reach rural areas", "pay for itself",
+	}
+	timeframes = []string{
+		"within two years", "before the end of the year", "next spring", "over the coming decade",
+		"by the summer", "in several phases", "as soon as funding is approved", "later this month",
+	}
+	sources = []string{
+		"a recent survey", "official figures", "the local newspaper", "an independent report",
+		"data published on Monday", "the organizers", "industry analysts", "a parliamentary committee",
+	}
+	people = []string{
+		"residents", "students", "commuters", "visitors", "employees", "volunteers", "parents", "shop owners",
+	}
+	reactions = []string{
+		"signed a petition against", "welcomed", "asked questions about", "took part in",
+		"complained about", "applied for", "voted on", "volunteered for",
+	}
+	periods = []string{"week", "month", "year", "season", "quarter"}
+	months  = []string{
+		"January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December",
+	}
+	resources = []string{
+		"funding", "staff", "public support", "space", "time", "data", "volunteers", "equipment",
+	}
+	tagPool = []string{
+		"politics", "economy", "tech", "science", "health", "sports", "culture", "climate",
+		"education", "transport", "energy", "local", "world", "business", "housing", "film",
+		"music", "space", "agriculture", "startups", "elections", "weather", "travel", "opinion",
+	}
+)
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// AnonymousActor identifies changes made over HTTP by visitors who aren't signed in
+	AnonymousActor = "anonymous"
+	// SystemActor identifies changes made without an actor in the context
+	SystemActor = "system"
+)
+
+// Actor identifies who performs a change, for the audit log, and the role that allows it
+type Actor struct {
+	ID        string
+	Role      model.Role
+	IP        string
+	RequestID string
+	// Scopes limit the role's permissions when the actor calls the API with a token; nil allows all of them
+	Scopes []model.TokenScope
+}
+
+type actorKey struct{}
+
+// WithActor returns a copy of ctx carrying the actor that changes made with it are attributed to
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor carried by ctx, or SystemActor if there is none.
+// Changes without an actor are made by the application itself, which may do everything.
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok && actor.ID != "" {
+		return actor
+	}
+	return Actor{ID: SystemActor, Role: model.RoleAdmin}
+}
+
+// WithAuditLog records every created, updated, deleted and imported post in the audit log
+func WithAuditLog(repo repository.AuditRepository) Option {
+	return func(s *PostService) {
+		s.audit = repo
+	}
+}
+
+// record stamps the entries with the time and the actor from ctx and appends them to the audit log, if any.
+// The change is already written by then, so a failure is logged rather than returned.
+func (s *PostService) record(ctx context.Context, entries ...*model.AuditEntry) {
+	if s.audit == nil || len(entries) == 0 {
+		return
+	}
+
+	actor := ActorFrom(ctx)
+	now := time.Now()
+	for _, entry := range entries {
+		entry.Time = now
+		entry.Actor = actor.ID
+		entry.IP = actor.IP
+		entry.RequestID = actor.RequestID
+	}
+
+	// Record changes even when the request was canceled right after they were written
+	if err := s.audit.Append(context.WithoutCancel(ctx), entries...); err != nil {
+		slog.Error("Failed to write audit log", "error", err, "entries", len(entries), "actor", actor.ID, "requestId", actor.RequestID)
+	}
+}
+
+// snapshot returns a copy of post that later changes to post don't affect, or nil for nil
+func snapshot(post *model.Post) *model.Post {
+	if post == nil {
+		return nil
+	}
+	copied := *post
+	copied.Tags = append([]string(nil), post.Tags...)
+	copied.Translations = append([]model.Translation(nil), post.Translations...)
+	return &copied
+}
+
+// AuditService browses and exports the audit log
+type AuditService struct {
+	repo repository.AuditRepository
+}
+
+// NewAuditService creates a new audit log service
+func NewAuditService(repo repository.AuditRepository) *AuditService {
+	return &AuditService{repo: repo}
+}
+
+// AuditQuery selects audit entries; empty fields match every entry
+type AuditQuery struct {
+	Action string
+	PostID string
+	Actor  string
+	// From and To restrict entries to those recorded in [From, To)
+	From time.Time
+	To   time.Time
+
+	Page     int
+	PageSize int
+}
+
+// filter validates the query and converts it into a repository filter
+func (q AuditQuery) filter() (repository.AuditFilter, error) {
+	filter := repository.AuditFilter{
+		Action: model.AuditAction(q.Action),
+		Actor:  strings.TrimSpace(q.Actor),
+		From:   q.From,
+		To:     q.To,
+	}
+
+	if filter.Action != "" && !filter.Action.Valid() {
+		return filter, fmt.Errorf("%w: unknown audit action %q", ErrValidationFailed, q.Action)
+	}
+	if postID := strings.TrimSpace(q.PostID); postID != "" {
+		id, err := primitive.ObjectIDFromHex(postID)
+		if err != nil {
+			return filter, ErrInvalidID
+		}
+		filter.PostID = id
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.To.After(q.From) {
+		return filter, fmt.Errorf("%w: the date range is empty", ErrValidationFailed)
+	}
+	return filter, nil
+}
+
+// Validate reports whether the query's filters are valid, with the error ListEntries and ExportEntries would return
+func (q AuditQuery) Validate() error {
+	_, err := q.filter()
+	return err
+}
+
+// ListEntries retrieves a page of audit entries matching the query, newest first.
+// Page numbers and sizes are adjusted like in GetPosts.
+func (s *AuditService) ListEntries(ctx context.Context, query AuditQuery) ([]*model.AuditEntry, Pagination, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = 10
+	}
+	if query.PageSize > 100 {
+		query.PageSize = 100
+	}
+
+	filter, err := query.filter()
+	if err != nil {
+		return nil, Pagination{}, err
+	}
+
+	page, err := s.repo.FindPage(ctx, filter, query.PageSize, (query.Page-1)*query.PageSize)
+	if err != nil {
+		return nil, Pagination{}, translate(err)
+	}
+
+	return page.Entries, NewPagination(query.Page, query.PageSize, page.Total), nil
+}
+
+// ExportEntries streams every audit entry matching the query to w as JSON Lines, oldest first.
+// Paging fields of the query are ignored. Returns the number of exported entries.
+func (s *AuditService) ExportEntries(ctx context.Context, w io.Writer, query AuditQuery) (int, error) {
+	filter, err := query.filter()
+	if err != nil {
+		return 0, err
+	}
+
+	writer := bufio.NewWriter(w)
+	encoder := json.NewEncoder(writer)
+	count := 0
+	err = s.repo.Stream(ctx, filter, func(entry *model.AuditEntry) error {
+		count++
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, writer.Flush()
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockAuditRepository keeps appended audit entries in memory
+type mockAuditRepository struct {
+	entries   []*model.AuditEntry
+	appendErr error
+}
+
+func (m *mockAuditRepository) Append(ctx context.Context, entries ...*model.AuditEntry) error {
+	if m.appendErr != nil {
+		return m.appendErr
+	}
+	m.entries = append(m.entries, entries...)
+	return nil
+}
+
+func (m *mockAuditRepository) FindPage(ctx context.Context, filter repository.AuditFilter, limit, offset int) (*repository.AuditPage, error) {
+	return &repository.AuditPage{Entries: m.entries, Total: int64(len(m.entries))}, nil
+}
+
+func (m *mockAuditRepository) Stream(ctx context.Context, filter repository.AuditFilter, fn func(*model.AuditEntry) error) error {
+	for _, entry := range m.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAuditLogRecordsChanges(t *testing.T) {
+	stored := model.NewPost("Title", "Content")
+	stored.ID = primitive.NewObjectID()
+	repo := &mockPostRepository{
+		findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+			post := *stored
+			return &post, nil
+		},
+	}
+	audit := &mockAuditRepository{}
+	service := NewPostService(repo, WithAuditLog(audit))
+
+	ctx := WithActor(context.Background(), Actor{ID: "editor", Role: model.RoleEditor, IP: "192.0.2.1", RequestID: "req-1"})
+
+	if _, err := service.CreatePost(ctx, PostInput{Title: "New", Content: "Content"}); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if _, err := service.UpdatePost(ctx, stored.ID.Hex(), PostInput{Title: "Changed", Content: "Content"}); err != nil {
+		t.Fatalf("UpdatePost() error = %v", err)
+	}
+	if _, err := service.SaveTranslation(ctx, stored.ID.Hex(), "uk", TranslationInput{Title: "Заголовок", Content: "Зміст"}); err != nil {
+		t.Fatalf("SaveTranslation() error = %v", err)
+	}
+	if err := service.DeletePost(ctx, stored.ID.Hex()); err != nil {
+		t.Fatalf("DeletePost() error = %v", err)
+	}
+
+	var actions []model.AuditAction
+	for _, entry := range audit.entries {
+		actions = append(actions, entry.Action)
+		if entry.Actor != "editor" || entry.IP != "192.0.2.1" || entry.RequestID != "req-1" || entry.Time.IsZero() {
+			t.Errorf("entry = %+v, want it attributed to the actor in the context", entry)
+		}
+	}
+	if fmt.Sprint(actions) != "[create update update delete]" {
+		t.Fatalf("actions = %v, want [create update update delete]", actions)
+	}
+
+	created, updated, translated, deleted := audit.entries[0], audit.entries[1], audit.entries[2], audit.entries[3]
+	if created.Before != nil || created.After == nil || created.After.Title != "New" {
+		t.Errorf("create entry = %+v, want only an after snapshot", created)
+	}
+	if updated.PostID != stored.ID || updated.Before.Title != "Title" || updated.After.Title != "Changed" {
+		t.Errorf("update entry = %+v, want snapshots of post %s around the change", updated, stored.ID.Hex())
+	}
+	if changes := translated.Changes(); len(changes) != 1 || changes[0].Field != "translations" {
+		t.Errorf("translation entry changes = %+v, want only translations", changes)
+	}
+	if deleted.Before == nil || deleted.Before.Title != "Title" || deleted.After != nil {
+		t.Errorf("delete entry = %+v, want only a before snapshot", deleted)
+	}
+}
+
+func TestAuditLogBulkAndImport(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			return ids, nil
+		},
+		updateManyFunc: func(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error) {
+			return int64(len(filter.IDs)), nil
+		},
+		bulkUpsertFunc: func(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error) {
+			return &repository.BulkUpsertResult{Inserted: 1, Failed: map[int]error{1: errors.New("duplicate slug")}}, nil
+		},
+	}
+	audit := &mockAuditRepository{}
+	service := NewPostService(repo, WithAuditLog(audit))
+
+	if _, err := service.BulkTag(context.Background(), BulkSelection{AllMatching: true}, []string{"go"}, false); err != nil {
+		t.Fatalf("BulkTag() error = %v", err)
+	}
+	if len(audit.entries) != 2 {
+		t.Fatalf("BulkTag() recorded %d entries, want one per post", len(audit.entries))
+	}
+	for i, entry := range audit.entries {
+		if entry.PostID != ids[i] || entry.Action != model.AuditUpdate || entry.Source != "bulk" || entry.Details != "add tags: go" {
+			t.Errorf("bulk entry = %+v, want an update of %s adding the tag", entry, ids[i].Hex())
+		}
+		if entry.Actor != SystemActor {
+			t.Errorf("bulk entry actor = %q, want %q without an actor in the context", entry.Actor, SystemActor)
+		}
+	}
+
+	audit.entries = nil
+	input := `{"title": "First", "content": "Content"}
+{"title": "Second", "content": "Content", "slug": "taken"}
+`
+	if _, err := service.ImportPosts(context.Background(), strings.NewReader(input), "jsonl", ImportOptions{}); err != nil {
+		t.Fatalf("ImportPosts() error = %v", err)
+	}
+	if len(audit.entries) != 1 || audit.entries[0].Action != model.AuditImport || audit.entries[0].After.Title != "First" {
+		t.Errorf("import entries = %+v, want only the written post", audit.entries)
+	}
+}
+
+func TestAuditLogFailureKeepsChange(t *testing.T) {
+	service := NewPostService(&mockPostRepository{}, WithAuditLog(&mockAuditRepository{appendErr: errors.New("unavailable")}))
+
+	if _, err := service.CreatePost(context.Background(), PostInput{Title: "Title", Content: "Content"}); err != nil {
+		t.Errorf("CreatePost() error = %v, want the post created when the audit log fails", err)
+	}
+}
+
+func TestAuditQueryValidate(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		query   AuditQuery
+		wantErr error
+	}{
+		{"empty", AuditQuery{}, nil},
+		{"all filters", AuditQuery{Action: "delete", PostID: primitive.NewObjectID().Hex(), Actor: "editor", From: day, To: day.AddDate(0, 0, 1)}, nil},
+		{"unknown action", AuditQuery{Action: "publish"}, ErrValidationFailed},
+		{"malformed post ID", AuditQuery{PostID: "not-an-id"}, ErrInvalidID},
+		{"empty date range", AuditQuery{From: day, To: day}, ErrValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExportEntries(t *testing.T) {
+	audit := &mockAuditRepository{entries: []*model.AuditEntry{
+		{Action: model.AuditCreate, Actor: "editor"},
+		{Action: model.AuditDelete, Actor: "cli"},
+	}}
+
+	var buf bytes.Buffer
+	count, err := NewAuditService(audit).ExportEntries(context.Background(), &buf, AuditQuery{})
+	if err != nil {
+		t.Fatalf("ExportEntries() error = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if count != 2 || len(lines) != 2 || !strings.Contains(lines[1], `"action":"delete"`) {
+		t.Errorf("ExportEntries() = %d entries:\n%s\nwant 2 JSON lines", count, buf.String())
+	}
+}
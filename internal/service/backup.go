@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/backup"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BackupCollections are the collections backups hold: posts, the audit log and webhooks that refer to them,
+// and users with their API tokens, so that scripts keep working after a restore.
+// The outbox, resume tokens, sessions and rate limits are state of running processes and aren't backed up.
+var BackupCollections = []string{"posts", repository.AuditCollection, "webhooks", "webhook_deliveries", repository.UserCollection, repository.TokenCollection}
+
+// DefaultRestoreBatchSize is the number of documents written per insert when restoring
+const DefaultRestoreBatchSize = 500
+
+// ErrRestoreTargetNotEmpty is returned when restoring into collections that hold documents without dropping them
+var ErrRestoreTargetNotEmpty = errors.New("the target database already holds data")
+
+// RestoreOptions controls how backups are restored
+type RestoreOptions struct {
+	// Drop removes the backed up collections of the target database before restoring;
+	// without it, restoring into collections that hold documents fails with ErrRestoreTargetNotEmpty
+	Drop bool
+	// BatchSize is the number of documents written per insert
+	BatchSize int
+}
+
+// BackupService writes and restores backup archives of the application's collections
+type BackupService struct {
+	repo     repository.BackupRepository
+	database string
+	// limits are checked on restored posts
+	limits model.Limits
+	now    func() time.Time
+}
+
+// NewBackupService creates a backup service for the named database.
+// Restored posts must be within limits, normally the configured ones.
+func NewBackupService(repo repository.BackupRepository, database string, limits model.Limits) *BackupService {
+	return &BackupService{
+		repo:     repo,
+		database: database,
+		limits:   limits,
+		now:      time.Now,
+	}
+}
+
+// Backup writes an archive of BackupCollections to w and returns its manifest.
+// The collections are read at a single point in time when the server supports snapshot reads,
+// which MongoDB keeps for 5 minutes by default (minSnapshotHistoryWindowInSeconds).
+// Nothing is written to w until every collection has been read.
+func (s *BackupService) Backup(ctx context.Context, w io.Writer) (*backup.Manifest, error) {
+	writer, err := backup.NewWriter()
+	if err != nil {
+		return nil, err
+	}
+	defer writer.Close()
+
+	manifest := backup.Manifest{CreatedAt: s.now().UTC().Truncate(time.Second), Database: s.database}
+	manifest.Consistent, err = s.repo.Snapshot(ctx, func(ctx context.Context) error {
+		for _, collection := range BackupCollections {
+			if err := writer.StartCollection(collection); err != nil {
+				return err
+			}
+			if err := s.repo.Each(ctx, collection, writer.Add); err != nil {
+				return fmt.Errorf("failed to read %s: %w", collection, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !manifest.Consistent {
+		slog.Warn("MongoDB doesn't support snapshot reads; the backup may mix changes made while it was taken. Run a replica set to avoid it")
+	}
+
+	return writer.Finish(w, manifest)
+}
+
+// Verify reads an archive, checking its manifest and that every document is valid, without restoring it
+func (s *BackupService) Verify(r io.Reader) (*backup.Manifest, error) {
+	return backup.Read(r, func(collection string, doc bson.Raw) error {
+		return s.validate(collection, doc)
+	})
+}
+
+// Restore writes the documents of an archive into the service's database, checking them like Verify as it goes.
+// An invalid document stops the restore with the documents before it written, so verify archives first.
+// Indexes aren't restored; migrate the database afterwards to create them.
+func (s *BackupService) Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (*backup.Manifest, error) {
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultRestoreBatchSize
+	}
+
+	for _, collection := range BackupCollections {
+		if opts.Drop {
+			if err := s.repo.Drop(ctx, collection); err != nil {
+				return nil, fmt.Errorf("failed to drop %s: %w", collection, err)
+			}
+			continue
+		}
+		count, err := s.repo.Count(ctx, collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", collection, err)
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%w: %s holds %d documents", ErrRestoreTargetNotEmpty, collection, count)
+		}
+	}
+
+	var current string
+	batch := make([]bson.Raw, 0, opts.BatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.repo.Insert(ctx, current, batch); err != nil {
+			return fmt.Errorf("failed to write %s: %w", current, err)
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	manifest, err := backup.Read(r, func(collection string, doc bson.Raw) error {
+		if err := s.validate(collection, doc); err != nil {
+			return err
+		}
+		if collection != current || len(batch) == opts.BatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+			current = collection
+		}
+		batch = append(batch, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// validate checks that a document of a backed up collection can be read by the application
+func (s *BackupService) validate(collection string, doc bson.Raw) error {
+	var id primitive.ObjectID
+	switch collection {
+	case "posts":
+		var post model.Post
+		if err := bson.Unmarshal(doc, &post); err != nil {
+			return fmt.Errorf("invalid post: %w", err)
+		}
+		if err := post.ValidateLimits(s.limits).Err(); err != nil {
+			return fmt.Errorf("invalid post %s: %w", post.ID.Hex(), err)
+		}
+		id = post.ID
+	case repository.AuditCollection:
+		var entry model.AuditEntry
+		if err := bson.Unmarshal(doc, &entry); err != nil {
+			return fmt.Errorf("invalid audit entry: %w", err)
+		}
+		if !entry.Action.Valid() {
+			return fmt.Errorf("audit entry %s has unknown action %q", entry.ID.Hex(), entry.Action)
+		}
+		id = entry.ID
+	case "webhooks":
+		var webhook model.Webhook
+		if err := bson.Unmarshal(doc, &webhook); err != nil {
+			return fmt.Errorf("invalid webhook: %w", err)
+		}
+		if webhook.URL == "" || webhook.Secret == "" {
+			return fmt.Errorf("webhook %s has no URL or secret", webhook.ID.Hex())
+		}
+		id = webhook.ID
+	case "webhook_deliveries":
+		var delivery model.Delivery
+		if err := bson.Unmarshal(doc, &delivery); err != nil {
+			return fmt.Errorf("invalid webhook delivery: %w", err)
+		}
+		if !delivery.Status.Valid() {
+			return fmt.Errorf("webhook delivery %s has unknown status %q", delivery.ID.Hex(), delivery.Status)
+		}
+		id = delivery.ID
+	case repository.UserCollection:
+		var user model.User
+		if err := bson.Unmarshal(doc, &user); err != nil {
+			return fmt.Errorf("invalid user: %w", err)
+		}
+		if user.Username == "" || user.PasswordHash == "" && !user.SSO() || !user.Role.Valid() {
+			return fmt.Errorf("user %s has no name or password, or an unknown role %q", user.ID.Hex(), user.Role)
+		}
+		id = user.ID
+	case repository.TokenCollection:
+		var token model.APIToken
+		if err := bson.Unmarshal(doc, &token); err != nil {
+			return fmt.Errorf("invalid API token: %w", err)
+		}
+		if token.Hash == "" || token.UserID.IsZero() || len(token.Scopes) == 0 {
+			return fmt.Errorf("API token %s has no hash, user or scopes", token.ID.Hex())
+		}
+		for _, scope := range token.Scopes {
+			if !scope.Valid() {
+				return fmt.Errorf("API token %s has unknown scope %q", token.ID.Hex(), scope)
+			}
+		}
+		id = token.ID
+	default:
+		return fmt.Errorf("unexpected collection %s", collection)
+	}
+
+	if id.IsZero() {
+		return fmt.Errorf("document of %s has no ObjectID _id", collection)
+	}
+	return nil
+}
+
+// BackupToDir writes an archive into dir, named after its creation time, and then removes all but the
+// newest keep archives there; keep below 1 keeps every archive. It returns the path of the new archive.
+func (s *BackupService) BackupToDir(ctx context.Context, dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Archives are written under a temporary name, so that incomplete ones are never taken for backups
+	file, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	manifest, err := s.Backup(ctx, file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, backup.FileName(manifest.CreatedAt))
+	if err := os.Rename(file.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to name backup file: %w", err)
+	}
+	if keep > 0 {
+		if err := pruneBackups(dir, keep); err != nil {
+			return path, fmt.Errorf("failed to remove old backups: %w", err)
+		}
+	}
+	return path, nil
+}
+
+// RunSchedule writes an archive into dir every interval until ctx is canceled, keeping the newest keep archives.
+// The schedule continues from the newest archive in dir, so restarts neither skip nor repeat backups.
+func (s *BackupService) RunSchedule(ctx context.Context, dir string, interval time.Duration, keep int) {
+	for {
+		wait := time.Duration(0)
+		if latest, ok := latestBackup(dir); ok {
+			wait = latest.Add(interval).Sub(s.now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		path, err := s.BackupToDir(ctx, dir, keep)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			slog.Error("Scheduled backup failed", "error", err)
+			// Retry after an interval rather than at once
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+			continue
+		}
+		slog.Info("Scheduled backup written", "path", path)
+	}
+}
+
+// backupFiles returns the names of the archives in dir, oldest first
+func backupFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if _, ok := backup.ParseFileName(entry.Name()); ok && entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// latestBackup returns the creation time of the newest archive in dir
+func latestBackup(dir string) (time.Time, bool) {
+	names, err := backupFiles(dir)
+	if err != nil || len(names) == 0 {
+		return time.Time{}, false
+	}
+	return backup.ParseFileName(names[len(names)-1])
+}
+
+// pruneBackups removes all but the newest keep archives in dir
+func pruneBackups(dir string, keep int) error {
+	names, err := backupFiles(dir)
+	if err != nil {
+		return err
+	}
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			return err
+		}
+		slog.Info("Old backup removed", "name", names[0])
+		names = names[1:]
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/backup"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockBackupRepository keeps collections in memory; snapshots reports whether it offers snapshot reads
+type mockBackupRepository struct {
+	collections map[string][]bson.Raw
+	snapshots   bool
+	inserts     int
+}
+
+func (m *mockBackupRepository) Snapshot(ctx context.Context, fn func(ctx context.Context) error) (bool, error) {
+	return m.snapshots, fn(ctx)
+}
+
+func (m *mockBackupRepository) Each(ctx context.Context, collection string, fn func(doc bson.Raw) error) error {
+	for _, doc := range m.collections[collection] {
+		if err := fn(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockBackupRepository) Count(ctx context.Context, collection string) (int64, error) {
+	return int64(len(m.collections[collection])), nil
+}
+
+func (m *mockBackupRepository) Drop(ctx context.Context, collection string) error {
+	delete(m.collections, collection)
+	return nil
+}
+
+func (m *mockBackupRepository) Insert(ctx context.Context, collection string, docs []bson.Raw) error {
+	m.inserts++
+	m.collections[collection] = append(m.collections[collection], docs...)
+	return nil
+}
+
+func marshalDocument(t *testing.T, v interface{}) bson.Raw {
+	t.Helper()
+	doc, err := bson.Marshal(v)
+	if err != nil {
+		t.Fatalf("bson.Marshal() error = %v", err)
+	}
+	return doc
+}
+
+func backupSource(t *testing.T) *mockBackupRepository {
+	first := model.NewPost("First", "Content")
+	first.ID = primitive.NewObjectID()
+	second := model.NewPost("Second", "Content")
+	second.ID = primitive.NewObjectID()
+	second.SetTranslation("uk", "Другий", "Текст")
+
+	return &mockBackupRepository{
+		snapshots: true,
+		collections: map[string][]bson.Raw{
+			"posts": {marshalDocument(t, first), marshalDocument(t, second)},
+			"audit_log": {marshalDocument(t, &model.AuditEntry{
+				ID: primitive.NewObjectID(), Action: model.AuditCreate, PostID: first.ID, Actor: "cli", After: first,
+			})},
+			"webhooks": {marshalDocument(t, &model.Webhook{
+				ID: primitive.NewObjectID(), URL: "https://example.com/hook", Secret: "secret", Events: []model.EventType{model.EventPostCreated}, Active: true,
+			})},
+		},
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	source := backupSource(t)
+	ctx := context.Background()
+
+	var archive bytes.Buffer
+	manifest, err := NewBackupService(source, "newsdb", model.DefaultLimits).Backup(ctx, &archive)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if !manifest.Consistent || manifest.Database != "newsdb" || len(manifest.Collections) != len(BackupCollections) {
+		t.Errorf("manifest = %+v, want a consistent backup of every backed up collection", manifest)
+	}
+
+	target := &mockBackupRepository{collections: map[string][]bson.Raw{}}
+	service := NewBackupService(target, "restored", model.DefaultLimits)
+	if _, err := service.Verify(bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if _, err := service.Restore(ctx, bytes.NewReader(archive.Bytes()), RestoreOptions{BatchSize: 1}); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	for _, collection := range BackupCollections {
+		if got, want := target.collections[collection], source.collections[collection]; len(got) != len(want) {
+			t.Errorf("restored %d documents of %s, want %d", len(got), collection, len(want))
+		}
+	}
+	if target.inserts != 4 {
+		t.Errorf("Restore() made %d inserts, want one per document with a batch size of 1", target.inserts)
+	}
+	if !bytes.Equal(target.collections["posts"][1], source.collections["posts"][1]) {
+		t.Error("restored post differs from the backed up one")
+	}
+
+	if _, err := service.Restore(ctx, bytes.NewReader(archive.Bytes()), RestoreOptions{}); !errors.Is(err, ErrRestoreTargetNotEmpty) {
+		t.Errorf("Restore() into restored data error = %v, want ErrRestoreTargetNotEmpty", err)
+	}
+	if _, err := service.Restore(ctx, bytes.NewReader(archive.Bytes()), RestoreOptions{Drop: true}); err != nil {
+		t.Fatalf("Restore() with Drop error = %v", err)
+	}
+	if len(target.collections["posts"]) != 2 {
+		t.Errorf("Restore() with Drop left %d posts, want the 2 backed up ones", len(target.collections["posts"]))
+	}
+}
+
+func TestVerifyRejectsInvalidDocuments(t *testing.T) {
+	tests := []struct {
+		name       string
+		collection string
+		doc        interface{}
+	}{
+		{"post without title", "posts", &model.Post{ID: primitive.NewObjectID(), Content: "Content"}},
+		{"post without ID", "posts", &model.Post{Title: "Title", Content: "Content"}},
+		{"audit entry of unknown action", "audit_log", &model.AuditEntry{ID: primitive.NewObjectID(), Action: "rename"}},
+		{"webhook without secret", "webhooks", &model.Webhook{ID: primitive.NewObjectID(), URL: "https://example.com"}},
+		{"unexpected type", "webhook_deliveries", bson.M{"_id": primitive.NewObjectID(), "attempts": "many"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &mockBackupRepository{collections: map[string][]bson.Raw{tt.collection: {marshalDocument(t, tt.doc)}}}
+			var archive bytes.Buffer
+			if _, err := NewBackupService(source, "newsdb", model.DefaultLimits).Backup(context.Background(), &archive); err != nil {
+				t.Fatalf("Backup() error = %v", err)
+			}
+
+			target := &mockBackupRepository{collections: map[string][]bson.Raw{}}
+			service := NewBackupService(target, "newsdb", model.DefaultLimits)
+			if _, err := service.Verify(bytes.NewReader(archive.Bytes())); err == nil || errors.Is(err, backup.ErrInvalidArchive) {
+				t.Errorf("Verify() error = %v, want the invalid document reported", err)
+			}
+			if _, err := service.Restore(context.Background(), bytes.NewReader(archive.Bytes()), RestoreOptions{}); err == nil {
+				t.Error("Restore() error = nil, want the invalid document reported")
+			}
+		})
+	}
+}
+
+func TestBackupToDir(t *testing.T) {
+	dir := t.TempDir()
+	notes := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(notes, []byte("keep me"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewBackupService(backupSource(t), "newsdb", model.DefaultLimits)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, err := service.BackupToDir(context.Background(), dir, 2)
+		if err != nil {
+			t.Fatalf("BackupToDir() error = %v", err)
+		}
+		paths = append(paths, path)
+		now = now.Add(time.Hour)
+	}
+
+	names, err := backupFiles(dir)
+	if err != nil {
+		t.Fatalf("backupFiles() error = %v", err)
+	}
+	want := []string{"backup-20240501T140000Z.tar.gz", "backup-20240501T150000Z.tar.gz"}
+	if len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("backups = %v, want the newest two %v", names, want)
+	}
+	if filepath.Base(paths[3]) != want[1] {
+		t.Errorf("BackupToDir() = %s, want %s", paths[3], want[1])
+	}
+	if _, err := os.Stat(notes); err != nil {
+		t.Errorf("other files were removed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 3 {
+		t.Errorf("directory holds %d files, want 2 backups and the notes without temporary files", len(entries))
+	}
+
+	latest, ok := latestBackup(dir)
+	if !ok || !latest.Equal(time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)) {
+		t.Errorf("latestBackup() = %v, %v, want the newest backup's time", latest, ok)
+	}
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultBulkBatchSize is the number of posts a bulk action writes per transaction when no batch size is given
+const DefaultBulkBatchSize = 500
+
+// Bulk actions supported by the bulk service methods
+const (
+	BulkActionDelete = "delete"
+	BulkActionTag    = "tag"
+	BulkActionUntag  = "untag"
+	BulkActionStatus = "status"
+)
+
+// BulkSelection identifies the posts a bulk action applies to.
+// When AllMatching is set, every post matching Filter is selected and IDs are ignored.
+type BulkSelection struct {
+	IDs         []string
+	AllMatching bool
+	// Filter holds the criteria of the post list the selection was made on; its sort and paging are ignored
+	Filter ListQuery
+}
+
+// BulkFailure describes why a bulk action could not be applied to a single post
+type BulkFailure struct {
+	ID    string
+	Error string
+}
+
+// BulkSummary summarizes the outcome of a bulk action
+type BulkSummary struct {
+	Action    string
+	Requested int
+	// Applied counts the posts of the batches that were written; it falls short when a batch failed
+	Applied  int
+	Affected int64
+	Failures []BulkFailure
+}
+
+// BulkDelete deletes all selected posts, with one DeleteMany per batch.
+// Selected IDs that are invalid or don't exist are reported as failures.
+func (s *PostService) BulkDelete(ctx context.Context, selection BulkSelection) (*BulkSummary, error) {
+	return s.bulkApply(ctx, BulkActionDelete, selection, model.AuditDelete, repository.PostChanges{}, s.repo.DeleteMany)
+}
+
+// BulkTag adds tags to, or removes tags from, all selected posts with one UpdateMany per batch
+func (s *PostService) BulkTag(ctx context.Context, selection BulkSelection, tags []string, remove bool) (*BulkSummary, error) {
+	tags = model.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("%w: at least one tag is required", ErrValidationFailed)
+	}
+
+	action := BulkActionTag
+	changes := repository.PostChanges{AddTags: tags}
+	if remove {
+		action = BulkActionUntag
+		changes = repository.PostChanges{RemoveTags: tags}
+	}
+
+	return s.bulkUpdate(ctx, action, selection, changes)
+}
+
+// BulkSetStatus changes the status of all selected posts with one UpdateMany per batch
+func (s *PostService) BulkSetStatus(ctx context.Context, selection BulkSelection, status model.PostStatus) (*BulkSummary, error) {
+	if !status.Valid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrValidationFailed, status)
+	}
+
+	return s.bulkUpdate(ctx, BulkActionStatus, selection, repository.PostChanges{Status: status})
+}
+
+func (s *PostService) bulkUpdate(ctx context.Context, action string, selection BulkSelection, changes repository.PostChanges) (*BulkSummary, error) {
+	return s.bulkApply(ctx, action, selection, model.AuditUpdate, changes, func(ctx context.Context, filter repository.PostFilter) (int64, error) {
+		return s.repo.UpdateMany(ctx, filter, changes)
+	})
+}
+
+// bulkApply writes the selected posts in batches of at most bulkBatchSize posts, each in its own transaction
+// with its own events, so that large selections stay within MongoDB's document size and transaction time limits.
+// Batches written before a failing one stay written, so a failure returns the summary of those with the error.
+func (s *PostService) bulkApply(ctx context.Context, action string, selection BulkSelection, audit model.AuditAction, changes repository.PostChanges, write func(ctx context.Context, filter repository.PostFilter) (int64, error)) (*BulkSummary, error) {
+	if err := authorize(ctx, append(bulkPermissions[action], model.PermModerate)...); err != nil {
+		return nil, err
+	}
+
+	apply := func(summary *BulkSummary, ids []primitive.ObjectID) error {
+		filter := repository.PostFilter{IDs: ids}
+		var affected int64
+		err := s.changePosts(ctx, audit, ids, changes, func(ctx context.Context) error {
+			var err error
+			affected, err = write(ctx, filter)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		summary.Applied += len(ids)
+		summary.Affected += affected
+		return nil
+	}
+
+	if !selection.AllMatching {
+		summary, ids, err := s.resolveSelection(ctx, action, selection.IDs)
+		if err != nil {
+			return nil, err
+		}
+		for batch := range slices.Chunk(ids, s.bulkBatchSize) {
+			if err := apply(summary, batch); err != nil {
+				return summary, err
+			}
+		}
+		return summary, nil
+	}
+
+	query := selection.Filter
+	query.Language = model.NormalizeLanguage(query.Language)
+	if err := query.validateFilters(); err != nil {
+		return nil, err
+	}
+
+	// Matching posts are paged through in ID order, so only one batch of IDs is held at a time
+	summary := &BulkSummary{Action: action, Failures: []BulkFailure{}}
+	filter := repository.PostFilter{
+		Search:      query.Search,
+		Language:    query.Language,
+		CreatedFrom: query.CreatedFrom,
+		CreatedTo:   query.CreatedTo,
+		Tags:        model.NormalizeTags(query.Tags),
+		Status:      query.Status,
+		Limit:       s.bulkBatchSize,
+	}
+	for {
+		ids, err := s.repo.FindIDs(ctx, filter)
+		if err != nil {
+			return summary, err
+		}
+		if len(ids) == 0 {
+			return summary, nil
+		}
+		summary.Requested += len(ids)
+		if err := apply(summary, ids); err != nil {
+			return summary, err
+		}
+		if len(ids) < s.bulkBatchSize {
+			return summary, nil
+		}
+		filter.After = ids[len(ids)-1]
+	}
+}
+
+// bulkPermissions lists the permissions each bulk action takes, besides PermModerate
+var bulkPermissions = map[string][]model.Permission{
+	BulkActionDelete: {model.PermDelete},
+	BulkActionStatus: {model.PermPublish},
+}
+
+// resolveSelection returns the existing posts among the selected IDs. Invalid and unknown IDs are recorded as
+// failures in the returned summary.
+func (s *PostService) resolveSelection(ctx context.Context, action string, selected []string) (*BulkSummary, []primitive.ObjectID, error) {
+	if len(selected) == 0 {
+		return nil, nil, ErrNothingSelected
+	}
+	summary := &BulkSummary{Action: action, Requested: len(selected), Failures: []BulkFailure{}}
+
+	requested := make([]primitive.ObjectID, 0, len(selected))
+	for _, id := range selected {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			summary.Failures = append(summary.Failures, BulkFailure{ID: id, Error: ErrInvalidID.Error()})
+			continue
+		}
+		requested = append(requested, objectID)
+	}
+	if len(requested) == 0 {
+		return summary, nil, nil
+	}
+
+	existing, err := s.repo.FindIDs(ctx, repository.PostFilter{IDs: requested})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	found := make(map[primitive.ObjectID]bool, len(existing))
+	for _, id := range existing {
+		found[id] = true
+	}
+	for _, id := range requested {
+		if !found[id] {
+			summary.Failures = append(summary.Failures, BulkFailure{ID: id.Hex(), Error: ErrPostNotFound.Error()})
+		}
+	}
+
+	return summary, existing, nil
+}
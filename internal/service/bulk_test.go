@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestBulkDelete(t *testing.T) {
+	existing := primitive.NewObjectID()
+	missing := primitive.NewObjectID()
+
+	var deleted []primitive.ObjectID
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			var found []primitive.ObjectID
+			for _, id := range filter.IDs {
+				if id == existing {
+					found = append(found, id)
+				}
+			}
+			return found, nil
+		},
+		deleteManyFunc: func(ctx context.Context, filter repository.PostFilter) (int64, error) {
+			deleted = filter.IDs
+			return int64(len(filter.IDs)), nil
+		},
+	}
+	service := NewPostService(repo)
+
+	summary, err := service.BulkDelete(context.Background(), BulkSelection{
+		IDs: []string{existing.Hex(), missing.Hex(), "not-an-id"},
+	})
+	if err != nil {
+		t.Fatalf("BulkDelete() unexpected error = %v", err)
+	}
+
+	if len(deleted) != 1 || deleted[0] != existing {
+		t.Errorf("BulkDelete() deleted %v, want only %v", deleted, existing)
+	}
+	if summary.Requested != 3 || summary.Affected != 1 {
+		t.Errorf("BulkDelete() summary = %+v, want 3 requested and 1 affected", summary)
+	}
+
+	failures := map[string]string{}
+	for _, failure := range summary.Failures {
+		failures[failure.ID] = failure.Error
+	}
+	if failures[missing.Hex()] != ErrPostNotFound.Error() {
+		t.Errorf("BulkDelete() failure for missing post = %q, want %q", failures[missing.Hex()], ErrPostNotFound.Error())
+	}
+	if failures["not-an-id"] != ErrInvalidID.Error() {
+		t.Errorf("BulkDelete() failure for invalid id = %q, want %q", failures["not-an-id"], ErrInvalidID.Error())
+	}
+}
+
+func TestBulkTagAllMatching(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+
+	var gotChanges repository.PostChanges
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			if filter.Search != "golang" {
+				t.Errorf("FindIDs() search = %q, want golang", filter.Search)
+			}
+			return ids, nil
+		},
+		updateManyFunc: func(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error) {
+			gotChanges = changes
+			return int64(len(filter.IDs)), nil
+		},
+	}
+	service := NewPostService(repo)
+
+	summary, err := service.BulkTag(context.Background(), BulkSelection{AllMatching: true, Filter: ListQuery{Search: "golang"}}, []string{" Go ", "go", "News"}, false)
+	if err != nil {
+		t.Fatalf("BulkTag() unexpected error = %v", err)
+	}
+
+	if summary.Requested != 2 || summary.Affected != 2 {
+		t.Errorf("BulkTag() summary = %+v, want 2 requested and 2 affected", summary)
+	}
+	if len(gotChanges.AddTags) != 2 || gotChanges.AddTags[0] != "go" || gotChanges.AddTags[1] != "news" {
+		t.Errorf("BulkTag() add tags = %v, want [go news]", gotChanges.AddTags)
+	}
+}
+
+func TestBulkDeleteAllMatchingInBatches(t *testing.T) {
+	ids := make([]primitive.ObjectID, 5)
+	for i := range ids {
+		ids[i] = primitive.NewObjectID()
+	}
+
+	var batches [][]primitive.ObjectID
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			page := ids
+			if !filter.After.IsZero() {
+				page = ids[slices.Index(ids, filter.After)+1:]
+			}
+			return page[:min(len(page), filter.Limit)], nil
+		},
+		deleteManyFunc: func(ctx context.Context, filter repository.PostFilter) (int64, error) {
+			batches = append(batches, filter.IDs)
+			return int64(len(filter.IDs)), nil
+		},
+	}
+	outbox := &mockOutboxRepository{}
+	transactor := &mockTransactor{outbox: outbox}
+	service := NewPostService(repo, WithOutbox(outbox, transactor), WithBulkBatchSize(2))
+
+	summary, err := service.BulkDelete(context.Background(), BulkSelection{AllMatching: true})
+	if err != nil {
+		t.Fatalf("BulkDelete() unexpected error = %v", err)
+	}
+
+	if summary.Requested != 5 || summary.Affected != 5 {
+		t.Errorf("BulkDelete() summary = %+v, want 5 requested and 5 affected", summary)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[1]) != 2 || len(batches[2]) != 1 {
+		t.Errorf("BulkDelete() batches = %v, want batches of 2, 2 and 1 posts", batches)
+	}
+	if transactor.transactions != 3 {
+		t.Errorf("BulkDelete() ran %d transactions, want one per batch", transactor.transactions)
+	}
+	if len(outbox.records) != 5 {
+		t.Errorf("BulkDelete() stored %d events, want one per post", len(outbox.records))
+	}
+}
+
+func TestBulkSetStatusPartialFailure(t *testing.T) {
+	ids := []string{primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()}
+	writeErr := errors.New("write conflict")
+
+	batches := 0
+	repo := &mockPostRepository{
+		updateManyFunc: func(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error) {
+			batches++
+			if batches == 2 {
+				return 0, writeErr
+			}
+			return int64(len(filter.IDs)), nil
+		},
+	}
+	outbox := &mockOutboxRepository{}
+	service := NewPostService(repo, WithOutbox(outbox, &mockTransactor{outbox: outbox}), WithBulkBatchSize(2))
+
+	summary, err := service.BulkSetStatus(context.Background(), BulkSelection{IDs: ids}, model.StatusArchived)
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("BulkSetStatus() error = %v, want %v", err, writeErr)
+	}
+	if summary == nil || summary.Requested != 3 || summary.Applied != 2 || summary.Affected != 2 {
+		t.Fatalf("BulkSetStatus() summary = %+v, want 2 of 3 applied by the first batch", summary)
+	}
+	if len(outbox.records) != 2 {
+		t.Errorf("BulkSetStatus() stored %d events, want those of the first batch", len(outbox.records))
+	}
+}
+
+func TestBulkAllMatchingFilter(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var got repository.PostFilter
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			got = filter
+			return nil, nil
+		},
+	}
+	service := NewPostService(repo)
+
+	selection := BulkSelection{AllMatching: true, Filter: ListQuery{
+		Search:      "vote",
+		Language:    "UK",
+		CreatedFrom: from,
+		Tags:        []string{" News "},
+		Status:      model.StatusDraft,
+		Sort:        repository.SortByTitle,
+		Page:        3,
+	}}
+	if _, err := service.BulkDelete(context.Background(), selection); err != nil {
+		t.Fatalf("BulkDelete() unexpected error = %v", err)
+	}
+	if got.Search != "vote" || got.Language != "uk" || !got.CreatedFrom.Equal(from) || fmt.Sprint(got.Tags) != "[news]" || got.Status != model.StatusDraft {
+		t.Errorf("FindIDs() filter = %+v, want every criterion of the list", got)
+	}
+
+	selection.Filter.Status = "deleted"
+	if _, err := service.BulkDelete(context.Background(), selection); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("BulkDelete() with an unknown status error = %v, want %v", err, ErrValidationFailed)
+	}
+}
+
+func TestBulkSetStatusValidation(t *testing.T) {
+	service := NewPostService(&mockPostRepository{})
+
+	_, err := service.BulkSetStatus(context.Background(), BulkSelection{IDs: []string{primitive.NewObjectID().Hex()}}, model.PostStatus("deleted"))
+	if !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("BulkSetStatus() error = %v, want %v", err, ErrValidationFailed)
+	}
+
+	_, err = service.BulkSetStatus(context.Background(), BulkSelection{}, model.StatusDraft)
+	if !errors.Is(err, ErrNothingSelected) {
+		t.Errorf("BulkSetStatus() error = %v, want %v", err, ErrNothingSelected)
+	}
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// changeWatcherToken is the name the change watcher's resume token is stored under
+const changeWatcherToken = "posts"
+
+// postInvalidator is implemented by post repositories whose cache must drop posts changed by other processes
+type postInvalidator interface {
+	Invalidate(ctx context.Context, ids ...string)
+}
+
+// ApplyExternalChange passes a change of a post written by another tool, e.g. an insert from mongosh,
+// through the same outbox, listeners and caches as the service's own changes.
+// Its events get IDs derived from the change, so that watchers in several processes store them once.
+// External changes aren't audited, since nothing tells who made them.
+// Their events belong to the tenant of the changed post; deletions, whose post is gone, belong to the tenant
+// of ctx, and to none when ctx carries none, so that no tenant's webhooks receive them.
+func (s *PostService) ApplyExternalChange(ctx context.Context, change *repository.PostChange) error {
+	if invalidator, ok := s.repo.(postInvalidator); ok {
+		invalidator.Invalidate(ctx, change.PostID.Hex())
+	}
+
+	tenantID := externalTenant(ctx, change)
+	if tenantID != "" {
+		ctx = tenant.WithID(ctx, tenantID)
+	}
+	events := externalEvents(change, tenantID)
+	if err := s.store(ctx, events); err != nil {
+		return err
+	}
+	s.publish(ctx, events...)
+	s.notifyChanged(ctx)
+	return nil
+}
+
+// externalTenant returns the ID of the tenant a change written by another tool belongs to, or "" when it isn't known
+func externalTenant(ctx context.Context, change *repository.PostChange) string {
+	if change.Post != nil {
+		if change.Post.TenantID == "" {
+			return tenant.DefaultID
+		}
+		return change.Post.TenantID
+	}
+	if t, ok := tenant.FromContext(ctx); ok {
+		return t.ID
+	}
+	return ""
+}
+
+// externalEvents returns the events of a change written by another tool to a post of the given tenant.
+// Updates only count as publishing when they set the status, since the post before the change isn't known.
+func externalEvents(change *repository.PostChange, tenantID string) []model.PostEvent {
+	var types []model.EventType
+	switch change.Operation {
+	case repository.OperationDelete:
+		types = []model.EventType{model.EventPostDeleted}
+	case repository.OperationInsert:
+		types = []model.EventType{model.EventPostCreated}
+		if change.Post != nil && change.Post.EffectiveStatus() == model.StatusPublished {
+			types = append(types, model.EventPostPublished)
+		}
+	default:
+		types = []model.EventType{model.EventPostUpdated}
+		if change.Published {
+			types = append(types, model.EventPostPublished)
+		}
+	}
+
+	now := time.Unix(int64(change.Time.T), 0)
+	events := make([]model.PostEvent, len(types))
+	for i, t := range types {
+		events[i] = model.PostEvent{
+			ID:       externalEventID(change.Time, i),
+			Type:     t,
+			PostID:   change.PostID,
+			Post:     change.Post,
+			Time:     now,
+			TenantID: tenantID,
+		}
+	}
+	return events
+}
+
+// externalEventID returns the ID of the n-th event of the change written at the given cluster time.
+// Like other ObjectIDs it starts with the time in seconds, followed by the cluster time's increment and n.
+func externalEventID(clusterTime primitive.Timestamp, n int) primitive.ObjectID {
+	var id primitive.ObjectID
+	binary.BigEndian.PutUint32(id[0:4], clusterTime.T)
+	binary.BigEndian.PutUint32(id[4:8], clusterTime.I)
+	binary.BigEndian.PutUint32(id[8:12], uint32(n))
+	return id
+}
+
+// ChangeWatcher applies changes of posts written by other tools, following the change stream of posts
+type ChangeWatcher struct {
+	watcher repository.PostWatcher
+	tokens  repository.ResumeTokenRepository
+	posts   *PostService
+	// retry is the delay before watching again after the stream failed
+	retry time.Duration
+}
+
+// NewChangeWatcher creates a watcher applying external changes to posts
+func NewChangeWatcher(watcher repository.PostWatcher, tokens repository.ResumeTokenRepository, posts *PostService) *ChangeWatcher {
+	return &ChangeWatcher{
+		watcher: watcher,
+		tokens:  tokens,
+		posts:   posts,
+		retry:   5 * time.Second,
+	}
+}
+
+// Run applies external changes until ctx is canceled, resuming after the last applied change.
+// When the oplog no longer holds that change, it starts over from now; on servers without change streams
+// it logs a warning and returns at once.
+func (w *ChangeWatcher) Run(ctx context.Context) {
+	for {
+		err := w.watch(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case errors.Is(err, repository.ErrChangeStreamsUnsupported):
+			slog.Warn("MongoDB doesn't support change streams; changes written by other tools are not picked up. Run a replica set to enable them")
+			return
+		case errors.Is(err, repository.ErrResumeTokenExpired):
+			slog.Warn("Change stream resume token expired; changes written while the watcher was stopped are missed")
+			if err := w.tokens.Save(ctx, changeWatcherToken, nil); err == nil {
+				continue
+			}
+			slog.Error("Failed to reset resume token", "error", err)
+		default:
+			slog.Error("Change stream failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.retry):
+		}
+	}
+}
+
+// watch follows the change stream from the stored resume token, storing the token of every applied change
+func (w *ChangeWatcher) watch(ctx context.Context) error {
+	token, err := w.tokens.Load(ctx, changeWatcherToken)
+	if err != nil {
+		return fmt.Errorf("failed to load resume token: %w", err)
+	}
+	slog.Info("Watching changes of posts", "resumed", token != nil)
+
+	return w.watcher.Watch(ctx, token, func(ctx context.Context, change *repository.PostChange, token bson.Raw) error {
+		if change != nil {
+			if err := w.posts.ApplyExternalChange(ctx, change); err != nil {
+				return fmt.Errorf("failed to apply change of post %s: %w", change.PostID.Hex(), err)
+			}
+		}
+		if err := w.tokens.Save(ctx, changeWatcherToken, token); err != nil {
+			return fmt.Errorf("failed to save resume token: %w", err)
+		}
+		return nil
+	})
+}
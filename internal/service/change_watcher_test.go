@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockPostWatcher runs one scripted stream per Watch call and reports missing change streams once they run out
+type mockPostWatcher struct {
+	streams []func(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *repository.PostChange, token bson.Raw) error) error
+	tokens  []bson.Raw
+}
+
+func (m *mockPostWatcher) Watch(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *repository.PostChange, token bson.Raw) error) error {
+	m.tokens = append(m.tokens, token)
+	if len(m.streams) == 0 {
+		return repository.ErrChangeStreamsUnsupported
+	}
+	stream := m.streams[0]
+	m.streams = m.streams[1:]
+	return stream(ctx, token, fn)
+}
+
+type mockResumeTokenRepository struct {
+	tokens map[string]bson.Raw
+}
+
+func (m *mockResumeTokenRepository) Load(ctx context.Context, name string) (bson.Raw, error) {
+	return m.tokens[name], nil
+}
+
+func (m *mockResumeTokenRepository) Save(ctx context.Context, name string, token bson.Raw) error {
+	if token == nil {
+		delete(m.tokens, name)
+		return nil
+	}
+	m.tokens[name] = token
+	return nil
+}
+
+// invalidatingPostRepository records the posts a cache would drop
+type invalidatingPostRepository struct {
+	mockPostRepository
+	invalidated []string
+}
+
+func (r *invalidatingPostRepository) Invalidate(ctx context.Context, ids ...string) {
+	r.invalidated = append(r.invalidated, ids...)
+}
+
+func resumeToken(t *testing.T, data string) bson.Raw {
+	t.Helper()
+	token, err := bson.Marshal(bson.M{"_data": data})
+	if err != nil {
+		t.Fatalf("bson.Marshal() error = %v", err)
+	}
+	return token
+}
+
+func TestExternalEvents(t *testing.T) {
+	draft := &model.Post{Title: "Draft", Status: model.StatusDraft}
+	published := &model.Post{Title: "Published", Status: model.StatusPublished}
+
+	tests := []struct {
+		name   string
+		change repository.PostChange
+		want   []model.EventType
+	}{
+		{"insert draft", repository.PostChange{Operation: repository.OperationInsert, Post: draft}, []model.EventType{model.EventPostCreated}},
+		{"insert published", repository.PostChange{Operation: repository.OperationInsert, Post: published}, []model.EventType{model.EventPostCreated, model.EventPostPublished}},
+		{"update", repository.PostChange{Operation: repository.OperationUpdate, Post: published}, []model.EventType{model.EventPostUpdated}},
+		{"publish", repository.PostChange{Operation: repository.OperationUpdate, Post: published, Published: true}, []model.EventType{model.EventPostUpdated, model.EventPostPublished}},
+		{"replace", repository.PostChange{Operation: repository.OperationReplace, Post: draft}, []model.EventType{model.EventPostUpdated}},
+		{"delete", repository.PostChange{Operation: repository.OperationDelete}, []model.EventType{model.EventPostDeleted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.change.PostID = primitive.NewObjectID()
+			tt.change.Time = primitive.Timestamp{T: 1714564800, I: 3}
+			events := externalEvents(&tt.change, "daily")
+
+			if len(events) != len(tt.want) {
+				t.Fatalf("externalEvents() returned %d events, want %v", len(events), tt.want)
+			}
+			for i, event := range events {
+				if event.Type != tt.want[i] || event.PostID != tt.change.PostID || event.Post != tt.change.Post || event.TenantID != "daily" {
+					t.Errorf("event %d = %+v, want %s of the changed post", i, event, tt.want[i])
+				}
+				if event.ID != externalEventID(tt.change.Time, i) || event.ID.Timestamp().Unix() != 1714564800 {
+					t.Errorf("event %d ID = %s, want one derived from the cluster time", i, event.ID.Hex())
+				}
+			}
+		})
+	}
+}
+
+func TestExternalTenant(t *testing.T) {
+	daily := &model.Post{Title: "Daily", TenantID: "daily"}
+	legacy := &model.Post{Title: "Stored before tenants"}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		change repository.PostChange
+		want   string
+	}{
+		{"post of a tenant", context.Background(), repository.PostChange{Operation: repository.OperationInsert, Post: daily}, "daily"},
+		{"post without a tenant", tenant.WithID(context.Background(), "weekly"), repository.PostChange{Operation: repository.OperationUpdate, Post: legacy}, tenant.DefaultID},
+		{"deletion in a tenant's context", tenant.WithID(context.Background(), "weekly"), repository.PostChange{Operation: repository.OperationDelete}, "weekly"},
+		{"deletion without a tenant", context.Background(), repository.PostChange{Operation: repository.OperationDelete}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := externalTenant(tt.ctx, &tt.change); got != tt.want {
+				t.Errorf("externalTenant() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyExternalChange(t *testing.T) {
+	repo := &invalidatingPostRepository{}
+	outbox := &mockOutboxRepository{}
+	var published []model.PostEvent
+	changed := 0
+	service := NewPostService(repo,
+		WithOutbox(outbox, nil),
+		WithEventListener(func(ctx context.Context, event model.PostEvent) {
+			published = append(published, event)
+		}),
+		WithChangeListener(func(ctx context.Context) {
+			changed++
+		}))
+
+	change := &repository.PostChange{
+		Operation: repository.OperationInsert,
+		PostID:    primitive.NewObjectID(),
+		Post:      model.NewPost("External", "Content"),
+		Time:      primitive.Timestamp{T: 1714564800, I: 1},
+	}
+	if err := service.ApplyExternalChange(context.Background(), change); err != nil {
+		t.Fatalf("ApplyExternalChange() error = %v", err)
+	}
+
+	if len(repo.invalidated) != 1 || repo.invalidated[0] != change.PostID.Hex() {
+		t.Errorf("invalidated %v, want the changed post", repo.invalidated)
+	}
+	if changed != 1 {
+		t.Errorf("change listeners ran %d times, want 1", changed)
+	}
+	if len(published) != 2 || len(outbox.records) != 2 {
+		t.Fatalf("published %d events and stored %d, want post.created and post.published", len(published), len(outbox.records))
+	}
+	for i, record := range outbox.records {
+		if record.ID != published[i].ID {
+			t.Errorf("record %d = %s, want the published event %s", i, record.ID.Hex(), published[i].ID.Hex())
+		}
+	}
+
+	outbox.addErr = errors.New("outbox unavailable")
+	if err := service.ApplyExternalChange(context.Background(), change); err == nil {
+		t.Error("ApplyExternalChange() error = nil, want the outbox error so that the change is applied again")
+	}
+}
+
+func TestChangeWatcher(t *testing.T) {
+	first, second := resumeToken(t, "1"), resumeToken(t, "2")
+	change := &repository.PostChange{Operation: repository.OperationDelete, PostID: primitive.NewObjectID(), Time: primitive.Timestamp{T: 1, I: 1}}
+
+	watcher := &mockPostWatcher{streams: []func(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *repository.PostChange, token bson.Raw) error) error{
+		// A change, then an idle advance, then a network failure
+		func(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *repository.PostChange, token bson.Raw) error) error {
+			if err := fn(ctx, change, first); err != nil {
+				return err
+			}
+			if err := fn(ctx, nil, second); err != nil {
+				return err
+			}
+			return errors.New("connection reset")
+		},
+		// Resumed after the oplog moved on
+		func(ctx context.Context, token bson.Raw, fn func(ctx context.Context, change *repository.PostChange, token bson.Raw) error) error {
+			return repository.ErrResumeTokenExpired
+		},
+	}}
+	tokens := &mockResumeTokenRepository{tokens: map[string]bson.Raw{}}
+	outbox := &mockOutboxRepository{}
+	service := NewPostService(&mockPostRepository{}, WithOutbox(outbox, nil))
+
+	changeWatcher := NewChangeWatcher(watcher, tokens, service)
+	changeWatcher.retry = time.Millisecond
+	// Returns once the mock reports missing change streams
+	changeWatcher.Run(context.Background())
+
+	if len(outbox.records) != 1 || outbox.records[0].Event.Type != model.EventPostDeleted {
+		t.Errorf("outbox = %+v, want the post.deleted event of the change", outbox.records)
+	}
+	want := []bson.Raw{nil, second, nil}
+	if len(watcher.tokens) != len(want) {
+		t.Fatalf("Watch() was called %d times, want %d", len(watcher.tokens), len(want))
+	}
+	for i, token := range watcher.tokens {
+		if string(token) != string(want[i]) {
+			t.Errorf("Watch() call %d resumed after %v, want %v", i, token, want[i])
+		}
+	}
+	if _, ok := tokens.tokens[changeWatcherToken]; ok {
+		t.Error("expired resume token was kept")
+	}
+}
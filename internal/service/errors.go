@@ -0,0 +1,165 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+)
+
+// Kind classifies service errors, so callers can react to them without knowing their cause
+type Kind int
+
+const (
+	// KindInternal is an unexpected failure, e.g. the database is unavailable
+	KindInternal Kind = iota
+	// KindInvalid is a malformed request, e.g. an unknown sort field or a bad post ID
+	KindInvalid
+	// KindNotFound means the requested post doesn't exist
+	KindNotFound
+	// KindConflict means the change conflicts with existing data, e.g. a duplicate slug
+	KindConflict
+	// KindValidation means one or more post fields are invalid
+	KindValidation
+	// KindForbidden means the actor's role doesn't allow the change
+	KindForbidden
+	// KindUnauthorized means the request's credentials, e.g. an API token, aren't valid
+	KindUnauthorized
+)
+
+// String returns the name of the kind
+func (k Kind) String() string {
+	switch k {
+	case KindInvalid:
+		return "invalid"
+	case KindNotFound:
+		return "not_found"
+	case KindConflict:
+		return "conflict"
+	case KindValidation:
+		return "validation"
+	case KindForbidden:
+		return "forbidden"
+	case KindUnauthorized:
+		return "unauthorized"
+	default:
+		return "internal"
+	}
+}
+
+// Error is an error returned by the service layer.
+// Message is safe to show to users; Err is the underlying cause, if any.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	Err     error
+}
+
+// Error returns the user facing message
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unwrap returns the underlying cause
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is a service error with the same code,
+// so wrapped errors match the sentinels below with errors.Is
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+var (
+	ErrPostNotFound     = &Error{Kind: KindNotFound, Code: "post_not_found", Message: "post not found"}
+	ErrInvalidID        = &Error{Kind: KindInvalid, Code: "invalid_id", Message: "invalid post id"}
+	ErrValidationFailed = &Error{Kind: KindInvalid, Code: "validation_failed", Message: "validation failed"}
+	ErrNothingSelected  = &Error{Kind: KindInvalid, Code: "nothing_selected", Message: "no posts selected"}
+	ErrConflict         = &Error{Kind: KindConflict, Code: "conflict", Message: "the post conflicts with an existing post"}
+	ErrInvalidFields    = &Error{Kind: KindValidation, Code: "invalid_fields", Message: "validation failed"}
+
+	ErrTranslationNotFound = &Error{Kind: KindNotFound, Code: "translation_not_found", Message: "translation not found"}
+
+	ErrWebhookNotFound   = &Error{Kind: KindNotFound, Code: "webhook_not_found", Message: "webhook not found"}
+	ErrInvalidWebhookID  = &Error{Kind: KindInvalid, Code: "invalid_webhook_id", Message: "invalid webhook id"}
+	ErrDeliveryNotFound  = &Error{Kind: KindNotFound, Code: "delivery_not_found", Message: "delivery not found"}
+	ErrInvalidDeliveryID = &Error{Kind: KindInvalid, Code: "invalid_delivery_id", Message: "invalid delivery id"}
+
+	ErrForbidden          = &Error{Kind: KindForbidden, Code: "forbidden", Message: "you are not allowed to do this"}
+	ErrUserNotFound       = &Error{Kind: KindNotFound, Code: "user_not_found", Message: "user not found"}
+	ErrInvalidUserID      = &Error{Kind: KindInvalid, Code: "invalid_user_id", Message: "invalid user id"}
+	ErrUsernameTaken      = &Error{Kind: KindConflict, Code: "username_taken", Message: "a user with the same name already exists"}
+	ErrLastAdmin          = &Error{Kind: KindConflict, Code: "last_admin", Message: "the last admin can't be given another role"}
+	ErrInvalidCredentials = &Error{Kind: KindInvalid, Code: "invalid_credentials", Message: "wrong user name or password"}
+	ErrSessionExpired     = &Error{Kind: KindInvalid, Code: "session_expired", Message: "the session has expired"}
+
+	ErrInvalidToken   = &Error{Kind: KindUnauthorized, Code: "invalid_token", Message: "the API token is invalid, expired or revoked"}
+	ErrTokenNotFound  = &Error{Kind: KindNotFound, Code: "token_not_found", Message: "API token not found"}
+	ErrInvalidTokenID = &Error{Kind: KindInvalid, Code: "invalid_token_id", Message: "invalid API token id"}
+
+	ErrSSOFailed     = &Error{Kind: KindUnauthorized, Code: "sso_failed", Message: "single sign-on failed, please try again"}
+	ErrSSONotAllowed = &Error{Kind: KindForbidden, Code: "sso_not_allowed", Message: "this account is not allowed to sign in here"}
+)
+
+// KindOf returns the kind of the first service error in err's chain, or KindInternal if there is none
+func KindOf(err error) Kind {
+	var svcErr *Error
+	if errors.As(err, &svcErr) {
+		return svcErr.Kind
+	}
+	return KindInternal
+}
+
+// CodeOf returns the code of the first service error in err's chain, or "internal" if there is none
+func CodeOf(err error) string {
+	var svcErr *Error
+	if errors.As(err, &svcErr) {
+		return svcErr.Code
+	}
+	return KindInternal.String()
+}
+
+// wrap returns a copy of sentinel caused by err
+func wrap(sentinel *Error, err error) *Error {
+	return &Error{Kind: sentinel.Kind, Code: sentinel.Code, Message: sentinel.Message, Err: err}
+}
+
+// translate converts repository and validation errors into service errors.
+// Other errors, including service errors, are returned unchanged.
+func translate(err error) error {
+	var validationErrs model.ValidationErrors
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, new(*Error)):
+		return err
+	case errors.Is(err, repository.ErrPostNotFound):
+		return wrap(ErrPostNotFound, err)
+	case errors.Is(err, repository.ErrInvalidID):
+		return wrap(ErrInvalidID, err)
+	case errors.Is(err, repository.ErrDuplicate):
+		return wrap(ErrConflict, err)
+	case errors.Is(err, repository.ErrWebhookNotFound):
+		return wrap(ErrWebhookNotFound, err)
+	case errors.Is(err, repository.ErrDeliveryNotFound):
+		return wrap(ErrDeliveryNotFound, err)
+	case errors.Is(err, repository.ErrUserNotFound):
+		return wrap(ErrUserNotFound, err)
+	case errors.Is(err, repository.ErrUsernameTaken):
+		return wrap(ErrUsernameTaken, err)
+	case errors.Is(err, repository.ErrSessionNotFound):
+		return wrap(ErrSessionExpired, err)
+	case errors.Is(err, repository.ErrTokenNotFound):
+		return wrap(ErrTokenNotFound, err)
+	case errors.As(err, &validationErrs):
+		// The message lists every field, like model.ValidationErrors itself
+		invalid := wrap(ErrInvalidFields, err)
+		invalid.Message = validationErrs.Error()
+		return invalid
+	default:
+		return err
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+)
+
+func TestTranslate(t *testing.T) {
+	internal := errors.New("connection refused")
+	fieldErrs := model.ValidationErrors{{Field: "title", Code: model.CodeRequired, Message: "title is required"}}
+
+	tests := []struct {
+		name     string
+		err      error
+		wantKind Kind
+		wantIs   error
+		wantMsg  string
+	}{
+		{"not found", repository.ErrPostNotFound, KindNotFound, ErrPostNotFound, "post not found"},
+		{"invalid id", repository.ErrInvalidID, KindInvalid, ErrInvalidID, "invalid post id"},
+		{"duplicate", repository.ErrDuplicate, KindConflict, ErrConflict, ErrConflict.Message},
+		{"user name taken", repository.ErrUsernameTaken, KindConflict, ErrUsernameTaken, ErrUsernameTaken.Message},
+		{"validation", fieldErrs, KindValidation, ErrInvalidFields, "title is required"},
+		{"wrapped service error", fmt.Errorf("%w: bad sort", ErrValidationFailed), KindInvalid, ErrValidationFailed, "validation failed: bad sort"},
+		{"internal", internal, KindInternal, internal, "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := translate(tt.err)
+			if got := KindOf(err); got != tt.wantKind {
+				t.Errorf("KindOf() = %v, want %v", got, tt.wantKind)
+			}
+			if !errors.Is(err, tt.wantIs) {
+				t.Errorf("translate() = %v, want it to match %v", err, tt.wantIs)
+			}
+			if errors.Unwrap(err) == nil && err != tt.err {
+				t.Errorf("translate() = %v, want it to wrap %v", err, tt.err)
+			}
+			if err.Error() != tt.wantMsg {
+				t.Errorf("Error() = %q, want %q", err.Error(), tt.wantMsg)
+			}
+		})
+	}
+
+	var validationErrs model.ValidationErrors
+	if !errors.As(translate(fieldErrs), &validationErrs) || validationErrs.For("title") == "" {
+		t.Errorf("translate() of validation errors doesn't expose the field errors")
+	}
+	if translate(nil) != nil {
+		t.Errorf("translate(nil) != nil")
+	}
+	if errors.Is(translate(repository.ErrPostNotFound), ErrInvalidID) {
+		t.Errorf("not found error matches ErrInvalidID")
+	}
+}
+
+func TestDeletePostNotFound(t *testing.T) {
+	service := NewPostService(&mockPostRepository{
+		deleteFunc: func(ctx context.Context, id string) error {
+			return repository.ErrPostNotFound
+		},
+	})
+
+	err := service.DeletePost(context.Background(), "507f1f77bcf86cd799439011")
+	if !errors.Is(err, ErrPostNotFound) || KindOf(err) != KindNotFound {
+		t.Errorf("DeletePost() error = %v, want %v", err, ErrPostNotFound)
+	}
+}
@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WithEventListener registers fn to be called with an event for every changed post.
+// Listeners run after the change is written, in the request that made it, so they must not block.
+// Events a crash must not lose belong in the outbox; see WithOutbox.
+func WithEventListener(fn func(ctx context.Context, event model.PostEvent)) Option {
+	return func(s *PostService) {
+		s.eventListeners = append(s.eventListeners, fn)
+	}
+}
+
+// WithOutbox stores the events of every change in the outbox, in the same transaction as the change,
+// so that an OutboxRelay delivers them even if the process stops right after the change.
+// Without a transactor, e.g. on a standalone server, events are written right after the change
+// and lost if the process stops in between.
+func WithOutbox(repo repository.OutboxRepository, transactor repository.Transactor) Option {
+	return func(s *PostService) {
+		s.outbox = repo
+		s.transactor = transactor
+	}
+}
+
+// errBatchFailed aborts the transaction of an imported batch in which some posts failed to be written
+var errBatchFailed = errors.New("some posts of the batch failed")
+
+// transact runs write in a transaction when the service has a transactor, and directly otherwise
+func (s *PostService) transact(ctx context.Context, write func(ctx context.Context) error) error {
+	if s.transactor == nil {
+		return write(ctx)
+	}
+	return s.transactor.WithTransaction(ctx, write)
+}
+
+// store adds the events to the outbox, if any. Called within transact, they are written with the change.
+func (s *PostService) store(ctx context.Context, events []model.PostEvent) error {
+	if s.outbox == nil || len(events) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	records := make([]*model.OutboxRecord, len(events))
+	for i, event := range events {
+		records[i] = model.NewOutboxRecord(event, now)
+	}
+	if err := s.outbox.Add(ctx, records...); err != nil {
+		return fmt.Errorf("failed to write outbox: %w", err)
+	}
+	return nil
+}
+
+// publish passes the events to every event listener
+func (s *PostService) publish(ctx context.Context, events ...model.PostEvent) {
+	for _, event := range events {
+		for _, listener := range s.eventListeners {
+			listener(ctx, event)
+		}
+	}
+}
+
+// changePost writes a change of a single post with write, together with its events, then records the change
+// in the audit log and publishes the events. Before is nil for created posts and after is nil for deleted ones.
+func (s *PostService) changePost(ctx context.Context, action model.AuditAction, before, after *model.Post, write func(ctx context.Context) error) error {
+	var entry *model.AuditEntry
+	var events []model.PostEvent
+	err := s.transact(ctx, func(ctx context.Context) error {
+		if err := write(ctx); err != nil {
+			return err
+		}
+
+		// Created posts get their ID from write
+		entry = &model.AuditEntry{Action: action, Before: before, After: snapshot(after)}
+		if after != nil {
+			entry.PostID = after.ID
+		} else if before != nil {
+			entry.PostID = before.ID
+		}
+		events = forTenant(ctx, changeEvents(entry.PostID, before, entry.After))
+		return s.store(ctx, events)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.record(ctx, entry)
+	s.publish(ctx, events...)
+	s.notifyChanged(ctx)
+	return nil
+}
+
+// changePosts writes a bulk action on the posts with the given IDs with write, together with its events,
+// then records the action on each post and publishes the events.
+// Bulk actions don't load the posts, so neither the audit entries nor the events have snapshots,
+// and setting the status to published counts as publishing every selected post.
+func (s *PostService) changePosts(ctx context.Context, action model.AuditAction, ids []primitive.ObjectID, changes repository.PostChanges, write func(ctx context.Context) error) error {
+	var events []model.PostEvent
+	err := s.transact(ctx, func(ctx context.Context) error {
+		if err := write(ctx); err != nil {
+			return err
+		}
+		events = forTenant(ctx, bulkEvents(action, ids, changes))
+		return s.store(ctx, events)
+	})
+	if err != nil {
+		return err
+	}
+
+	entries := make([]*model.AuditEntry, len(ids))
+	for i, id := range ids {
+		entries[i] = &model.AuditEntry{Action: action, PostID: id, Source: "bulk", Details: changes.String()}
+	}
+	s.record(ctx, entries...)
+	s.publish(ctx, events...)
+	s.notifyChanged(ctx)
+	return nil
+}
+
+// upsertBatch writes a batch of imported posts together with a post.updated event for each written post,
+// then records them in the audit log and publishes the events. Imports don't tell created posts from replaced ones.
+// A write error aborts a whole transaction, so in transactions a batch with failed posts is written again without them.
+// The returned result counts every attempt, and its failures are indexed like the batch.
+func (s *PostService) upsertBatch(ctx context.Context, batch []*model.Post) (*repository.BulkUpsertResult, error) {
+	total := &repository.BulkUpsertResult{Failed: make(map[int]error)}
+	// indexes maps the posts being written to their index in the batch
+	indexes := make([]int, len(batch))
+	for i := range batch {
+		indexes[i] = i
+	}
+
+	for len(indexes) > 0 {
+		posts := make([]*model.Post, len(indexes))
+		for i, index := range indexes {
+			posts[i] = batch[index]
+		}
+
+		var result *repository.BulkUpsertResult
+		var events []model.PostEvent
+		err := s.transact(ctx, func(ctx context.Context) error {
+			var err error
+			result, err = s.repo.BulkUpsert(ctx, posts)
+			if err != nil {
+				return err
+			}
+			if len(result.Failed) > 0 && s.transactor != nil {
+				return errBatchFailed
+			}
+			events = forTenant(ctx, importEvents(posts, result.Failed))
+			return s.store(ctx, events)
+		})
+		if err != nil && !errors.Is(err, errBatchFailed) {
+			return nil, err
+		}
+
+		remaining := indexes[:0:0]
+		for i, index := range indexes {
+			if failure := result.Failed[i]; failure != nil {
+				total.Failed[index] = failure
+			} else if err != nil {
+				remaining = append(remaining, index)
+			}
+		}
+		if err == nil {
+			total.Inserted += result.Inserted
+			total.Updated += result.Updated
+			s.recordImport(ctx, posts, result.Failed)
+			s.publish(ctx, events...)
+		}
+		indexes = remaining
+	}
+
+	return total, nil
+}
+
+// recordImport records every written post of an imported batch in the audit log
+func (s *PostService) recordImport(ctx context.Context, posts []*model.Post, failed map[int]error) {
+	var entries []*model.AuditEntry
+	for i, post := range posts {
+		if failed[i] == nil {
+			entries = append(entries, &model.AuditEntry{Action: model.AuditImport, PostID: post.ID, Source: "import", After: snapshot(post)})
+		}
+	}
+	s.record(ctx, entries...)
+}
+
+// forTenant sets the tenant of ctx, whose posts were changed, on the events and returns them
+func forTenant(ctx context.Context, events []model.PostEvent) []model.PostEvent {
+	id := tenant.ID(ctx)
+	for i := range events {
+		events[i].TenantID = id
+	}
+	return events
+}
+
+// changeEvents returns the events of a change of a single post from before to after.
+// A post that is published after the change but wasn't before also gets a post.published event.
+func changeEvents(id primitive.ObjectID, before, after *model.Post) []model.PostEvent {
+	now := time.Now()
+	switch {
+	case after == nil:
+		return []model.PostEvent{model.NewPostEvent(model.EventPostDeleted, id, before, now)}
+	case before == nil:
+		events := []model.PostEvent{model.NewPostEvent(model.EventPostCreated, id, after, now)}
+		if after.EffectiveStatus() == model.StatusPublished {
+			events = append(events, model.NewPostEvent(model.EventPostPublished, id, after, now))
+		}
+		return events
+	default:
+		events := []model.PostEvent{model.NewPostEvent(model.EventPostUpdated, id, after, now)}
+		if after.EffectiveStatus() == model.StatusPublished && before.EffectiveStatus() != model.StatusPublished {
+			events = append(events, model.NewPostEvent(model.EventPostPublished, id, after, now))
+		}
+		return events
+	}
+}
+
+// bulkEvents returns the events of a bulk action on the posts with the given IDs
+func bulkEvents(action model.AuditAction, ids []primitive.ObjectID, changes repository.PostChanges) []model.PostEvent {
+	var events []model.PostEvent
+	now := time.Now()
+	for _, id := range ids {
+		if action == model.AuditDelete {
+			events = append(events, model.NewPostEvent(model.EventPostDeleted, id, nil, now))
+			continue
+		}
+		events = append(events, model.NewPostEvent(model.EventPostUpdated, id, nil, now))
+		if changes.Status == model.StatusPublished {
+			events = append(events, model.NewPostEvent(model.EventPostPublished, id, nil, now))
+		}
+	}
+	return events
+}
+
+// importEvents returns a post.updated event for every written post of an imported batch
+func importEvents(posts []*model.Post, failed map[int]error) []model.PostEvent {
+	var events []model.PostEvent
+	now := time.Now()
+	for i, post := range posts {
+		if failed[i] == nil {
+			events = append(events, model.NewPostEvent(model.EventPostUpdated, post.ID, snapshot(post), now))
+		}
+	}
+	return events
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestChangeEvents(t *testing.T) {
+	draft := &model.Post{Title: "Draft", Status: model.StatusDraft}
+	published := &model.Post{Title: "Published", Status: model.StatusPublished}
+
+	tests := []struct {
+		name   string
+		before *model.Post
+		after  *model.Post
+		want   []model.EventType
+	}{
+		{"create draft", nil, draft, []model.EventType{model.EventPostCreated}},
+		{"create published", nil, published, []model.EventType{model.EventPostCreated, model.EventPostPublished}},
+		{"publish", draft, published, []model.EventType{model.EventPostUpdated, model.EventPostPublished}},
+		{"edit published", published, published, []model.EventType{model.EventPostUpdated}},
+		{"delete", published, nil, []model.EventType{model.EventPostDeleted}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := primitive.NewObjectID()
+			events := changeEvents(id, tt.before, tt.after)
+
+			if len(events) != len(tt.want) {
+				t.Fatalf("changeEvents() returned %d events, want %v", len(events), tt.want)
+			}
+			for i, event := range events {
+				if event.Type != tt.want[i] || event.PostID != id {
+					t.Errorf("event %d = %s of %s, want %s of %s", i, event.Type, event.PostID.Hex(), tt.want[i], id.Hex())
+				}
+				if event.Post == nil {
+					t.Errorf("event %d has no post", i)
+				}
+			}
+		})
+	}
+}
+
+func TestEventListener(t *testing.T) {
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	repo := &mockPostRepository{
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			return ids, nil
+		},
+		updateManyFunc: func(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error) {
+			return int64(len(filter.IDs)), nil
+		},
+	}
+
+	var events []model.PostEvent
+	service := NewPostService(repo, WithEventListener(func(ctx context.Context, event model.PostEvent) {
+		events = append(events, event)
+	}))
+
+	post, err := service.CreatePost(context.Background(), PostInput{Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if len(events) == 0 || events[0].Type != model.EventPostCreated || events[0].Post.Title != post.Title || events[0].TenantID != tenant.DefaultID {
+		t.Errorf("CreatePost() events = %+v, want post.created with the post of the default tenant", events)
+	}
+
+	events = nil
+	if _, err := service.BulkSetStatus(tenant.WithID(context.Background(), "daily"), BulkSelection{AllMatching: true}, model.StatusPublished); err != nil {
+		t.Fatalf("BulkSetStatus() error = %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("BulkSetStatus() published %d events, want post.updated and post.published for each post", len(events))
+	}
+	for i, event := range events {
+		want := model.EventPostUpdated
+		if i%2 == 1 {
+			want = model.EventPostPublished
+		}
+		if event.Type != want || event.PostID != ids[i/2] || event.Post != nil || event.TenantID != "daily" {
+			t.Errorf("bulk event %d = %+v, want %s of %s of the daily tenant without a post", i, event, want, ids[i/2].Hex())
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+)
+
+// EventSink receives the events relayed from the outbox.
+// Delivery is at least once: an event may be passed again after a crash or a failure,
+// so sinks must use the event ID to drop events they already handled.
+type EventSink interface {
+	// Name identifies the sink in outbox records; it must not change between releases
+	Name() string
+	HandleEvent(ctx context.Context, event model.PostEvent) error
+}
+
+// RelayOptions tunes an outbox relay; zero values fall back to the defaults of NewOutboxRelay
+type RelayOptions struct {
+	// Backoff is the delay before the first retry of a failed event; each further retry waits twice as long, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a claimed record is hidden from other relays; it must outlast the sinks
+	Lease time.Duration
+}
+
+// OutboxRelay drains the outbox, passing every event to each sink in the order the events were written.
+// Failed events are retried with backoff until every sink has handled them.
+type OutboxRelay struct {
+	outbox  repository.OutboxRepository
+	sinks   []EventSink
+	options RelayOptions
+	wake    chan struct{}
+	now     func() time.Time
+}
+
+// NewOutboxRelay creates a new outbox relay.
+// By default a failed event is retried after 5s, 10s, 20s and so on up to 10 minutes, and claimed for a minute.
+func NewOutboxRelay(outbox repository.OutboxRepository, sinks []EventSink, options RelayOptions) *OutboxRelay {
+	if options.Backoff <= 0 {
+		options.Backoff = 5 * time.Second
+	}
+	if options.MaxBackoff < options.Backoff {
+		options.MaxBackoff = max(10*time.Minute, options.Backoff)
+	}
+	if options.Lease <= 0 {
+		options.Lease = time.Minute
+	}
+	return &OutboxRelay{
+		outbox:  outbox,
+		sinks:   sinks,
+		options: options,
+		wake:    make(chan struct{}, 1),
+		now:     time.Now,
+	}
+}
+
+// Notify wakes a running relay, so that new events are relayed without waiting for the next poll.
+// It is meant to be registered with WithEventListener and never blocks.
+func (r *OutboxRelay) Notify(ctx context.Context, event model.PostEvent) {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays due events every interval, and whenever Notify is called, until ctx is canceled
+func (r *OutboxRelay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RelayDue(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to relay outbox", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.wake:
+		}
+	}
+}
+
+// RelayDue passes every due event to the sinks that haven't handled it yet and returns the number of events processed.
+// Failures of sinks are stored on the records; only outbox errors are returned.
+func (r *OutboxRelay) RelayDue(ctx context.Context) (int, error) {
+	processed := 0
+	for ctx.Err() == nil {
+		record, err := r.outbox.ClaimDue(ctx, r.now(), r.options.Lease)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim outbox record: %w", err)
+		}
+		if record == nil {
+			return processed, nil
+		}
+
+		r.relay(ctx, record)
+		if err := r.outbox.SaveAttempt(ctx, record); err != nil {
+			return processed, fmt.Errorf("failed to save outbox record %s: %w", record.ID.Hex(), err)
+		}
+		if record.Status == model.OutboxProcessed {
+			processed++
+		}
+	}
+	return processed, nil
+}
+
+// relay passes the record's event to the sinks that haven't handled it and updates the record with the outcome
+func (r *OutboxRelay) relay(ctx context.Context, record *model.OutboxRecord) {
+	var errs []error
+	for _, sink := range r.sinks {
+		if slices.Contains(record.HandledBy, sink.Name()) {
+			continue
+		}
+		if err := sink.HandleEvent(ctx, record.Event); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		record.HandledBy = append(record.HandledBy, sink.Name())
+	}
+
+	record.Attempts++
+	if len(errs) == 0 {
+		record.Status = model.OutboxProcessed
+		record.LastError = ""
+		record.ProcessedAt = r.now()
+		return
+	}
+
+	record.LastError = errors.Join(errs...).Error()
+	record.NextAttemptAt = r.now().Add(r.backoff(record.Attempts))
+	slog.Warn("Outbox event failed", "id", record.ID.Hex(), "event", record.Event.Type, "attempts", record.Attempts, "error", record.LastError)
+}
+
+// backoff returns the delay before the next attempt after the given number of failed attempts
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	delay := r.options.Backoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= r.options.MaxBackoff {
+			return r.options.MaxBackoff
+		}
+	}
+	return delay
+}
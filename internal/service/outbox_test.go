@@ -0,0 +1,254 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+)
+
+type mockOutboxRepository struct {
+	records []*model.OutboxRecord
+	addErr  error
+}
+
+func (m *mockOutboxRepository) Add(ctx context.Context, records ...*model.OutboxRecord) error {
+	if m.addErr != nil {
+		return m.addErr
+	}
+	m.records = append(m.records, records...)
+	return nil
+}
+
+func (m *mockOutboxRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.OutboxRecord, error) {
+	for _, record := range m.records {
+		if record.Status == model.OutboxPending && !record.NextAttemptAt.After(now) {
+			record.NextAttemptAt = now.Add(lease)
+			claimed := *record
+			claimed.HandledBy = append([]string(nil), record.HandledBy...)
+			return &claimed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *mockOutboxRepository) SaveAttempt(ctx context.Context, record *model.OutboxRecord) error {
+	for i, stored := range m.records {
+		if stored.ID == record.ID {
+			saved := *record
+			m.records[i] = &saved
+			return nil
+		}
+	}
+	return repository.ErrOutboxRecordNotFound
+}
+
+// mockTransactor counts transactions; like MongoDB, it aborts them by dropping the outbox records they added
+type mockTransactor struct {
+	outbox       *mockOutboxRepository
+	transactions int
+}
+
+func (m *mockTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	m.transactions++
+	written := len(m.outbox.records)
+	if err := fn(ctx); err != nil {
+		m.outbox.records = m.outbox.records[:written]
+		return err
+	}
+	return nil
+}
+
+// mockSink records the events it handles and fails while err is set
+type mockSink struct {
+	name   string
+	err    error
+	events []model.PostEvent
+}
+
+func (m *mockSink) Name() string {
+	return m.name
+}
+
+func (m *mockSink) HandleEvent(ctx context.Context, event model.PostEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestOutboxStoresEvents(t *testing.T) {
+	outbox := &mockOutboxRepository{}
+	transactor := &mockTransactor{outbox: outbox}
+	var published []model.PostEvent
+	service := NewPostService(&mockPostRepository{},
+		WithOutbox(outbox, transactor),
+		WithEventListener(func(ctx context.Context, event model.PostEvent) {
+			published = append(published, event)
+		}))
+
+	if _, err := service.CreatePost(context.Background(), PostInput{Title: "Title", Content: "Content"}); err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if transactor.transactions != 1 {
+		t.Errorf("CreatePost() ran %d transactions, want 1", transactor.transactions)
+	}
+	if len(outbox.records) != 2 || len(published) != 2 {
+		t.Fatalf("CreatePost() stored %d events and published %d, want post.created and post.published", len(outbox.records), len(published))
+	}
+	for i, record := range outbox.records {
+		if record.ID != published[i].ID || record.Event.ID != published[i].ID || record.Status != model.OutboxPending {
+			t.Errorf("record %d = %+v, want the pending published event %s", i, record, published[i].ID.Hex())
+		}
+	}
+
+	outbox.addErr = errors.New("outbox unavailable")
+	published = nil
+	if _, err := service.CreatePost(context.Background(), PostInput{Title: "Title", Content: "Content"}); err == nil {
+		t.Error("CreatePost() error = nil, want the outbox error")
+	}
+	if len(published) != 0 {
+		t.Errorf("CreatePost() published %d events of a failed change", len(published))
+	}
+}
+
+func TestOutboxImportRetriesWithoutFailedPosts(t *testing.T) {
+	var calls [][]string
+	repo := &mockPostRepository{
+		bulkUpsertFunc: func(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error) {
+			result := &repository.BulkUpsertResult{Failed: map[int]error{}}
+			var titles []string
+			for i, post := range posts {
+				titles = append(titles, post.Title)
+				if post.Slug == "taken" {
+					result.Failed[i] = errors.New("duplicate slug")
+				} else {
+					result.Inserted++
+				}
+			}
+			calls = append(calls, titles)
+			return result, nil
+		},
+	}
+	outbox := &mockOutboxRepository{}
+	transactor := &mockTransactor{outbox: outbox}
+	service := NewPostService(repo, WithOutbox(outbox, transactor))
+
+	input := `{"title": "First", "content": "Content"}
+{"title": "Second", "content": "Content", "slug": "taken"}
+{"title": "Third", "content": "Content"}
+`
+	report, err := service.ImportPosts(context.Background(), strings.NewReader(input), "jsonl", ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportPosts() error = %v", err)
+	}
+
+	if len(calls) != 2 || strings.Join(calls[1], ",") != "First,Third" {
+		t.Errorf("BulkUpsert() calls = %v, want the batch written again without the failed post", calls)
+	}
+	if report.Inserted != 2 || len(report.Errors) != 1 || report.Errors[0].Line != 2 {
+		t.Errorf("report = %+v, want 2 inserted and line 2 failed", report)
+	}
+	if len(outbox.records) != 2 {
+		t.Fatalf("outbox has %d records, want one per written post", len(outbox.records))
+	}
+	for i, title := range []string{"First", "Third"} {
+		if event := outbox.records[i].Event; event.Type != model.EventPostUpdated || event.Post.Title != title {
+			t.Errorf("record %d = %s of %q, want post.updated of %q", i, event.Type, event.Post.Title, title)
+		}
+	}
+}
+
+func TestOutboxRelay(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	event := model.NewPostEvent(model.EventPostDeleted, [12]byte{1}, nil, now)
+	outbox := &mockOutboxRepository{records: []*model.OutboxRecord{model.NewOutboxRecord(event, now)}}
+	healthy := &mockSink{name: "healthy"}
+	flaky := &mockSink{name: "flaky", err: errors.New("unavailable")}
+
+	relay := NewOutboxRelay(outbox, []EventSink{healthy, flaky}, RelayOptions{Backoff: time.Minute})
+	relay.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if count, err := relay.RelayDue(ctx); err != nil || count != 0 {
+		t.Fatalf("RelayDue() = %d, %v, want no processed event", count, err)
+	}
+	record := outbox.records[0]
+	if record.Status != model.OutboxPending || record.Attempts != 1 || !record.NextAttemptAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("record = %+v, want pending and retried in a minute", record)
+	}
+	if !strings.Contains(record.LastError, "flaky: unavailable") {
+		t.Errorf("LastError = %q, want the failing sink's error", record.LastError)
+	}
+
+	flaky.err = nil
+	if count, _ := relay.RelayDue(ctx); count != 0 {
+		t.Errorf("RelayDue() relayed %d events before the backoff elapsed", count)
+	}
+	now = now.Add(time.Minute)
+	if count, err := relay.RelayDue(ctx); err != nil || count != 1 {
+		t.Fatalf("RelayDue() = %d, %v, want the event processed", count, err)
+	}
+
+	record = outbox.records[0]
+	if record.Status != model.OutboxProcessed || record.LastError != "" || !record.ProcessedAt.Equal(now) {
+		t.Errorf("record = %+v, want processed", record)
+	}
+	if len(healthy.events) != 1 {
+		t.Errorf("healthy sink got the event %d times, want once", len(healthy.events))
+	}
+	if len(flaky.events) != 1 || flaky.events[0].ID != event.ID {
+		t.Errorf("flaky sink got %+v, want the event once it recovered", flaky.events)
+	}
+}
+
+func TestOutboxRelayBackoff(t *testing.T) {
+	relay := NewOutboxRelay(&mockOutboxRepository{}, nil, RelayOptions{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second},
+		{20, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := relay.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestReindexSearchRunsInTransaction(t *testing.T) {
+	transactor := &mockTransactor{outbox: &mockOutboxRepository{}}
+	repo := &mockPostRepository{
+		refreshFunc: func(ctx context.Context) (int64, error) {
+			if transactor.transactions != 1 {
+				t.Error("RefreshTextLanguages() ran outside a transaction")
+			}
+			return 3, nil
+		},
+	}
+	service := NewPostService(repo, WithOutbox(transactor.outbox, transactor))
+
+	updated, err := service.ReindexSearch(context.Background())
+	if err != nil || updated != 3 {
+		t.Errorf("ReindexSearch() = %d, %v, want 3 updated posts", updated, err)
+	}
+
+	repo.refreshFunc = func(ctx context.Context) (int64, error) {
+		return 0, errors.New("bulk write failed")
+	}
+	if _, err := service.ReindexSearch(context.Background()); err == nil {
+		t.Error("ReindexSearch() error = nil, want the repository error")
+	}
+}
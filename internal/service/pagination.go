@@ -0,0 +1,40 @@
+package service
+
+// Pagination describes where a page sits within a list of posts
+type Pagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	TotalItems int64 `json:"total_items"`
+	TotalPages int   `json:"total_pages"`
+	HasPrev    bool  `json:"has_prev"`
+	HasNext    bool  `json:"has_next"`
+	// Estimated is set when TotalItems is an estimate, see WithEstimatedCount
+	Estimated bool `json:"estimated"`
+}
+
+// NewPagination computes pagination for the given page of a list with total items
+func NewPagination(page, pageSize int, total int64) Pagination {
+	totalPages := int(total) / pageSize
+	if int(total)%pageSize != 0 {
+		totalPages++
+	}
+
+	return Pagination{
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: total,
+		TotalPages: totalPages,
+		HasPrev:    page > 1,
+		HasNext:    page < totalPages,
+	}
+}
+
+// PrevPage returns the number of the previous page
+func (p Pagination) PrevPage() int {
+	return p.Page - 1
+}
+
+// NextPage returns the number of the next page
+func (p Pagination) NextPage() int {
+	return p.Page + 1
+}
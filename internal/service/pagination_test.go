@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+)
+
+func TestNewPagination(t *testing.T) {
+	tests := []struct {
+		name     string
+		page     int
+		pageSize int
+		total    int64
+		want     Pagination
+	}{
+		{
+			name:     "empty list",
+			page:     1,
+			pageSize: 10,
+			total:    0,
+			want:     Pagination{Page: 1, PageSize: 10, TotalItems: 0, TotalPages: 0},
+		},
+		{
+			name:     "single page",
+			page:     1,
+			pageSize: 10,
+			total:    10,
+			want:     Pagination{Page: 1, PageSize: 10, TotalItems: 10, TotalPages: 1},
+		},
+		{
+			name:     "first of several pages",
+			page:     1,
+			pageSize: 10,
+			total:    21,
+			want:     Pagination{Page: 1, PageSize: 10, TotalItems: 21, TotalPages: 3, HasNext: true},
+		},
+		{
+			name:     "middle page",
+			page:     2,
+			pageSize: 10,
+			total:    21,
+			want:     Pagination{Page: 2, PageSize: 10, TotalItems: 21, TotalPages: 3, HasPrev: true, HasNext: true},
+		},
+		{
+			name:     "last page",
+			page:     3,
+			pageSize: 10,
+			total:    21,
+			want:     Pagination{Page: 3, PageSize: 10, TotalItems: 21, TotalPages: 3, HasPrev: true},
+		},
+		{
+			name:     "page past the end",
+			page:     5,
+			pageSize: 10,
+			total:    21,
+			want:     Pagination{Page: 5, PageSize: 10, TotalItems: 21, TotalPages: 3, HasPrev: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewPagination(tt.page, tt.pageSize, tt.total)
+			if got != tt.want {
+				t.Errorf("NewPagination() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPostsEstimatedCount(t *testing.T) {
+	var estimate bool
+	repo := &mockPostRepository{
+		findPageFunc: func(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error) {
+			estimate = query.EstimateTotal
+			return &repository.PostPage{Total: 100, Estimated: query.EstimateTotal}, nil
+		},
+	}
+	service := NewPostService(repo, WithEstimatedCount(true))
+
+	_, pagination, err := service.GetPosts(context.Background(), 1, 10)
+	if err != nil {
+		t.Fatalf("GetPosts() unexpected error = %v", err)
+	}
+	if !estimate {
+		t.Errorf("FindPage() EstimateTotal = false, want true")
+	}
+	if !pagination.Estimated {
+		t.Errorf("GetPosts() pagination.Estimated = false, want true")
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"slices"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+// Can reports whether the actor's role grants permission p and, for API tokens, one of its scopes allows it
+func (a Actor) Can(p model.Permission) bool {
+	if !a.Role.Can(p) {
+		return false
+	}
+	if a.Scopes == nil {
+		return true
+	}
+	for _, scope := range a.Scopes {
+		if scope.Allows(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the actor may use scope s: API tokens need to have it, browsers always may
+func (a Actor) HasScope(s model.TokenScope) bool {
+	return a.Scopes == nil || slices.Contains(a.Scopes, s)
+}
+
+// Owns reports whether the actor wrote post. Anonymous visitors own no posts.
+func (a Actor) Owns(post *model.Post) bool {
+	return post.AuthorID != "" && a.ID != AnonymousActor && post.AuthorID == a.ID
+}
+
+// CanEdit reports whether the actor may edit post: every post with PermEditAny, or their own with PermEditOwn
+func (a Actor) CanEdit(post *model.Post) bool {
+	return a.Can(model.PermEditAny) || (a.Can(model.PermEditOwn) && a.Owns(post))
+}
+
+// authorize returns ErrForbidden unless the actor of ctx has every permission
+func authorize(ctx context.Context, permissions ...model.Permission) error {
+	actor := ActorFrom(ctx)
+	for _, p := range permissions {
+		if !actor.Can(p) {
+			return ErrForbidden
+		}
+	}
+	return nil
+}
+
+// authorizeEdit returns ErrForbidden unless the actor of ctx may edit post
+func authorizeEdit(ctx context.Context, post *model.Post) error {
+	if !ActorFrom(ctx).CanEdit(post) {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPostServicePermissions(t *testing.T) {
+	own := &model.Post{ID: primitive.NewObjectID(), Title: "Own", Content: "Content", AuthorID: "jane"}
+	other := &model.Post{ID: primitive.NewObjectID(), Title: "Other", Content: "Content", AuthorID: "john"}
+	repo := &mockPostRepository{
+		findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+			for _, post := range []*model.Post{own, other} {
+				if post.ID.Hex() == id {
+					copied := *post
+					return &copied, nil
+				}
+			}
+			return nil, repository.ErrPostNotFound
+		},
+		findIDsFunc: func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+			return filter.IDs, nil
+		},
+	}
+	service := NewPostService(repo)
+
+	input := PostInput{Title: "Title", Content: "Content"}
+	selection := BulkSelection{IDs: []string{own.ID.Hex()}}
+	operations := map[string]func(ctx context.Context) error{
+		"create": func(ctx context.Context) error {
+			_, err := service.CreatePost(ctx, input)
+			return err
+		},
+		"edit own": func(ctx context.Context) error {
+			_, err := service.UpdatePost(ctx, own.ID.Hex(), input)
+			return err
+		},
+		"edit other": func(ctx context.Context) error {
+			_, err := service.UpdatePost(ctx, other.ID.Hex(), input)
+			return err
+		},
+		"translate other": func(ctx context.Context) error {
+			_, err := service.SaveTranslation(ctx, other.ID.Hex(), "uk", TranslationInput{Title: "Назва", Content: "Зміст"})
+			return err
+		},
+		"delete": func(ctx context.Context) error {
+			return service.DeletePost(ctx, own.ID.Hex())
+		},
+		"bulk tag": func(ctx context.Context) error {
+			_, err := service.BulkTag(ctx, selection, []string{"news"}, false)
+			return err
+		},
+		"bulk publish": func(ctx context.Context) error {
+			_, err := service.BulkSetStatus(ctx, selection, model.StatusPublished)
+			return err
+		},
+		"import": func(ctx context.Context) error {
+			_, err := service.LoadPosts(ctx, nil, ImportOptions{})
+			return err
+		},
+	}
+
+	tests := []struct {
+		role    model.Role
+		allowed []string
+	}{
+		{model.RoleReader, nil},
+		{model.RoleAuthor, []string{"create", "edit own"}},
+		{model.RoleEditor, []string{"create", "edit own", "edit other", "translate other", "delete", "bulk tag", "bulk publish", "import"}},
+		{model.RoleAdmin, []string{"create", "edit own", "edit other", "translate other", "delete", "bulk tag", "bulk publish", "import"}},
+	}
+
+	for _, tt := range tests {
+		ctx := WithActor(context.Background(), Actor{ID: "jane", Role: tt.role})
+		for name, operation := range operations {
+			t.Run(string(tt.role)+" "+name, func(t *testing.T) {
+				allowed := false
+				for _, a := range tt.allowed {
+					allowed = allowed || a == name
+				}
+
+				err := operation(ctx)
+				if forbidden := errors.Is(err, ErrForbidden); forbidden == allowed {
+					t.Errorf("error = %v, want allowed = %v", err, allowed)
+				}
+			})
+		}
+	}
+}
+
+func TestCreatePostAuthorAndStatus(t *testing.T) {
+	service := NewPostService(&mockPostRepository{})
+
+	author := WithActor(context.Background(), Actor{ID: "jane", Role: model.RoleAuthor})
+	post, err := service.CreatePost(author, PostInput{Title: "Title", Content: "Content"})
+	if err != nil {
+		t.Fatalf("CreatePost() error = %v", err)
+	}
+	if post.AuthorID != "jane" || post.Status != model.StatusDraft {
+		t.Errorf("post of an author = %q, %s, want written by jane as a draft", post.AuthorID, post.Status)
+	}
+
+	editor := WithActor(context.Background(), Actor{ID: "john", Role: model.RoleEditor})
+	if post, err = service.CreatePost(editor, PostInput{Title: "Title", Content: "Content"}); err != nil || post.Status != model.StatusPublished {
+		t.Errorf("post of an editor = %v, %v, want it published", post, err)
+	}
+
+	anonymous := WithActor(context.Background(), Actor{ID: AnonymousActor, Role: model.RoleAuthor})
+	if post, err = service.CreatePost(anonymous, PostInput{Title: "Title", Content: "Content"}); err != nil || post.AuthorID != "" {
+		t.Errorf("post of an anonymous visitor = %v, %v, want it without author", post, err)
+	}
+	if (Actor{ID: AnonymousActor, Role: model.RoleAuthor}).CanEdit(post) {
+		t.Error("anonymous authors can edit posts written anonymously")
+	}
+}
+
+func TestActorScopes(t *testing.T) {
+	tests := []struct {
+		name   string
+		actor  Actor
+		perm   model.Permission
+		wantOK bool
+	}{
+		{"session", Actor{Role: model.RoleEditor}, model.PermDelete, true},
+		{"write scope", Actor{Role: model.RoleEditor, Scopes: []model.TokenScope{model.ScopeWrite}}, model.PermDelete, true},
+		{"read scope", Actor{Role: model.RoleEditor, Scopes: []model.TokenScope{model.ScopeRead}}, model.PermDelete, false},
+		{"write scope without admin", Actor{Role: model.RoleEditor, Scopes: []model.TokenScope{model.ScopeWrite}}, model.PermModerate, false},
+		{"admin scope", Actor{Role: model.RoleAdmin, Scopes: []model.TokenScope{model.ScopeRead, model.ScopeAdmin}}, model.PermManage, true},
+		{"scope beyond role", Actor{Role: model.RoleAuthor, Scopes: []model.TokenScope{model.ScopeAdmin}}, model.PermModerate, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.actor.Can(tt.perm); got != tt.wantOK {
+				t.Errorf("Can(%s) = %v, want %v", tt.perm, got, tt.wantOK)
+			}
+		})
+	}
+}
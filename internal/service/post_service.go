@@ -2,151 +2,308 @@ package service
 
 import (
 	"context"
-	"errors"
+	"fmt"
+	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
 	"github.com/iyhunko/go-htmx-mongo/internal/repository"
-)
-
-var (
-	ErrPostNotFound     = errors.New("post not found")
-	ErrInvalidID        = errors.New("invalid post id")
-	ErrValidationFailed = errors.New("validation failed")
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
 )
 
 // PostService handles business logic for posts
 type PostService struct {
-	repo repository.PostRepository
+	repo            repository.PostRepository
+	changeListeners []func(ctx context.Context)
+	estimateCount   bool
+	validator       *validation.Validator
+	audit           repository.AuditRepository
+	eventListeners  []func(ctx context.Context, event model.PostEvent)
+	outbox          repository.OutboxRepository
+	transactor      repository.Transactor
+	bulkBatchSize   int
 }
 
-// NewPostService creates a new post service
-func NewPostService(repo repository.PostRepository) *PostService {
-	return &PostService{
-		repo: repo,
+// PostInput holds the user editable fields of a post
+type PostInput struct {
+	Title   string   `json:"title"`
+	Content string   `json:"content"`
+	Tags    []string `json:"tags"`
+	// Language is the language of the title and content; empty keeps the current one, or the default for new posts
+	Language string `json:"language"`
+}
+
+// Option configures optional PostService dependencies
+type Option func(*PostService)
+
+// WithChangeListener registers fn to be called after every successful write, e.g. to invalidate caches
+func WithChangeListener(fn func(ctx context.Context)) Option {
+	return func(s *PostService) {
+		s.changeListeners = append(s.changeListeners, fn)
 	}
 }
 
-// CreatePost creates a new post with the provided title and content.
-// It validates the post before saving it to the repository.
-// Returns the created post or an error if validation or creation fails.
-func (s *PostService) CreatePost(ctx context.Context, title, content string) (*model.Post, error) {
-	post := model.NewPost(title, content)
+// WithEstimatedCount makes unfiltered post lists report the collection's estimated document count
+// as their total, which is much cheaper than counting on large collections but may be slightly off.
+// The estimate counts the posts of every tenant, so it must only be enabled when a single tenant is served.
+func WithEstimatedCount(enabled bool) Option {
+	return func(s *PostService) {
+		s.estimateCount = enabled
+	}
+}
 
-	if err := post.Validate(); err != nil {
-		return nil, err
+// WithValidator replaces the default validation of created, updated and imported posts
+func WithValidator(v *validation.Validator) Option {
+	return func(s *PostService) {
+		s.validator = v
 	}
+}
 
-	if err := s.repo.Create(ctx, post); err != nil {
-		return nil, err
+// WithBulkBatchSize sets the number of posts bulk actions write per transaction, DefaultBulkBatchSize by default
+func WithBulkBatchSize(n int) Option {
+	return func(s *PostService) {
+		if n > 0 {
+			s.bulkBatchSize = n
+		}
 	}
+}
 
-	return post, nil
+// NewPostService creates a new post service
+func NewPostService(repo repository.PostRepository, opts ...Option) *PostService {
+	s := &PostService{
+		repo:          repo,
+		validator:     validation.Default(),
+		bulkBatchSize: DefaultBulkBatchSize,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-// GetPost retrieves a post by its ID.
-// Returns the post if found, or an error if the post doesn't exist or the ID is invalid.
-func (s *PostService) GetPost(ctx context.Context, id string) (*model.Post, error) {
-	post, err := s.repo.FindByID(ctx, id)
-	if err != nil {
-		return nil, err
+// notifyChanged informs change listeners that posts were written
+func (s *PostService) notifyChanged(ctx context.Context) {
+	for _, listener := range s.changeListeners {
+		listener(ctx)
 	}
-	return post, nil
 }
 
-// GetPosts retrieves paginated posts.
-// It returns posts for the requested page, the total number of pages, and an error if any.
-// Page numbers start at 1, and invalid values are adjusted to defaults (page=1, pageSize=10).
-// Maximum page size is capped at 100.
-func (s *PostService) GetPosts(ctx context.Context, page, pageSize int) ([]*model.Post, int, error) {
-	if page < 1 {
-		page = 1
+// CreatePost creates a new post from the input, written by the actor of ctx.
+// It validates the post before saving it to the repository. Posts of actors who can't publish are drafts.
+// Returns the created post, ErrForbidden if the actor can't create posts,
+// or an error of KindValidation wrapping model.ValidationErrors that lists every invalid field.
+func (s *PostService) CreatePost(ctx context.Context, input PostInput) (*model.Post, error) {
+	if err := authorize(ctx, model.PermCreate); err != nil {
+		return nil, err
 	}
-	if pageSize < 1 {
-		pageSize = 10
+
+	post := model.NewPost(input.Title, input.Content)
+	post.Tags = model.NormalizeTags(input.Tags)
+	post.Language = model.NormalizeLanguage(input.Language)
+	if actor := ActorFrom(ctx); actor.ID != AnonymousActor {
+		post.AuthorID = actor.ID
 	}
-	if pageSize > 100 {
-		pageSize = 100
+	if !ActorFrom(ctx).Can(model.PermPublish) {
+		post.Status = model.StatusDraft
 	}
 
-	offset := (page - 1) * pageSize
+	if err := s.validator.Validate(post); err != nil {
+		return nil, translate(err)
+	}
 
-	posts, err := s.repo.FindAll(ctx, pageSize, offset)
+	err := s.changePost(ctx, model.AuditCreate, nil, post, func(ctx context.Context) error {
+		return s.repo.Create(ctx, post)
+	})
 	if err != nil {
-		return nil, 0, err
+		return nil, translate(err)
 	}
 
-	total, err := s.repo.Count(ctx)
+	return post, nil
+}
+
+// GetPost retrieves a post by its ID.
+// Returns the post if found, ErrPostNotFound if it doesn't exist, or ErrInvalidID if the ID is malformed.
+func (s *PostService) GetPost(ctx context.Context, id string) (*model.Post, error) {
+	post, err := s.repo.FindByID(ctx, id)
 	if err != nil {
-		return nil, 0, err
+		return nil, translate(err)
 	}
+	return post, nil
+}
+
+// ListQuery selects, filters and orders a page of posts
+type ListQuery struct {
+	Search string
+	// Language restricts the list to posts available in the language and the search to their text in it;
+	// empty lists posts in every language
+	Language string
+	// CreatedFrom and CreatedTo restrict posts to those created in [CreatedFrom, CreatedTo)
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Tags        []string
+	Status      model.PostStatus
+	// Sort must be one of repository.SortFields and defaults to the creation time
+	Sort       repository.SortField
+	Descending bool
+	Page       int
+	PageSize   int
+}
 
-	totalPages := int(total) / pageSize
-	if int(total)%pageSize != 0 {
-		totalPages++
+// validateFilters checks the criteria restricting the posts, once the language is normalized
+func (q ListQuery) validateFilters() error {
+	if q.Status != "" && !q.Status.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrValidationFailed, q.Status)
 	}
+	if q.Language != "" && !model.ValidLanguage(q.Language) {
+		return fmt.Errorf("%w: invalid language %q", ErrValidationFailed, q.Language)
+	}
+	if !q.CreatedFrom.IsZero() && !q.CreatedTo.IsZero() && !q.CreatedTo.After(q.CreatedFrom) {
+		return fmt.Errorf("%w: the date range is empty", ErrValidationFailed)
+	}
+	return nil
+}
 
-	return posts, totalPages, nil
+// GetPosts retrieves paginated posts, newest first.
+// It returns posts for the requested page, its pagination, and an error if any.
+// Page numbers start at 1, and invalid values are adjusted to defaults (page=1, pageSize=10).
+// Maximum page size is capped at 100.
+func (s *PostService) GetPosts(ctx context.Context, page, pageSize int) ([]*model.Post, Pagination, error) {
+	return s.ListPosts(ctx, ListQuery{Page: page, PageSize: pageSize, Sort: repository.SortByCreated, Descending: true})
 }
 
-// SearchPosts searches posts by query string in title and content.
-// It returns matching posts for the requested page, the total number of pages, and an error if any.
+// SearchPosts searches posts by query string in title and content, newest first.
+// It returns matching posts for the requested page, its pagination, and an error if any.
 // Page numbers start at 1, and invalid values are adjusted to defaults (page=1, pageSize=10).
 // Maximum page size is capped at 100.
-func (s *PostService) SearchPosts(ctx context.Context, query string, page, pageSize int) ([]*model.Post, int, error) {
-	if page < 1 {
-		page = 1
+func (s *PostService) SearchPosts(ctx context.Context, query string, page, pageSize int) ([]*model.Post, Pagination, error) {
+	return s.ListPosts(ctx, ListQuery{Search: query, Page: page, PageSize: pageSize, Sort: repository.SortByCreated, Descending: true})
+}
+
+// ListPosts retrieves a page of posts matching the query's filters in the requested order.
+// Page numbers and sizes are adjusted like in GetPosts. Unknown sort fields or statuses and
+// empty date ranges fail with ErrValidationFailed.
+func (s *PostService) ListPosts(ctx context.Context, query ListQuery) ([]*model.Post, Pagination, error) {
+	if query.Page < 1 {
+		query.Page = 1
 	}
-	if pageSize < 1 {
-		pageSize = 10
+	if query.PageSize < 1 {
+		query.PageSize = 10
 	}
-	if pageSize > 100 {
-		pageSize = 100
+	if query.PageSize > 100 {
+		query.PageSize = 100
 	}
+	if query.Sort == "" {
+		query.Sort = repository.SortByCreated
+	}
+	query.Language = model.NormalizeLanguage(query.Language)
 
-	offset := (page - 1) * pageSize
-
-	posts, err := s.repo.Search(ctx, query, pageSize, offset)
-	if err != nil {
-		return nil, 0, err
+	if !query.Sort.Valid() {
+		return nil, Pagination{}, fmt.Errorf("%w: cannot sort by %q", ErrValidationFailed, query.Sort)
+	}
+	if err := query.validateFilters(); err != nil {
+		return nil, Pagination{}, err
 	}
 
-	total, err := s.repo.CountSearch(ctx, query)
+	result, err := s.repo.FindPage(ctx, repository.PageQuery{
+		Search:        query.Search,
+		Language:      query.Language,
+		CreatedFrom:   query.CreatedFrom,
+		CreatedTo:     query.CreatedTo,
+		Tags:          model.NormalizeTags(query.Tags),
+		Status:        query.Status,
+		SortBy:        query.Sort,
+		Descending:    query.Descending,
+		Limit:         query.PageSize,
+		Offset:        (query.Page - 1) * query.PageSize,
+		EstimateTotal: s.estimateCount,
+	})
 	if err != nil {
-		return nil, 0, err
+		return nil, Pagination{}, translate(err)
 	}
 
-	totalPages := int(total) / pageSize
-	if int(total)%pageSize != 0 {
-		totalPages++
-	}
+	pagination := NewPagination(query.Page, query.PageSize, result.Total)
+	pagination.Estimated = result.Estimated
 
-	return posts, totalPages, nil
+	return result.Posts, pagination, nil
 }
 
-// UpdatePost updates an existing post with new title and content.
+// UpdatePost updates an existing post with the input's title, content and tags.
 // It retrieves the post, updates it, validates it, and saves it back to the repository.
-// Returns the updated post or an error if the post is not found or validation fails.
-func (s *PostService) UpdatePost(ctx context.Context, id, title, content string) (*model.Post, error) {
+// Tags are left unchanged when the input has none (nil), and cleared when they are empty.
+// Returns the updated post or an error if the post is not found, the actor can't edit it or validation fails.
+func (s *PostService) UpdatePost(ctx context.Context, id string, input PostInput) (*model.Post, error) {
 	post, err := s.repo.FindByID(ctx, id)
 	if err != nil {
+		return nil, translate(err)
+	}
+	if err := authorizeEdit(ctx, post); err != nil {
 		return nil, err
 	}
+	before := snapshot(post)
 
-	post.Update(title, content)
+	post.Update(input.Title, input.Content)
+	if input.Tags != nil {
+		post.Tags = model.NormalizeTags(input.Tags)
+	}
+	if input.Language != "" {
+		post.Language = model.NormalizeLanguage(input.Language)
+	}
 
-	if err := post.Validate(); err != nil {
-		return nil, err
+	if err := s.validator.Validate(post); err != nil {
+		return nil, translate(err)
 	}
 
-	if err := s.repo.Update(ctx, post); err != nil {
-		return nil, err
+	err = s.changePost(ctx, model.AuditUpdate, before, post, func(ctx context.Context) error {
+		return s.repo.Update(ctx, post)
+	})
+	if err != nil {
+		return nil, translate(err)
 	}
 
 	return post, nil
 }
 
 // DeletePost deletes a post by its ID.
-// Returns an error if the post is not found or deletion fails.
+// Returns ErrForbidden if the actor can't delete posts, ErrPostNotFound if the post doesn't exist,
+// or another error if deletion fails.
+// With an audit log, event listeners or an outbox, the post is read first so that its last state is recorded.
 func (s *PostService) DeletePost(ctx context.Context, id string) error {
-	return s.repo.Delete(ctx, id)
+	if err := authorize(ctx, model.PermDelete); err != nil {
+		return err
+	}
+
+	var before *model.Post
+	if s.audit != nil || len(s.eventListeners) > 0 || s.outbox != nil {
+		post, err := s.repo.FindByID(ctx, id)
+		if err != nil {
+			return translate(err)
+		}
+		before = post
+	}
+
+	err := s.changePost(ctx, model.AuditDelete, before, nil, func(ctx context.Context) error {
+		return s.repo.Delete(ctx, id)
+	})
+	return translate(err)
+}
+
+// ReindexSearch sets the text search languages of posts stored with missing or outdated ones,
+// e.g. by other tools, and returns the number of updated posts.
+// It runs in a transaction, so that change stream watchers don't take the updates for external changes.
+func (s *PostService) ReindexSearch(ctx context.Context) (int64, error) {
+	var updated int64
+	err := s.transact(ctx, func(ctx context.Context) error {
+		var err error
+		updated, err = s.repo.RefreshTextLanguages(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh text languages: %w", err)
+	}
+	return updated, nil
+}
+
+// Version returns the current version of the posts collection, used for HTTP caching.
+// It changes whenever a post is created, updated or deleted.
+func (s *PostService) Version(ctx context.Context) (*repository.CollectionVersion, error) {
+	return s.repo.Version(ctx)
 }
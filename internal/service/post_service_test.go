@@ -3,9 +3,14 @@ package service
 import (
 	"context"
 	"errors"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // mockPostRepository is a mock implementation for testing
@@ -18,6 +23,21 @@ type mockPostRepository struct {
 	deleteFunc      func(ctx context.Context, id string) error
 	countFunc       func(ctx context.Context) (int64, error)
 	countSearchFunc func(ctx context.Context, query string) (int64, error)
+	streamFunc      func(ctx context.Context, query string, fn func(*model.Post) error) error
+	bulkUpsertFunc  func(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error)
+	findIDsFunc     func(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error)
+	updateManyFunc  func(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error)
+	deleteManyFunc  func(ctx context.Context, filter repository.PostFilter) (int64, error)
+	versionFunc     func(ctx context.Context) (*repository.CollectionVersion, error)
+	findPageFunc    func(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error)
+	refreshFunc     func(ctx context.Context) (int64, error)
+}
+
+func (m *mockPostRepository) FindPage(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error) {
+	if m.findPageFunc != nil {
+		return m.findPageFunc(ctx, query)
+	}
+	return &repository.PostPage{}, nil
 }
 
 func (m *mockPostRepository) Create(ctx context.Context, post *model.Post) error {
@@ -76,6 +96,55 @@ func (m *mockPostRepository) CountSearch(ctx context.Context, query string) (int
 	return 0, nil
 }
 
+func (m *mockPostRepository) Stream(ctx context.Context, query string, fn func(*model.Post) error) error {
+	if m.streamFunc != nil {
+		return m.streamFunc(ctx, query, fn)
+	}
+	return nil
+}
+
+func (m *mockPostRepository) BulkUpsert(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error) {
+	if m.bulkUpsertFunc != nil {
+		return m.bulkUpsertFunc(ctx, posts)
+	}
+	return &repository.BulkUpsertResult{Inserted: int64(len(posts)), Failed: map[int]error{}}, nil
+}
+
+func (m *mockPostRepository) RefreshTextLanguages(ctx context.Context) (int64, error) {
+	if m.refreshFunc != nil {
+		return m.refreshFunc(ctx)
+	}
+	return 0, nil
+}
+
+func (m *mockPostRepository) FindIDs(ctx context.Context, filter repository.PostFilter) ([]primitive.ObjectID, error) {
+	if m.findIDsFunc != nil {
+		return m.findIDsFunc(ctx, filter)
+	}
+	return filter.IDs, nil
+}
+
+func (m *mockPostRepository) UpdateMany(ctx context.Context, filter repository.PostFilter, changes repository.PostChanges) (int64, error) {
+	if m.updateManyFunc != nil {
+		return m.updateManyFunc(ctx, filter, changes)
+	}
+	return int64(len(filter.IDs)), nil
+}
+
+func (m *mockPostRepository) DeleteMany(ctx context.Context, filter repository.PostFilter) (int64, error) {
+	if m.deleteManyFunc != nil {
+		return m.deleteManyFunc(ctx, filter)
+	}
+	return int64(len(filter.IDs)), nil
+}
+
+func (m *mockPostRepository) Version(ctx context.Context) (*repository.CollectionVersion, error) {
+	if m.versionFunc != nil {
+		return m.versionFunc(ctx)
+	}
+	return &repository.CollectionVersion{}, nil
+}
+
 func TestCreatePost(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -118,7 +187,7 @@ func TestCreatePost(t *testing.T) {
 			repo := &mockPostRepository{}
 			service := NewPostService(repo)
 
-			post, err := service.CreatePost(context.Background(), tt.title, tt.content)
+			post, err := service.CreatePost(context.Background(), PostInput{Title: tt.title, Content: tt.content})
 
 			if tt.wantErr {
 				if err == nil {
@@ -179,26 +248,29 @@ func TestGetPosts(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			repo := &mockPostRepository{
-				findAllFunc: func(ctx context.Context, limit, offset int) ([]*model.Post, error) {
-					if limit != tt.expectedSize {
-						t.Errorf("FindAll() limit = %v, want %v", limit, tt.expectedSize)
+				findPageFunc: func(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error) {
+					if query.Limit != tt.expectedSize {
+						t.Errorf("FindPage() limit = %v, want %v", query.Limit, tt.expectedSize)
 					}
 					expectedOffset := (tt.expectedPage - 1) * tt.expectedSize
-					if offset != expectedOffset {
-						t.Errorf("FindAll() offset = %v, want %v", offset, expectedOffset)
+					if query.Offset != expectedOffset {
+						t.Errorf("FindPage() offset = %v, want %v", query.Offset, expectedOffset)
 					}
-					return []*model.Post{}, nil
-				},
-				countFunc: func(ctx context.Context) (int64, error) {
-					return 0, nil
+					if query.Search != "" {
+						t.Errorf("FindPage() search = %q, want empty", query.Search)
+					}
+					return &repository.PostPage{Posts: []*model.Post{}}, nil
 				},
 			}
 			service := NewPostService(repo)
 
-			_, _, err := service.GetPosts(context.Background(), tt.page, tt.pageSize)
+			_, pagination, err := service.GetPosts(context.Background(), tt.page, tt.pageSize)
 			if err != nil {
 				t.Errorf("GetPosts() unexpected error = %v", err)
 			}
+			if pagination.Page != tt.expectedPage || pagination.PageSize != tt.expectedSize {
+				t.Errorf("GetPosts() pagination = %+v, want page %d of size %d", pagination, tt.expectedPage, tt.expectedSize)
+			}
 		})
 	}
 }
@@ -248,7 +320,7 @@ func TestUpdatePost(t *testing.T) {
 			}
 			service := NewPostService(repo)
 
-			_, err := service.UpdatePost(context.Background(), tt.id, tt.title, tt.content)
+			_, err := service.UpdatePost(context.Background(), tt.id, PostInput{Title: tt.title, Content: tt.content})
 
 			if tt.wantErr {
 				if err == nil {
@@ -267,20 +339,196 @@ func TestUpdatePost(t *testing.T) {
 
 func TestSearchPosts(t *testing.T) {
 	repo := &mockPostRepository{
-		searchFunc: func(ctx context.Context, query string, limit, offset int) ([]*model.Post, error) {
-			if query != "test" {
-				t.Errorf("Search() query = %v, want test", query)
+		findPageFunc: func(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error) {
+			if query.Search != "test" {
+				t.Errorf("FindPage() search = %v, want test", query.Search)
 			}
-			return []*model.Post{}, nil
-		},
-		countSearchFunc: func(ctx context.Context, query string) (int64, error) {
-			return 0, nil
+			if query.EstimateTotal {
+				t.Errorf("FindPage() EstimateTotal = true, want false")
+			}
+			return &repository.PostPage{Posts: []*model.Post{}, Total: 25}, nil
 		},
 	}
 	service := NewPostService(repo)
 
-	_, _, err := service.SearchPosts(context.Background(), "test", 1, 10)
+	_, pagination, err := service.SearchPosts(context.Background(), "test", 1, 10)
 	if err != nil {
 		t.Errorf("SearchPosts() unexpected error = %v", err)
 	}
+	if pagination.TotalItems != 25 || pagination.TotalPages != 3 {
+		t.Errorf("SearchPosts() pagination = %+v, want 25 items on 3 pages", pagination)
+	}
+}
+
+func TestChangeListener(t *testing.T) {
+	changes := 0
+	repo := &mockPostRepository{
+		findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+			return model.NewPost("Title", "Content"), nil
+		},
+		deleteFunc: func(ctx context.Context, id string) error {
+			if id == "missing" {
+				return repository.ErrPostNotFound
+			}
+			return nil
+		},
+	}
+	service := NewPostService(repo, WithChangeListener(func(ctx context.Context) { changes++ }))
+	ctx := context.Background()
+
+	if _, err := service.CreatePost(ctx, PostInput{Title: "Title", Content: "Content"}); err != nil {
+		t.Fatalf("CreatePost() unexpected error = %v", err)
+	}
+	if _, err := service.UpdatePost(ctx, "123", PostInput{Title: "New Title", Content: "New Content"}); err != nil {
+		t.Fatalf("UpdatePost() unexpected error = %v", err)
+	}
+	if err := service.DeletePost(ctx, "123"); err != nil {
+		t.Fatalf("DeletePost() unexpected error = %v", err)
+	}
+	if changes != 3 {
+		t.Errorf("change listener called %d times, want 3", changes)
+	}
+
+	// Failed writes don't notify listeners
+	service.CreatePost(ctx, PostInput{Content: "Content"})
+	service.DeletePost(ctx, "missing")
+	if changes != 3 {
+		t.Errorf("change listener called %d times after failed writes, want 3", changes)
+	}
+}
+
+func TestListPosts(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		query     ListQuery
+		wantErr   bool
+		wantQuery repository.PageQuery
+	}{
+		{
+			name:      "defaults to sorting by creation time",
+			query:     ListQuery{},
+			wantQuery: repository.PageQuery{Tags: []string{}, SortBy: repository.SortByCreated, Limit: 10},
+		},
+		{
+			name: "filters and sort are passed through",
+			query: ListQuery{
+				Search:      "go",
+				CreatedFrom: day,
+				CreatedTo:   day.AddDate(0, 0, 1),
+				Tags:        []string{" News ", "news"},
+				Status:      model.StatusDraft,
+				Sort:        repository.SortByTitle,
+				Page:        2,
+				PageSize:    5,
+			},
+			wantQuery: repository.PageQuery{
+				Search:      "go",
+				CreatedFrom: day,
+				CreatedTo:   day.AddDate(0, 0, 1),
+				Tags:        []string{"news"},
+				Status:      model.StatusDraft,
+				SortBy:      repository.SortByTitle,
+				Limit:       5,
+				Offset:      5,
+			},
+		},
+		{
+			name:    "unknown sort field",
+			query:   ListQuery{Sort: "content"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown status",
+			query:   ListQuery{Status: "deleted"},
+			wantErr: true,
+		},
+		{
+			name:    "empty date range",
+			query:   ListQuery{CreatedFrom: day, CreatedTo: day},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got repository.PageQuery
+			repo := &mockPostRepository{
+				findPageFunc: func(ctx context.Context, query repository.PageQuery) (*repository.PostPage, error) {
+					got = query
+					return &repository.PostPage{}, nil
+				},
+			}
+			service := NewPostService(repo)
+
+			_, _, err := service.ListPosts(context.Background(), tt.query)
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidationFailed) {
+					t.Errorf("ListPosts() error = %v, want %v", err, ErrValidationFailed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListPosts() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.wantQuery) {
+				t.Errorf("FindPage() query = %+v, want %+v", got, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestCreatePostValidationErrors(t *testing.T) {
+	repo := &mockPostRepository{
+		createFunc: func(ctx context.Context, post *model.Post) error {
+			t.Errorf("Create() called for an invalid post")
+			return nil
+		},
+	}
+	validator := validation.NewValidator(model.DefaultLimits, validation.RequiredTags([]string{"news"}))
+	service := NewPostService(repo, WithValidator(validator))
+
+	_, err := service.CreatePost(context.Background(), PostInput{Content: "Content", Tags: []string{"sport"}})
+
+	var errs model.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("CreatePost() error = %v, want ValidationErrors", err)
+	}
+	if errs.For("title") == "" || errs.For("tags") == "" {
+		t.Errorf("CreatePost() errors = %v, want title and tags errors", errs)
+	}
+}
+
+func TestUpdatePostTags(t *testing.T) {
+	tests := []struct {
+		name     string
+		tags     []string
+		wantTags []string
+	}{
+		{name: "nil keeps tags", tags: nil, wantTags: []string{"go"}},
+		{name: "empty clears tags", tags: []string{}, wantTags: []string{}},
+		{name: "tags are normalized", tags: []string{" News", "news", "Go"}, wantTags: []string{"news", "go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &mockPostRepository{
+				findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+					post := model.NewPost("Title", "Content")
+					post.Tags = []string{"go"}
+					return post, nil
+				},
+			}
+			service := NewPostService(repo)
+
+			post, err := service.UpdatePost(context.Background(), "123", PostInput{Title: "Title", Content: "Content", Tags: tt.tags})
+			if err != nil {
+				t.Fatalf("UpdatePost() unexpected error = %v", err)
+			}
+			if !reflect.DeepEqual(post.Tags, tt.wantTags) {
+				t.Errorf("UpdatePost() tags = %v, want %v", post.Tags, tt.wantTags)
+			}
+		})
+	}
 }
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc"
+)
+
+// RoleMapping gives users of single sign-on a role from their groups at the identity provider
+type RoleMapping struct {
+	// Claim names the ID token claim listing the user's groups, e.g. "groups"
+	Claim string
+	// Groups maps group names to roles; users in several groups get the role with the most permissions
+	Groups map[string]model.Role
+	// Default is the role of users in none of the groups; empty refuses them
+	Default model.Role
+}
+
+// ParseRoleMap parses "group=role" entries, e.g. "news-admins=admin"
+func ParseRoleMap(entries []string) (map[string]model.Role, error) {
+	groups := make(map[string]model.Role, len(entries))
+	for _, entry := range entries {
+		group, role, ok := strings.Cut(entry, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || !model.Role(role).Valid() {
+			return nil, fmt.Errorf("invalid role mapping %q, want group=role with a role of reader, author, editor or admin", entry)
+		}
+		groups[group] = model.Role(role)
+	}
+	return groups, nil
+}
+
+// Role returns the role of a user in the groups, or false when they may not sign in
+func (m RoleMapping) Role(groups []string) (model.Role, bool) {
+	best := -1
+	for _, group := range groups {
+		if role, ok := m.Groups[group]; ok {
+			best = max(best, slices.Index(model.Roles, role))
+		}
+	}
+	if best >= 0 {
+		return model.Roles[best], true
+	}
+	return m.Default, m.Default.Valid()
+}
+
+// SSOOptions configures single sign-on
+type SSOOptions struct {
+	// UsernameClaim names new users, e.g. "preferred_username"; e-mail addresses are named by their local part
+	UsernameClaim string
+	Roles         RoleMapping
+}
+
+// SSOService signs users in with an OpenID Connect provider, creating them on their first sign-in
+type SSOService struct {
+	provider *oidc.Provider
+	users    *UserService
+	options  SSOOptions
+}
+
+// NewSSOService creates a new single sign-on service. By default users are named by their "preferred_username".
+func NewSSOService(provider *oidc.Provider, users *UserService, options SSOOptions) *SSOService {
+	if options.UsernameClaim == "" {
+		options.UsernameClaim = "preferred_username"
+	}
+	return &SSOService{
+		provider: provider,
+		users:    users,
+		options:  options,
+	}
+}
+
+// Begin starts a sign-in returning to redirectURL. It returns the request, which must be kept until the provider's
+// callback, and the provider's URL to send the browser to.
+func (s *SSOService) Begin(ctx context.Context, redirectURL string) (oidc.AuthRequest, string, error) {
+	req, err := oidc.NewAuthRequest(redirectURL)
+	if err != nil {
+		return oidc.AuthRequest{}, "", err
+	}
+	authURL, err := s.provider.AuthCodeURL(ctx, req)
+	if err != nil {
+		return oidc.AuthRequest{}, "", fmt.Errorf("failed to start single sign-on: %w", err)
+	}
+	return req, authURL, nil
+}
+
+// Complete finishes the sign-in req with the authorization code of the provider's callback and starts a session.
+// Returns ErrSSOFailed when the provider's answer can't be verified or names no valid user, ErrSSONotAllowed when
+// the user's groups have no role, or ErrUsernameTaken when a new user's name is in use.
+func (s *SSOService) Complete(ctx context.Context, code string, req oidc.AuthRequest) (string, *model.User, error) {
+	token, err := s.provider.Exchange(ctx, code, req)
+	if err != nil {
+		slog.Warn("Single sign-on failed", "error", err)
+		return "", nil, wrap(ErrSSOFailed, err)
+	}
+
+	groups := token.Strings(s.options.Roles.Claim)
+	role, ok := s.options.Roles.Role(groups)
+	if !ok {
+		slog.Warn("Single sign-on refused a user without a role", "subject", token.Subject, "groups", groups)
+		return "", nil, ErrSSONotAllowed
+	}
+
+	session, user, err := s.users.LoginExternal(ctx, ExternalIdentity{
+		Issuer:   token.Issuer,
+		Subject:  token.Subject,
+		Username: ssoUsername(token, s.options.UsernameClaim),
+		Role:     role,
+	})
+	if KindOf(err) == KindValidation {
+		// The provider named the user with nothing a user name can be made of
+		slog.Warn("Single sign-on failed to name a new user", "subject", token.Subject, "error", err)
+		return "", nil, wrap(ErrSSOFailed, err)
+	}
+	return session, user, err
+}
+
+// ssoUsername derives the name of a new user from the claim, falling back to their e-mail address.
+// Characters user names can't have become hyphens, e.g. "Jane Doe" becomes "jane-doe".
+func ssoUsername(token *oidc.IDToken, claim string) string {
+	name := token.String(claim)
+	if name == "" {
+		name = token.String("email")
+	}
+	name, _, _ = strings.Cut(model.NormalizeUsername(name), "@")
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-' {
+			return r
+		}
+		return '-'
+	}, name)
+	name = strings.TrimLeft(name, "._-")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return name
+}
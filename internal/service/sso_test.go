@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc"
+	"github.com/iyhunko/go-htmx-mongo/internal/oidc/oidctest"
+)
+
+func TestParseRoleMap(t *testing.T) {
+	groups, err := ParseRoleMap([]string{"news-admins=admin", " desk = editor "})
+	if err != nil || groups["news-admins"] != model.RoleAdmin || groups["desk"] != model.RoleEditor {
+		t.Errorf("ParseRoleMap() = %v, %v, want both groups mapped", groups, err)
+	}
+	for _, entry := range []string{"news-admins", "=admin", "desk=owner"} {
+		if _, err := ParseRoleMap([]string{entry}); err == nil {
+			t.Errorf("ParseRoleMap(%q) succeeded, want an error", entry)
+		}
+	}
+}
+
+func TestRoleMapping(t *testing.T) {
+	mapping := RoleMapping{Groups: map[string]model.Role{"staff": model.RoleAuthor, "desk": model.RoleEditor, "it": model.RoleAdmin}}
+
+	tests := []struct {
+		name     string
+		groups   []string
+		fallback model.Role
+		wantRole model.Role
+		wantOK   bool
+	}{
+		{"one group", []string{"staff"}, "", model.RoleAuthor, true},
+		{"most permissions win", []string{"staff", "desk", "visitors"}, "", model.RoleEditor, true},
+		{"admins", []string{"it", "staff"}, model.RoleReader, model.RoleAdmin, true},
+		{"no group", []string{"visitors"}, model.RoleReader, model.RoleReader, true},
+		{"no groups refused", nil, "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mapping.Default = tt.fallback
+			role, ok := mapping.Role(tt.groups)
+			if role != tt.wantRole || ok != tt.wantOK {
+				t.Errorf("Role(%v) = %q, %v, want %q, %v", tt.groups, role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSSOUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   string
+	}{
+		{"preferred username", map[string]any{"preferred_username": "Jane.Doe", "email": "jd@corp.example"}, "jane.doe"},
+		{"e-mail address", map[string]any{"preferred_username": "Jane.Doe@corp.example"}, "jane.doe"},
+		{"e-mail claim", map[string]any{"email": "jd@corp.example"}, "jd"},
+		{"spaces and accents", map[string]any{"preferred_username": " Jane Müller "}, "jane-m-ller"},
+		{"leading punctuation", map[string]any{"preferred_username": "_jane"}, "jane"},
+		{"too long", map[string]any{"preferred_username": "abcdefghijklmnopqrstuvwxyz0123456789"}, "abcdefghijklmnopqrstuvwxyz012345"},
+		{"none", map[string]any{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ssoUsername(&oidc.IDToken{Claims: tt.claims}, "preferred_username"); got != tt.want {
+				t.Errorf("ssoUsername() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSOServiceComplete(t *testing.T) {
+	idp := oidctest.NewProvider(t, "news", "secret")
+	users, _, _ := newTestUserService()
+	sso := NewSSOService(oidc.NewProvider(oidc.Config{Issuer: idp.Issuer(), ClientID: "news", ClientSecret: "secret"}), users, SSOOptions{
+		Roles: RoleMapping{Claim: "groups", Groups: map[string]model.Role{"desk": model.RoleEditor}},
+	})
+	ctx := context.Background()
+
+	// signIn runs the flow for the provider's user and returns the authorization code and the request
+	signIn := func(claims map[string]any) (string, oidc.AuthRequest) {
+		t.Helper()
+		idp.SignInAs(claims)
+		req, authURL, err := sso.Begin(ctx, "http://news.example/login/oidc/callback")
+		if err != nil {
+			t.Fatalf("Begin() error = %v", err)
+		}
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(authURL)
+		if err != nil {
+			t.Fatalf("authorize error = %v", err)
+		}
+		resp.Body.Close()
+		location, _ := url.Parse(resp.Header.Get("Location"))
+		return location.Query().Get("code"), req
+	}
+
+	code, req := signIn(map[string]any{"sub": "u-1", "preferred_username": "jane", "groups": []string{"staff", "desk"}})
+	token, jane, err := sso.Complete(ctx, code, req)
+	if err != nil || token == "" {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if jane.Username != "jane" || jane.Role != model.RoleEditor || jane.OIDCIssuer != idp.Issuer() || jane.OIDCSubject != "u-1" {
+		t.Errorf("signed-in user = %+v, want jane as an editor linked to the provider", jane)
+	}
+
+	code, req = signIn(map[string]any{"sub": "u-2", "preferred_username": "john", "groups": []string{"staff"}})
+	if _, _, err := sso.Complete(ctx, code, req); !errors.Is(err, ErrSSONotAllowed) {
+		t.Errorf("Complete() of a user without a role error = %v, want ErrSSONotAllowed", err)
+	}
+
+	code, req = signIn(map[string]any{"sub": "u-1", "groups": []string{"desk"}})
+	req.Nonce = "another"
+	if _, _, err := sso.Complete(ctx, code, req); !errors.Is(err, ErrSSOFailed) {
+		t.Errorf("Complete() with another nonce error = %v, want ErrSSOFailed", err)
+	}
+	if _, _, err := sso.Complete(ctx, "forged", req); !errors.Is(err, ErrSSOFailed) {
+		t.Errorf("Complete() of a forged code error = %v, want ErrSSOFailed", err)
+	}
+}
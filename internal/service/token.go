@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// TokenPrefix starts every API token, so that leaked tokens are easy to recognize, e.g. by secret scanners
+	TokenPrefix = "ghm_"
+	// tokenBytes is the amount of randomness in an API token
+	tokenBytes = 32
+	// tokenDisplayLength is the length of the start of a token that is kept to tell tokens apart
+	tokenDisplayLength = len(TokenPrefix) + 6
+	// touchInterval is how often the last use of a token is written, so that busy tokens don't write on every request
+	touchInterval = time.Minute
+)
+
+// TokenService manages the API tokens of signed-in users and authenticates API requests carrying them
+type TokenService struct {
+	tokens repository.TokenRepository
+	users  repository.UserRepository
+	now    func() time.Time
+}
+
+// TokenInput holds the fields of a new API token
+type TokenInput struct {
+	Name   string
+	Scopes []model.TokenScope
+	// ExpiresIn is how long the token works; zero never expires
+	ExpiresIn time.Duration
+}
+
+// NewTokenService creates a new API token service
+func NewTokenService(tokens repository.TokenRepository, users repository.UserRepository) *TokenService {
+	return &TokenService{
+		tokens: tokens,
+		users:  users,
+		now:    time.Now,
+	}
+}
+
+// CreateToken gives the signed-in actor a new API token with the input's name, scopes and expiry.
+// It returns the token, which is only available now, and its stored form.
+// Returns ErrForbidden for actors who aren't signed in with a session, e.g. anonymous visitors or other tokens,
+// or an error of KindValidation listing every invalid field, e.g. scopes the actor's role can't use.
+func (s *TokenService) CreateToken(ctx context.Context, input TokenInput) (string, *model.APIToken, error) {
+	actor := ActorFrom(ctx)
+	userID, err := sessionUserID(actor)
+	if err != nil {
+		return "", nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if err := model.ValidateToken(name, input.Scopes, actor.Role).Err(); err != nil {
+		return "", nil, translate(err)
+	}
+	if input.ExpiresIn < 0 {
+		return "", nil, fmt.Errorf("%w: the expiry must not be in the past", ErrValidationFailed)
+	}
+
+	secret, err := newAPIToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := s.now()
+	token := &model.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    secret[:tokenDisplayLength],
+		Hash:      hashToken(secret),
+		Scopes:    input.Scopes,
+		CreatedAt: now,
+	}
+	if input.ExpiresIn > 0 {
+		token.ExpiresAt = now.Add(input.ExpiresIn)
+	}
+	if err := s.tokens.Create(ctx, token); err != nil {
+		return "", nil, fmt.Errorf("failed to store API token: %w", err)
+	}
+	return secret, token, nil
+}
+
+// ListTokens returns the API tokens of the signed-in actor, newest first
+func (s *TokenService) ListTokens(ctx context.Context) ([]*model.APIToken, error) {
+	userID, err := sessionUserID(ActorFrom(ctx))
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.tokens.FindForUser(ctx, userID)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes the API token with the ID of the signed-in actor, which stops working immediately.
+// Returns ErrTokenNotFound if the actor has no such token.
+func (s *TokenService) RevokeToken(ctx context.Context, id string) error {
+	userID, err := sessionUserID(ActorFrom(ctx))
+	if err != nil {
+		return err
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidTokenID
+	}
+	return translate(s.tokens.Delete(ctx, objectID, userID))
+}
+
+// Authenticate returns the user calling the API with the token, and the token, whose scopes limit what they may do.
+// Returns ErrInvalidToken if the token is unknown, revoked or expired, or its user no longer exists.
+func (s *TokenService) Authenticate(ctx context.Context, secret string) (*model.User, *model.APIToken, error) {
+	if !strings.HasPrefix(secret, TokenPrefix) {
+		return nil, nil, ErrInvalidToken
+	}
+	token, err := s.tokens.FindByHash(ctx, hashToken(secret))
+	if errors.Is(err, repository.ErrTokenNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+	now := s.now()
+	if token.Expired(now) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	user, err := s.users.FindByID(ctx, token.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, translate(err)
+	}
+
+	if now.Sub(token.LastUsedAt) >= touchInterval {
+		token.LastUsedAt = now.Truncate(touchInterval)
+		// The request is allowed either way, so a failure is only logged
+		if err := s.tokens.Touch(context.WithoutCancel(ctx), token.ID, token.LastUsedAt); err != nil {
+			slog.Error("Failed to record API token use", "error", err, "token", token.ID.Hex())
+		}
+	}
+	return user, token, nil
+}
+
+// sessionUserID returns the ID of the user the actor signed in as with a session.
+// Tokens can't manage tokens, so that a leaked token can't be used to keep access after it is revoked.
+func sessionUserID(actor Actor) (primitive.ObjectID, error) {
+	if actor.Scopes != nil {
+		return primitive.NilObjectID, ErrForbidden
+	}
+	userID, err := primitive.ObjectIDFromHex(actor.ID)
+	if err != nil {
+		return primitive.NilObjectID, ErrForbidden
+	}
+	return userID, nil
+}
+
+// newAPIToken returns a random API token starting with TokenPrefix
+func newAPIToken() (string, error) {
+	b := make([]byte, tokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate API token: %w", err)
+	}
+	return TokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
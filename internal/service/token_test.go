@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockTokenRepository keeps API tokens in memory
+type mockTokenRepository struct {
+	tokens  []*model.APIToken
+	touches int
+}
+
+func (m *mockTokenRepository) Create(ctx context.Context, token *model.APIToken) error {
+	token.ID = primitive.NewObjectID()
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockTokenRepository) FindByHash(ctx context.Context, hash string) (*model.APIToken, error) {
+	for _, token := range m.tokens {
+		if token.Hash == hash {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrTokenNotFound
+}
+
+func (m *mockTokenRepository) FindForUser(ctx context.Context, userID primitive.ObjectID) ([]*model.APIToken, error) {
+	tokens := []*model.APIToken{}
+	for _, token := range m.tokens {
+		if token.UserID == userID {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *mockTokenRepository) Delete(ctx context.Context, id, userID primitive.ObjectID) error {
+	for i, token := range m.tokens {
+		if token.ID == id && token.UserID == userID {
+			m.tokens = append(m.tokens[:i], m.tokens[i+1:]...)
+			return nil
+		}
+	}
+	return repository.ErrTokenNotFound
+}
+
+func (m *mockTokenRepository) Touch(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	for _, token := range m.tokens {
+		if token.ID == id {
+			token.LastUsedAt = at
+			m.touches++
+		}
+	}
+	return nil
+}
+
+func TestTokenServiceCreateAndAuthenticate(t *testing.T) {
+	users := &mockUserRepository{}
+	jane := &model.User{Username: "jane", Role: model.RoleAuthor}
+	if err := users.Create(context.Background(), jane); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	tokens := &mockTokenRepository{}
+	service := NewTokenService(tokens, users)
+	ctx := WithActor(context.Background(), Actor{ID: jane.ID.Hex(), Role: jane.Role})
+
+	secret, token, err := service.CreateToken(ctx, TokenInput{Name: " CI ", Scopes: []model.TokenScope{model.ScopeRead, model.ScopeWrite}, ExpiresIn: time.Hour})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if !strings.HasPrefix(secret, TokenPrefix) || !strings.HasPrefix(secret, token.Prefix) || token.Hash == secret || token.Hash == "" {
+		t.Errorf("CreateToken() = %q, %+v, want a prefixed token stored under its hash", secret, token)
+	}
+	if token.Name != "CI" || token.UserID != jane.ID || token.ExpiresAt.IsZero() {
+		t.Errorf("created token = %+v, want a trimmed name, jane's ID and an expiry", token)
+	}
+
+	user, authenticated, err := service.Authenticate(ctx, secret)
+	if err != nil || user.ID != jane.ID || authenticated.ID != token.ID {
+		t.Fatalf("Authenticate() = %v, %v, %v, want jane's token", user, authenticated, err)
+	}
+	if tokens.touches != 1 || tokens.tokens[0].LastUsedAt.IsZero() {
+		t.Errorf("last use recorded %d times, want once", tokens.touches)
+	}
+	if _, _, err := service.Authenticate(ctx, secret); err != nil || tokens.touches != 1 {
+		t.Errorf("Authenticate() again = %v, recorded %d times, want the use within a minute not recorded again", err, tokens.touches)
+	}
+
+	for name, secret := range map[string]string{"unknown": TokenPrefix + "unknown", "unprefixed": "abc", "empty": ""} {
+		if _, _, err := service.Authenticate(ctx, secret); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate() of an %s token error = %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	service.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, _, err := service.Authenticate(ctx, secret); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Authenticate() of an expired token error = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestTokenServiceCreateToken(t *testing.T) {
+	userID := primitive.NewObjectID().Hex()
+	service := NewTokenService(&mockTokenRepository{}, &mockUserRepository{})
+
+	tests := []struct {
+		name    string
+		actor   Actor
+		input   TokenInput
+		wantErr error
+	}{
+		{"reader reads", Actor{ID: userID, Role: model.RoleReader}, TokenInput{Name: "feed", Scopes: []model.TokenScope{model.ScopeRead}}, nil},
+		{"admin administers", Actor{ID: userID, Role: model.RoleAdmin}, TokenInput{Name: "backups", Scopes: []model.TokenScope{model.ScopeAdmin}}, nil},
+		{"reader writes", Actor{ID: userID, Role: model.RoleReader}, TokenInput{Name: "feed", Scopes: []model.TokenScope{model.ScopeWrite}}, ErrInvalidFields},
+		{"author administers", Actor{ID: userID, Role: model.RoleAuthor}, TokenInput{Name: "ci", Scopes: []model.TokenScope{model.ScopeAdmin}}, ErrInvalidFields},
+		{"unknown scope", Actor{ID: userID, Role: model.RoleAdmin}, TokenInput{Name: "ci", Scopes: []model.TokenScope{"delete"}}, ErrInvalidFields},
+		{"no scopes", Actor{ID: userID, Role: model.RoleAdmin}, TokenInput{Name: "ci"}, ErrInvalidFields},
+		{"no name", Actor{ID: userID, Role: model.RoleAdmin}, TokenInput{Name: " ", Scopes: []model.TokenScope{model.ScopeRead}}, ErrInvalidFields},
+		{"past expiry", Actor{ID: userID, Role: model.RoleAdmin}, TokenInput{Name: "ci", Scopes: []model.TokenScope{model.ScopeRead}, ExpiresIn: -time.Hour}, ErrValidationFailed},
+		{"anonymous", Actor{ID: AnonymousActor, Role: model.RoleAdmin}, TokenInput{Name: "ci", Scopes: []model.TokenScope{model.ScopeRead}}, ErrForbidden},
+		{"token", Actor{ID: userID, Role: model.RoleAdmin, Scopes: []model.TokenScope{model.ScopeAdmin}}, TokenInput{Name: "ci", Scopes: []model.TokenScope{model.ScopeRead}}, ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := service.CreateToken(WithActor(context.Background(), tt.actor), tt.input)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("CreateToken() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTokenServiceRevokeToken(t *testing.T) {
+	tokens := &mockTokenRepository{}
+	service := NewTokenService(tokens, &mockUserRepository{})
+	jane := WithActor(context.Background(), Actor{ID: primitive.NewObjectID().Hex(), Role: model.RoleEditor})
+	john := WithActor(context.Background(), Actor{ID: primitive.NewObjectID().Hex(), Role: model.RoleEditor})
+
+	_, token, err := service.CreateToken(jane, TokenInput{Name: "ci", Scopes: []model.TokenScope{model.ScopeWrite}})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if list, err := service.ListTokens(john); err != nil || len(list) != 0 {
+		t.Errorf("ListTokens() of another user = %v, %v, want none", list, err)
+	}
+	if err := service.RevokeToken(john, token.ID.Hex()); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("RevokeToken() by another user error = %v, want ErrTokenNotFound", err)
+	}
+	if err := service.RevokeToken(jane, "not-an-id"); !errors.Is(err, ErrInvalidTokenID) {
+		t.Errorf("RevokeToken() of an invalid ID error = %v, want ErrInvalidTokenID", err)
+	}
+	if err := service.RevokeToken(jane, token.ID.Hex()); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if list, err := service.ListTokens(jane); err != nil || len(list) != 0 {
+		t.Errorf("ListTokens() after RevokeToken() = %v, %v, want none", list, err)
+	}
+}
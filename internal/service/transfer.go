@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/transfer"
+)
+
+// DefaultImportBatchSize is the number of posts written per bulk write when no batch size is given
+const DefaultImportBatchSize = 500
+
+// ImportOptions controls how posts are imported
+type ImportOptions struct {
+	// DryRun validates every record without writing anything
+	DryRun bool
+	// BatchSize is the number of posts sent to the database per bulk write
+	BatchSize int
+}
+
+// ImportLineError describes why a single input record was rejected
+type ImportLineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// ImportReport summarizes the result of an import
+type ImportReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Processed int               `json:"processed"`
+	Valid     int               `json:"valid"`
+	Inserted  int64             `json:"inserted"`
+	Updated   int64             `json:"updated"`
+	Errors    []ImportLineError `json:"errors"`
+}
+
+// ExportPosts streams all posts matching the search query (all posts when empty) to w.
+// Returns the number of exported posts.
+func (s *PostService) ExportPosts(ctx context.Context, w io.Writer, format transfer.Format, query string) (int, error) {
+	encoder := transfer.NewEncoder(w, format)
+
+	count := 0
+	err := s.repo.Stream(ctx, query, func(post *model.Post) error {
+		count++
+		return encoder.Encode(post)
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, encoder.Flush()
+}
+
+// ImportPosts reads posts from r, validates every record and upserts valid ones in batches.
+// Records are matched by ID, then by slug. Invalid records are reported per line and skipped;
+// an error is returned only when the input can't be read or the database is unavailable.
+func (s *PostService) ImportPosts(ctx context.Context, r io.Reader, format transfer.Format, opts ImportOptions) (*ImportReport, error) {
+	decoder, err := transfer.NewDecoder(r, format)
+	if err != nil {
+		return nil, err
+	}
+	return s.importRecords(ctx, decoder, opts)
+}
+
+// LoadPosts imports posts built in code, such as generated or fixture posts, like ImportPosts.
+// The line numbers in the report are the positions of the rejected posts, starting at 1.
+func (s *PostService) LoadPosts(ctx context.Context, posts []*model.Post, opts ImportOptions) (*ImportReport, error) {
+	return s.importRecords(ctx, &postsDecoder{posts: posts}, opts)
+}
+
+// importRecords validates and upserts the records of decoder in batches.
+// Imports overwrite posts of every author and set their status, so they take moderators.
+func (s *PostService) importRecords(ctx context.Context, decoder transfer.Decoder, opts ImportOptions) (*ImportReport, error) {
+	if err := authorize(ctx, model.PermModerate, model.PermPublish); err != nil {
+		return nil, err
+	}
+	if opts.BatchSize < 1 {
+		opts.BatchSize = DefaultImportBatchSize
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun, Errors: []ImportLineError{}}
+	batch := make([]*model.Post, 0, opts.BatchSize)
+	lines := make([]int, 0, opts.BatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 || opts.DryRun {
+			batch, lines = batch[:0], lines[:0]
+			return nil
+		}
+
+		result, err := s.upsertBatch(ctx, batch)
+		if err != nil {
+			return fmt.Errorf("failed to write batch ending at line %d: %w", lines[len(lines)-1], err)
+		}
+		report.Inserted += result.Inserted
+		report.Updated += result.Updated
+		if result.Inserted+result.Updated > 0 {
+			s.notifyChanged(ctx)
+		}
+		for i, writeErr := range result.Failed {
+			report.Valid--
+			report.Errors = append(report.Errors, ImportLineError{Line: lines[i], Error: writeErr.Error()})
+		}
+
+		batch, lines = batch[:0], lines[:0]
+		return nil
+	}
+
+	for {
+		record, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		report.Processed++
+		if record.Err != nil {
+			report.Errors = append(report.Errors, ImportLineError{Line: record.Line, Error: record.Err.Error()})
+			continue
+		}
+
+		post := record.Post
+		post.Title = strings.TrimSpace(post.Title)
+		post.Content = strings.TrimSpace(post.Content)
+		if post.Tags != nil {
+			post.Tags = model.NormalizeTags(post.Tags)
+		}
+		post.Language = model.NormalizeLanguage(post.Language)
+		for i := range post.Translations {
+			translation := &post.Translations[i]
+			translation.Language = model.NormalizeLanguage(translation.Language)
+			translation.Title = strings.TrimSpace(translation.Title)
+			translation.Content = strings.TrimSpace(translation.Content)
+		}
+		if err := s.validator.Validate(post); err != nil {
+			report.Errors = append(report.Errors, ImportLineError{Line: record.Line, Error: err.Error()})
+			continue
+		}
+		if err := s.validateTranslations(post); err != nil {
+			report.Errors = append(report.Errors, ImportLineError{Line: record.Line, Error: err.Error()})
+			continue
+		}
+
+		report.Valid++
+		batch = append(batch, post)
+		lines = append(lines, record.Line)
+
+		if len(batch) >= opts.BatchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	return report, nil
+}
+
+// postsDecoder returns posts of a slice as records numbered from 1
+type postsDecoder struct {
+	posts []*model.Post
+	next  int
+}
+
+func (d *postsDecoder) Next() (*transfer.Record, error) {
+	if d.next == len(d.posts) {
+		return nil, io.EOF
+	}
+	d.next++
+	return &transfer.Record{Line: d.next, Post: d.posts[d.next-1]}, nil
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/transfer"
+)
+
+func TestImportPosts(t *testing.T) {
+	input := strings.Join([]string{
+		`{"title":"First","content":"First content"}`,
+		`{"title":"","content":"Missing title"}`,
+		`not json`,
+		``,
+		`{"title":"Second","content":"Second content","slug":"second"}`,
+		`{"title":"Third","content":"Third content","slug":"third"}`,
+	}, "\n")
+
+	tests := []struct {
+		name          string
+		dryRun        bool
+		wantBatches   int
+		wantValid     int
+		wantInserted  int64
+		wantErrLines  []int
+		failWriteSlug string
+	}{
+		{
+			name:         "dry run validates without writing",
+			dryRun:       true,
+			wantBatches:  0,
+			wantValid:    3,
+			wantInserted: 0,
+			wantErrLines: []int{2, 3},
+		},
+		{
+			name:         "writes valid posts in batches",
+			wantBatches:  2,
+			wantValid:    3,
+			wantInserted: 3,
+			wantErrLines: []int{2, 3},
+		},
+		{
+			name:          "reports write failures per line",
+			wantBatches:   2,
+			wantValid:     2,
+			wantInserted:  2,
+			wantErrLines:  []int{2, 3, 6},
+			failWriteSlug: "third",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			batches := 0
+			repo := &mockPostRepository{
+				bulkUpsertFunc: func(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error) {
+					batches++
+					result := &repository.BulkUpsertResult{Failed: map[int]error{}}
+					for i, post := range posts {
+						if post.Slug != "" && post.Slug == tt.failWriteSlug {
+							result.Failed[i] = errors.New("duplicate key")
+							continue
+						}
+						result.Inserted++
+					}
+					return result, nil
+				},
+			}
+			service := NewPostService(repo)
+
+			report, err := service.ImportPosts(context.Background(), strings.NewReader(input), transfer.FormatJSONL, ImportOptions{
+				DryRun:    tt.dryRun,
+				BatchSize: 2,
+			})
+			if err != nil {
+				t.Fatalf("ImportPosts() unexpected error = %v", err)
+			}
+
+			if batches != tt.wantBatches {
+				t.Errorf("ImportPosts() wrote %d batches, want %d", batches, tt.wantBatches)
+			}
+			if report.Processed != 5 {
+				t.Errorf("ImportPosts() processed = %d, want 5", report.Processed)
+			}
+			if report.Valid != tt.wantValid {
+				t.Errorf("ImportPosts() valid = %d, want %d", report.Valid, tt.wantValid)
+			}
+			if report.Inserted != tt.wantInserted {
+				t.Errorf("ImportPosts() inserted = %d, want %d", report.Inserted, tt.wantInserted)
+			}
+			if len(report.Errors) != len(tt.wantErrLines) {
+				t.Fatalf("ImportPosts() errors = %+v, want lines %v", report.Errors, tt.wantErrLines)
+			}
+			for i, line := range tt.wantErrLines {
+				if report.Errors[i].Line != line {
+					t.Errorf("ImportPosts() error %d line = %d, want %d", i, report.Errors[i].Line, line)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadPosts(t *testing.T) {
+	var written []*model.Post
+	repo := &mockPostRepository{
+		bulkUpsertFunc: func(ctx context.Context, posts []*model.Post) (*repository.BulkUpsertResult, error) {
+			written = append(written, posts...)
+			return &repository.BulkUpsertResult{Inserted: int64(len(posts)), Failed: map[int]error{}}, nil
+		},
+	}
+	service := NewPostService(repo)
+
+	posts := []*model.Post{
+		{Title: " First ", Content: "Content", Tags: []string{"Go", "go"}},
+		{Title: "", Content: "Missing title"},
+		{Title: "Third", Content: "Content"},
+	}
+	report, err := service.LoadPosts(context.Background(), posts, ImportOptions{})
+	if err != nil {
+		t.Fatalf("LoadPosts() error = %v", err)
+	}
+
+	if report.Processed != 3 || report.Inserted != 2 || len(report.Errors) != 1 || report.Errors[0].Line != 2 {
+		t.Errorf("report = %+v, want 2 inserted and post 2 rejected", report)
+	}
+	if len(written) != 2 || written[0].Title != "First" || len(written[0].Tags) != 1 {
+		t.Errorf("written = %+v, want the valid posts normalized like imported ones", written)
+	}
+}
+
+func TestExportPosts(t *testing.T) {
+	posts := []*model.Post{
+		model.NewPost("First", "First content"),
+		model.NewPost("Second", `Second, with "quotes"`),
+	}
+	repo := &mockPostRepository{
+		streamFunc: func(ctx context.Context, query string, fn func(*model.Post) error) error {
+			for _, post := range posts {
+				if err := fn(post); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+	service := NewPostService(repo)
+
+	var buf bytes.Buffer
+	count, err := service.ExportPosts(context.Background(), &buf, transfer.FormatCSV, "")
+	if err != nil {
+		t.Fatalf("ExportPosts() unexpected error = %v", err)
+	}
+	if count != 2 {
+		t.Errorf("ExportPosts() count = %d, want 2", count)
+	}
+
+	// Exported CSV must be importable as-is
+	report, err := service.ImportPosts(context.Background(), &buf, transfer.FormatCSV, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("ImportPosts() unexpected error = %v", err)
+	}
+	if report.Valid != 2 || len(report.Errors) != 0 {
+		t.Errorf("ImportPosts() of exported CSV = %+v, want 2 valid records", report)
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+// TranslationInput holds the user editable fields of a translation
+type TranslationInput struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// SaveTranslation adds or replaces the translation of a post into language.
+// The translation is validated like the post itself, so the same length limits and rules apply.
+// Returns the updated post, ErrForbidden if the actor can't edit the post,
+// or an error of KindValidation listing every invalid field.
+func (s *PostService) SaveTranslation(ctx context.Context, id, language string, input TranslationInput) (*model.Post, error) {
+	language = model.NormalizeLanguage(language)
+
+	post, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, translate(err)
+	}
+	if err := authorizeEdit(ctx, post); err != nil {
+		return nil, err
+	}
+
+	var errs model.ValidationErrors
+	switch {
+	case !model.ValidLanguage(language):
+		errs.Add("language", model.CodeInvalid, "language must be a language code such as en or uk")
+	case language == post.OriginalLanguage():
+		errs.Add("language", model.CodeDuplicate, "the post is written in this language; edit the post instead", "language", language)
+	}
+	if err := errs.Err(); err != nil {
+		return nil, translate(err)
+	}
+
+	before := snapshot(post)
+	post.SetTranslation(language, input.Title, input.Content)
+	if err := s.validateTranslation(post, post.FindTranslation(language)); err != nil {
+		return nil, translate(err)
+	}
+
+	err = s.changePost(ctx, model.AuditUpdate, before, post, func(ctx context.Context) error {
+		return s.repo.Update(ctx, post)
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return post, nil
+}
+
+// DeleteTranslation removes the translation of a post into language.
+// Returns the updated post, ErrForbidden if the actor can't edit the post,
+// or ErrTranslationNotFound if the post has no such translation.
+func (s *PostService) DeleteTranslation(ctx context.Context, id, language string) (*model.Post, error) {
+	post, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, translate(err)
+	}
+	if err := authorizeEdit(ctx, post); err != nil {
+		return nil, err
+	}
+
+	before := snapshot(post)
+	if !post.RemoveTranslation(model.NormalizeLanguage(language)) {
+		return nil, ErrTranslationNotFound
+	}
+
+	err = s.changePost(ctx, model.AuditUpdate, before, post, func(ctx context.Context) error {
+		return s.repo.Update(ctx, post)
+	})
+	if err != nil {
+		return nil, translate(err)
+	}
+
+	return post, nil
+}
+
+// validateTranslation validates the title and content of a translation of post with the post's validator.
+// Failures are reported for the title and content fields, like for the post itself.
+func (s *PostService) validateTranslation(post *model.Post, translation *model.Translation) error {
+	candidate := *post
+	candidate.Title = translation.Title
+	candidate.Content = translation.Content
+	candidate.Language = translation.Language
+	candidate.Translations = nil
+	return s.validator.Validate(&candidate)
+}
+
+// validateTranslations validates every translation of post, naming the language of the first invalid one
+func (s *PostService) validateTranslations(post *model.Post) error {
+	for i := range post.Translations {
+		if err := s.validateTranslation(post, &post.Translations[i]); err != nil {
+			return fmt.Errorf("translation %s: %w", post.Translations[i].Language, err)
+		}
+	}
+	return nil
+}
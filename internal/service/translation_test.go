@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/validation"
+)
+
+func TestSaveTranslation(t *testing.T) {
+	tests := []struct {
+		name       string
+		language   string
+		input      TranslationInput
+		wantFields []string
+	}{
+		{name: "valid", language: " UK", input: TranslationInput{Title: "Заголовок", Content: "Зміст"}},
+		{name: "invalid language", language: "ukrainian!", input: TranslationInput{Title: "Заголовок", Content: "Зміст"}, wantFields: []string{"language"}},
+		{name: "original language", language: "en", input: TranslationInput{Title: "Title", Content: "Content"}, wantFields: []string{"language"}},
+		{name: "invalid fields", language: "uk", input: TranslationInput{Title: strings.Repeat("x", 201), Content: "заборонено"}, wantFields: []string{"title", "content"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updated *model.Post
+			repo := &mockPostRepository{
+				findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+					return model.NewPost("Title", "Content"), nil
+				},
+				updateFunc: func(ctx context.Context, post *model.Post) error {
+					updated = post
+					return nil
+				},
+			}
+			validator := validation.NewValidator(model.DefaultLimits, validation.BannedWords([]string{"заборонено"}))
+			service := NewPostService(repo, WithValidator(validator))
+
+			post, err := service.SaveTranslation(context.Background(), "123", tt.language, tt.input)
+
+			if tt.wantFields == nil {
+				if err != nil {
+					t.Fatalf("SaveTranslation() unexpected error = %v", err)
+				}
+				translation := post.FindTranslation("uk")
+				if updated != post || translation == nil || translation.Title != tt.input.Title {
+					t.Errorf("SaveTranslation() translations = %+v, want the translation saved", post.Translations)
+				}
+				if post.Title != "Title" {
+					t.Errorf("SaveTranslation() changed the original title to %q", post.Title)
+				}
+				return
+			}
+
+			var errs model.ValidationErrors
+			if !errors.As(err, &errs) || KindOf(err) != KindValidation {
+				t.Fatalf("SaveTranslation() error = %v, want ValidationErrors", err)
+			}
+			for _, field := range tt.wantFields {
+				if errs.For(field) == "" {
+					t.Errorf("SaveTranslation() errors = %v, want a %s error", errs, field)
+				}
+			}
+			if updated != nil {
+				t.Errorf("SaveTranslation() saved an invalid translation")
+			}
+		})
+	}
+}
+
+func TestDeleteTranslation(t *testing.T) {
+	repo := &mockPostRepository{
+		findByIDFunc: func(ctx context.Context, id string) (*model.Post, error) {
+			post := model.NewPost("Title", "Content")
+			post.SetTranslation("uk", "Заголовок", "Зміст")
+			return post, nil
+		},
+	}
+	service := NewPostService(repo)
+
+	post, err := service.DeleteTranslation(context.Background(), "123", "uk")
+	if err != nil {
+		t.Fatalf("DeleteTranslation() unexpected error = %v", err)
+	}
+	if len(post.Translations) != 0 {
+		t.Errorf("DeleteTranslation() translations = %+v, want none", post.Translations)
+	}
+
+	_, err = service.DeleteTranslation(context.Background(), "123", "de")
+	if !errors.Is(err, ErrTranslationNotFound) || KindOf(err) != KindNotFound {
+		t.Errorf("DeleteTranslation() of a missing translation error = %v, want %v", err, ErrTranslationNotFound)
+	}
+}
@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sessionTokenBytes is the amount of randomness in a session token
+const sessionTokenBytes = 32
+
+// UserOptions configures the user service; zero values select the defaults
+type UserOptions struct {
+	// SessionTTL is how long users stay signed in
+	SessionTTL time.Duration
+	// PasswordCost is the bcrypt cost of password hashes; tests lower it to bcrypt.MinCost
+	PasswordCost int
+}
+
+// UserService manages users and their roles, and signs them in and out
+type UserService struct {
+	users    repository.UserRepository
+	sessions repository.SessionRepository
+	options  UserOptions
+	now      func() time.Time
+
+	// dummyHash is compared against when a user doesn't exist,
+	// so that signing in takes as long for unknown user names as for wrong passwords
+	dummyHash func() ([]byte, error)
+}
+
+// UserInput holds the fields of a new user
+type UserInput struct {
+	Username string
+	Password string
+	Role     model.Role
+}
+
+// NewUserService creates a new user service. By default users stay signed in for a week.
+func NewUserService(users repository.UserRepository, sessions repository.SessionRepository, options UserOptions) *UserService {
+	if options.SessionTTL <= 0 {
+		options.SessionTTL = 7 * 24 * time.Hour
+	}
+	if options.PasswordCost == 0 {
+		options.PasswordCost = bcrypt.DefaultCost
+	}
+	return &UserService{
+		users:    users,
+		sessions: sessions,
+		options:  options,
+		now:      time.Now,
+		dummyHash: sync.OnceValues(func() ([]byte, error) {
+			return bcrypt.GenerateFromPassword([]byte("not a password"), options.PasswordCost)
+		}),
+	}
+}
+
+// CreateUser adds a user with the input's name, password and role.
+// Returns ErrForbidden unless the actor may manage users, ErrUsernameTaken if the name is in use,
+// or an error of KindValidation listing every invalid field.
+func (s *UserService) CreateUser(ctx context.Context, input UserInput) (*model.User, error) {
+	if err := authorize(ctx, model.PermManage); err != nil {
+		return nil, err
+	}
+
+	username := model.NormalizeUsername(input.Username)
+	if err := model.ValidateUser(username, input.Password, input.Role).Err(); err != nil {
+		return nil, translate(err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), s.options.PasswordCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &model.User{Username: username, PasswordHash: string(hash), Role: input.Role}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, translate(err)
+	}
+	return user, nil
+}
+
+// ListUsers returns every user, ordered by name, or ErrForbidden unless the actor may manage users
+func (s *UserService) ListUsers(ctx context.Context) ([]*model.User, error) {
+	if err := authorize(ctx, model.PermManage); err != nil {
+		return nil, err
+	}
+	users, err := s.users.FindAll(ctx)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return users, nil
+}
+
+// SetRole gives the user with the ID another role, which takes effect on their next request.
+// Returns ErrForbidden unless the actor may manage users, and ErrLastAdmin when the user is the only admin,
+// so that users can always be managed.
+func (s *UserService) SetRole(ctx context.Context, id string, role model.Role) (*model.User, error) {
+	if err := authorize(ctx, model.PermManage); err != nil {
+		return nil, err
+	}
+	if !role.Valid() {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrValidationFailed, role)
+	}
+
+	user, err := s.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == role {
+		return user, nil
+	}
+	if user.Role == model.RoleAdmin {
+		admins, err := s.users.CountByRole(ctx, model.RoleAdmin)
+		if err != nil {
+			return nil, translate(err)
+		}
+		if admins <= 1 {
+			return nil, ErrLastAdmin
+		}
+	}
+
+	if err := s.users.SetRole(ctx, user.ID, role); err != nil {
+		return nil, translate(err)
+	}
+	user.Role = role
+	return user, nil
+}
+
+// SetPassword replaces the password of the user with the name and signs them out everywhere.
+// Returns ErrForbidden unless the actor may manage users, or ErrUserNotFound.
+func (s *UserService) SetPassword(ctx context.Context, username, password string) error {
+	if err := authorize(ctx, model.PermManage); err != nil {
+		return err
+	}
+	if err := model.ValidatePassword(password).Err(); err != nil {
+		return translate(err)
+	}
+
+	user, err := s.users.FindByUsername(ctx, model.NormalizeUsername(username))
+	if err != nil {
+		return translate(err)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), s.options.PasswordCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.users.SetPasswordHash(ctx, user.ID, string(hash)); err != nil {
+		return translate(err)
+	}
+	return translate(s.sessions.DeleteForUser(ctx, user.ID))
+}
+
+// Login checks the user name and password and starts a session.
+// It returns the session token, which identifies the session in later requests, and the user,
+// or ErrInvalidCredentials without telling whether the user exists.
+func (s *UserService) Login(ctx context.Context, username, password string) (string, *model.User, error) {
+	user, err := s.users.FindByUsername(ctx, model.NormalizeUsername(username))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		if hash, err := s.dummyHash(); err == nil {
+			_ = bcrypt.CompareHashAndPassword(hash, []byte(password))
+		}
+		return "", nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return "", nil, translate(err)
+	}
+	if user.PasswordHash == "" {
+		// Users of single sign-on have no password
+		if hash, err := s.dummyHash(); err == nil {
+			_ = bcrypt.CompareHashAndPassword(hash, []byte(password))
+		}
+		return "", nil, ErrInvalidCredentials
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return "", nil, ErrInvalidCredentials
+	}
+	return s.startSession(ctx, user)
+}
+
+// ExternalIdentity is a user signed in by an OpenID Connect provider
+type ExternalIdentity struct {
+	Issuer  string
+	Subject string
+	// Username names the user when they're created
+	Username string
+	// Role is given to the user on every sign-in
+	Role model.Role
+}
+
+// LoginExternal starts a session for a user signed in by an identity provider, creating them on their first sign-in.
+// Their role follows the provider's on every sign-in, so that changes there apply without an admin here.
+// Returns ErrUsernameTaken when a new user's name is in use, since existing accounts are never taken over,
+// or an error of KindValidation when the name or role is invalid.
+func (s *UserService) LoginExternal(ctx context.Context, identity ExternalIdentity) (string, *model.User, error) {
+	if !identity.Role.Valid() {
+		return "", nil, fmt.Errorf("%w: unknown role %q", ErrValidationFailed, identity.Role)
+	}
+
+	user, err := s.users.FindByOIDCSubject(ctx, identity.Issuer, identity.Subject)
+	switch {
+	case errors.Is(err, repository.ErrUserNotFound):
+		username := model.NormalizeUsername(identity.Username)
+		if err := model.ValidateUsername(username).Err(); err != nil {
+			return "", nil, translate(err)
+		}
+		user = &model.User{Username: username, Role: identity.Role, OIDCIssuer: identity.Issuer, OIDCSubject: identity.Subject}
+		if err := s.users.Create(ctx, user); err != nil {
+			return "", nil, translate(err)
+		}
+	case err != nil:
+		return "", nil, translate(err)
+	case user.Role != identity.Role:
+		if err := s.users.SetRole(ctx, user.ID, identity.Role); err != nil {
+			return "", nil, translate(err)
+		}
+		user.Role = identity.Role
+	}
+	return s.startSession(ctx, user)
+}
+
+// startSession starts a session for the user and returns its token
+func (s *UserService) startSession(ctx context.Context, user *model.User) (string, *model.User, error) {
+	token, err := newSessionToken()
+	if err != nil {
+		return "", nil, err
+	}
+	now := s.now()
+	session := &model.Session{ID: hashToken(token), UserID: user.ID, CreatedAt: now, ExpiresAt: now.Add(s.options.SessionTTL)}
+	if err := s.sessions.Create(ctx, session); err != nil {
+		return "", nil, fmt.Errorf("failed to store session: %w", err)
+	}
+	return token, user, nil
+}
+
+// Logout ends the session identified by token
+func (s *UserService) Logout(ctx context.Context, token string) error {
+	return translate(s.sessions.Delete(ctx, hashToken(token)))
+}
+
+// Authenticate returns the signed-in user of the session identified by token,
+// or ErrSessionExpired if the session ended or its user no longer exists
+func (s *UserService) Authenticate(ctx context.Context, token string) (*model.User, error) {
+	session, err := s.sessions.Find(ctx, hashToken(token), s.now())
+	if err != nil {
+		return nil, translate(err)
+	}
+	user, err := s.users.FindByID(ctx, session.UserID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, ErrSessionExpired
+	}
+	if err != nil {
+		return nil, translate(err)
+	}
+	return user, nil
+}
+
+// SessionTTL returns how long sessions last, e.g. for the expiry of session cookies
+func (s *UserService) SessionTTL() time.Duration {
+	return s.options.SessionTTL
+}
+
+// findUser returns the user with the hex ID
+func (s *UserService) findUser(ctx context.Context, id string) (*model.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	user, err := s.users.FindByID(ctx, objectID)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return user, nil
+}
+
+// newSessionToken returns a random session token
+func newSessionToken() (string, error) {
+	b := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the SHA-256 hash that session and API tokens are stored under
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mockUserRepository keeps users in memory
+type mockUserRepository struct {
+	users []*model.User
+}
+
+func (m *mockUserRepository) Create(ctx context.Context, user *model.User) error {
+	if _, err := m.FindByUsername(ctx, user.Username); err == nil {
+		return repository.ErrUsernameTaken
+	}
+	user.ID = primitive.NewObjectID()
+	m.users = append(m.users, user)
+	return nil
+}
+
+func (m *mockUserRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.User, error) {
+	for _, user := range m.users {
+		if user.ID == id {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindByUsername(ctx context.Context, username string) (*model.User, error) {
+	for _, user := range m.users {
+		if user.Username == username {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindByOIDCSubject(ctx context.Context, issuer, subject string) (*model.User, error) {
+	for _, user := range m.users {
+		if user.OIDCIssuer == issuer && user.OIDCSubject == subject {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) FindAll(ctx context.Context) ([]*model.User, error) {
+	return m.users, nil
+}
+
+func (m *mockUserRepository) CountByRole(ctx context.Context, role model.Role) (int64, error) {
+	var count int64
+	for _, user := range m.users {
+		if user.Role == role {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockUserRepository) SetRole(ctx context.Context, id primitive.ObjectID, role model.Role) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.Role = role
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+func (m *mockUserRepository) SetPasswordHash(ctx context.Context, id primitive.ObjectID, hash string) error {
+	for _, user := range m.users {
+		if user.ID == id {
+			user.PasswordHash = hash
+			return nil
+		}
+	}
+	return repository.ErrUserNotFound
+}
+
+// mockSessionRepository keeps sessions in memory
+type mockSessionRepository struct {
+	sessions map[string]*model.Session
+}
+
+func (m *mockSessionRepository) Create(ctx context.Context, session *model.Session) error {
+	if m.sessions == nil {
+		m.sessions = make(map[string]*model.Session)
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *mockSessionRepository) Find(ctx context.Context, id string, now time.Time) (*model.Session, error) {
+	session, ok := m.sessions[id]
+	if !ok || !session.ExpiresAt.After(now) {
+		return nil, repository.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (m *mockSessionRepository) Delete(ctx context.Context, id string) error {
+	delete(m.sessions, id)
+	return nil
+}
+
+func (m *mockSessionRepository) DeleteForUser(ctx context.Context, userID primitive.ObjectID) error {
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+	return nil
+}
+
+func newTestUserService() (*UserService, *mockUserRepository, *mockSessionRepository) {
+	users := &mockUserRepository{}
+	sessions := &mockSessionRepository{}
+	return NewUserService(users, sessions, UserOptions{PasswordCost: bcrypt.MinCost}), users, sessions
+}
+
+func TestUserServiceLogin(t *testing.T) {
+	service, _, _ := newTestUserService()
+	ctx := context.Background()
+
+	user, err := service.CreateUser(ctx, UserInput{Username: " Jane ", Password: "correct horse", Role: model.RoleAuthor})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	if user.Username != "jane" || user.PasswordHash == "correct horse" {
+		t.Errorf("created user = %+v, want a normalized name and a hashed password", user)
+	}
+	if _, err := service.CreateUser(ctx, UserInput{Username: "jane", Password: "another one", Role: model.RoleReader}); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("CreateUser() of a taken name error = %v, want ErrUsernameTaken", err)
+	}
+
+	for _, tt := range []struct{ username, password string }{{"jane", "wrong horse"}, {"nobody", "correct horse"}} {
+		if _, _, err := service.Login(ctx, tt.username, tt.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Login(%q, %q) error = %v, want ErrInvalidCredentials", tt.username, tt.password, err)
+		}
+	}
+
+	token, signedIn, err := service.Login(ctx, "JANE", "correct horse")
+	if err != nil || signedIn.ID != user.ID {
+		t.Fatalf("Login() = %v, %v, want jane signed in", signedIn, err)
+	}
+	if authenticated, err := service.Authenticate(ctx, token); err != nil || authenticated.ID != user.ID {
+		t.Errorf("Authenticate() = %v, %v, want jane", authenticated, err)
+	}
+
+	// Sessions end when they expire, on sign out and when the password changes
+	service.now = func() time.Time { return time.Now().Add(service.SessionTTL() + time.Minute) }
+	if _, err := service.Authenticate(ctx, token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Authenticate() of an expired session error = %v, want ErrSessionExpired", err)
+	}
+	service.now = time.Now
+
+	if err := service.Logout(ctx, token); err != nil {
+		t.Fatalf("Logout() error = %v", err)
+	}
+	if _, err := service.Authenticate(ctx, token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Authenticate() after Logout() error = %v, want ErrSessionExpired", err)
+	}
+
+	token, _, _ = service.Login(ctx, "jane", "correct horse")
+	if err := service.SetPassword(ctx, "jane", "battery staple"); err != nil {
+		t.Fatalf("SetPassword() error = %v", err)
+	}
+	if _, err := service.Authenticate(ctx, token); !errors.Is(err, ErrSessionExpired) {
+		t.Errorf("Authenticate() after SetPassword() error = %v, want ErrSessionExpired", err)
+	}
+	if _, _, err := service.Login(ctx, "jane", "battery staple"); err != nil {
+		t.Errorf("Login() with the new password error = %v", err)
+	}
+}
+
+func TestUserServiceRoles(t *testing.T) {
+	service, _, _ := newTestUserService()
+	ctx := context.Background()
+
+	admin, err := service.CreateUser(ctx, UserInput{Username: "admin", Password: "correct horse", Role: model.RoleAdmin})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	jane, err := service.CreateUser(ctx, UserInput{Username: "jane", Password: "correct horse", Role: model.RoleReader})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	// Only users who may manage users assign roles
+	editor := WithActor(ctx, Actor{ID: jane.ID.Hex(), Role: model.RoleEditor})
+	if _, err := service.SetRole(editor, jane.ID.Hex(), model.RoleAdmin); !errors.Is(err, ErrForbidden) {
+		t.Errorf("SetRole() by an editor error = %v, want ErrForbidden", err)
+	}
+	if _, err := service.ListUsers(editor); !errors.Is(err, ErrForbidden) {
+		t.Errorf("ListUsers() by an editor error = %v, want ErrForbidden", err)
+	}
+
+	asAdmin := WithActor(ctx, Actor{ID: admin.ID.Hex(), Role: model.RoleAdmin})
+	updated, err := service.SetRole(asAdmin, jane.ID.Hex(), model.RoleEditor)
+	if err != nil || updated.Role != model.RoleEditor {
+		t.Fatalf("SetRole() = %v, %v, want jane an editor", updated, err)
+	}
+	if _, err := service.SetRole(asAdmin, jane.ID.Hex(), model.Role("owner")); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("SetRole() of an unknown role error = %v, want ErrValidationFailed", err)
+	}
+	if _, err := service.SetRole(asAdmin, "not-an-id", model.RoleEditor); !errors.Is(err, ErrInvalidUserID) {
+		t.Errorf("SetRole() of an invalid ID error = %v, want ErrInvalidUserID", err)
+	}
+
+	// The last admin keeps their role, so that someone can always manage users
+	if _, err := service.SetRole(asAdmin, admin.ID.Hex(), model.RoleEditor); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("SetRole() of the last admin error = %v, want ErrLastAdmin", err)
+	}
+	if _, err := service.SetRole(asAdmin, jane.ID.Hex(), model.RoleAdmin); err != nil {
+		t.Fatalf("SetRole() error = %v", err)
+	}
+	if _, err := service.SetRole(asAdmin, admin.ID.Hex(), model.RoleEditor); err != nil {
+		t.Errorf("SetRole() of one of two admins error = %v", err)
+	}
+
+	users, err := service.ListUsers(asAdmin)
+	if err != nil || len(users) != 2 {
+		t.Errorf("ListUsers() = %d users, %v, want 2", len(users), err)
+	}
+}
+
+func TestUserServiceLoginExternal(t *testing.T) {
+	service, users, _ := newTestUserService()
+	ctx := context.Background()
+	if _, err := service.CreateUser(ctx, UserInput{Username: "john", Password: "correct horse", Role: model.RoleAdmin}); err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	identity := ExternalIdentity{Issuer: "https://idp.example", Subject: "u-1", Username: "Jane", Role: model.RoleAuthor}
+
+	// The first sign-in creates the user, later ones find them by their subject and follow their role
+	token, jane, err := service.LoginExternal(ctx, identity)
+	if err != nil {
+		t.Fatalf("LoginExternal() error = %v", err)
+	}
+	if jane.Username != "jane" || jane.Role != model.RoleAuthor || jane.PasswordHash != "" || !jane.SSO() {
+		t.Errorf("created user = %+v, want jane, an author without a password", jane)
+	}
+	if authenticated, err := service.Authenticate(ctx, token); err != nil || authenticated.ID != jane.ID {
+		t.Errorf("Authenticate() = %v, %v, want jane", authenticated, err)
+	}
+
+	identity.Username, identity.Role = "jane.doe", model.RoleEditor
+	if _, again, err := service.LoginExternal(ctx, identity); err != nil || again.ID != jane.ID || again.Role != model.RoleEditor {
+		t.Errorf("LoginExternal() again = %+v, %v, want jane as an editor", again, err)
+	}
+	if len(users.users) != 2 || users.users[1].Role != model.RoleEditor {
+		t.Errorf("stored users = %d, want jane's new role stored", len(users.users))
+	}
+
+	// Users of single sign-on have no password, and existing users aren't taken over
+	if _, _, err := service.Login(ctx, "jane", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Login() without a password error = %v, want ErrInvalidCredentials", err)
+	}
+	john := ExternalIdentity{Issuer: "https://idp.example", Subject: "u-2", Username: "john", Role: model.RoleReader}
+	if _, _, err := service.LoginExternal(ctx, john); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("LoginExternal() of a taken name error = %v, want ErrUsernameTaken", err)
+	}
+	john.Username = "j"
+	if _, _, err := service.LoginExternal(ctx, john); KindOf(err) != KindValidation {
+		t.Errorf("LoginExternal() of an invalid name error = %v, want KindValidation", err)
+	}
+	john.Username, john.Role = "john.smith", "owner"
+	if _, _, err := service.LoginExternal(ctx, john); !errors.Is(err, ErrValidationFailed) {
+		t.Errorf("LoginExternal() with an unknown role error = %v, want ErrValidationFailed", err)
+	}
+}
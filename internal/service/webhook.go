@@ -0,0 +1,440 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Headers of webhook requests
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// maxErrorBody is how much of a failed response body is kept as the delivery's last error
+const maxErrorBody = 256
+
+// WebhookOptions tunes webhook deliveries; zero values fall back to the defaults of NewWebhookService
+type WebhookOptions struct {
+	// MaxAttempts is the number of attempts after which a delivery moves to the dead-letter list
+	MaxAttempts int
+	// Backoff is the delay before the first retry; each further retry waits twice as long, up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Timeout bounds each request to a receiver
+	Timeout time.Duration
+	// Client sends the requests; tests can replace it
+	Client *http.Client
+}
+
+// WebhookService manages webhook subscriptions and sends post events to them
+type WebhookService struct {
+	webhooks   repository.WebhookRepository
+	deliveries repository.DeliveryRepository
+	options    WebhookOptions
+	now        func() time.Time
+}
+
+// NewWebhookService creates a new webhook service.
+// By default a delivery is attempted 8 times, retried after 30s, 1m, 2m and so on up to an hour, with a 10s timeout.
+func NewWebhookService(webhooks repository.WebhookRepository, deliveries repository.DeliveryRepository, options WebhookOptions) *WebhookService {
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 8
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = 30 * time.Second
+	}
+	if options.MaxBackoff < options.Backoff {
+		options.MaxBackoff = max(time.Hour, options.Backoff)
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = 10 * time.Second
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{}
+	}
+	return &WebhookService{
+		webhooks:   webhooks,
+		deliveries: deliveries,
+		options:    options,
+		now:        time.Now,
+	}
+}
+
+// WebhookInput holds the fields of a new webhook
+type WebhookInput struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret signs the payloads; a random one is generated when empty
+	Secret string `json:"secret"`
+}
+
+// CreateWebhook subscribes an http or https URL to the given events.
+// Returns the webhook with its secret, which receivers need to verify signatures.
+func (s *WebhookService) CreateWebhook(ctx context.Context, input WebhookInput) (*model.Webhook, error) {
+	target, err := url.Parse(strings.TrimSpace(input.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("%w: the webhook URL must be an absolute http or https URL", ErrValidationFailed)
+	}
+
+	var events []model.EventType
+	for _, name := range input.Events {
+		event := model.EventType(strings.TrimSpace(name))
+		if !event.Valid() {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrValidationFailed, name)
+		}
+		if !slices.Contains(events, event) {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("%w: select at least one event", ErrValidationFailed)
+	}
+
+	secret := strings.TrimSpace(input.Secret)
+	if secret == "" {
+		if secret, err = generateSecret(); err != nil {
+			return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+		}
+	}
+
+	webhook := &model.Webhook{URL: target.String(), Secret: secret, Events: events, Active: true}
+	if err := s.webhooks.Create(ctx, webhook); err != nil {
+		return nil, translate(err)
+	}
+	return webhook, nil
+}
+
+// ListWebhooks returns every webhook, oldest first
+func (s *WebhookService) ListWebhooks(ctx context.Context) ([]*model.Webhook, error) {
+	webhooks, err := s.webhooks.FindAll(ctx)
+	if err != nil {
+		return nil, translate(err)
+	}
+	return webhooks, nil
+}
+
+// SetWebhookActive pauses or resumes sending events to a webhook
+func (s *WebhookService) SetWebhookActive(ctx context.Context, id string, active bool) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidWebhookID
+	}
+	return translate(s.webhooks.SetActive(ctx, objectID, active))
+}
+
+// DeleteWebhook removes a webhook. Its pending deliveries are dropped when they come due.
+func (s *WebhookService) DeleteWebhook(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidWebhookID
+	}
+	return translate(s.webhooks.Delete(ctx, objectID))
+}
+
+// DeliveryQuery selects webhook deliveries; empty fields match every delivery
+type DeliveryQuery struct {
+	WebhookID string
+	Status    string
+
+	Page     int
+	PageSize int
+}
+
+// ListDeliveries retrieves a page of deliveries matching the query, newest first.
+// Page numbers and sizes are adjusted like in GetPosts.
+func (s *WebhookService) ListDeliveries(ctx context.Context, query DeliveryQuery) ([]*model.Delivery, Pagination, error) {
+	if query.Page < 1 {
+		query.Page = 1
+	}
+	if query.PageSize < 1 {
+		query.PageSize = 10
+	}
+	if query.PageSize > 100 {
+		query.PageSize = 100
+	}
+
+	filter := repository.DeliveryFilter{Status: model.DeliveryStatus(query.Status)}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return nil, Pagination{}, fmt.Errorf("%w: unknown delivery status %q", ErrValidationFailed, query.Status)
+	}
+	if query.WebhookID != "" {
+		id, err := primitive.ObjectIDFromHex(query.WebhookID)
+		if err != nil {
+			return nil, Pagination{}, ErrInvalidWebhookID
+		}
+		filter.WebhookID = id
+	}
+
+	page, err := s.deliveries.FindPage(ctx, filter, query.PageSize, (query.Page-1)*query.PageSize)
+	if err != nil {
+		return nil, Pagination{}, translate(err)
+	}
+
+	return page.Deliveries, NewPagination(query.Page, query.PageSize, page.Total), nil
+}
+
+// ReplayDelivery queues a delivery to be sent again right away with a fresh set of attempts.
+// The payload and its delivery ID are unchanged, so receivers can recognize a replay of a delivery they processed.
+func (s *WebhookService) ReplayDelivery(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrInvalidDeliveryID
+	}
+	return translate(s.deliveries.Requeue(ctx, objectID, s.now()))
+}
+
+// webhookPayload is the JSON body of a webhook request
+type webhookPayload struct {
+	ID string `json:"id"`
+	// EventID is the same in the deliveries of an event to every webhook, and in replays
+	EventID   string          `json:"event_id"`
+	Event     model.EventType `json:"event"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      webhookData     `json:"data"`
+}
+
+type webhookData struct {
+	PostID string `json:"post_id"`
+	// Post is omitted for changes made by bulk actions
+	Post *model.Post `json:"post,omitempty"`
+}
+
+// Name identifies the webhooks as an outbox sink
+func (s *WebhookService) Name() string {
+	return "webhooks"
+}
+
+// HandleEvent queues a delivery of the event to every active webhook subscribed to it.
+// It is meant to be run by an OutboxRelay: deliveries carry the event ID,
+// so handling an event again doesn't queue a second delivery to the same webhook.
+// Only the webhooks of the event's tenant receive it; events of unknown tenants are dropped.
+func (s *WebhookService) HandleEvent(ctx context.Context, event model.PostEvent) error {
+	if event.TenantID == "" {
+		return nil
+	}
+	ctx = tenant.WithID(ctx, event.TenantID)
+
+	webhooks, err := s.webhooks.FindSubscribed(ctx, event.Type)
+	if err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil
+	}
+
+	now := s.now()
+	deliveries := make([]*model.Delivery, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		id := primitive.NewObjectID()
+		payload, err := json.Marshal(webhookPayload{
+			ID:        id.Hex(),
+			EventID:   event.ID.Hex(),
+			Event:     event.Type,
+			CreatedAt: event.Time,
+			Data:      webhookData{PostID: event.PostID.Hex(), Post: event.Post},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode webhook payload: %w", err)
+		}
+		deliveries = append(deliveries, &model.Delivery{
+			ID:            id,
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			URL:           webhook.URL,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        model.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+			TenantID:      event.TenantID,
+		})
+	}
+
+	if err := s.deliveries.Enqueue(ctx, deliveries...); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// Run attempts due deliveries every interval until ctx is canceled
+func (s *WebhookService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.DeliverDue(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue attempts every delivery that is due, one at a time, and returns how many it attempted.
+// Several workers can run it at once: each delivery is claimed by one of them.
+func (s *WebhookService) DeliverDue(ctx context.Context) (int, error) {
+	// A claimed delivery is skipped by other workers for twice the request timeout
+	lease := 2 * s.options.Timeout
+
+	count := 0
+	for ctx.Err() == nil {
+		delivery, err := s.deliveries.ClaimDue(ctx, s.now(), lease)
+		if err != nil {
+			return count, fmt.Errorf("failed to claim webhook delivery: %w", err)
+		}
+		if delivery == nil {
+			return count, nil
+		}
+
+		s.attempt(ctx, delivery)
+		count++
+
+		if err := s.deliveries.SaveAttempt(context.WithoutCancel(ctx), delivery); err != nil {
+			return count, fmt.Errorf("failed to save webhook delivery %s: %w", delivery.ID.Hex(), err)
+		}
+	}
+	return count, ctx.Err()
+}
+
+// attempt sends the delivery to its webhook and updates it with the outcome.
+// Failed deliveries are retried with exponential backoff until they run out of attempts and are dead-lettered.
+func (s *WebhookService) attempt(ctx context.Context, delivery *model.Delivery) {
+	delivery.Attempts++
+	logger := slog.With("deliveryId", delivery.ID.Hex(), "event", delivery.Event, "url", delivery.URL, "attempt", delivery.Attempts)
+
+	// Deliveries are claimed for every tenant; the webhook is looked up in the delivery's
+	ctx = tenant.WithID(ctx, delivery.TenantID)
+	webhook, err := s.webhooks.FindByID(ctx, delivery.WebhookID)
+	if err != nil {
+		// Deliveries of deleted webhooks can't be signed or sent
+		delivery.Status = model.DeliveryDead
+		delivery.LastError = err.Error()
+		delivery.LastStatusCode = 0
+		logger.Warn("Webhook delivery dropped", "error", err)
+		return
+	}
+
+	statusCode, err := s.send(ctx, webhook, delivery)
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = s.now()
+		delivery.LastError = ""
+		logger.Info("Webhook delivered", "status", statusCode)
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= s.options.MaxAttempts {
+		delivery.Status = model.DeliveryDead
+		logger.Error("Webhook delivery failed permanently", "error", err, "status", statusCode)
+		return
+	}
+	delivery.Status = model.DeliveryPending
+	delivery.NextAttemptAt = s.now().Add(s.backoff(delivery.Attempts))
+	logger.Warn("Webhook delivery failed", "error", err, "status", statusCode, "nextAttemptAt", delivery.NextAttemptAt)
+}
+
+// send posts the signed payload of the delivery to the webhook.
+// It returns the response status code, if any, and an error unless the receiver answered with a 2xx status.
+func (s *WebhookService) send(ctx context.Context, webhook *model.Webhook, delivery *model.Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.options.Timeout)
+	defer cancel()
+
+	body := []byte(delivery.Payload)
+	timestamp := s.now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-htmx-mongo-webhooks")
+	req.Header.Set(WebhookEventHeader, string(delivery.Event))
+	req.Header.Set(WebhookDeliveryHeader, delivery.ID.Hex())
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(webhook.Secret, timestamp, body))
+
+	resp, err := s.options.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		// Drain the body so the connection can be reused
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return resp.StatusCode, nil
+	}
+
+	excerpt, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message := fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	if text := strings.TrimSpace(string(excerpt)); text != "" {
+		message += ": " + text
+	}
+	return resp.StatusCode, errors.New(message)
+}
+
+// backoff returns the delay before the retry that follows the given number of failed attempts
+func (s *WebhookService) backoff(attempts int) time.Duration {
+	delay := s.options.Backoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= s.options.MaxBackoff {
+			return s.options.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// SignWebhook returns the X-Webhook-Signature header value of a payload sent at timestamp (Unix seconds):
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the webhook secret
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature is the valid signature of body sent at timestamp.
+// Receivers should also reject timestamps far from their clock to prevent replays.
+func VerifyWebhook(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(SignWebhook(secret, timestamp, body)), []byte(signature))
+}
+
+// generateSecret returns a random hex secret for signing webhook payloads
+func generateSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
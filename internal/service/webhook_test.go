@@ -0,0 +1,513 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/repository"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockWebhookRepository keeps webhooks in memory, scoped to tenants like the MongoDB repository
+type mockWebhookRepository struct {
+	webhooks []*model.Webhook
+}
+
+func (m *mockWebhookRepository) Create(ctx context.Context, webhook *model.Webhook) error {
+	webhook.ID = primitive.NewObjectID()
+	webhook.CreatedAt = time.Now()
+	webhook.TenantID = tenant.ID(ctx)
+	m.webhooks = append(m.webhooks, webhook)
+	return nil
+}
+
+func (m *mockWebhookRepository) FindAll(ctx context.Context) ([]*model.Webhook, error) {
+	var webhooks []*model.Webhook
+	for _, webhook := range m.webhooks {
+		if tenant.From(ctx).Owns(webhook.TenantID) {
+			webhooks = append(webhooks, webhook)
+		}
+	}
+	return webhooks, nil
+}
+
+func (m *mockWebhookRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Webhook, error) {
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id && tenant.From(ctx).Owns(webhook.TenantID) {
+			return webhook, nil
+		}
+	}
+	return nil, repository.ErrWebhookNotFound
+}
+
+func (m *mockWebhookRepository) FindSubscribed(ctx context.Context, t model.EventType) ([]*model.Webhook, error) {
+	var subscribed []*model.Webhook
+	for _, webhook := range m.webhooks {
+		if webhook.Subscribed(t) && tenant.From(ctx).Owns(webhook.TenantID) {
+			subscribed = append(subscribed, webhook)
+		}
+	}
+	return subscribed, nil
+}
+
+func (m *mockWebhookRepository) SetActive(ctx context.Context, id primitive.ObjectID, active bool) error {
+	webhook, err := m.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	webhook.Active = active
+	return nil
+}
+
+func (m *mockWebhookRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id && tenant.From(ctx).Owns(webhook.TenantID) {
+			m.webhooks = slices.Delete(m.webhooks, i, i+1)
+			return nil
+		}
+	}
+	return repository.ErrWebhookNotFound
+}
+
+// mockDeliveryRepository keeps deliveries in memory, claiming them like the MongoDB repository
+type mockDeliveryRepository struct {
+	deliveries []*model.Delivery
+}
+
+func (m *mockDeliveryRepository) Enqueue(ctx context.Context, deliveries ...*model.Delivery) error {
+	for _, delivery := range deliveries {
+		if m.queued(delivery.WebhookID, delivery.EventID) {
+			continue
+		}
+		if delivery.ID.IsZero() {
+			delivery.ID = primitive.NewObjectID()
+		}
+		if delivery.TenantID == "" {
+			delivery.TenantID = tenant.ID(ctx)
+		}
+		stored := *delivery
+		m.deliveries = append(m.deliveries, &stored)
+	}
+	return nil
+}
+
+// queued reports whether a delivery of the event to the webhook is already stored, like the unique index does
+func (m *mockDeliveryRepository) queued(webhookID, eventID primitive.ObjectID) bool {
+	if eventID.IsZero() {
+		return false
+	}
+	for _, delivery := range m.deliveries {
+		if delivery.WebhookID == webhookID && delivery.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mockDeliveryRepository) ClaimDue(ctx context.Context, now time.Time, lease time.Duration) (*model.Delivery, error) {
+	var due *model.Delivery
+	for _, delivery := range m.deliveries {
+		if delivery.Status == model.DeliveryPending && !delivery.NextAttemptAt.After(now) &&
+			(due == nil || delivery.NextAttemptAt.Before(due.NextAttemptAt)) {
+			due = delivery
+		}
+	}
+	if due == nil {
+		return nil, nil
+	}
+	due.NextAttemptAt = now.Add(lease)
+	claimed := *due
+	return &claimed, nil
+}
+
+func (m *mockDeliveryRepository) SaveAttempt(ctx context.Context, delivery *model.Delivery) error {
+	stored, err := m.FindByID(ctx, delivery.ID)
+	if err != nil {
+		return err
+	}
+	*stored = *delivery
+	return nil
+}
+
+func (m *mockDeliveryRepository) FindByID(ctx context.Context, id primitive.ObjectID) (*model.Delivery, error) {
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+	return nil, repository.ErrDeliveryNotFound
+}
+
+func (m *mockDeliveryRepository) FindPage(ctx context.Context, filter repository.DeliveryFilter, limit, offset int) (*repository.DeliveryPage, error) {
+	var deliveries []*model.Delivery
+	for _, delivery := range m.deliveries {
+		if filter.Status == "" || delivery.Status == filter.Status {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return &repository.DeliveryPage{Deliveries: deliveries, Total: int64(len(deliveries))}, nil
+}
+
+func (m *mockDeliveryRepository) Requeue(ctx context.Context, id primitive.ObjectID, now time.Time) error {
+	delivery, err := m.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	delivery.Status = model.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = now
+	return nil
+}
+
+// receivedWebhook is a request recorded by a test receiver
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver is a local HTTP server that records webhook requests and answers with status
+type webhookReceiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	status   int
+	received []receivedWebhook
+}
+
+func newWebhookReceiver(t *testing.T, status int) *webhookReceiver {
+	receiver := &webhookReceiver{status: status}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		receiver.mu.Lock()
+		defer receiver.mu.Unlock()
+		receiver.received = append(receiver.received, receivedWebhook{header: r.Header.Clone(), body: body})
+		w.WriteHeader(receiver.status)
+		if receiver.status >= 300 {
+			io.WriteString(w, "receiver unavailable")
+		}
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver
+}
+
+func (r *webhookReceiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *webhookReceiver) requests() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.received...)
+}
+
+// newTestWebhookService returns a webhook service with in-memory repositories and a clock the test controls
+func newTestWebhookService(options WebhookOptions) (*WebhookService, *mockDeliveryRepository, *time.Time) {
+	deliveries := &mockDeliveryRepository{}
+	service := NewWebhookService(&mockWebhookRepository{}, deliveries, options)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+	return service, deliveries, &now
+}
+
+// newTestEvent returns an event of the default tenant, like the post service creates outside requests
+func newTestEvent(t model.EventType, postID primitive.ObjectID, post *model.Post, now time.Time) model.PostEvent {
+	event := model.NewPostEvent(t, postID, post, now)
+	event.TenantID = tenant.DefaultID
+	return event
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusNoContent)
+	service, deliveries, now := newTestWebhookService(WebhookOptions{})
+	ctx := context.Background()
+
+	webhook, err := service.CreateWebhook(ctx, WebhookInput{URL: receiver.URL, Events: []string{"post.created"}})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if len(webhook.Secret) != 64 {
+		t.Errorf("CreateWebhook() secret = %q, want a generated 32 byte hex secret", webhook.Secret)
+	}
+	// Not subscribed, so only the post.created event is delivered
+	if _, err := service.CreateWebhook(ctx, WebhookInput{URL: receiver.URL, Events: []string{"post.deleted"}}); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+
+	post := model.NewPost("Hello", "World")
+	post.ID = primitive.NewObjectID()
+	event := newTestEvent(model.EventPostCreated, post.ID, post, *now)
+	// Relays pass an event again after failures, which must not queue a second delivery
+	for range 2 {
+		if err := service.HandleEvent(ctx, event); err != nil {
+			t.Fatalf("HandleEvent() error = %v", err)
+		}
+	}
+
+	count, err := service.DeliverDue(ctx)
+	if err != nil || count != 1 {
+		t.Fatalf("DeliverDue() = %d, %v, want 1 delivery", count, err)
+	}
+
+	requests := receiver.requests()
+	if len(requests) != 1 {
+		t.Fatalf("receiver got %d requests, want 1", len(requests))
+	}
+	request := requests[0]
+	delivery := deliveries.deliveries[0]
+
+	timestamp, err := strconv.ParseInt(request.header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil || timestamp != now.Unix() {
+		t.Errorf("%s = %q, want %d", WebhookTimestampHeader, request.header.Get(WebhookTimestampHeader), now.Unix())
+	}
+	if !VerifyWebhook(webhook.Secret, timestamp, request.body, request.header.Get(WebhookSignatureHeader)) {
+		t.Errorf("%s = %q does not verify with the webhook secret", WebhookSignatureHeader, request.header.Get(WebhookSignatureHeader))
+	}
+	if VerifyWebhook("other secret", timestamp, request.body, request.header.Get(WebhookSignatureHeader)) {
+		t.Error("signature verifies with another secret")
+	}
+	if got := request.header.Get(WebhookEventHeader); got != "post.created" {
+		t.Errorf("%s = %q, want post.created", WebhookEventHeader, got)
+	}
+	if got := request.header.Get(WebhookDeliveryHeader); got != delivery.ID.Hex() {
+		t.Errorf("%s = %q, want the delivery ID %s", WebhookDeliveryHeader, got, delivery.ID.Hex())
+	}
+
+	var payload struct {
+		ID      string `json:"id"`
+		EventID string `json:"event_id"`
+		Event   string `json:"event"`
+		Data    struct {
+			PostID string      `json:"post_id"`
+			Post   *model.Post `json:"post"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("payload %s is not JSON: %v", request.body, err)
+	}
+	if payload.ID != delivery.ID.Hex() || payload.EventID != event.ID.Hex() || payload.Event != "post.created" || payload.Data.PostID != post.ID.Hex() ||
+		payload.Data.Post == nil || payload.Data.Post.Title != "Hello" {
+		t.Errorf("payload = %s, want the created post", request.body)
+	}
+
+	if delivery.Status != model.DeliveryDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusNoContent {
+		t.Errorf("delivery = %+v, want delivered after one attempt", delivery)
+	}
+	if count, _ := service.DeliverDue(ctx); count != 0 {
+		t.Errorf("DeliverDue() attempted %d deliveries again, want 0", count)
+	}
+}
+
+func TestWebhookRetriesAndDeadLetters(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusInternalServerError)
+	service, deliveries, now := newTestWebhookService(WebhookOptions{MaxAttempts: 3, Backoff: time.Minute})
+	ctx := context.Background()
+
+	if _, err := service.CreateWebhook(ctx, WebhookInput{URL: receiver.URL, Events: []string{"post.deleted"}}); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if err := service.HandleEvent(ctx, newTestEvent(model.EventPostDeleted, primitive.NewObjectID(), nil, *now)); err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	delivery := deliveries.deliveries[0]
+
+	for attempt, wait := range []time.Duration{time.Minute, 2 * time.Minute} {
+		if count, err := service.DeliverDue(ctx); err != nil || count != 1 {
+			t.Fatalf("attempt %d: DeliverDue() = %d, %v, want 1 delivery", attempt+1, count, err)
+		}
+		if delivery.Status != model.DeliveryPending || !delivery.NextAttemptAt.Equal(now.Add(wait)) {
+			t.Errorf("attempt %d: delivery is %s, next attempt at %v, want pending in %v", attempt+1, delivery.Status, delivery.NextAttemptAt, wait)
+		}
+		// Not due yet
+		if count, _ := service.DeliverDue(ctx); count != 0 {
+			t.Errorf("attempt %d: DeliverDue() retried %d deliveries before the backoff elapsed", attempt+1, count)
+		}
+		*now = now.Add(wait)
+	}
+
+	if count, err := service.DeliverDue(ctx); err != nil || count != 1 {
+		t.Fatalf("last attempt: DeliverDue() = %d, %v, want 1 delivery", count, err)
+	}
+	if delivery.Status != model.DeliveryDead || delivery.Attempts != 3 || delivery.LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("delivery = %+v, want dead after 3 attempts", delivery)
+	}
+	if !strings.Contains(delivery.LastError, "receiver unavailable") {
+		t.Errorf("LastError = %q, want the response body", delivery.LastError)
+	}
+
+	dead, _, err := service.ListDeliveries(ctx, DeliveryQuery{Status: "dead"})
+	if err != nil || len(dead) != 1 {
+		t.Fatalf("ListDeliveries(dead) = %v, %v, want the dead delivery", dead, err)
+	}
+
+	receiver.setStatus(http.StatusOK)
+	if err := service.ReplayDelivery(ctx, delivery.ID.Hex()); err != nil {
+		t.Fatalf("ReplayDelivery() error = %v", err)
+	}
+	if count, err := service.DeliverDue(ctx); err != nil || count != 1 {
+		t.Fatalf("after replay: DeliverDue() = %d, %v, want 1 delivery", count, err)
+	}
+	if delivery.Status != model.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Errorf("replayed delivery = %+v, want delivered on its first new attempt", delivery)
+	}
+
+	requests := receiver.requests()
+	if len(requests) != 4 {
+		t.Fatalf("receiver got %d requests, want 3 failed attempts and the replay", len(requests))
+	}
+	for _, request := range requests {
+		if got := request.header.Get(WebhookDeliveryHeader); got != delivery.ID.Hex() {
+			t.Errorf("%s = %q, want the same delivery ID on every attempt", WebhookDeliveryHeader, got)
+		}
+	}
+}
+
+func TestWebhookDeliveryOfDeletedWebhook(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	service, deliveries, now := newTestWebhookService(WebhookOptions{})
+	ctx := context.Background()
+
+	webhook, err := service.CreateWebhook(ctx, WebhookInput{URL: receiver.URL, Events: []string{"post.updated"}})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if err := service.HandleEvent(ctx, newTestEvent(model.EventPostUpdated, primitive.NewObjectID(), nil, *now)); err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	if err := service.DeleteWebhook(ctx, webhook.ID.Hex()); err != nil {
+		t.Fatalf("DeleteWebhook() error = %v", err)
+	}
+
+	if _, err := service.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue() error = %v", err)
+	}
+	if delivery := deliveries.deliveries[0]; delivery.Status != model.DeliveryDead {
+		t.Errorf("delivery status = %s, want dead once its webhook is deleted", delivery.Status)
+	}
+	if len(receiver.requests()) != 0 {
+		t.Error("receiver got a request of a deleted webhook")
+	}
+}
+
+func TestWebhookDeliveryTenants(t *testing.T) {
+	receiver := newWebhookReceiver(t, http.StatusOK)
+	service, deliveries, now := newTestWebhookService(WebhookOptions{})
+	daily := tenant.WithID(context.Background(), "daily")
+	weekly := tenant.WithID(context.Background(), "weekly")
+
+	dailyWebhook, err := service.CreateWebhook(daily, WebhookInput{URL: receiver.URL + "/daily", Events: []string{"post.updated"}})
+	if err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if _, err := service.CreateWebhook(weekly, WebhookInput{URL: receiver.URL + "/weekly", Events: []string{"post.updated"}}); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+
+	event := model.NewPostEvent(model.EventPostUpdated, primitive.NewObjectID(), nil, *now)
+	// Events of no known tenant, e.g. deletions by other tools, reach no webhook
+	if err := service.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	if len(deliveries.deliveries) != 0 {
+		t.Fatalf("queued %d deliveries of an event without a tenant, want none", len(deliveries.deliveries))
+	}
+
+	// The relay handles events without a tenant in its context
+	event.TenantID = "daily"
+	if err := service.HandleEvent(context.Background(), event); err != nil {
+		t.Fatalf("HandleEvent() error = %v", err)
+	}
+	if len(deliveries.deliveries) != 1 || deliveries.deliveries[0].WebhookID != dailyWebhook.ID || deliveries.deliveries[0].TenantID != "daily" {
+		t.Fatalf("deliveries = %+v, want one to the webhook of the event's tenant", deliveries.deliveries)
+	}
+
+	// The delivery worker serves every tenant
+	if count, err := service.DeliverDue(context.Background()); err != nil || count != 1 {
+		t.Fatalf("DeliverDue() = %d, %v, want 1 delivery", count, err)
+	}
+	if delivery := deliveries.deliveries[0]; delivery.Status != model.DeliveryDelivered {
+		t.Errorf("delivery status = %s, want delivered", delivery.Status)
+	}
+	if len(receiver.requests()) != 1 {
+		t.Errorf("receiver got %d requests, want 1", len(receiver.requests()))
+	}
+
+	// Tenants only see and change their own webhooks
+	if webhooks, err := service.ListWebhooks(weekly); err != nil || len(webhooks) != 1 || webhooks[0].ID == dailyWebhook.ID {
+		t.Errorf("ListWebhooks() = %v, %v, want only the tenant's webhook", webhooks, err)
+	}
+	if err := service.DeleteWebhook(weekly, dailyWebhook.ID.Hex()); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("DeleteWebhook() of another tenant's webhook error = %v, want %v", err, ErrWebhookNotFound)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	service := NewWebhookService(&mockWebhookRepository{}, &mockDeliveryRepository{}, WebhookOptions{
+		Backoff:    10 * time.Second,
+		MaxBackoff: time.Minute,
+	})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, time.Minute},
+		{30, time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := service.backoff(tt.attempts); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestCreateWebhookValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   WebhookInput
+		wantErr bool
+	}{
+		{"valid", WebhookInput{URL: "https://example.com/hooks", Events: []string{"post.created", "post.created"}}, false},
+		{"relative URL", WebhookInput{URL: "/hooks", Events: []string{"post.created"}}, true},
+		{"unsupported scheme", WebhookInput{URL: "ftp://example.com", Events: []string{"post.created"}}, true},
+		{"no events", WebhookInput{URL: "https://example.com"}, true},
+		{"unknown event", WebhookInput{URL: "https://example.com", Events: []string{"post.viewed"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewWebhookService(&mockWebhookRepository{}, &mockDeliveryRepository{}, WebhookOptions{})
+			webhook, err := service.CreateWebhook(context.Background(), WebhookInput{URL: tt.input.URL, Events: tt.input.Events, Secret: "secret"})
+			if tt.wantErr {
+				if !errors.Is(err, ErrValidationFailed) {
+					t.Errorf("CreateWebhook() error = %v, want ErrValidationFailed", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CreateWebhook() error = %v", err)
+			}
+			if len(webhook.Events) != 1 || webhook.Secret != "secret" || !webhook.Active {
+				t.Errorf("CreateWebhook() = %+v, want an active webhook with deduplicated events and the given secret", webhook)
+			}
+		})
+	}
+}
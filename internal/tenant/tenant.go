@@ -0,0 +1,255 @@
+// Package tenant separates the newsrooms served by one deployment. Every request is resolved to a tenant
+// by its path prefix or host name, and repositories scope their queries to the tenant carried by the context.
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// DefaultID is the ID of the default tenant. It serves requests no other tenant claims, and owns the
+// documents stored before tenants existed, which have no tenant ID.
+const DefaultID = "default"
+
+// Tenant is a newsroom with its own posts, audit log and webhooks
+type Tenant struct {
+	// ID is stored with every document of the tenant; it must not change once documents exist
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Hosts are the host names the tenant is served on, e.g. "daily.example.com"
+	Hosts []string `json:"hosts,omitempty"`
+	// PathPrefix serves the tenant under a path, e.g. "/daily"
+	PathPrefix string `json:"path_prefix,omitempty"`
+	// PageSize overrides the configured number of items per page when set
+	PageSize int      `json:"page_size,omitempty"`
+	Branding Branding `json:"branding"`
+}
+
+// Branding customizes how the tenant's pages look
+type Branding struct {
+	// Title replaces the application title in page headers and titles
+	Title string `json:"title,omitempty"`
+	// LogoURL is an image shown next to the title; the Content-Security-Policy only allows images of the site itself
+	LogoURL string `json:"logo_url,omitempty"`
+	// Color is the header color as a CSS hex color, e.g. "#1a365d"
+	Color string `json:"color,omitempty"`
+}
+
+// Path returns the path of the tenant's page at p, which must start with a slash
+func (t *Tenant) Path(p string) string {
+	return t.PathPrefix + p
+}
+
+// Owns reports whether a document stored with tenantID belongs to the tenant.
+// Documents without a tenant ID belong to the default tenant.
+func (t *Tenant) Owns(tenantID string) bool {
+	return tenantID == t.ID || (tenantID == "" && t.ID == DefaultID)
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx carrying t
+func WithTenant(ctx context.Context, t *Tenant) context.Context {
+	return context.WithValue(ctx, tenantKey{}, t)
+}
+
+// WithID returns a copy of ctx carrying the tenant with the given ID, e.g. the tenant of an event
+func WithID(ctx context.Context, id string) context.Context {
+	return WithTenant(ctx, &Tenant{ID: id})
+}
+
+// FromContext returns the tenant carried by ctx, if any
+func FromContext(ctx context.Context) (*Tenant, bool) {
+	t, ok := ctx.Value(tenantKey{}).(*Tenant)
+	return t, ok && t != nil
+}
+
+// From returns the tenant carried by ctx, or the default tenant if there is none,
+// so that work outside requests, such as seeding on startup, uses the default tenant
+func From(ctx context.Context) *Tenant {
+	if t, ok := FromContext(ctx); ok {
+		return t
+	}
+	return &Tenant{ID: DefaultID}
+}
+
+// ID returns the ID of the tenant carried by ctx, or DefaultID if there is none
+func ID(ctx context.Context) string {
+	return From(ctx).ID
+}
+
+var (
+	idPattern     = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	prefixPattern = regexp.MustCompile(`^(?:/[a-z0-9]+(?:-[a-z0-9]+)*)+$`)
+	colorPattern  = regexp.MustCompile(`^#(?:[0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+)
+
+// ErrUnknownTenant is returned when looking up a tenant that isn't configured
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// Registry holds the configured tenants and resolves requests to them
+type Registry struct {
+	tenants []*Tenant
+	byID    map[string]*Tenant
+	byHost  map[string]*Tenant
+	// prefixed holds the tenants with a path prefix, longest prefix first
+	prefixed []*Tenant
+}
+
+// NewRegistry checks the tenants and creates a registry of them.
+// The default tenant is added when it isn't among them, so a registry of no tenants serves everything as before.
+func NewRegistry(tenants []Tenant) (*Registry, error) {
+	r := &Registry{byID: make(map[string]*Tenant), byHost: make(map[string]*Tenant)}
+	prefixes := make(map[string]bool)
+
+	for i := range tenants {
+		t := tenants[i]
+		t.Hosts = slices.Clone(t.Hosts)
+		if !idPattern.MatchString(t.ID) || len(t.ID) > 64 {
+			return nil, fmt.Errorf("tenant %q: the ID must contain only lowercase letters, digits and hyphens", t.ID)
+		}
+		if r.byID[t.ID] != nil {
+			return nil, fmt.Errorf("tenant %q is defined twice", t.ID)
+		}
+		if t.PathPrefix != "" {
+			if !prefixPattern.MatchString(t.PathPrefix) {
+				return nil, fmt.Errorf("tenant %q: the path prefix must look like /name", t.ID)
+			}
+			if prefixes[t.PathPrefix] {
+				return nil, fmt.Errorf("tenant %q: path prefix %s is used by another tenant", t.ID, t.PathPrefix)
+			}
+			prefixes[t.PathPrefix] = true
+		}
+		for j, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if host == "" {
+				return nil, fmt.Errorf("tenant %q: empty host name", t.ID)
+			}
+			if r.byHost[host] != nil {
+				return nil, fmt.Errorf("tenant %q: host %s is used by another tenant", t.ID, host)
+			}
+			t.Hosts[j] = host
+		}
+		if t.PageSize < 0 {
+			return nil, fmt.Errorf("tenant %q: the page size must not be negative", t.ID)
+		}
+		if t.Branding.Color != "" && !colorPattern.MatchString(t.Branding.Color) {
+			return nil, fmt.Errorf("tenant %q: the color must be a hex color such as #1a365d", t.ID)
+		}
+
+		r.tenants = append(r.tenants, &t)
+		r.byID[t.ID] = &t
+		for _, host := range t.Hosts {
+			r.byHost[host] = &t
+		}
+		if t.PathPrefix != "" {
+			r.prefixed = append(r.prefixed, &t)
+		}
+	}
+
+	if r.byID[DefaultID] == nil {
+		t := &Tenant{ID: DefaultID}
+		r.tenants = append([]*Tenant{t}, r.tenants...)
+		r.byID[DefaultID] = t
+	}
+	// Longer prefixes go first, so that /news/daily isn't taken for /news
+	slices.SortStableFunc(r.prefixed, func(a, b *Tenant) int {
+		return len(b.PathPrefix) - len(a.PathPrefix)
+	})
+	return r, nil
+}
+
+// LoadFile reads the tenants from a JSON file holding an array of tenants and creates a registry of them.
+// An empty path creates a registry of only the default tenant.
+func LoadFile(path string) (*Registry, error) {
+	if path == "" {
+		return NewRegistry(nil)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants file: %w", err)
+	}
+	var tenants []Tenant
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return nil, fmt.Errorf("invalid tenants file %s: %w", path, err)
+	}
+	return NewRegistry(tenants)
+}
+
+// Default returns the default tenant
+func (r *Registry) Default() *Tenant {
+	return r.byID[DefaultID]
+}
+
+// Lookup returns the tenant with the given ID; an empty ID names the default tenant
+func (r *Registry) Lookup(id string) (*Tenant, error) {
+	if id == "" {
+		return r.Default(), nil
+	}
+	if t, ok := r.byID[id]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownTenant, id)
+}
+
+// All returns every tenant, including the default one
+func (r *Registry) All() []*Tenant {
+	return slices.Clone(r.tenants)
+}
+
+// Len returns the number of tenants, including the default one
+func (r *Registry) Len() int {
+	return len(r.tenants)
+}
+
+// Resolve returns the tenant serving a request for host and path, and the path within the tenant.
+// A path prefix takes precedence over the host name; requests matching neither go to the default tenant.
+func (r *Registry) Resolve(host, path string) (*Tenant, string) {
+	for _, t := range r.prefixed {
+		if path == t.PathPrefix {
+			return t, "/"
+		}
+		if rest, ok := strings.CutPrefix(path, t.PathPrefix); ok && strings.HasPrefix(rest, "/") {
+			return t, rest
+		}
+	}
+
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	if t, ok := r.byHost[strings.ToLower(host)]; ok {
+		return t, path
+	}
+	return r.Default(), path
+}
+
+// Handler resolves the tenant of every request, passes it to next in the request context and strips the
+// tenant's path prefix, so that routes are the same for every tenant
+func Handler(r *Registry, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t, path := r.Resolve(req.Host, req.URL.Path)
+
+		resolved := req.WithContext(WithTenant(req.Context(), t))
+		if path != req.URL.Path {
+			resolved.URL = new(url.URL)
+			*resolved.URL = *req.URL
+			resolved.URL.Path = path
+			if req.URL.RawPath != "" {
+				resolved.URL.RawPath = path
+				if raw, ok := strings.CutPrefix(req.URL.RawPath, t.PathPrefix); ok && raw != "" {
+					resolved.URL.RawPath = raw
+				}
+			}
+		}
+		next.ServeHTTP(w, resolved)
+	})
+}
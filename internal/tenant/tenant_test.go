@@ -0,0 +1,167 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	registry, err := NewRegistry([]Tenant{
+		{ID: "daily", Name: "The Daily", Hosts: []string{"Daily.example.com"}, PageSize: 20},
+		{ID: "weekly", Name: "The Weekly", PathPrefix: "/weekly"},
+		{ID: "weekly-sport", Name: "Weekly Sport", PathPrefix: "/weekly/sport"},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func TestResolve(t *testing.T) {
+	registry := testRegistry(t)
+
+	tests := []struct {
+		name     string
+		host     string
+		path     string
+		wantID   string
+		wantPath string
+	}{
+		{"host", "daily.example.com", "/posts", "daily", "/posts"},
+		{"host with port and other case", "DAILY.example.com:8080", "/posts", "daily", "/posts"},
+		{"path prefix", "example.com", "/weekly/posts/view", "weekly", "/posts/view"},
+		{"bare path prefix", "example.com", "/weekly", "weekly", "/"},
+		{"longest path prefix", "example.com", "/weekly/sport/posts", "weekly-sport", "/posts"},
+		{"path prefix wins over host", "daily.example.com", "/weekly/posts", "weekly", "/posts"},
+		{"prefix must end at a segment", "example.com", "/weeklyposts", DefaultID, "/weeklyposts"},
+		{"unknown host", "example.com", "/posts", DefaultID, "/posts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant, path := registry.Resolve(tt.host, tt.path)
+			if tenant.ID != tt.wantID || path != tt.wantPath {
+				t.Errorf("Resolve(%q, %q) = %s, %q, want %s, %q", tt.host, tt.path, tenant.ID, path, tt.wantID, tt.wantPath)
+			}
+		})
+	}
+}
+
+func TestNewRegistryRejectsInvalidTenants(t *testing.T) {
+	tests := []struct {
+		name    string
+		tenants []Tenant
+	}{
+		{"invalid ID", []Tenant{{ID: "The Daily"}}},
+		{"duplicate ID", []Tenant{{ID: "daily"}, {ID: "daily"}}},
+		{"shared host", []Tenant{{ID: "daily", Hosts: []string{"example.com"}}, {ID: "weekly", Hosts: []string{"EXAMPLE.com"}}}},
+		{"shared prefix", []Tenant{{ID: "daily", PathPrefix: "/news"}, {ID: "weekly", PathPrefix: "/news"}}},
+		{"prefix with trailing slash", []Tenant{{ID: "daily", PathPrefix: "/daily/"}}},
+		{"negative page size", []Tenant{{ID: "daily", PageSize: -1}}},
+		{"color that isn't a hex color", []Tenant{{ID: "daily", Branding: Branding{Color: "red;}"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRegistry(tt.tenants); err == nil {
+				t.Error("NewRegistry() error = nil, want the invalid tenant reported")
+			}
+		})
+	}
+}
+
+func TestRegistryDefaultTenant(t *testing.T) {
+	registry, err := NewRegistry(nil)
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if registry.Len() != 1 || registry.Default().ID != DefaultID {
+		t.Errorf("registry of no tenants = %d tenants, want only the default one", registry.Len())
+	}
+
+	// A configured default tenant keeps its settings
+	registry, err = NewRegistry([]Tenant{{ID: DefaultID, Branding: Branding{Title: "Main"}}, {ID: "daily"}})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	if registry.Len() != 2 || registry.Default().Branding.Title != "Main" {
+		t.Errorf("Default() = %+v, want the configured default tenant", registry.Default())
+	}
+
+	if found, err := registry.Lookup(""); err != nil || found.ID != DefaultID {
+		t.Errorf("Lookup(\"\") = %v, %v, want the default tenant", found, err)
+	}
+	if _, err := registry.Lookup("weekly"); !errors.Is(err, ErrUnknownTenant) {
+		t.Errorf("Lookup() of an unknown tenant error = %v, want ErrUnknownTenant", err)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	data := `[{"id": "daily", "name": "The Daily", "hosts": ["daily.example.com"], "page_size": 20,
+		"branding": {"title": "The Daily", "logo_url": "/static/daily.svg", "color": "#1a365d"}}]`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	daily, err := registry.Lookup("daily")
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	if daily.PageSize != 20 || daily.Branding.Color != "#1a365d" || daily.Branding.LogoURL != "/static/daily.svg" {
+		t.Errorf("loaded tenant = %+v", daily)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	var gotID, gotPath, gotRawPath string
+	handler := Handler(testRegistry(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = ID(r.Context())
+		gotPath = r.URL.Path
+		gotRawPath = r.URL.EscapedPath()
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/weekly/posts/a%2Fb?page=2", nil))
+	if gotID != "weekly" || gotPath != "/posts/a/b" || gotRawPath != "/posts/a%2Fb" {
+		t.Errorf("handler saw tenant %q and path %q (%q), want weekly and /posts/a/b", gotID, gotPath, gotRawPath)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/posts", nil)
+	request.Host = "daily.example.com"
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if gotID != "daily" || gotPath != "/posts" {
+		t.Errorf("handler saw tenant %q and path %q, want daily and /posts", gotID, gotPath)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := FromContext(ctx); ok {
+		t.Error("FromContext() found a tenant in an empty context")
+	}
+	if ID(ctx) != DefaultID {
+		t.Errorf("ID() = %q, want the default tenant outside requests", ID(ctx))
+	}
+	if ID(WithID(ctx, "daily")) != "daily" {
+		t.Errorf("ID() = %q, want the tenant of the context", ID(WithID(ctx, "daily")))
+	}
+
+	daily := &Tenant{ID: "daily"}
+	defaultTenant := &Tenant{ID: DefaultID}
+	if !daily.Owns("daily") || daily.Owns("") || daily.Owns(DefaultID) {
+		t.Error("Owns() of a tenant must only accept its own ID")
+	}
+	if !defaultTenant.Owns("") || !defaultTenant.Owns(DefaultID) || defaultTenant.Owns("daily") {
+		t.Error("Owns() of the default tenant must accept its ID and documents without one")
+	}
+}
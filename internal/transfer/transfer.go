@@ -0,0 +1,300 @@
+package transfer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Format is a serialization format for bulk post transfer
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+// maxLineSize bounds a single JSON Lines record; posts are limited to 10000 characters of content
+const maxLineSize = 1024 * 1024
+
+// csvColumns is the column order used when exporting CSV.
+// CSV holds the original language only; translations are transferred as JSON Lines.
+var csvColumns = []string{"id", "slug", "title", "content", "tags", "status", "language", "created_at", "updated_at"}
+
+// csvTagSeparator separates tags within the CSV tags column
+const csvTagSeparator = ";"
+
+var ErrUnknownFormat = errors.New("unknown format, expected jsonl or csv")
+
+// ParseFormat converts a user supplied format name into a Format.
+// An empty name defaults to JSON Lines.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "jsonl", "ndjson":
+		return FormatJSONL, nil
+	case "csv":
+		return FormatCSV, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	if f == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Encoder writes posts one record at a time
+type Encoder interface {
+	Encode(post *model.Post) error
+	// Flush writes any buffered data to the underlying writer
+	Flush() error
+}
+
+// NewEncoder creates an encoder writing posts to w in the given format
+func NewEncoder(w io.Writer, format Format) Encoder {
+	if format == FormatCSV {
+		return &csvEncoder{writer: csv.NewWriter(w)}
+	}
+	return &jsonlEncoder{writer: bufio.NewWriter(w)}
+}
+
+type jsonlEncoder struct {
+	writer *bufio.Writer
+}
+
+func (e *jsonlEncoder) Encode(post *model.Post) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	if _, err := e.writer.Write(data); err != nil {
+		return err
+	}
+	return e.writer.WriteByte('\n')
+}
+
+func (e *jsonlEncoder) Flush() error {
+	return e.writer.Flush()
+}
+
+type csvEncoder struct {
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func (e *csvEncoder) Encode(post *model.Post) error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	return e.writer.Write([]string{
+		post.ID.Hex(),
+		post.Slug,
+		post.Title,
+		post.Content,
+		strings.Join(post.Tags, csvTagSeparator),
+		string(post.Status),
+		post.Language,
+		post.CreatedAt.UTC().Format(time.RFC3339),
+		post.UpdatedAt.UTC().Format(time.RFC3339),
+	})
+}
+
+func (e *csvEncoder) Flush() error {
+	if !e.wroteHeader {
+		if err := e.writer.Write(csvColumns); err != nil {
+			return err
+		}
+		e.wroteHeader = true
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// Record is a single decoded input record.
+// Err is set when the record could not be parsed; Post is nil in that case.
+type Record struct {
+	Line int
+	Post *model.Post
+	Err  error
+}
+
+// Decoder reads posts one record at a time.
+// Next returns io.EOF when there are no more records.
+type Decoder interface {
+	Next() (*Record, error)
+}
+
+// NewDecoder creates a decoder reading posts from r in the given format
+func NewDecoder(r io.Reader, format Format) (Decoder, error) {
+	if format == FormatCSV {
+		return newCSVDecoder(r)
+	}
+	return &jsonlDecoder{reader: bufio.NewReader(r)}, nil
+}
+
+type jsonlDecoder struct {
+	reader *bufio.Reader
+	line   int
+}
+
+func (d *jsonlDecoder) Next() (*Record, error) {
+	for {
+		data, tooLong, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		d.line++
+		if tooLong {
+			return &Record{Line: d.line, Err: fmt.Errorf("line is longer than %d bytes", maxLineSize)}, nil
+		}
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		var post model.Post
+		if err := json.Unmarshal(data, &post); err != nil {
+			return &Record{Line: d.line, Err: fmt.Errorf("invalid JSON: %w", err)}, nil
+		}
+		return &Record{Line: d.line, Post: &post}, nil
+	}
+}
+
+// readLine reads the next line. Lines longer than maxLineSize are skipped without being held in memory,
+// and reported as too long, so that one oversized record doesn't abort the import.
+func (d *jsonlDecoder) readLine() ([]byte, bool, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := d.reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(bytes.TrimRight(chunk, "\r\n")) > maxLineSize {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err == io.EOF && (len(line) > 0 || tooLong):
+			return line, tooLong, nil
+		default:
+			return line, tooLong, err
+		}
+	}
+}
+
+type csvDecoder struct {
+	reader  *csv.Reader
+	columns map[string]int
+}
+
+func newCSVDecoder(r io.Reader) (*csvDecoder, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("csv input is empty")
+		}
+		return nil, fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"title", "content"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("csv header is missing required column %q", required)
+		}
+	}
+
+	return &csvDecoder{reader: reader, columns: columns}, nil
+}
+
+func (d *csvDecoder) Next() (*Record, error) {
+	fields, err := d.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return &Record{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+		return nil, err
+	}
+
+	line, _ := d.reader.FieldPos(0)
+	post, err := d.decodePost(fields)
+	if err != nil {
+		return &Record{Line: line, Err: err}, nil
+	}
+	return &Record{Line: line, Post: post}, nil
+}
+
+func (d *csvDecoder) decodePost(fields []string) (*model.Post, error) {
+	field := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	post := &model.Post{
+		Title:    field("title"),
+		Content:  field("content"),
+		Slug:     strings.TrimSpace(field("slug")),
+		Status:   model.PostStatus(strings.TrimSpace(field("status"))),
+		Language: strings.TrimSpace(field("language")),
+	}
+	if tags := field("tags"); tags != "" {
+		post.Tags = model.NormalizeTags(strings.Split(tags, csvTagSeparator))
+	}
+
+	if id := strings.TrimSpace(field("id")); id != "" {
+		objectID, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q", id)
+		}
+		post.ID = objectID
+	}
+
+	var err error
+	if post.CreatedAt, err = parseTime(field("created_at")); err != nil {
+		return nil, fmt.Errorf("invalid created_at: %w", err)
+	}
+	if post.UpdatedAt, err = parseTime(field("updated_at")); err != nil {
+		return nil, fmt.Errorf("invalid updated_at: %w", err)
+	}
+
+	return post, nil
+}
+
+// parseTime parses an RFC 3339 timestamp, treating an empty value as the zero time
+func parseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,204 @@
+package transfer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    Format
+		wantErr bool
+	}{
+		{"", FormatJSONL, false},
+		{"ndjson", FormatJSONL, false},
+		{" CSV ", FormatCSV, false},
+		{"xml", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFormat(tt.name)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("ParseFormat(%q) = %q, %v, want %q, error %v", tt.name, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// decodeAll reads every record of input
+func decodeAll(t *testing.T, input io.Reader, format Format) []*Record {
+	t.Helper()
+	decoder, err := NewDecoder(input, format)
+	if err != nil {
+		t.Fatalf("NewDecoder() error = %v", err)
+	}
+	var records []*Record
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return records
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	posts := []*model.Post{
+		{
+			ID:        primitive.NewObjectID(),
+			Title:     "Election night",
+			Content:   "Results, \"quotes\" and commas\nacross lines",
+			Slug:      "election-night",
+			Tags:      []string{"news", "politics"},
+			Status:    model.StatusPublished,
+			Language:  "en",
+			CreatedAt: created,
+			UpdatedAt: created.Add(time.Hour),
+		},
+		{
+			ID:        primitive.NewObjectID(),
+			Title:     "Draft",
+			Content:   "Not yet",
+			Status:    model.StatusDraft,
+			CreatedAt: created,
+			UpdatedAt: created,
+		},
+	}
+
+	for _, format := range []Format{FormatJSONL, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			encoder := NewEncoder(&buf, format)
+			for _, post := range posts {
+				if err := encoder.Encode(post); err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+			}
+			if err := encoder.Flush(); err != nil {
+				t.Fatalf("Flush() error = %v", err)
+			}
+
+			records := decodeAll(t, &buf, format)
+			if len(records) != len(posts) {
+				t.Fatalf("decoded %d records, want %d", len(records), len(posts))
+			}
+			for i, record := range records {
+				if record.Err != nil {
+					t.Errorf("record %d error = %v", i, record.Err)
+					continue
+				}
+				if !reflect.DeepEqual(record.Post, posts[i]) {
+					t.Errorf("record %d = %+v, want %+v", i, record.Post, posts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestEncoderCSVHeaderWithoutPosts(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf, FormatCSV).Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if got, want := buf.String(), strings.Join(csvColumns, ",")+"\n"; got != want {
+		t.Errorf("empty CSV export = %q, want the header %q", got, want)
+	}
+}
+
+func TestDecoderJSONLMalformed(t *testing.T) {
+	input := strings.Join([]string{
+		`{"title":"First","content":"one"}`,
+		``,
+		`{"title":`,
+		`"` + strings.Repeat("x", maxLineSize) + `"`,
+		`{"title":"Last","content":"two"}`,
+	}, "\n")
+
+	records := decodeAll(t, strings.NewReader(input), FormatJSONL)
+	if len(records) != 4 {
+		t.Fatalf("decoded %d records, want 4 without the blank line", len(records))
+	}
+
+	tests := []struct {
+		line      int
+		wantTitle string
+		wantErr   string
+	}{
+		{1, "First", ""},
+		{3, "", "invalid JSON"},
+		{4, "", "line is longer than"},
+		{5, "Last", ""},
+	}
+	for i, tt := range tests {
+		record := records[i]
+		if record.Line != tt.line {
+			t.Errorf("record %d line = %d, want %d", i, record.Line, tt.line)
+		}
+		if tt.wantErr == "" {
+			if record.Err != nil || record.Post == nil || record.Post.Title != tt.wantTitle {
+				t.Errorf("record %d = %+v, want the post %q", i, record, tt.wantTitle)
+			}
+			continue
+		}
+		if record.Err == nil || !strings.Contains(record.Err.Error(), tt.wantErr) || record.Post != nil {
+			t.Errorf("record %d error = %v, want %q without a post", i, record.Err, tt.wantErr)
+		}
+	}
+}
+
+func TestDecoderCSVMalformed(t *testing.T) {
+	for _, input := range []string{"", "title,slug\nA,a\n"} {
+		if _, err := NewDecoder(strings.NewReader(input), FormatCSV); err == nil {
+			t.Errorf("NewDecoder(%q) succeeded, want an error", input)
+		}
+	}
+
+	input := "title,content,id,created_at\n" +
+		"Good,Body,,\n" +
+		"Bad id,Body,nope,\n" +
+		"Bad time,Body,,yesterday\n" +
+		"\"Unterminated,Body,,\n"
+	records := decodeAll(t, strings.NewReader(input), FormatCSV)
+
+	tests := []struct {
+		line    int
+		wantErr string
+	}{
+		{2, ""},
+		{3, "invalid id"},
+		{4, "invalid created_at"},
+		{5, "quote"},
+	}
+	if len(records) != len(tests) {
+		t.Fatalf("decoded %d records, want %d", len(records), len(tests))
+	}
+	for i, tt := range tests {
+		record := records[i]
+		if record.Line != tt.line {
+			t.Errorf("record %d line = %d, want %d", i, record.Line, tt.line)
+		}
+		if tt.wantErr == "" {
+			if record.Err != nil || record.Post == nil || record.Post.Title != "Good" {
+				t.Errorf("record %d = %+v, want the good post", i, record)
+			}
+			continue
+		}
+		if record.Err == nil || !strings.Contains(record.Err.Error(), tt.wantErr) {
+			t.Errorf("record %d error = %v, want %q", i, record.Err, tt.wantErr)
+		}
+	}
+}
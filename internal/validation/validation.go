@@ -0,0 +1,125 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/pkg/config"
+)
+
+// Rule is an additional check applied to posts after the built-in field validation
+type Rule interface {
+	// Check records every failure of post in errs
+	Check(post *model.Post, errs *model.ValidationErrors)
+}
+
+// RuleFunc adapts a function to the Rule interface
+type RuleFunc func(post *model.Post, errs *model.ValidationErrors)
+
+// Check calls f(post, errs)
+func (f RuleFunc) Check(post *model.Post, errs *model.ValidationErrors) {
+	f(post, errs)
+}
+
+// Validator validates posts against configurable limits and rules
+type Validator struct {
+	limits model.Limits
+	rules  []Rule
+}
+
+// NewValidator creates a validator applying the limits and then every rule in order
+// Nil rules are skipped, so optional rules can be passed unconditionally.
+func NewValidator(limits model.Limits, rules ...Rule) *Validator {
+	v := &Validator{limits: limits}
+	for _, rule := range rules {
+		if rule != nil {
+			v.rules = append(v.rules, rule)
+		}
+	}
+	return v
+}
+
+// Default returns a validator with the default limits and no additional rules
+func Default() *Validator {
+	return NewValidator(model.DefaultLimits)
+}
+
+// Validate returns model.ValidationErrors listing every failure, or nil if the post is valid
+func (v *Validator) Validate(post *model.Post) error {
+	errs := post.ValidateLimits(v.limits)
+	for _, rule := range v.rules {
+		rule.Check(post, &errs)
+	}
+	return errs.Err()
+}
+
+// BannedWords rejects posts whose title or content contains any of the words as a whole word,
+// ignoring case. It returns nil when there are no words.
+func BannedWords(words []string) Rule {
+	var quoted []string
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return nil
+	}
+	// \b only knows ASCII word characters, so word boundaries are spelled out to support any script
+	pattern := regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(` + strings.Join(quoted, "|") + `)(?:$|[^\p{L}\p{N}_])`)
+
+	return RuleFunc(func(post *model.Post, errs *model.ValidationErrors) {
+		for _, field := range []struct{ name, value string }{
+			{"title", post.Title},
+			{"content", post.Content},
+		} {
+			if match := pattern.FindStringSubmatch(field.value); match != nil {
+				word := strings.ToLower(match[1])
+				errs.Add(field.name, model.CodeBannedWord, fmt.Sprintf("%s must not contain %q", field.name, word), "word", word)
+			}
+		}
+	})
+}
+
+// RequiredTags rejects posts that have none of the tags.
+// It returns nil when there are no tags.
+func RequiredTags(tags []string) Rule {
+	tags = model.NormalizeTags(tags)
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return RuleFunc(func(post *model.Post, errs *model.ValidationErrors) {
+		for _, tag := range post.Tags {
+			for _, required := range tags {
+				if tag == required {
+					return
+				}
+			}
+		}
+
+		message := "a post must be tagged with " + tags[0]
+		if len(tags) > 1 {
+			message = "a post must be tagged with one of " + strings.Join(tags, ", ")
+		}
+		errs.Add("tags", model.CodeMissingTag, message, "tags", strings.Join(tags, ", "))
+	})
+}
+
+// FromConfig builds the validator described by the application configuration
+func FromConfig(cfg *config.Config) *Validator {
+	return NewValidator(LimitsFromConfig(cfg), BannedWords(cfg.BannedWords), RequiredTags(cfg.RequiredTags))
+}
+
+// LimitsFromConfig returns the length limits of post fields set in the application configuration
+func LimitsFromConfig(cfg *config.Config) model.Limits {
+	return model.Limits{
+		TitleMin:   cfg.TitleMinLength,
+		TitleMax:   cfg.TitleMaxLength,
+		ContentMin: cfg.ContentMinLength,
+		ContentMax: cfg.ContentMaxLength,
+		MaxTags:    model.DefaultLimits.MaxTags,
+	}
+}
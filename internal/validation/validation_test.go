@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+)
+
+func TestValidator(t *testing.T) {
+	validator := NewValidator(
+		model.Limits{TitleMin: 5, TitleMax: 20, ContentMax: 50},
+		BannedWords([]string{"spam", "шахрайство"}),
+		RequiredTags([]string{"News", "sport"}),
+		BannedWords(nil),
+	)
+
+	tests := []struct {
+		name       string
+		title      string
+		content    string
+		tags       []string
+		wantFields []string
+		wantCodes  []string
+	}{
+		{
+			name:    "valid post",
+			title:   "Valid title",
+			content: "Spammer is not a banned word",
+			tags:    []string{"news"},
+		},
+		{
+			name:       "every failing field is reported",
+			title:      "Hi",
+			content:    strings.Repeat("a", 51),
+			wantFields: []string{"title", "content", "tags"},
+			wantCodes:  []string{model.CodeTooShort, model.CodeTooLong, model.CodeMissingTag},
+		},
+		{
+			name:       "banned words match whole words ignoring case",
+			title:      "Buy SPAM now",
+			content:    "Це шахрайство!",
+			tags:       []string{"sport"},
+			wantFields: []string{"title", "content"},
+			wantCodes:  []string{model.CodeBannedWord, model.CodeBannedWord},
+		},
+		{
+			name:       "blank fields are required",
+			title:      "  ",
+			content:    "",
+			tags:       []string{"news"},
+			wantFields: []string{"title", "content"},
+			wantCodes:  []string{model.CodeRequired, model.CodeRequired},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := model.NewPost(tt.title, tt.content)
+			post.Tags = tt.tags
+
+			err := validator.Validate(post)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+
+			var errs model.ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("Validate() error = %v, want ValidationErrors", err)
+			}
+			if len(errs) != len(tt.wantFields) {
+				t.Fatalf("Validate() returned %d errors, want %d: %v", len(errs), len(tt.wantFields), errs)
+			}
+			for i, fieldErr := range errs {
+				if fieldErr.Field != tt.wantFields[i] || fieldErr.Code != tt.wantCodes[i] {
+					t.Errorf("error %d = %s/%s, want %s/%s", i, fieldErr.Field, fieldErr.Code, tt.wantFields[i], tt.wantCodes[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorsMessage(t *testing.T) {
+	post := model.NewPost("", "")
+
+	err := Default().Validate(post)
+	if err == nil || err.Error() != "title is required; content is required" {
+		t.Errorf("Validate() error = %v, want both messages", err)
+	}
+
+	var errs model.ValidationErrors
+	if errors.As(err, &errs) && errs.For("content") != "content is required" {
+		t.Errorf("For(content) = %q, want %q", errs.For("content"), "content is required")
+	}
+}
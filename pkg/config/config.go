@@ -4,6 +4,7 @@ import (
 	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // Config holds application configuration
@@ -15,7 +16,125 @@ type Config struct {
 	MongoDBDatabase string
 	MongoDBUser     string
 	MongoDBPassword string
-	PageSizeLimit   int
+	// MongoDBReplicaSet names the replica set to connect to; transactions need a replica set or a sharded cluster
+	MongoDBReplicaSet string
+	// MongoDBDirectConnection connects to the configured host only, without discovering the other members
+	MongoDBDirectConnection bool
+	PageSizeLimit           int
+	// EstimatedCount reports estimated totals for unfiltered post lists instead of counting documents
+	EstimatedCount bool
+
+	// RateLimitStore selects where token buckets are kept: "memory" or "mongo" (shared by replicas)
+	RateLimitStore string
+	// RateLimitKey selects how clients are identified: "ip" or "user"
+	RateLimitKey string
+	// TrustedProxies lists the proxy addresses or CIDR ranges whose X-Forwarded-For and X-Real-IP headers
+	// name the client IP; empty trusts none, so the client IP is the connection's address
+	TrustedProxies          []string
+	RateLimitWritePerMinute float64
+	RateLimitWriteBurst     int
+	RateLimitReadPerMinute  float64
+	RateLimitReadBurst      int
+	MaxRequestBodyBytes     int64
+
+	// SessionSecret signs session-bound tokens such as CSRF tokens.
+	// When empty a random secret is generated at startup, which invalidates tokens on restart.
+	SessionSecret string
+	// CookieSecure marks cookies as HTTPS-only
+	CookieSecure bool
+	// SessionTTLHours is how long users stay signed in
+	SessionTTLHours int
+	// AnonymousRole is the role of visitors who aren't signed in: reader, author, editor or admin
+	AnonymousRole string
+
+	// CSPReportOnly reports Content-Security-Policy violations without enforcing the policy
+	CSPReportOnly bool
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds, sent on HTTPS requests; 0 disables it
+	HSTSMaxAge int
+	// FrameAncestors is the CSP frame-ancestors source list
+	FrameAncestors string
+	ReferrerPolicy string
+
+	// Post validation limits, in characters; minimums of 0 only require a non-blank value
+	TitleMinLength   int
+	TitleMaxLength   int
+	ContentMinLength int
+	ContentMaxLength int
+	// BannedWords are rejected as whole words in titles and content
+	BannedWords []string
+	// RequiredTags lists tags of which every post must have at least one; empty disables the rule
+	RequiredTags []string
+
+	// PostCacheSize is the number of posts kept in the in-process read-through cache; 0 disables the cache
+	PostCacheSize       int
+	PostCacheTTLSeconds int
+
+	// FragmentCacheSize is the number of rendered list fragments kept in memory; 0 disables the cache
+	FragmentCacheSize int
+	// FragmentCacheTTLSeconds bounds how long a cached fragment is served
+	FragmentCacheTTLSeconds int
+
+	// WebDir, when set, serves templates and static files from this directory instead of the binary,
+	// and re-parses templates whenever they change. Meant for development, e.g. WEB_DIR=web.
+	WebDir string
+
+	// DefaultTimezone is the IANA time zone dates are shown in until the browser reports its own
+	DefaultTimezone string
+
+	// WebhookWorker runs the worker sending webhook deliveries in this process
+	WebhookWorker bool
+	// WebhookPollSeconds is how often the worker looks for due deliveries
+	WebhookPollSeconds int
+	// WebhookMaxAttempts is the number of attempts after which a delivery moves to the dead-letter list
+	WebhookMaxAttempts int
+	// WebhookBackoffSeconds is the delay before the first retry, doubled for each further retry
+	// up to WebhookMaxBackoffSeconds
+	WebhookBackoffSeconds    int
+	WebhookMaxBackoffSeconds int
+	WebhookTimeoutSeconds    int
+
+	// OutboxRelay runs the relay passing outbox events to webhooks in this process
+	OutboxRelay bool
+	// OutboxPollSeconds is how often the relay looks for due events it wasn't woken for
+	OutboxPollSeconds int
+
+	// ChangeStreamWatcher applies changes of posts written by other tools, following the posts change stream
+	ChangeStreamWatcher bool
+
+	// SeedFixture names a fixture set loaded on startup when there are no posts, for development and demos
+	SeedFixture string
+
+	// BackupDir is the directory scheduled backups are written to
+	BackupDir string
+	// BackupIntervalHours is how often backups are scheduled; 0 disables scheduled backups
+	BackupIntervalHours int
+	// BackupRetention is the number of scheduled backups kept in BackupDir; 0 keeps every backup
+	BackupRetention int
+
+	// TenantsFile is a JSON file listing the tenants served by host name or path prefix; empty serves only the default tenant
+	TenantsFile string
+	// Tenant is the ID of the tenant admin commands work on; empty means the default tenant
+	Tenant string
+
+	// OIDCIssuer is the issuer URL of the OpenID Connect provider staff sign in with; empty disables single sign-on
+	OIDCIssuer string
+	// OIDCClientID and OIDCClientSecret identify the site at the provider
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is the callback URL registered at the provider; empty derives it from the request's host
+	OIDCRedirectURL string
+	// OIDCScopes are requested besides "openid"; empty requests "profile" and "email"
+	OIDCScopes []string
+	// OIDCProviderName names the provider on the sign-in button
+	OIDCProviderName string
+	// OIDCUsernameClaim is the ID token claim naming new users
+	OIDCUsernameClaim string
+	// OIDCRoleClaim is the ID token claim listing the user's groups
+	OIDCRoleClaim string
+	// OIDCRoleMap maps groups to roles as "group=role" entries; users in several groups get the role with the most permissions
+	OIDCRoleMap []string
+	// OIDCDefaultRole is the role of users in none of the mapped groups; empty refuses them
+	OIDCDefaultRole string
 }
 
 // Load loads configuration from environment variables
@@ -23,14 +142,86 @@ type Config struct {
 // or default values if environment variables are not set.
 func Load() *Config {
 	return &Config{
-		HttpServerHost:  getEnv("HTTP_SERVER_HOST", ""),
-		HttpServerPort:  getEnv("HTTP_SERVER_PORT", "8080"),
-		MongoDBHost:     getEnv("MONGODB_HOST", "localhost"),
-		MongoDBPort:     getEnv("MONGODB_PORT", "27017"),
-		MongoDBDatabase: getEnv("MONGODB_DATABASE", "newsdb"),
-		MongoDBUser:     getEnv("MONGODB_USER", ""),
-		MongoDBPassword: getEnv("MONGODB_PASSWORD", ""),
-		PageSizeLimit:   getEnvAsInt("PAGE_SIZE_LIMIT", 10),
+		HttpServerHost:          getEnv("HTTP_SERVER_HOST", ""),
+		HttpServerPort:          getEnv("HTTP_SERVER_PORT", "8080"),
+		MongoDBHost:             getEnv("MONGODB_HOST", "localhost"),
+		MongoDBPort:             getEnv("MONGODB_PORT", "27017"),
+		MongoDBDatabase:         getEnv("MONGODB_DATABASE", "newsdb"),
+		MongoDBUser:             getEnv("MONGODB_USER", ""),
+		MongoDBPassword:         getEnv("MONGODB_PASSWORD", ""),
+		MongoDBReplicaSet:       getEnv("MONGODB_REPLICA_SET", ""),
+		MongoDBDirectConnection: getEnvAsBool("MONGODB_DIRECT_CONNECTION", false),
+		PageSizeLimit:           getEnvAsInt("PAGE_SIZE_LIMIT", 10),
+		EstimatedCount:          getEnvAsBool("ESTIMATED_COUNT", false),
+
+		RateLimitStore:          getEnv("RATE_LIMIT_STORE", "memory"),
+		RateLimitKey:            getEnv("RATE_LIMIT_KEY", "ip"),
+		TrustedProxies:          getEnvAsList("TRUSTED_PROXIES"),
+		RateLimitWritePerMinute: getEnvAsFloat("RATE_LIMIT_WRITE_PER_MINUTE", 30),
+		RateLimitWriteBurst:     getEnvAsInt("RATE_LIMIT_WRITE_BURST", 10),
+		RateLimitReadPerMinute:  getEnvAsFloat("RATE_LIMIT_READ_PER_MINUTE", 600),
+		RateLimitReadBurst:      getEnvAsInt("RATE_LIMIT_READ_BURST", 100),
+		MaxRequestBodyBytes:     int64(getEnvAsInt("MAX_REQUEST_BODY_BYTES", 64*1024)),
+
+		SessionSecret: getEnv("SESSION_SECRET", ""),
+		CookieSecure:  getEnvAsBool("COOKIE_SECURE", false),
+
+		SessionTTLHours: getEnvAsInt("SESSION_TTL_HOURS", 7*24),
+		AnonymousRole:   getEnv("ANONYMOUS_ROLE", "reader"),
+
+		CSPReportOnly:  getEnvAsBool("CSP_REPORT_ONLY", false),
+		HSTSMaxAge:     getEnvAsInt("HSTS_MAX_AGE", 31536000),
+		FrameAncestors: getEnv("FRAME_ANCESTORS", "'none'"),
+		ReferrerPolicy: getEnv("REFERRER_POLICY", "strict-origin-when-cross-origin"),
+
+		TitleMinLength:   getEnvAsInt("TITLE_MIN_LENGTH", 0),
+		TitleMaxLength:   getEnvAsInt("TITLE_MAX_LENGTH", 200),
+		ContentMinLength: getEnvAsInt("CONTENT_MIN_LENGTH", 0),
+		ContentMaxLength: getEnvAsInt("CONTENT_MAX_LENGTH", 10000),
+		BannedWords:      getEnvAsList("BANNED_WORDS"),
+		RequiredTags:     getEnvAsList("REQUIRED_TAGS"),
+
+		PostCacheSize:       getEnvAsInt("POST_CACHE_SIZE", 1000),
+		PostCacheTTLSeconds: getEnvAsInt("POST_CACHE_TTL_SECONDS", 300),
+
+		FragmentCacheSize:       getEnvAsInt("FRAGMENT_CACHE_SIZE", 256),
+		FragmentCacheTTLSeconds: getEnvAsInt("FRAGMENT_CACHE_TTL_SECONDS", 60),
+
+		WebDir: getEnv("WEB_DIR", ""),
+
+		DefaultTimezone: getEnv("DEFAULT_TIMEZONE", "UTC"),
+
+		WebhookWorker:            getEnvAsBool("WEBHOOK_WORKER", true),
+		WebhookPollSeconds:       getEnvAsInt("WEBHOOK_POLL_SECONDS", 5),
+		WebhookMaxAttempts:       getEnvAsInt("WEBHOOK_MAX_ATTEMPTS", 8),
+		WebhookBackoffSeconds:    getEnvAsInt("WEBHOOK_BACKOFF_SECONDS", 30),
+		WebhookMaxBackoffSeconds: getEnvAsInt("WEBHOOK_MAX_BACKOFF_SECONDS", 3600),
+		WebhookTimeoutSeconds:    getEnvAsInt("WEBHOOK_TIMEOUT_SECONDS", 10),
+
+		OutboxRelay:       getEnvAsBool("OUTBOX_RELAY", true),
+		OutboxPollSeconds: getEnvAsInt("OUTBOX_POLL_SECONDS", 5),
+
+		ChangeStreamWatcher: getEnvAsBool("CHANGE_STREAM_WATCHER", false),
+
+		SeedFixture: getEnv("SEED_FIXTURE", ""),
+
+		BackupDir:           getEnv("BACKUP_DIR", "backups"),
+		BackupIntervalHours: getEnvAsInt("BACKUP_INTERVAL_HOURS", 0),
+		BackupRetention:     getEnvAsInt("BACKUP_RETENTION", 7),
+
+		TenantsFile: getEnv("TENANTS_FILE", ""),
+		Tenant:      getEnv("TENANT", ""),
+
+		OIDCIssuer:        getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:      getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:        getEnvAsList("OIDC_SCOPES"),
+		OIDCProviderName:  getEnv("OIDC_PROVIDER_NAME", "SSO"),
+		OIDCUsernameClaim: getEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		OIDCRoleClaim:     getEnv("OIDC_ROLE_CLAIM", "groups"),
+		OIDCRoleMap:       getEnvAsList("OIDC_ROLE_MAP"),
+		OIDCDefaultRole:   getEnv("OIDC_DEFAULT_ROLE", "reader"),
 	}
 }
 
@@ -41,7 +232,19 @@ func (c *Config) GetMongoURI() string {
 		userinfo := url.UserPassword(c.MongoDBUser, c.MongoDBPassword)
 		auth = userinfo.String() + "@"
 	}
-	return "mongodb://" + auth + c.MongoDBHost + ":" + c.MongoDBPort
+	uri := "mongodb://" + auth + c.MongoDBHost + ":" + c.MongoDBPort
+
+	query := url.Values{}
+	if c.MongoDBReplicaSet != "" {
+		query.Set("replicaSet", c.MongoDBReplicaSet)
+	}
+	if c.MongoDBDirectConnection {
+		query.Set("directConnection", "true")
+	}
+	if len(query) > 0 {
+		uri += "/?" + query.Encode()
+	}
+	return uri
 }
 
 // GetServerAddress constructs the HTTP server address from config values
@@ -64,3 +267,32 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsList splits a comma separated variable, dropping empty items
+func getEnvAsList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
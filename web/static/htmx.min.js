@@ -1,86 +1,194 @@
 (function(){
+  // Collects form values from the elements matched by an hx-include selector
+  function includeValues(el, formData) {
+    var selector = el.getAttribute('hx-include');
+    if (!selector) return;
+    document.querySelectorAll(selector).forEach(function(included) {
+      if (included.tagName === 'FORM') {
+        new FormData(included).forEach(function(value, key) { formData.append(key, value); });
+      } else if (included.name && !((included.type === 'checkbox' || included.type === 'radio') && !included.checked)) {
+        formData.append(included.name, included.value);
+      }
+    });
+  }
+
+  // Parses hx-trigger values like "refresh, postsChanged from:body"
+  function parseTriggers(el) {
+    var spec = el.getAttribute('hx-trigger');
+    if (!spec) return [];
+    return spec.split(',').map(function(part) {
+      var tokens = part.trim().split(/\s+/);
+      var trigger = { event: tokens[0], from: el };
+      tokens.slice(1).forEach(function(token) {
+        if (token === 'from:body') trigger.from = document.body;
+      });
+      return trigger;
+    });
+  }
+
+  // Dispatches events named in the HX-Trigger response header
+  function handleTriggerHeader(response) {
+    var header = response.headers.get('HX-Trigger');
+    if (!header) return;
+    header.split(',').forEach(function(name) {
+      name = name.trim();
+      if (name) document.body.dispatchEvent(new Event(name, { bubbles: true }));
+    });
+  }
+
+  // Merges hx-headers JSON from the element and its ancestors, closest first
+  function requestHeaders(el) {
+    var headers = { 'HX-Request': 'true' };
+    for (var node = el; node && node.getAttribute; node = node.parentElement) {
+      var spec = node.getAttribute('hx-headers');
+      if (!spec) continue;
+      try {
+        var parsed = JSON.parse(spec);
+        Object.keys(parsed).forEach(function(name) {
+          if (!(name in headers)) headers[name] = parsed[name];
+        });
+      } catch (err) {
+        console.error('Invalid hx-headers:', err);
+      }
+    }
+    return headers;
+  }
+
+  // Pushes the request URL (hx-push-url="true") or the given URL into the browser history
+  function pushHistory(el, url, response) {
+    var push = el.getAttribute('hx-push-url');
+    if (!push || push === 'false' || !response.ok) return;
+    // Mark the current entry too, so going back to it is handled on popstate
+    if (!history.state) history.replaceState({ htmx: true }, '');
+    history.pushState({ htmx: true }, '', push === 'true' ? url : push);
+  }
+
+  // Applies HX-Retarget and HX-Reswap response headers, which override where and how the response is swapped
+  function responseTarget(response, target, swap) {
+    var retarget = response.headers.get('HX-Retarget');
+    var reswap = response.headers.get('HX-Reswap');
+    return {
+      target: retarget ? document.querySelector(retarget) : target,
+      swap: reswap || swap
+    };
+  }
+
+  function issueRequest(el, method, submitter) {
+    var url = el.getAttribute('hx-' + method.toLowerCase()) ||
+        (el.tagName === 'FORM' ? el.action : '');
+    var target = document.querySelector(el.getAttribute('hx-target') || 'body');
+    var swap = el.getAttribute('hx-swap') || 'innerHTML';
+
+    var formData = el.tagName === 'FORM' ? new FormData(el, submitter || null) : new FormData();
+    includeValues(el, formData);
+
+    var body = null;
+    // For GET requests, append form data as URL parameters
+    if (method === 'GET') {
+      var params = new URLSearchParams(formData).toString();
+      if (params) url = url + (url.includes('?') ? '&' : '?') + params;
+    } else if (el.tagName === 'FORM' || el.hasAttribute('hx-include')) {
+      body = formData;
+    }
+
+    fetch(url, { method: method, body: body, headers: requestHeaders(el) })
+        .then(function(r) {
+          return r.text().then(function(html) { return { response: r, html: html }; });
+        })
+        .then(function(result) {
+          pushHistory(el, url, result.response);
+          var html = result.html;
+          var resolved = responseTarget(result.response, target, swap);
+          var swapTarget = resolved.target;
+          if (!swapTarget) {
+            console.error('HTMX target not found for', url);
+            return;
+          }
+          // Extract base swap type (remove modifiers like "swap:1s")
+          var swapType = resolved.swap.split(' ')[0];
+
+          if (swapType === 'innerHTML') {
+            swapTarget.innerHTML = html;
+          }
+          else if (swapType === 'outerHTML') {
+            var parent = swapTarget.parentNode;
+            if (html.trim() === '') {
+              // For empty responses (like DELETE), remove the element
+              swapTarget.remove();
+            } else {
+              swapTarget.outerHTML = html;
+            }
+            if (parent) htmx.process(parent);
+            handleTriggerHeader(result.response);
+            return;
+          }
+          else if (swapType.includes('afterbegin')) {
+            swapTarget.insertAdjacentHTML('afterbegin', html);
+          }
+          htmx.process(swapTarget);
+
+          // Trigger custom events
+          var trigger = el.getAttribute('hx-trigger-response');
+          if (trigger) {
+            document.body.dispatchEvent(new Event(trigger));
+          }
+          handleTriggerHeader(result.response);
+        })
+        .catch(function(err) {
+          console.error('HTMX request failed:', err);
+        });
+  }
+
   var htmx = {
     process: function(elt) {
       var elements = elt.querySelectorAll('[hx-get], [hx-post], [hx-put], [hx-delete]');
       elements.forEach(function(el) {
+        // Elements are bound only once, even when their container is processed again
+        if (el.htmxProcessed) return;
+        el.htmxProcessed = true;
+
         var method = el.getAttribute('hx-get') ? 'GET' :
             el.getAttribute('hx-post') ? 'POST' :
                 el.getAttribute('hx-put') ? 'PUT' : 'DELETE';
-        var events = [];
 
-        // Only listen to submit for forms, click for everything else
-        if (el.tagName === 'FORM') {
-          events = ['submit'];
-        } else {
-          events = ['click'];
+        // Custom triggers (hx-trigger) replace the default submit/click handling
+        var triggers = parseTriggers(el).filter(function(t) {
+          return t.event !== 'submit' && t.event !== 'click';
+        });
+        if (triggers.length > 0) {
+          triggers.forEach(function(t) {
+            t.from.addEventListener(t.event, function() { issueRequest(el, method); });
+          });
+          return;
         }
 
-        events.forEach(function(evt) {
-          el.addEventListener(evt, function(e) {
-            e.preventDefault();
+        // Only listen to submit for forms, click for everything else
+        var evt = el.tagName === 'FORM' ? 'submit' : 'click';
+        el.addEventListener(evt, function(e) {
+          e.preventDefault();
 
-            // Handle confirmation dialogs
-            var confirm = el.getAttribute('hx-confirm');
-            if (confirm && !window.confirm(confirm)) {
-              return;
-            }
+          // Handle confirmation dialogs, on the element or the button that submitted the form
+          var submitter = e.submitter;
+          var confirm = (submitter && submitter.getAttribute('hx-confirm')) || el.getAttribute('hx-confirm');
+          if (confirm && !window.confirm(confirm)) {
+            return;
+          }
 
-            var url = el.getAttribute('hx-' + method.toLowerCase()) ||
-                (el.tagName === 'FORM' ? el.action : '');
-            var target = document.querySelector(el.getAttribute('hx-target') || 'body');
-            var swap = el.getAttribute('hx-swap') || 'innerHTML';
-
-            var body = null;
-            if (el.tagName === 'FORM') {
-              var formData = new FormData(el);
-              // For GET requests, append form data as URL parameters
-              if (method === 'GET') {
-                var params = new URLSearchParams(formData);
-                url = url + (url.includes('?') ? '&' : '?') + params.toString();
-              } else {
-                body = formData;
-              }
-            }
-
-            fetch(url, { method: method, body: body })
-                .then(r => r.text())
-                .then(html => {
-                  // Extract base swap type (remove modifiers like "swap:1s")
-                  var swapType = swap.split(' ')[0];
-                  
-                  if (swapType === 'innerHTML') {
-                    target.innerHTML = html;
-                  }
-                  else if (swapType === 'outerHTML') {
-                    var parent = target.parentNode;
-                    if (html.trim() === '') {
-                      // For empty responses (like DELETE), remove the element
-                      target.remove();
-                    } else {
-                      target.outerHTML = html;
-                    }
-                    if (parent) htmx.process(parent);
-                    return;
-                  }
-                  else if (swapType.includes('afterbegin')) {
-                    target.insertAdjacentHTML('afterbegin', html);
-                  }
-                  htmx.process(target);
-                  
-                  // Trigger custom events
-                  var trigger = el.getAttribute('hx-trigger-response');
-                  if (trigger) {
-                    document.body.dispatchEvent(new Event(trigger));
-                  }
-                })
-                .catch(function(err) {
-                  console.error('HTMX request failed:', err);
-                });
-          });
+          issueRequest(el, method, submitter);
         });
       });
+    },
+
+    // trigger dispatches a custom event on the element (or the first element matching a selector)
+    trigger: function(elt, name) {
+      var target = typeof elt === 'string' ? document.querySelector(elt) : elt;
+      if (target) target.dispatchEvent(new Event(name, { bubbles: true }));
     }
   };
   window.htmx = htmx;
+  // Pushed URLs render the full page on the server, so going back reloads it
+  window.addEventListener('popstate', function(e) {
+    if (e.state && e.state.htmx) location.reload();
+  });
   document.addEventListener('DOMContentLoaded', function() { htmx.process(document.body); });
 })();
@@ -1,23 +1,286 @@
 package web
 
 import (
+	"embed"
+	"errors"
+	"fmt"
 	"html/template"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin/render"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/tenant"
+)
+
+// files holds the templates and static assets compiled into the binary
+//
+//go:embed templates static
+var files embed.FS
+
+// Template directories. Pages are rendered inside the base layout and may use every partial;
+// partials are rendered on their own, e.g. as htmx fragments.
+const (
+	layoutsPattern  = "templates/layouts/*.html"
+	partialsPattern = "templates/partials/*.html"
+	pagesPattern    = "templates/pages/*.html"
 )
 
-// LoadTemplates loads all HTML templates with custom functions
-func LoadTemplates() (*template.Template, error) {
-	funcMap := template.FuncMap{
-		"add": func(a, b int) int { return a + b },
-		"sub": func(a, b int) int { return a - b },
-		"dict": func(values ...interface{}) map[string]interface{} {
-			dict := make(map[string]interface{})
-			for i := 0; i < len(values); i += 2 {
-				key := values[i].(string)
-				dict[key] = values[i+1]
-			}
-			return dict
-		},
-	}
-
-	return template.New("").Funcs(funcMap).ParseGlob("web/templates/*.html")
+// Files returns the embedded templates and static assets, or the ones in dir when dir is set.
+// Reading from dir lets template and style changes show up without rebuilding the binary.
+func Files(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	return files
+}
+
+// Static returns the static assets in fsys for serving over HTTP
+func Static(fsys fs.FS) http.FileSystem {
+	static, err := fs.Sub(fsys, "static")
+	if err != nil {
+		// fs.Sub only fails for invalid paths
+		panic(err)
+	}
+	return http.FS(static)
+}
+
+// actor is the user a page is rendered for, e.g. a service.Actor.
+// Templates only show actions the actor's role allows; the services check them again.
+type actor interface {
+	Can(p model.Permission) bool
+	CanEdit(post *model.Post) bool
+}
+
+// funcMap holds the custom functions available to all templates
+var funcMap = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"dict": func(values ...interface{}) map[string]interface{} {
+		dict := make(map[string]interface{})
+		for i := 0; i < len(values); i += 2 {
+			key := values[i].(string)
+			dict[key] = values[i+1]
+		}
+		return dict
+	},
+	// T translates a message, e.g. {{T .L "posts.create"}}; the localizer is nil outside requests
+	"T": func(l *i18n.Localizer, key string, args ...interface{}) string {
+		return localizerOrDefault(l).T(key, args...)
+	},
+	// N translates a message in the plural form matching n, e.g. {{N .L "posts.count" .Total}}
+	"N": func(l *i18n.Localizer, key string, n int64, args ...interface{}) string {
+		return localizerOrDefault(l).N(key, n, args...)
+	},
+	// language names a content language, e.g. {{language .L "uk"}}
+	"language": func(l *i18n.Localizer, code string) string {
+		return localizerOrDefault(l).LanguageName(code)
+	},
+	// datetime formats a time in the user's time zone and locale
+	"datetime": func(l *i18n.Localizer, t time.Time) string {
+		return localizerOrDefault(l).FormatDateTime(t)
+	},
+	// site names the site, e.g. {{site .L .Tenant}}: the tenant's branded title, or the translated application title
+	"site": func(l *i18n.Localizer, t *tenant.Tenant) string {
+		if t != nil && t.Branding.Title != "" {
+			return t.Branding.Title
+		}
+		return localizerOrDefault(l).T("app.title")
+	},
+	// can reports whether the actor may take an action, e.g. {{if can .Actor "delete"}}; without an actor nothing is allowed
+	"can": func(a interface{}, p string) bool {
+		actor, ok := a.(actor)
+		return ok && actor.Can(model.Permission(p))
+	},
+	// canEdit reports whether the actor may edit a post, e.g. {{if canEdit .Actor .Post}}
+	"canEdit": func(a interface{}, post *model.Post) bool {
+		actor, ok := a.(actor)
+		return ok && post != nil && actor.CanEdit(post)
+	},
+}
+
+// localizerOrDefault returns l, or a localizer for the default locale when l is nil
+func localizerOrDefault(l *i18n.Localizer) *i18n.Localizer {
+	if l == nil {
+		return i18n.Default().Localizer(i18n.DefaultLocale, time.UTC)
+	}
+	return l
+}
+
+// Templates renders pages and partials by file name, e.g. "index.html".
+// With reload enabled, templates are parsed again whenever a file changes, which is meant for development.
+type Templates struct {
+	fsys   fs.FS
+	reload bool
+
+	mu        sync.RWMutex
+	pages     map[string]*template.Template
+	partials  *template.Template
+	parsedAt  time.Time
+	lastCheck time.Time
+}
+
+// reloadInterval limits how often template files are checked for changes in reload mode
+var reloadInterval = 500 * time.Millisecond
+
+// LoadTemplates loads the HTML templates embedded in the binary
+func LoadTemplates() (*Templates, error) {
+	return NewTemplates(files, false)
+}
+
+// NewTemplates loads the HTML templates in fsys. When reload is set, changed files are parsed again on use.
+func NewTemplates(fsys fs.FS, reload bool) (*Templates, error) {
+	t := &Templates{fsys: fsys, reload: reload}
+	if err := t.parse(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// parse parses every layout, partial and page, replacing the current templates only on success
+func (t *Templates) parse() error {
+	parsedAt := time.Now()
+
+	partials := template.New("").Funcs(funcMap)
+	for _, pattern := range []string{layoutsPattern, partialsPattern} {
+		matches, err := fs.Glob(t.fsys, pattern)
+		if err != nil {
+			return err
+		}
+		if len(matches) == 0 {
+			continue
+		}
+		if _, err := partials.ParseFS(t.fsys, matches...); err != nil {
+			return fmt.Errorf("failed to parse templates: %w", err)
+		}
+	}
+
+	pageFiles, err := fs.Glob(t.fsys, pagesPattern)
+	if err != nil {
+		return err
+	}
+
+	// Every page gets its own copy of the partials, so pages can define the same layout blocks
+	pages := make(map[string]*template.Template, len(pageFiles))
+	for _, file := range pageFiles {
+		page, err := partials.Clone()
+		if err != nil {
+			return err
+		}
+		if _, err := page.ParseFS(t.fsys, file); err != nil {
+			return fmt.Errorf("failed to parse page %s: %w", file, err)
+		}
+		pages[path.Base(file)] = page
+	}
+
+	t.mu.Lock()
+	t.pages = pages
+	t.partials = partials
+	t.parsedAt = parsedAt
+	t.mu.Unlock()
+
+	return nil
+}
+
+// reloadIfChanged parses the templates again when a file was modified since they were last parsed
+func (t *Templates) reloadIfChanged() error {
+	t.mu.Lock()
+	if time.Since(t.lastCheck) < reloadInterval {
+		t.mu.Unlock()
+		return nil
+	}
+	t.lastCheck = time.Now()
+	parsedAt := t.parsedAt
+	t.mu.Unlock()
+
+	changed := false
+	err := fs.WalkDir(t.fsys, "templates", func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(parsedAt) {
+			changed = true
+			return fs.SkipAll
+		}
+		return nil
+	})
+	if err != nil || !changed {
+		return err
+	}
+
+	slog.Info("Templates changed, reloading")
+	return t.parse()
+}
+
+// lookup returns the template set that defines name
+func (t *Templates) lookup(name string) (*template.Template, error) {
+	if t.reload {
+		if err := t.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if page, ok := t.pages[name]; ok {
+		return page, nil
+	}
+	if t.partials.Lookup(name) != nil {
+		return t.partials, nil
+	}
+	return nil, fmt.Errorf("template %q is not defined", name)
+}
+
+// ExecuteTemplate renders the page or partial with the given file name to w
+func (t *Templates) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	set, err := t.lookup(name)
+	if err != nil {
+		return err
+	}
+	return set.ExecuteTemplate(w, name, data)
+}
+
+// Validate checks that every named template exists, so missing templates fail at startup instead of on use
+func (t *Templates) Validate(names ...string) error {
+	var errs []error
+	for _, name := range names {
+		if _, err := t.lookup(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Instance implements gin's render.HTMLRender, so ctx.HTML renders pages and partials too
+func (t *Templates) Instance(name string, data any) render.Render {
+	return htmlRender{templates: t, name: name, data: data}
+}
+
+type htmlRender struct {
+	templates *Templates
+	name      string
+	data      any
+}
+
+func (r htmlRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return r.templates.ExecuteTemplate(w, r.name, r.data)
+}
+
+func (r htmlRender) WriteContentType(w http.ResponseWriter) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	}
 }
@@ -0,0 +1,155 @@
+package web
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iyhunko/go-htmx-mongo/internal/controller"
+	"github.com/iyhunko/go-htmx-mongo/internal/i18n"
+	"github.com/iyhunko/go-htmx-mongo/internal/model"
+	"github.com/iyhunko/go-htmx-mongo/internal/service"
+)
+
+func TestLoadTemplates(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+
+	if err := templates.Validate(controller.TemplateNames...); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := templates.Validate("missing.html"); err == nil {
+		t.Errorf("Validate() of a missing template succeeded")
+	}
+
+	post := model.NewPost("Layout Title", "Body")
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "post-detail.html", map[string]interface{}{"Post": post}); err != nil {
+		t.Fatalf("ExecuteTemplate() error = %v", err)
+	}
+
+	page := buf.String()
+	for _, want := range []string{"<title>Layout Title - News Articles</title>", `id="error-region"`, "site-footer", "Body"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("post-detail.html output doesn't contain %q", want)
+		}
+	}
+
+	buf.Reset()
+	localized := map[string]interface{}{"Post": post, "L": i18n.Default().Localizer("uk", time.UTC)}
+	if err := templates.ExecuteTemplate(&buf, "post-detail.html", localized); err != nil {
+		t.Fatalf("ExecuteTemplate() error = %v", err)
+	}
+	for _, want := range []string{`<html lang="uk">`, "Усі публікації", post.CreatedAt.UTC().Format("02.01.2006 15:04")} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("localized post-detail.html output doesn't contain %q", want)
+		}
+	}
+
+	buf.Reset()
+	if err := templates.ExecuteTemplate(&buf, "error.html", map[string]interface{}{"Error": "boom"}); err != nil {
+		t.Fatalf("ExecuteTemplate() error = %v", err)
+	}
+	if strings.Contains(buf.String(), "<html") || !strings.Contains(buf.String(), "boom") {
+		t.Errorf("error.html output = %q, want a fragment without the layout", buf.String())
+	}
+}
+
+func TestPostRowActions(t *testing.T) {
+	templates, err := LoadTemplates()
+	if err != nil {
+		t.Fatalf("LoadTemplates() error = %v", err)
+	}
+
+	post := model.NewPost("Title", "Body")
+	post.AuthorID = "jane"
+
+	tests := []struct {
+		name       string
+		actor      interface{}
+		wantEdit   bool
+		wantDelete bool
+	}{
+		{"no actor", nil, false, false},
+		{"reader", service.Actor{ID: "jane", Role: model.RoleReader}, false, false},
+		{"author of the post", service.Actor{ID: "jane", Role: model.RoleAuthor}, true, false},
+		{"another author", service.Actor{ID: "john", Role: model.RoleAuthor}, false, false},
+		{"editor", service.Actor{ID: "john", Role: model.RoleEditor}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			data := map[string]interface{}{"Post": post, "Actor": tt.actor}
+			if err := templates.ExecuteTemplate(&buf, "post-row.html", data); err != nil {
+				t.Fatalf("ExecuteTemplate() error = %v", err)
+			}
+
+			row := buf.String()
+			if got := strings.Contains(row, "hx-get=\"/posts/edit"); got != tt.wantEdit {
+				t.Errorf("edit button shown = %v, want %v", got, tt.wantEdit)
+			}
+			if got := strings.Contains(row, "hx-delete="); got != tt.wantDelete {
+				t.Errorf("delete button shown = %v, want %v", got, tt.wantDelete)
+			}
+			if got := strings.Contains(row, "row-select"); got != tt.wantDelete {
+				t.Errorf("bulk checkbox shown = %v, want %v", got, tt.wantDelete)
+			}
+		})
+	}
+}
+
+func TestTemplatesReload(t *testing.T) {
+	defer func(interval time.Duration) { reloadInterval = interval }(reloadInterval)
+	reloadInterval = 0
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		file := filepath.Join(dir, "templates", name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure the change is newer than the last parse, whatever the file system's time resolution
+		future := time.Now().Add(time.Second)
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+	render := func(templates *Templates, name string) string {
+		var buf bytes.Buffer
+		if err := templates.ExecuteTemplate(&buf, name, nil); err != nil {
+			t.Fatalf("ExecuteTemplate(%q) error = %v", name, err)
+		}
+		return buf.String()
+	}
+
+	write("layouts/base.html", `{{define "base"}}[{{block "content" .}}{{end}}]{{end}}`)
+	write("pages/home.html", `{{template "base" .}}{{define "content"}}{{template "greeting.html"}}{{end}}`)
+	write("partials/greeting.html", `hello`)
+
+	templates, err := NewTemplates(os.DirFS(dir), true)
+	if err != nil {
+		t.Fatalf("NewTemplates() error = %v", err)
+	}
+	if got := render(templates, "home.html"); got != "[hello]" {
+		t.Errorf("home.html = %q, want [hello]", got)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	write("partials/greeting.html", `hi`)
+
+	if got := render(templates, "home.html"); got != "[hi]" {
+		t.Errorf("home.html after change = %q, want [hi]", got)
+	}
+	if got := render(templates, "greeting.html"); got != "hi" {
+		t.Errorf("greeting.html after change = %q, want hi", got)
+	}
+}